@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxWait is the default time the server waits for new records.
+const DefaultMaxWait = 5 * time.Second
+
+// ConsumerConfig configures a Consumer.
+type ConsumerConfig struct {
+	// Offset is the offset of the first record to read.
+	Offset uint64
+
+	// Isolation is the isolation level, read_uncommitted if it is empty.
+	Isolation string
+
+	// MaxWait is the time the server waits for new records on every request.
+	MaxWait time.Duration
+
+	// MaxStaleness is the time a follower may have been behind the leader to
+	// serve records. The request is redirected to the leader if the follower
+	// does not catch up within MaxWait. It is not limited if it is zero.
+	MaxStaleness time.Duration
+
+	// RetryBackoff is the delay before retrying a failed request.
+	RetryBackoff time.Duration
+}
+
+// Consumer reads records from the log one by one and tracks the offset of the
+// next record. It is not safe for concurrent use.
+type Consumer struct {
+	transport Transport
+	config    ConsumerConfig
+	offset    uint64
+}
+
+// NewConsumer creates a new Consumer that reads records with the transport
+// starting from the configured offset.
+func NewConsumer(transport Transport, config ConsumerConfig) *Consumer {
+	if config.Isolation == "" {
+		config.Isolation = ReadUncommitted
+	}
+
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultMaxWait
+	}
+
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DefaultRetryBackoff
+	}
+
+	return &Consumer{
+		transport: transport,
+		config:    config,
+		offset:    config.Offset,
+	}
+}
+
+// Next returns the next record. It waits until the record is appended, the
+// context is done or the server returns a permanent error. Temporary errors
+// are retried. A missing record is requested again right away only if the
+// server has waited for it, otherwise the retry is delayed as well, so a
+// server that does not wait is not flooded with requests. An evicted record
+// is never appended again, so ErrOffsetEvicted is returned right away.
+func (c *Consumer) Next(ctx context.Context) (Record, error) {
+	request := ConsumeRequest{ // nolint:exhaustivestruct
+		Offset:         c.offset,
+		Isolation:      c.config.Isolation,
+		MaxWaitMs:      uint64(c.config.MaxWait / time.Millisecond),
+		MaxStalenessMs: uint64(c.config.MaxStaleness / time.Millisecond),
+	}
+
+	for {
+		start := time.Now()
+
+		record, err := c.transport.Consume(ctx, request)
+		if err == nil {
+			c.offset = record.Offset + 1
+
+			return record, nil
+		}
+
+		if ctx.Err() != nil {
+			return Record{}, fmt.Errorf("failed to read the next record: %w", ctx.Err())
+		}
+
+		if errors.Is(err, ErrOffsetEvicted) {
+			return Record{}, err
+		}
+
+		notFound := errors.Is(err, ErrOffsetNotFound)
+		if notFound && time.Since(start) >= c.config.MaxWait {
+			continue
+		}
+
+		if !notFound && !temporary(err) {
+			return Record{}, err
+		}
+
+		select {
+		case <-time.After(retryDelay(err, c.config.RetryBackoff)):
+		case <-ctx.Done():
+			return Record{}, fmt.Errorf("failed to read the next record: %w", ctx.Err())
+		}
+	}
+}
+
+// Offset returns the offset of the next record to read.
+func (c *Consumer) Offset() uint64 {
+	return c.offset
+}
+
+// Seek sets the offset of the next record to read.
+func (c *Consumer) Seek(offset uint64) {
+	c.offset = offset
+}
@@ -0,0 +1,130 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumer_Next(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	for _, value := range []string{"record0", "record1"} {
+		_, err := transport.Produce(context.Background(), client.ProduceRequest{Value: []byte(value)})
+		assert.Nil(t, err)
+	}
+
+	c := client.NewConsumer(transport, client.ConsumerConfig{Offset: 1})
+
+	r, err := c.Next(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record1"), r.Value)
+	assert.Equal(t, uint64(1), r.Offset)
+	assert.Equal(t, uint64(2), c.Offset())
+
+	c.Seek(0)
+
+	r, err = c.Next(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record0"), r.Value)
+	assert.Equal(t, uint64(1), c.Offset())
+}
+
+func TestConsumer_LongPolling(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+	c := client.NewConsumer(transport, client.ConsumerConfig{MaxWait: time.Second})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		_, _ = transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("late")})
+	}()
+
+	r, err := c.Next(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("late"), r.Value)
+}
+
+func TestConsumer_NotFoundBackoff(t *testing.T) {
+	t.Parallel()
+
+	// The server does not wait for records and answers right away.
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := client.NewConsumer(client.NewHTTPTransport(srv.URL, nil), client.ConsumerConfig{ // nolint:exhaustivestruct
+		MaxWait:      time.Second,
+		RetryBackoff: 50 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 180*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.LessOrEqual(t, atomic.LoadInt32(&requests), int32(4))
+}
+
+func TestConsumer_ContextDone(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	c := client.NewConsumer(client.NewHTTPTransport(srv.URL, nil), client.ConsumerConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, uint64(0), c.Offset())
+}
+
+func TestConsumer_Evicted(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"Record evicted"}`))
+	}))
+	defer srv.Close()
+
+	c := client.NewConsumer(client.NewHTTPTransport(srv.URL, nil), client.ConsumerConfig{ // nolint:exhaustivestruct
+		MaxWait:      time.Second,
+		RetryBackoff: 50 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := c.Next(ctx)
+	assert.ErrorIs(t, err, client.ErrOffsetEvicted)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// FetchRequest is a request of a follower to fetch the records from the
+// offset as they are persisted by the server, including control markers.
+// The server waits up to MaxWaitMs for a record or for its high watermark to
+// advance past HighWatermark, and returns records of up to MaxBytes in total,
+// at least one. The server's default is used if MaxBytes is zero. Fetching
+// requires the replicate permission.
+type FetchRequest struct {
+	ReplicaID     string `json:"replica_id"`
+	Offset        uint64 `json:"offset"`
+	HighWatermark uint64 `json:"high_watermark"`
+	MaxWaitMs     uint64 `json:"max_wait_ms"`
+	MaxBytes      int    `json:"max_bytes,omitempty"`
+}
+
+// FetchResponse has the persisted records from the offset and the end of the
+// records replicated by all in-sync replicas. There are no entries if only
+// the high watermark has advanced.
+type FetchResponse struct {
+	Offset        uint64   `json:"offset"`
+	Entries       [][]byte `json:"entries"`
+	HighWatermark uint64   `json:"high_watermark"`
+}
+
+// Fetcher fetches the persisted records of the log for a follower.
+type Fetcher interface {
+	Fetch(ctx context.Context, request FetchRequest) (FetchResponse, error)
+}
+
+// Fetch fetches the persisted records from the offset.
+func (t *HTTPTransport) Fetch(ctx context.Context, request FetchRequest) (FetchResponse, error) {
+	var response FetchResponse
+
+	if err := t.do(ctx, http.MethodPost, "/v1/replicas/fetch", request, &response); err != nil {
+		return FetchResponse{}, err
+	}
+
+	return response, nil
+}
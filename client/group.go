@@ -0,0 +1,32 @@
+package client
+
+import "fmt"
+
+// ErrGroupNotFound is returned if the consumer group does not exist.
+var ErrGroupNotFound = fmt.Errorf("group not found")
+
+// GroupDescription describes a consumer group.
+type GroupDescription struct {
+	Group      string         `json:"group"`
+	Strategy   string         `json:"strategy"`
+	Generation uint64         `json:"generation"`
+	Members    []GroupMember  `json:"members"`
+	Partitions []PartitionLag `json:"partitions"`
+}
+
+// GroupMember is a member of a consumer group with its assigned partitions.
+type GroupMember struct {
+	MemberID   string   `json:"member_id"`
+	Generation uint64   `json:"generation"`
+	Partitions []uint32 `json:"partitions"`
+}
+
+// PartitionLag describes how far the group is behind the end of the
+// partition. CommittedOffset is nil if the group has not committed an offset.
+type PartitionLag struct {
+	Partition       uint32  `json:"partition"`
+	MemberID        string  `json:"member_id"`
+	CommittedOffset *uint64 `json:"committed_offset,omitempty"`
+	EndOffset       uint64  `json:"end_offset"`
+	Lag             uint64  `json:"lag"`
+}
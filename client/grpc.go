@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	api "github.com/ivanlemeshev/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCTransport sends requests to the gRPC API of the server.
+type GRPCTransport struct {
+	client api.LogClient
+}
+
+// NewGRPCTransport creates a new GRPCTransport that sends requests on the
+// connection. The connection is not closed by the transport.
+func NewGRPCTransport(conn grpc.ClientConnInterface) *GRPCTransport {
+	return &GRPCTransport{
+		client: api.NewLogClient(conn),
+	}
+}
+
+// DialGRPC connects to the gRPC server at the address, e.g. localhost:8400,
+// or to the servers of the cluster with a target of the GRPCScheme, e.g.
+// proglog:///localhost:8400, with the TLS configuration and the bearer token, an API key or a JWT. The
+// connection is not encrypted if the configuration is nil, and no token is
+// sent if it is empty. The options are added to the dial options.
+func DialGRPC(addr string, tlsConfig *tls.Config, token string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialOpts := []grpc.DialOption{grpc.WithInsecure()}
+	if tlsConfig != nil {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	}
+
+	if token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearerCredentials{token: token}))
+	}
+
+	conn, err := grpc.Dial(addr, append(dialOpts, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
+	}
+
+	return conn, nil
+}
+
+// bearerCredentials add the bearer token to requests.
+type bearerCredentials struct {
+	token string
+}
+
+func (c bearerCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity returns false, like the HTTP client sends tokens
+// without TLS.
+func (c bearerCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// Produce writes the record into the log and returns its offset.
+func (t *GRPCTransport) Produce(ctx context.Context, request ProduceRequest) (uint64, error) {
+	var md metadata.MD
+
+	response, err := t.client.Produce(ctx, &api.ProduceRequest{
+		Value:      request.Value,
+		Headers:    headersToProto(request.Headers),
+		ProducerId: request.ProducerID,
+		Sequence:   request.Sequence,
+		Acks:       request.Acks,
+	}, grpc.Header(&md))
+	if err != nil {
+		return 0, responseError(err, md)
+	}
+
+	return response.Offset, nil
+}
+
+// ProduceBatch writes the records into the log and returns their offsets.
+func (t *GRPCTransport) ProduceBatch(ctx context.Context, request ProduceBatchRequest) ([]uint64, error) {
+	records := make([]*api.Record, 0, len(request.Records))
+	for _, record := range request.Records {
+		records = append(records, &api.Record{Value: record.Value, Offset: 0, Headers: headersToProto(record.Headers)})
+	}
+
+	var md metadata.MD
+
+	response, err := t.client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records:    records,
+		ProducerId: request.ProducerID,
+		Sequence:   request.Sequence,
+		Resume:     request.Resume,
+		Acks:       request.Acks,
+	}, grpc.Header(&md))
+	if err != nil {
+		return nil, responseError(err, md)
+	}
+
+	return response.Offsets, nil
+}
+
+// Consume reads a record from the log. A follower that is behind responds
+// with 503 instead of redirecting to the leader.
+func (t *GRPCTransport) Consume(ctx context.Context, request ConsumeRequest) (Record, error) {
+	var md metadata.MD
+
+	response, err := t.client.Consume(ctx, &api.ConsumeRequest{
+		Offset:         request.Offset,
+		Isolation:      request.Isolation,
+		MaxWaitMs:      request.MaxWaitMs,
+		MinOffset:      request.MinOffset,
+		MaxStalenessMs: request.MaxStalenessMs,
+	}, grpc.Header(&md))
+	if status.Code(err) == codes.NotFound {
+		if status.Convert(err).Message() == evictedMessage {
+			return Record{}, ErrOffsetEvicted
+		}
+
+		return Record{}, ErrOffsetNotFound
+	}
+
+	if err != nil {
+		return Record{}, responseError(err, md)
+	}
+
+	record := response.GetRecord()
+
+	return Record{
+		Value:   record.GetValue(),
+		Offset:  record.GetOffset(),
+		Headers: headersFromProto(record.GetHeaders()),
+	}, nil
+}
+
+// grpcStatusCodes are the HTTP status codes of the gRPC codes the server
+// responds with, so errors of both transports are handled alike.
+var grpcStatusCodes = map[codes.Code]int{ // nolint:gochecknoglobals
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.NotFound:           http.StatusNotFound,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+}
+
+// responseError converts the status of a failed request to a ResponseError.
+// Errors that are not statuses, such as a canceled context, are returned as
+// they are.
+func responseError(err error, md metadata.MD) error {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() == codes.Canceled {
+		return err
+	}
+
+	statusCode, ok := grpcStatusCodes[s.Code()]
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+
+	var retryAfter time.Duration
+
+	if values := md.Get("retry-after"); len(values) != 0 {
+		if seconds, err := strconv.Atoi(values[0]); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return &ResponseError{
+		StatusCode: statusCode,
+		Message:    s.Message(),
+		RetryAfter: retryAfter,
+	}
+}
+
+func headersToProto(headers []Header) []*api.Header {
+	converted := make([]*api.Header, 0, len(headers))
+	for _, h := range headers {
+		converted = append(converted, &api.Header{Key: h.Key, Value: h.Value})
+	}
+
+	return converted
+}
+
+func headersFromProto(headers []*api.Header) []Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	converted := make([]Header, 0, len(headers))
+	for _, h := range headers {
+		converted = append(converted, Header{Key: h.Key, Value: h.Value})
+	}
+
+	return converted
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+// leaderAttribute is the key of the address attribute that tells whether the
+// server is the leader.
+type leaderAttribute struct{}
+
+// grpcBalancerBuilder builds the GRPCBalancer, which connects to every
+// resolved server and picks them with a grpcPicker.
+type grpcBalancerBuilder struct{}
+
+func (grpcBalancerBuilder) Name() string {
+	return GRPCBalancer
+}
+
+func (grpcBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	leader := &grpcLeader{mu: sync.RWMutex{}, addr: ""}
+	pickers := grpcPickerBuilder{cc: cc, leader: leader}
+
+	return &grpcBalancer{
+		Balancer: base.NewBalancerBuilder(GRPCBalancer, pickers, base.Config{HealthCheck: false}).Build(cc, opts),
+		leader:   leader,
+	}
+}
+
+// grpcBalancer keeps the address of the leader for the pickers. The leader
+// can change while the servers stay connected, when no new picker is built,
+// so the pickers look it up on every pick.
+type grpcBalancer struct {
+	balancer.Balancer
+	leader *grpcLeader
+}
+
+func (b *grpcBalancer) UpdateClientConnState(state balancer.ClientConnState) error {
+	leader := ""
+
+	for _, addr := range state.ResolverState.Addresses {
+		if isLeader(addr) {
+			leader = addr.Addr
+		}
+	}
+
+	b.leader.set(leader)
+
+	return b.Balancer.UpdateClientConnState(state) // nolint:wrapcheck
+}
+
+func isLeader(addr resolver.Address) bool {
+	if addr.Attributes == nil {
+		return false
+	}
+
+	leader, _ := addr.Attributes.Value(leaderAttribute{}).(bool)
+
+	return leader
+}
+
+// grpcLeader is the address of the leader, or empty if it is not known.
+type grpcLeader struct {
+	mu   sync.RWMutex
+	addr string
+}
+
+func (l *grpcLeader) get() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.addr
+}
+
+func (l *grpcLeader) set(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.addr = addr
+}
+
+// grpcPickerBuilder builds a grpcPicker of the ready servers whenever their
+// connections change.
+type grpcPickerBuilder struct {
+	cc     balancer.ClientConn
+	leader *grpcLeader
+}
+
+func (b grpcPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &grpcPicker{
+		cc:      b.cc,
+		leader:  b.leader,
+		servers: make([]grpcSubConn, 0, len(info.ReadySCs)),
+		mu:      sync.Mutex{},
+		next:    0,
+	}
+
+	for sc, scInfo := range info.ReadySCs {
+		p.servers = append(p.servers, grpcSubConn{addr: scInfo.Address.Addr, sc: sc})
+	}
+
+	// The servers are sorted, so the first server is the same for every
+	// picker if the leader is not known.
+	sort.Slice(p.servers, func(i, j int) bool { return p.servers[i].addr < p.servers[j].addr })
+
+	return p
+}
+
+// grpcSubConn is the connection to the server at the address.
+type grpcSubConn struct {
+	addr string
+	sc   balancer.SubConn
+}
+
+// grpcPicker picks the server of every request like the Picker. Produce
+// requests are sent to the leader, or the first server if the leader is not
+// known, consume requests are spread round-robin across the followers, or
+// all servers if there are no followers, and other requests across all
+// servers. The resolver is asked to resolve again if the leader is not
+// connected or a server is unavailable, for example because it is not the
+// leader anymore.
+type grpcPicker struct {
+	cc      balancer.ClientConn
+	leader  *grpcLeader
+	servers []grpcSubConn
+
+	mu   sync.Mutex
+	next int
+}
+
+func (p *grpcPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	leader := p.leader.get()
+
+	switch info.FullMethodName[strings.LastIndex(info.FullMethodName, "/")+1:] {
+	case "Produce", "ProduceBatch":
+		if leader == "" {
+			return balancer.PickResult{SubConn: p.servers[0].sc, Done: p.check}, nil
+		}
+
+		for _, server := range p.servers {
+			if server.addr == leader {
+				return balancer.PickResult{SubConn: server.sc, Done: p.check}, nil
+			}
+		}
+
+		// The request waits for the next picker, which is built once the
+		// leader is connected or another leader is resolved.
+		p.cc.ResolveNow(resolver.ResolveNowOptions{})
+
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	case "Consume":
+		followers := make([]grpcSubConn, 0, len(p.servers))
+		for _, server := range p.servers {
+			if server.addr != leader {
+				followers = append(followers, server)
+			}
+		}
+
+		if len(followers) == 0 {
+			followers = p.servers
+		}
+
+		return balancer.PickResult{SubConn: p.pickNext(followers), Done: p.check}, nil
+	default:
+		return balancer.PickResult{SubConn: p.pickNext(p.servers), Done: p.check}, nil
+	}
+}
+
+func (p *grpcPicker) pickNext(servers []grpcSubConn) balancer.SubConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := p.next % len(servers)
+	p.next = next + 1
+
+	return servers[next].sc
+}
+
+// check asks the resolver to resolve again if the server is unavailable,
+// which may be caused by a membership or leader change.
+func (p *grpcPicker) check(info balancer.DoneInfo) {
+	if status.Code(info.Err) == codes.Unavailable {
+		p.cc.ResolveNow(resolver.ResolveNowOptions{})
+	}
+}
@@ -0,0 +1,103 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestGRPCPicker(t *testing.T) {
+	t.Parallel()
+
+	cluster := &testCluster{}
+
+	logs := make([]*server.Log, 3)
+	servers := make([]*grpc.Server, 3)
+	addrs := make([]string, 3)
+
+	for i := range servers {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		logs[i] = server.NewLog()
+		servers[i] = server.NewGRPCServer(server.GRPCConfig{Log: logs[i], Cluster: cluster}) // nolint:exhaustivestruct
+		addrs[i] = listener.Addr().String()
+
+		go servers[i].Serve(listener) // nolint:errcheck
+
+		defer servers[i].Stop()
+	}
+
+	cluster.set(
+		server.ClusterServer{ID: "0", URL: "", GRPCAddr: addrs[0], Leader: true},
+		server.ClusterServer{ID: "1", URL: "", GRPCAddr: addrs[1], Leader: false},
+		server.ClusterServer{ID: "2", URL: "", GRPCAddr: addrs[2], Leader: false},
+	)
+
+	_, err := logs[1].Append([]byte("follower 1"))
+	assert.Nil(t, err)
+
+	_, err = logs[2].Append([]byte("follower 2"))
+	assert.Nil(t, err)
+
+	resolvers := client.NewGRPCResolverBuilder(client.GRPCResolverConfig{RefreshInterval: 50 * time.Millisecond})
+
+	conn, err := client.DialGRPC(client.GRPCScheme+":///"+addrs[2], nil, "", grpc.WithResolvers(resolvers))
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	transport := client.NewGRPCTransport(conn)
+
+	consumed := make(map[string]bool)
+
+	// The picker only picks the servers that are connected, so the followers
+	// are consumed from once both are. The leader has no record to consume.
+	assert.Eventually(t, func() bool {
+		r, err := transport.Consume(context.Background(), client.ConsumeRequest{Offset: 0})
+		if err != nil {
+			return false
+		}
+
+		consumed[string(r.Value)] = true
+
+		return len(consumed) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, map[string]bool{"follower 1": true, "follower 2": true}, consumed)
+
+	offset, err := transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("leader")})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset)
+	assert.Equal(t, uint64(1), logs[0].EndOffset())
+
+	// The leader fails and the first follower takes over.
+	cluster.set(
+		server.ClusterServer{ID: "1", URL: "", GRPCAddr: addrs[1], Leader: true},
+		server.ClusterServer{ID: "2", URL: "", GRPCAddr: addrs[2], Leader: false},
+	)
+	servers[0].Stop()
+
+	assert.Eventually(t, func() bool {
+		_, _ = transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("new leader")})
+
+		return logs[1].EndOffset() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	offset, err = transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("new leader")})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), offset)
+	assert.Equal(t, uint64(1), logs[2].EndOffset())
+
+	r, err := transport.Consume(context.Background(), client.ConsumeRequest{Offset: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("follower 2"), r.Value)
+}
@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/ivanlemeshev/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// GRPCScheme is the scheme of the gRPC targets whose servers are resolved by
+// asking the servers for the cluster, e.g. proglog:///localhost:8400 or
+// proglog:///host1:8400,host2:8400 with several seed addresses.
+const GRPCScheme = "proglog"
+
+// GRPCBalancer is the name of the load balancing policy the resolver of the
+// GRPCScheme configures. It sends produce requests to the leader and spreads
+// consume requests round-robin across the followers.
+const GRPCBalancer = "proglog"
+
+// nolint:gochecknoinits
+func init() {
+	resolver.Register(NewGRPCResolverBuilder(GRPCResolverConfig{}))
+	balancer.Register(grpcBalancerBuilder{})
+}
+
+// GRPCResolverConfig configures the resolver of the GRPCScheme.
+type GRPCResolverConfig struct {
+	// RefreshInterval is the period of resolving the servers again.
+	RefreshInterval time.Duration
+
+	// ResolveTimeout is the time after which asking a server for the cluster
+	// is considered failed.
+	ResolveTimeout time.Duration
+}
+
+// NewGRPCResolverBuilder creates a builder of resolvers of the GRPCScheme.
+// A builder with the default settings is registered, others are passed to
+// the connection with grpc.WithResolvers. The resolver asks the known
+// servers, then the seed addresses of the target, for the cluster with the
+// transport credentials of the connection, and refreshes the servers
+// periodically and when the connection asks, for example after a server
+// has become unavailable.
+func NewGRPCResolverBuilder(config GRPCResolverConfig) resolver.Builder {
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = DefaultRefreshInterval
+	}
+
+	if config.ResolveTimeout == 0 {
+		config.ResolveTimeout = DefaultResolveTimeout
+	}
+
+	return grpcResolverBuilder{config: config}
+}
+
+type grpcResolverBuilder struct {
+	config GRPCResolverConfig
+}
+
+func (b grpcResolverBuilder) Scheme() string {
+	return GRPCScheme
+}
+
+func (b grpcResolverBuilder) Build(
+	target resolver.Target,
+	cc resolver.ClientConn,
+	opts resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	var seeds []string
+
+	for _, addr := range strings.Split(target.Endpoint, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			seeds = append(seeds, addr)
+		}
+	}
+
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("failed to resolve %q: %w", target.Endpoint, ErrNoServers)
+	}
+
+	dialOpts := []grpc.DialOption{grpc.WithInsecure()}
+	if opts.DialCreds != nil {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(opts.DialCreds)}
+	}
+
+	if opts.Dialer != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(opts.Dialer))
+	}
+
+	r := &grpcResolver{
+		config:        b.config,
+		cc:            cc,
+		seeds:         seeds,
+		dialOpts:      dialOpts,
+		serviceConfig: cc.ParseServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, GRPCBalancer)),
+		mu:            sync.Mutex{},
+		servers:       nil,
+		conns:         make(map[string]*grpc.ClientConn),
+		resolveNow:    make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		closeOnce:     sync.Once{},
+	}
+
+	if !r.resolve() {
+		// No server has answered, so the seeds are used as servers without
+		// a known leader until they do.
+		servers := make([]Server, 0, len(seeds))
+		for _, addr := range seeds {
+			servers = append(servers, Server{ID: "", URL: "", GRPCAddr: addr, Leader: false})
+		}
+
+		r.update(servers)
+	}
+
+	go r.refresh()
+
+	return r, nil
+}
+
+// grpcResolver resolves the servers of the cluster and the leader like the
+// Resolver, but over gRPC.
+type grpcResolver struct {
+	config        GRPCResolverConfig
+	cc            resolver.ClientConn
+	seeds         []string
+	dialOpts      []grpc.DialOption
+	serviceConfig *serviceconfig.ParseResult
+
+	mu      sync.Mutex
+	servers []Server
+	conns   map[string]*grpc.ClientConn
+
+	resolveNow chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// ResolveNow asks the resolver to resolve the servers again without waiting
+// for the refresh interval. It does not wait for the servers to be resolved.
+func (r *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops refreshing the servers and closes the connections used to ask
+// for the cluster.
+func (r *grpcResolver) Close() {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for addr, conn := range r.conns {
+			_ = conn.Close()
+
+			delete(r.conns, addr)
+		}
+	})
+}
+
+func (r *grpcResolver) refresh() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.resolve()
+		case <-r.resolveNow:
+			r.resolve()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// resolve asks the known servers, then the seeds, for the cluster and
+// updates the connection with the servers of the first answer. It returns
+// false if no server answers, and the servers are kept.
+func (r *grpcResolver) resolve() bool {
+	for _, addr := range r.candidates() {
+		servers, err := r.cluster(addr)
+		if err != nil || len(servers) == 0 {
+			continue
+		}
+
+		r.update(servers)
+
+		return true
+	}
+
+	return false
+}
+
+// update passes the servers to the connection. The balancer finds the leader
+// by the attribute of its address. The connections to the servers that have
+// left the cluster are closed.
+func (r *grpcResolver) update(servers []Server) {
+	r.mu.Lock()
+	r.servers = servers
+
+	known := make(map[string]bool, len(servers)+len(r.seeds))
+	for _, server := range servers {
+		known[server.GRPCAddr] = true
+	}
+
+	for _, addr := range r.seeds {
+		known[addr] = true
+	}
+
+	for addr, conn := range r.conns {
+		if !known[addr] {
+			_ = conn.Close()
+
+			delete(r.conns, addr)
+		}
+	}
+	r.mu.Unlock()
+
+	addrs := make([]resolver.Address, 0, len(servers))
+	for _, server := range servers {
+		addrs = append(addrs, resolver.Address{ // nolint:exhaustivestruct
+			Addr:       server.GRPCAddr,
+			Attributes: attributes.New(leaderAttribute{}, server.Leader),
+		})
+	}
+
+	_ = r.cc.UpdateState(resolver.State{ // nolint:exhaustivestruct
+		Addresses:     addrs,
+		ServiceConfig: r.serviceConfig,
+	})
+}
+
+// cluster asks the server at the address for the servers of the cluster that
+// serve gRPC.
+func (r *grpcResolver) cluster(addr string) ([]Server, error) {
+	conn, err := r.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.ResolveTimeout)
+	defer cancel()
+
+	response, err := api.NewLogClient(conn).GetServers(ctx, &api.GetServersRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the servers from %s: %w", addr, err)
+	}
+
+	servers := make([]Server, 0, len(response.Servers))
+	for _, server := range response.Servers {
+		if server.GrpcAddr != "" {
+			servers = append(servers, Server{ID: server.Id, URL: "", GRPCAddr: server.GrpcAddr, Leader: server.Leader})
+		}
+	}
+
+	return servers, nil
+}
+
+func (r *grpcResolver) conn(addr string) (*grpc.ClientConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conn, ok := r.conns[addr]
+	if !ok {
+		var err error
+
+		conn, err = grpc.Dial(addr, r.dialOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
+		}
+
+		r.conns[addr] = conn
+	}
+
+	return conn, nil
+}
+
+// candidates returns the addresses of the known servers, the leader first,
+// and then the seeds.
+func (r *grpcResolver) candidates() []string {
+	r.mu.Lock()
+	servers := r.servers
+	r.mu.Unlock()
+
+	addrs := make([]string, 0, len(servers)+len(r.seeds))
+	seen := make(map[string]bool, cap(addrs))
+
+	add := func(addr string) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+
+	for _, server := range servers {
+		if server.Leader {
+			add(server.GRPCAddr)
+		}
+	}
+
+	for _, server := range servers {
+		add(server.GRPCAddr)
+	}
+
+	for _, addr := range r.seeds {
+		add(addr)
+	}
+
+	return addrs
+}
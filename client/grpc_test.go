@@ -0,0 +1,113 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveGRPC serves the log over gRPC on a local port and returns a transport
+// connected to it.
+func serveGRPC(t *testing.T, config server.GRPCConfig) *client.GRPCTransport {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.NewGRPCServer(config)
+
+	go srv.Serve(listener) // nolint:errcheck
+
+	t.Cleanup(srv.Stop)
+
+	conn, err := client.DialGRPC(listener.Addr().String(), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return client.NewGRPCTransport(conn)
+}
+
+func TestGRPCTransport(t *testing.T) {
+	t.Parallel()
+
+	transport := serveGRPC(t, server.GRPCConfig{Log: server.NewLog()}) // nolint:exhaustivestruct
+
+	p, err := client.NewProducer(transport, client.ProducerConfig{})
+	assert.Nil(t, err)
+
+	for i := uint64(0); i < 3; i++ {
+		offset, err := p.Produce(context.Background(), []byte("record"))
+		assert.Nil(t, err)
+		assert.Equal(t, i, offset)
+	}
+
+	assert.Nil(t, p.Close())
+
+	offset, err := transport.Produce(context.Background(), client.ProduceRequest{
+		Value:   []byte("single"),
+		Headers: []client.Header{{Key: "key", Value: "value"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), offset)
+
+	c := client.NewConsumer(transport, client.ConsumerConfig{Offset: 2, MaxWait: 10 * time.Millisecond})
+
+	r, err := c.Next(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record"), r.Value)
+	assert.Equal(t, uint64(2), r.Offset)
+
+	r, err = c.Next(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("single"), r.Value)
+	assert.Equal(t, []client.Header{{Key: "key", Value: "value"}}, r.Headers)
+
+	_, err = transport.Consume(context.Background(), client.ConsumeRequest{Offset: 4, MaxWaitMs: 10})
+	assert.Equal(t, client.ErrOffsetNotFound, err)
+
+	_, err = transport.ProduceBatch(context.Background(), client.ProduceBatchRequest{})
+	assert.Equal(t, http.StatusBadRequest, responseStatus(err))
+}
+
+func TestGRPCTransport_Throttled(t *testing.T) {
+	t.Parallel()
+
+	transport := serveGRPC(t, server.GRPCConfig{ // nolint:exhaustivestruct
+		Log:    server.NewLog(),
+		Quotas: quota.NewManager(quota.Config{Default: quota.Limit{RequestsPerSecond: 1}}), // nolint:exhaustivestruct
+	})
+
+	_, err := transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("first")})
+	assert.Nil(t, err)
+
+	_, err = transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("throttled")})
+
+	var responseErr *client.ResponseError
+	if assert.True(t, errors.As(err, &responseErr)) {
+		assert.Equal(t, http.StatusTooManyRequests, responseErr.StatusCode)
+		assert.True(t, responseErr.Temporary())
+		assert.Equal(t, time.Second, responseErr.RetryAfter)
+	}
+}
+
+func responseStatus(err error) int {
+	var responseErr *client.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode
+	}
+
+	return 0
+}
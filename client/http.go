@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPTransport sends requests to the HTTP API of the server.
+type HTTPTransport struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPTransport creates a new HTTPTransport that sends requests to the
+// server at the given URL, e.g. http://localhost:8080. The default HTTP client
+// is used if the client is nil.
+func NewHTTPTransport(url string, client *http.Client) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPTransport{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+	}
+}
+
+// NewHTTPClient creates an HTTP client that connects with the TLS
+// configuration and sends the bearer token, an API key or a JWT. The default
+// TLS settings are used if the configuration is nil, and no token is sent if
+// it is empty.
+func NewHTTPClient(tlsConfig *tls.Config, token string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone() // nolint:forcetypeassert
+	transport.TLSClientConfig = tlsConfig
+
+	var roundTripper http.RoundTripper = transport
+	if token != "" {
+		roundTripper = &bearerTransport{next: transport, token: token}
+	}
+
+	return &http.Client{Transport: roundTripper} // nolint:exhaustivestruct
+}
+
+// bearerTransport adds the bearer token to requests.
+type bearerTransport struct {
+	next  http.RoundTripper
+	token string
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+
+	return t.next.RoundTrip(r) // nolint:wrapcheck
+}
+
+type produceRequest struct {
+	Value      []byte   `json:"value"`
+	ProducerID string   `json:"producer_id,omitempty"`
+	Sequence   uint64   `json:"sequence"`
+	Headers    []Header `json:"headers,omitempty"`
+	Acks       string   `json:"acks,omitempty"`
+}
+
+type produceResponse struct {
+	Offset uint64 `json:"offset"`
+}
+
+type produceBatchRequest struct {
+	Records    []batchRecord `json:"records"`
+	ProducerID string        `json:"producer_id,omitempty"`
+	Sequence   uint64        `json:"sequence"`
+	Resume     bool          `json:"resume,omitempty"`
+	Acks       string        `json:"acks,omitempty"`
+}
+
+type batchRecord struct {
+	Value   []byte   `json:"value"`
+	Headers []Header `json:"headers,omitempty"`
+}
+
+type produceBatchResponse struct {
+	Offsets []uint64 `json:"offsets"`
+}
+
+type consumeRequest struct {
+	Offset         uint64 `json:"offset"`
+	Isolation      string `json:"isolation,omitempty"`
+	MaxWaitMs      uint64 `json:"max_wait_ms"`
+	MinOffset      uint64 `json:"min_offset,omitempty"`
+	MaxStalenessMs uint64 `json:"max_staleness_ms,omitempty"`
+}
+
+type consumeResponse struct {
+	Value   []byte   `json:"value"`
+	Offset  uint64   `json:"offset"`
+	Headers []Header `json:"headers"`
+}
+
+type describeGroupRequest struct {
+	Group string `json:"group"`
+}
+
+type clusterResponse struct {
+	Servers []Server `json:"servers"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Produce writes the record into the log and returns its offset.
+func (t *HTTPTransport) Produce(ctx context.Context, request ProduceRequest) (uint64, error) {
+	var response produceResponse
+
+	err := t.do(ctx, http.MethodPost, "/", produceRequest(request), &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Offset, nil
+}
+
+// ProduceBatch writes the records into the log and returns their offsets.
+func (t *HTTPTransport) ProduceBatch(ctx context.Context, request ProduceBatchRequest) ([]uint64, error) {
+	records := make([]batchRecord, 0, len(request.Records))
+	for _, record := range request.Records {
+		records = append(records, batchRecord(record))
+	}
+
+	var response produceBatchResponse
+
+	err := t.do(ctx, http.MethodPost, "/batch", produceBatchRequest{
+		Records:    records,
+		ProducerID: request.ProducerID,
+		Sequence:   request.Sequence,
+		Resume:     request.Resume,
+		Acks:       request.Acks,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Offsets, nil
+}
+
+// Consume reads a record from the log.
+func (t *HTTPTransport) Consume(ctx context.Context, request ConsumeRequest) (Record, error) {
+	var response consumeResponse
+
+	err := t.do(ctx, http.MethodGet, "/", consumeRequest(request), &response)
+	if isNotFound(err) {
+		var responseErr *ResponseError
+		if errors.As(err, &responseErr) && responseErr.Message == evictedMessage {
+			return Record{}, ErrOffsetEvicted
+		}
+
+		return Record{}, ErrOffsetNotFound
+	}
+
+	if err != nil {
+		return Record{}, err
+	}
+
+	return Record(response), nil
+}
+
+// DescribeGroup returns the members of the consumer group and its lag.
+func (t *HTTPTransport) DescribeGroup(ctx context.Context, group string) (GroupDescription, error) {
+	var response GroupDescription
+
+	request := describeGroupRequest{
+		Group: group,
+	}
+
+	err := t.do(ctx, http.MethodGet, "/groups/describe", request, &response)
+	if isNotFound(err) {
+		return GroupDescription{}, ErrGroupNotFound
+	}
+
+	if err != nil {
+		return GroupDescription{}, err
+	}
+
+	return response, nil
+}
+
+// Cluster returns the servers of the cluster known to the server.
+func (t *HTTPTransport) Cluster(ctx context.Context) ([]Server, error) {
+	var response clusterResponse
+
+	if err := t.do(ctx, http.MethodGet, "/v1/cluster", struct{}{}, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Servers, nil
+}
+
+func (t *HTTPTransport) do(ctx context.Context, method, path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode the request: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, t.url+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create the request: %w", err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to send the request: %w", err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Message:    e.Error,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode the response: %w", err)
+	}
+
+	return nil
+}
+
+// retryAfter parses the Retry-After header in seconds. It returns zero if the
+// header is not set or is an HTTP date.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func isNotFound(err error) bool {
+	var responseErr *ResponseError
+
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound
+}
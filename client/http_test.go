@@ -0,0 +1,119 @@
+package client_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL+"/", nil)
+
+	offset, err := transport.Produce(context.Background(), client.ProduceRequest{
+		Value:      []byte("record"),
+		ProducerID: "producer",
+		Sequence:   3,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset)
+
+	r, err := transport.Consume(context.Background(), client.ConsumeRequest{Offset: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record"), r.Value)
+
+	_, err = transport.Consume(context.Background(), client.ConsumeRequest{Offset: 1})
+	assert.Equal(t, client.ErrOffsetNotFound, err)
+
+	_, err = transport.Produce(context.Background(), client.ProduceRequest{
+		Value:      []byte("record"),
+		ProducerID: "producer",
+		Sequence:   5,
+	})
+
+	var responseErr *client.ResponseError
+	assert.ErrorAs(t, err, &responseErr)
+	assert.Equal(t, http.StatusConflict, responseErr.StatusCode)
+	assert.Equal(t, "Out of order sequence", responseErr.Message)
+	assert.False(t, responseErr.Temporary())
+}
+
+func TestHTTPTransport_Throttled(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{
+		Log:    server.NewLog(),
+		Quotas: quota.NewManager(quota.Config{Default: quota.Limit{RequestsPerSecond: 1}}),
+	}).Handler)
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	_, err := transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("first")})
+	assert.Nil(t, err)
+
+	_, err = transport.Produce(context.Background(), client.ProduceRequest{Value: []byte("second")})
+
+	var responseErr *client.ResponseError
+	assert.ErrorAs(t, err, &responseErr)
+	assert.Equal(t, http.StatusTooManyRequests, responseErr.StatusCode)
+	assert.Equal(t, time.Second, responseErr.RetryAfter)
+	assert.True(t, responseErr.Temporary())
+}
+
+func TestHTTPTransport_DescribeGroup(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	_, err := transport.DescribeGroup(context.Background(), "group")
+	assert.Equal(t, client.ErrGroupNotFound, err)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"offset":0,"entries":[],"high_watermark":1}`))
+	}))
+	defer srv.Close()
+
+	tlsConfig := &tls.Config{RootCAs: x509.NewCertPool()} // nolint:exhaustivestruct,gosec
+	tlsConfig.RootCAs.AddCert(srv.Certificate())
+
+	transport := client.NewHTTPTransport(srv.URL, client.NewHTTPClient(tlsConfig, "secret"))
+
+	resp, err := transport.Fetch(context.Background(), client.FetchRequest{ReplicaID: "replica"}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), resp.HighWatermark)
+
+	transport = client.NewHTTPTransport(srv.URL, client.NewHTTPClient(tlsConfig, ""))
+
+	_, err = transport.Fetch(context.Background(), client.FetchRequest{ReplicaID: "replica"}) // nolint:exhaustivestruct
+
+	var responseErr *client.ResponseError
+	assert.ErrorAs(t, err, &responseErr)
+	assert.Equal(t, http.StatusUnauthorized, responseErr.StatusCode)
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Picker is a Transport that picks the server of every request from the
+// servers of the resolver. Produce requests are sent to the leader, consume
+// requests are spread round-robin across the followers, or all servers if
+// there are no followers. The resolver is asked to resolve again if a server
+// cannot be reached or is not the leader.
+type Picker struct {
+	resolver *Resolver
+	client   *http.Client
+
+	mu         sync.Mutex
+	transports map[string]*HTTPTransport
+	next       int
+}
+
+// NewPicker creates a new Picker that sends requests to the servers of the
+// resolver. The default HTTP client is used if the client is nil.
+func NewPicker(resolver *Resolver, client *http.Client) *Picker {
+	return &Picker{
+		resolver:   resolver,
+		client:     client,
+		mu:         sync.Mutex{},
+		transports: make(map[string]*HTTPTransport),
+		next:       0,
+	}
+}
+
+// Produce writes the record into the log of the leader and returns its
+// offset. The first server is used if the leader is not known.
+func (p *Picker) Produce(ctx context.Context, request ProduceRequest) (uint64, error) {
+	offset, err := p.pickLeader().Produce(ctx, request)
+	p.check(err)
+
+	return offset, err
+}
+
+// ProduceBatch writes the records into the log of the leader and returns
+// their offsets. The first server is used if the leader is not known.
+func (p *Picker) ProduceBatch(ctx context.Context, request ProduceBatchRequest) ([]uint64, error) {
+	offsets, err := p.pickLeader().ProduceBatch(ctx, request)
+	p.check(err)
+
+	return offsets, err
+}
+
+// Consume reads a record from the log of the next follower.
+func (p *Picker) Consume(ctx context.Context, request ConsumeRequest) (Record, error) {
+	r, err := p.pickFollower().Consume(ctx, request)
+	p.check(err)
+
+	return r, err
+}
+
+func (p *Picker) pickLeader() *HTTPTransport {
+	servers := p.resolver.Servers()
+	for _, server := range servers {
+		if server.Leader {
+			return p.transport(server.URL)
+		}
+	}
+
+	return p.transport(servers[0].URL)
+}
+
+func (p *Picker) pickFollower() *HTTPTransport {
+	servers := p.resolver.Servers()
+
+	followers := make([]Server, 0, len(servers))
+	for _, server := range servers {
+		if !server.Leader {
+			followers = append(followers, server)
+		}
+	}
+
+	if len(followers) == 0 {
+		followers = servers
+	}
+
+	p.mu.Lock()
+	next := p.next % len(followers)
+	p.next = next + 1
+	p.mu.Unlock()
+
+	return p.transport(followers[next].URL)
+}
+
+func (p *Picker) transport(url string) *HTTPTransport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	transport, ok := p.transports[url]
+	if !ok {
+		transport = NewHTTPTransport(url, p.client)
+		p.transports[url] = transport
+	}
+
+	return transport
+}
+
+// check asks the resolver to resolve again if the server has failed, which
+// may be caused by a membership or leader change. Responses of a server that
+// is up, such as missing offsets or throttling, are not checked.
+func (p *Picker) check(err error) {
+	if err == nil || errors.Is(err, ErrOffsetNotFound) || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	p.resolver.ResolveNow()
+}
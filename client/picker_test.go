@@ -0,0 +1,144 @@
+package client_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCluster is a cluster whose servers can be changed by the test.
+type testCluster struct {
+	mu      sync.Mutex
+	servers []server.ClusterServer
+}
+
+func (c *testCluster) Servers() []server.ClusterServer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]server.ClusterServer(nil), c.servers...)
+}
+
+func (c *testCluster) set(servers ...server.ClusterServer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.servers = servers
+}
+
+func TestPicker(t *testing.T) {
+	t.Parallel()
+
+	cluster := &testCluster{}
+
+	logs := make([]*server.Log, 3)
+	servers := make([]*httptest.Server, 3)
+
+	for i := range servers {
+		logs[i] = server.NewLog()
+		servers[i] = httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: logs[i], Cluster: cluster}).Handler)
+		defer servers[i].Close()
+	}
+
+	cluster.set(
+		server.ClusterServer{ID: "0", URL: servers[0].URL, Leader: true},
+		server.ClusterServer{ID: "1", URL: servers[1].URL, Leader: false},
+		server.ClusterServer{ID: "2", URL: servers[2].URL, Leader: false},
+	)
+
+	_, err := logs[1].Append([]byte("follower 1"))
+	assert.Nil(t, err)
+
+	_, err = logs[2].Append([]byte("follower 2"))
+	assert.Nil(t, err)
+
+	resolver, err := client.NewResolver(client.ResolverConfig{
+		URLs:            []string{servers[2].URL},
+		RefreshInterval: time.Hour,
+	})
+	assert.Nil(t, err)
+
+	defer resolver.Close()
+
+	assert.Equal(t, []client.Server{
+		{ID: "0", URL: servers[0].URL, Leader: true},
+		{ID: "1", URL: servers[1].URL, Leader: false},
+		{ID: "2", URL: servers[2].URL, Leader: false},
+	}, resolver.Servers())
+
+	picker := client.NewPicker(resolver, nil)
+
+	offset, err := picker.Produce(context.Background(), client.ProduceRequest{Value: []byte("leader")})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset)
+	assert.Equal(t, uint64(1), logs[0].EndOffset())
+
+	consumed := make(map[string]bool)
+
+	for i := 0; i < 4; i++ {
+		r, err := picker.Consume(context.Background(), client.ConsumeRequest{Offset: 0})
+		assert.Nil(t, err)
+
+		consumed[string(r.Value)] = true
+	}
+
+	assert.Equal(t, map[string]bool{"follower 1": true, "follower 2": true}, consumed)
+
+	// The leader fails and the first follower takes over.
+	cluster.set(
+		server.ClusterServer{ID: "1", URL: servers[1].URL, Leader: true},
+		server.ClusterServer{ID: "2", URL: servers[2].URL, Leader: false},
+	)
+	servers[0].Close()
+
+	_, err = picker.Produce(context.Background(), client.ProduceRequest{Value: []byte("lost")})
+	assert.NotNil(t, err)
+
+	assert.Eventually(t, func() bool {
+		servers := resolver.Servers()
+
+		return len(servers) == 2 && servers[0].Leader
+	}, time.Second, 10*time.Millisecond)
+
+	offset, err = picker.Produce(context.Background(), client.ProduceRequest{Value: []byte("new leader")})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), offset)
+	assert.Equal(t, uint64(2), logs[1].EndOffset())
+
+	r, err := picker.Consume(context.Background(), client.ConsumeRequest{Offset: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("follower 2"), r.Value)
+}
+
+func TestResolver_NoCluster(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	resolver, err := client.NewResolver(client.ResolverConfig{URLs: []string{srv.URL + "/"}})
+	assert.Nil(t, err)
+
+	defer resolver.Close()
+
+	assert.Equal(t, []client.Server{{ID: "", URL: srv.URL, Leader: false}}, resolver.Servers())
+
+	picker := client.NewPicker(resolver, nil)
+
+	offset, err := picker.Produce(context.Background(), client.ProduceRequest{Value: []byte("record")})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset)
+
+	r, err := picker.Consume(context.Background(), client.ConsumeRequest{Offset: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record"), r.Value)
+
+	_, err = client.NewResolver(client.ResolverConfig{})
+	assert.Equal(t, client.ErrNoServers, err)
+}
@@ -0,0 +1,416 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default producer settings used for the zero values of ProducerConfig.
+const (
+	DefaultBatchSize      = 100
+	DefaultLinger         = 5 * time.Millisecond
+	DefaultMaxRetries     = 5
+	DefaultRetryBackoff   = 100 * time.Millisecond
+	DefaultRequestTimeout = 30 * time.Second
+)
+
+// ErrProducerClosed is returned if records are produced after closing the
+// producer.
+var ErrProducerClosed = fmt.Errorf("producer closed")
+
+// ProducerConfig configures a Producer.
+type ProducerConfig struct {
+	// BatchSize is the number of records that are sent without waiting for
+	// the linger time.
+	BatchSize int
+
+	// Linger is the time records wait for more records to fill the batch.
+	Linger time.Duration
+
+	// MaxRetries is the number of times a failed request is retried. A negative
+	// value disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry. It doubles on every
+	// next retry.
+	RetryBackoff time.Duration
+
+	// RequestTimeout is the time after which a request is considered failed.
+	RequestTimeout time.Duration
+
+	// Acks are the acknowledgements the server waits for before responding:
+	// AcksLeader or AcksAll. The server default, AcksLeader, is used if it is
+	// empty.
+	Acks string
+}
+
+// DeliveryCallback is called when the record is appended to the log or all
+// retries have failed. It is called from the sending goroutine, so it may
+// produce more records with ProduceAsync, but Produce and Flush wait for the
+// sending goroutine and only return once their context is done.
+type DeliveryCallback func(offset uint64, err error)
+
+// Producer writes records into the log. Records are collected into batches
+// and sent in order by a background goroutine, a batch in one request.
+// Requests carry a producer ID and the sequence number of the first record,
+// so retries do not duplicate records.
+type Producer struct {
+	transport Transport
+	config    ProducerConfig
+
+	mu     sync.Mutex
+	batch  []message
+	queue  [][]message // the batches waiting for the sending goroutine
+	timer  *time.Timer
+	closed bool
+
+	ready chan struct{} // signals queued batches or closing
+	done  chan struct{}
+
+	// Only the sending goroutine uses the producer ID, the sequence and
+	// resume, which is set after a batch has failed.
+	producerID string
+	sequence   uint64
+	resume     bool
+}
+
+// message is a record waiting to be sent or a flush marker.
+type message struct {
+	value    []byte
+	callback DeliveryCallback
+	flushed  chan struct{} // closed when all previous records are sent
+}
+
+// NewProducer creates a new Producer that sends records with the transport.
+// It must be closed to send the remaining records.
+func NewProducer(transport Transport, config ProducerConfig) (*Producer, error) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+
+	if config.Linger <= 0 {
+		config.Linger = DefaultLinger
+	}
+
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DefaultRetryBackoff
+	}
+
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = DefaultRequestTimeout
+	}
+
+	producerID, err := newProducerID()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Producer{
+		transport:  transport,
+		config:     config,
+		mu:         sync.Mutex{},
+		batch:      nil,
+		queue:      nil,
+		timer:      nil,
+		closed:     false,
+		ready:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		producerID: producerID,
+		sequence:   0,
+		resume:     false,
+	}
+
+	go p.run()
+
+	return p, nil
+}
+
+// Produce writes the record into the log and waits for its offset. The
+// context only bounds the wait: the record is sent in a batch with the records
+// of other calls, and every request of the batch is bounded by the request
+// timeout. If the context is done first, the record may still be appended
+// later.
+func (p *Producer) Produce(ctx context.Context, value []byte) (uint64, error) {
+	type result struct {
+		offset uint64
+		err    error
+	}
+
+	results := make(chan result, 1)
+
+	err := p.ProduceAsync(value, func(offset uint64, err error) {
+		results <- result{offset: offset, err: err}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	p.sendBatch()
+	p.mu.Unlock()
+
+	select {
+	case r := <-results:
+		return r.offset, r.err
+	case <-ctx.Done():
+		return 0, fmt.Errorf("failed to wait for the record: %w", ctx.Err())
+	}
+}
+
+// ProduceAsync adds the record to the current batch and returns without
+// waiting. The callback is called from the sending goroutine, it may be nil.
+func (p *Producer) ProduceAsync(value []byte, callback DeliveryCallback) error {
+	return p.enqueue(message{
+		value:    value,
+		callback: callback,
+		flushed:  nil,
+	})
+}
+
+// Flush sends the current batch and waits until all records produced before
+// are delivered.
+func (p *Producer) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	err := p.enqueue(message{
+		value:    nil,
+		callback: nil,
+		flushed:  flushed,
+	})
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.sendBatch()
+	p.mu.Unlock()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush the producer: %w", ctx.Err())
+	}
+}
+
+// Close sends the remaining records and stops the producer.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+
+		return nil
+	}
+
+	p.sendBatch()
+	p.closed = true
+	p.signal()
+	p.mu.Unlock()
+
+	<-p.done
+
+	return nil
+}
+
+func (p *Producer) enqueue(m message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	p.batch = append(p.batch, m)
+
+	if len(p.batch) >= p.config.BatchSize {
+		p.sendBatch()
+	} else if p.timer == nil {
+		p.timer = time.AfterFunc(p.config.Linger, p.linger)
+	}
+
+	return nil
+}
+
+// linger sends the batch when the linger time is over.
+func (p *Producer) linger() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.sendBatch()
+	}
+}
+
+// sendBatch queues the current batch for the sending goroutine. It does not
+// wait for the sending goroutine, which may be calling a callback that
+// produces more records. The caller must hold the mutex.
+func (p *Producer) sendBatch() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	if len(p.batch) == 0 || p.closed {
+		return
+	}
+
+	p.queue = append(p.queue, p.batch)
+	p.batch = nil
+	p.signal()
+}
+
+// signal wakes up the sending goroutine if it is not woken up already.
+func (p *Producer) signal() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued batches until the producer is closed.
+func (p *Producer) run() {
+	defer close(p.done)
+
+	for range p.ready {
+		p.mu.Lock()
+		queue, closed := p.queue, p.closed
+		p.queue = nil
+		p.mu.Unlock()
+
+		for _, batch := range queue {
+			p.sendMessages(batch)
+		}
+
+		if closed {
+			return
+		}
+	}
+}
+
+// sendMessages sends the records between flush markers in one request and
+// releases the flush markers once the records before them are delivered.
+func (p *Producer) sendMessages(batch []message) {
+	var records []message
+
+	for _, m := range batch {
+		if m.flushed == nil {
+			records = append(records, m)
+
+			continue
+		}
+
+		p.deliver(records)
+		records = nil
+
+		close(m.flushed)
+	}
+
+	p.deliver(records)
+}
+
+// deliver sends the records and calls their callbacks.
+func (p *Producer) deliver(records []message) {
+	if len(records) == 0 {
+		return
+	}
+
+	offsets, err := p.send(records)
+
+	for i, m := range records {
+		if m.callback == nil {
+			continue
+		}
+
+		if err != nil {
+			m.callback(0, err)
+		} else {
+			m.callback(offsets[i], nil)
+		}
+	}
+}
+
+// send writes the records into the log retrying temporary errors. Retries
+// have the same producer ID and sequence numbers, so the records appended by
+// a failed request are not appended again.
+func (p *Producer) send(records []message) ([]uint64, error) {
+	request := ProduceBatchRequest{
+		Records:    make([]BatchRecord, 0, len(records)),
+		ProducerID: p.producerID,
+		Sequence:   p.sequence,
+		Resume:     p.resume,
+		Acks:       p.config.Acks,
+	}
+
+	for _, m := range records {
+		request.Records = append(request.Records, BatchRecord{Value: m.value, Headers: nil})
+	}
+
+	// The sequence numbers are used up even if the batch fails, because its
+	// records may have been appended anyway.
+	p.sequence += uint64(len(records))
+
+	backoff := p.config.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		// The batch has the records of several calls, so the requests are
+		// not bound to the context of any of them.
+		ctx, cancel := context.WithTimeout(context.Background(), p.config.RequestTimeout)
+		offsets, err := p.transport.ProduceBatch(ctx, request)
+		cancel()
+
+		if err == nil {
+			p.resume = false
+
+			if len(offsets) != len(records) {
+				return nil, fmt.Errorf("failed to produce the records: %d offsets for %d records",
+					len(offsets), len(records))
+			}
+
+			return offsets, nil
+		}
+
+		if attempt >= p.config.MaxRetries || !temporary(err) {
+			// The next batch skips the sequence numbers of this one, so
+			// it is not mistaken for a retry of these records.
+			p.resume = true
+
+			return nil, err
+		}
+
+		time.Sleep(retryDelay(err, backoff))
+		backoff *= 2
+	}
+}
+
+// temporary reports whether the error may go away on retry. Errors without
+// a response from the server, such as timeouts, are temporary.
+func temporary(err error) bool {
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.Temporary()
+	}
+
+	return true
+}
+
+func newProducerID() (string, error) {
+	b := make([]byte, 16) // nolint:gomnd
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a producer ID: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,314 @@
+package client_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducer_Produce(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	p, err := client.NewProducer(client.NewHTTPTransport(srv.URL, nil), client.ProducerConfig{})
+	assert.Nil(t, err)
+
+	defer p.Close() // nolint:errcheck
+
+	for i := uint64(0); i < 3; i++ {
+		offset, err := p.Produce(context.Background(), []byte("record"))
+		assert.Nil(t, err)
+		assert.Equal(t, i, offset)
+	}
+}
+
+func TestProducer_ProduceAsync(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	config := client.ProducerConfig{
+		BatchSize: 2,
+		Linger:    time.Hour,
+	}
+
+	p, err := client.NewProducer(client.NewHTTPTransport(srv.URL, nil), config)
+	assert.Nil(t, err)
+
+	var (
+		mu      sync.Mutex
+		offsets []uint64
+	)
+
+	for i := 0; i < 5; i++ {
+		err := p.ProduceAsync([]byte("record"), func(offset uint64, err error) {
+			assert.Nil(t, err)
+
+			mu.Lock()
+			offsets = append(offsets, offset)
+			mu.Unlock()
+		})
+		assert.Nil(t, err)
+	}
+
+	err = p.Flush(context.Background())
+	assert.Nil(t, err)
+
+	mu.Lock()
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4}, offsets)
+	mu.Unlock()
+
+	err = p.Close()
+	assert.Nil(t, err)
+
+	err = p.ProduceAsync([]byte("record"), nil)
+	assert.Equal(t, client.ErrProducerClosed, err)
+}
+
+func TestProducer_Retry(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	transport := &flakyTransport{
+		log:      log,
+		failures: 2,
+	}
+
+	config := client.ProducerConfig{
+		RetryBackoff: time.Millisecond,
+	}
+
+	p, err := client.NewProducer(transport, config)
+	assert.Nil(t, err)
+
+	defer p.Close() // nolint:errcheck
+
+	offset, err := p.Produce(context.Background(), []byte("record"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset)
+
+	// The record is appended once although the first requests have failed.
+	_, err = log.Read(1)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+
+	offset, err = p.Produce(context.Background(), []byte("record"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), offset)
+}
+
+func TestProducer_RetriesExhausted(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	transport := &flakyTransport{
+		log:      log,
+		failures: 2,
+	}
+
+	config := client.ProducerConfig{
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	}
+
+	p, err := client.NewProducer(transport, config)
+	assert.Nil(t, err)
+
+	defer p.Close() // nolint:errcheck
+
+	_, err = p.Produce(context.Background(), []byte("lost"))
+	assert.NotNil(t, err)
+
+	// The failed record has been appended, the next record must not be
+	// mistaken for its retry.
+	offset, err := p.Produce(context.Background(), []byte("next"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), offset)
+
+	r, err := log.Read(offset)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("next"), r.Value)
+
+	// The producer keeps its ID after the failure.
+	transport.mu.Lock()
+	assert.Equal(t, 1, len(transport.producerIDs))
+	transport.mu.Unlock()
+}
+
+func TestProducer_Batch(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	transport := &flakyTransport{
+		log:      log,
+		failures: 1,
+	}
+
+	config := client.ProducerConfig{
+		BatchSize:    3,
+		Linger:       time.Hour,
+		RetryBackoff: time.Millisecond,
+	}
+
+	p, err := client.NewProducer(transport, config)
+	assert.Nil(t, err)
+
+	var (
+		mu      sync.Mutex
+		offsets []uint64
+	)
+
+	for i := 0; i < 3; i++ {
+		err := p.ProduceAsync([]byte("record"), func(offset uint64, err error) {
+			assert.Nil(t, err)
+
+			mu.Lock()
+			offsets = append(offsets, offset)
+			mu.Unlock()
+		})
+		assert.Nil(t, err)
+	}
+
+	err = p.Close()
+	assert.Nil(t, err)
+
+	// The batch is sent in one request and appended once although the
+	// first request has failed.
+	mu.Lock()
+	assert.Equal(t, []uint64{0, 1, 2}, offsets)
+	mu.Unlock()
+
+	transport.mu.Lock()
+	assert.Equal(t, 2, transport.requests)
+	transport.mu.Unlock()
+
+	_, err = log.Read(3)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+}
+
+// flakyTransport appends records to the log directly and fails the given
+// number of requests after appending the records, as if the response was
+// lost.
+type flakyTransport struct {
+	mu          sync.Mutex
+	log         *server.Log
+	failures    int
+	requests    int
+	producerIDs map[string]bool
+}
+
+func (t *flakyTransport) Produce(_ context.Context, request client.ProduceRequest) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offset, err := t.log.AppendIdempotent(request.ProducerID, request.Sequence, request.Value)
+	if err != nil {
+		return 0, err
+	}
+
+	if t.failures > 0 {
+		t.failures--
+
+		return 0, context.DeadlineExceeded
+	}
+
+	return offset, nil
+}
+
+func (t *flakyTransport) ProduceBatch(_ context.Context, request client.ProduceBatchRequest) ([]uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+
+	if t.producerIDs == nil {
+		t.producerIDs = make(map[string]bool)
+	}
+
+	t.producerIDs[request.ProducerID] = true
+
+	records := make([]server.Record, 0, len(request.Records))
+	for _, record := range request.Records {
+		records = append(records, server.Record{Value: record.Value, Offset: 0, Headers: nil})
+	}
+
+	offsets, err := t.log.AppendBatch(request.ProducerID, request.Sequence, request.Resume, records)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.failures > 0 {
+		t.failures--
+
+		return nil, context.DeadlineExceeded
+	}
+
+	return offsets, nil
+}
+
+func (t *flakyTransport) Consume(_ context.Context, request client.ConsumeRequest) (client.Record, error) {
+	record, err := t.log.Read(request.Offset)
+	if err != nil {
+		return client.Record{}, client.ErrOffsetNotFound
+	}
+
+	return client.Record{Value: record.Value, Offset: record.Offset, Headers: nil}, nil
+}
+
+func TestProducer_ProduceFromCallback(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()}).Handler)
+	defer srv.Close()
+
+	config := client.ProducerConfig{
+		BatchSize: 1,
+		Linger:    time.Hour,
+	}
+
+	p, err := client.NewProducer(client.NewHTTPTransport(srv.URL, nil), config)
+	assert.Nil(t, err)
+
+	defer p.Close() // nolint:errcheck
+
+	produced := make(chan uint64, 10)
+
+	// Every callback produces the next record while the following batches
+	// are queued, which fills more than one batch.
+	var callback client.DeliveryCallback
+
+	callback = func(offset uint64, err error) {
+		assert.Nil(t, err)
+
+		produced <- offset
+
+		if offset < 5 {
+			assert.Nil(t, p.ProduceAsync([]byte("next"), callback))
+			assert.Nil(t, p.ProduceAsync([]byte("other"), nil))
+		}
+	}
+
+	assert.Nil(t, p.ProduceAsync([]byte("first"), callback))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, expected := range []uint64{0, 1, 3, 5} {
+		select {
+		case offset := <-produced:
+			assert.Equal(t, expected, offset)
+		case <-ctx.Done():
+			t.Fatal("the records produced from callbacks are not delivered")
+		}
+	}
+
+	assert.Nil(t, p.Flush(ctx))
+}
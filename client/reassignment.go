@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrReassignmentNotFound is returned if there is no reassignment to describe
+// or no reassignment in progress to change.
+var ErrReassignmentNotFound = fmt.Errorf("reassignment not found")
+
+// States of reassignments.
+const (
+	ReassignmentInProgress = "in_progress"
+	ReassignmentCompleted  = "completed"
+	ReassignmentCancelled  = "cancelled"
+)
+
+// ReassignmentPlan is the change of the followers assigned to replicate the
+// log.
+type ReassignmentPlan struct {
+	Current  []string `json:"current"`
+	Target   []string `json:"target"`
+	Adding   []string `json:"adding"`
+	Removing []string `json:"removing"`
+}
+
+// Reassignment describes the plan and the progress of a reassignment.
+type Reassignment struct {
+	Plan                   ReassignmentPlan    `json:"plan"`
+	State                  string              `json:"state"`
+	ThrottleBytesPerSecond float64             `json:"throttle_bytes_per_second"`
+	StartedAt              time.Time           `json:"started_at"`
+	EndedAt                *time.Time          `json:"ended_at,omitempty"`
+	Replicas               []ReassignedReplica `json:"replicas"`
+}
+
+// ReassignedReplica describes the progress of a replica of the reassignment:
+// adding, kept or removing.
+type ReassignedReplica struct {
+	ID     string `json:"id"`
+	Role   string `json:"role"`
+	Offset uint64 `json:"offset"`
+	Lag    uint64 `json:"lag"`
+	InSync bool   `json:"in_sync"`
+}
+
+type reassignRequest struct {
+	Replicas               []string `json:"replicas"`
+	ThrottleBytesPerSecond float64  `json:"throttle_bytes_per_second"`
+	DryRun                 bool     `json:"dry_run"`
+}
+
+type reassignmentThrottleRequest struct {
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// PlanReassignment returns the plan of reassigning the log to the target
+// followers without starting it.
+func (t *HTTPTransport) PlanReassignment(ctx context.Context, replicas []string) (ReassignmentPlan, error) {
+	var response ReassignmentPlan
+
+	request := reassignRequest{
+		Replicas:               nonNil(replicas),
+		ThrottleBytesPerSecond: 0,
+		DryRun:                 true,
+	}
+
+	if err := t.do(ctx, http.MethodPost, "/v1/reassignment", request, &response); err != nil {
+		return ReassignmentPlan{}, err
+	}
+
+	return response, nil
+}
+
+// Reassign starts reassigning the log to the target followers. The catch-up
+// of the adding followers is not throttled if the throttle is zero.
+func (t *HTTPTransport) Reassign(ctx context.Context, replicas []string, bytesPerSecond float64) (Reassignment, error) {
+	var response Reassignment
+
+	request := reassignRequest{
+		Replicas:               nonNil(replicas),
+		ThrottleBytesPerSecond: bytesPerSecond,
+		DryRun:                 false,
+	}
+
+	if err := t.do(ctx, http.MethodPost, "/v1/reassignment", request, &response); err != nil {
+		return Reassignment{}, err
+	}
+
+	return response, nil
+}
+
+// Reassignment returns the last reassignment.
+func (t *HTTPTransport) Reassignment(ctx context.Context) (Reassignment, error) {
+	return t.reassignment(ctx, http.MethodGet, "/v1/reassignment", struct{}{})
+}
+
+// SetReassignmentThrottle changes the throttle of the reassignment in
+// progress. Zero removes the throttle.
+func (t *HTTPTransport) SetReassignmentThrottle(ctx context.Context, bytesPerSecond float64) (Reassignment, error) {
+	request := reassignmentThrottleRequest{
+		BytesPerSecond: bytesPerSecond,
+	}
+
+	return t.reassignment(ctx, http.MethodPut, "/v1/reassignment/throttle", request)
+}
+
+// CancelReassignment cancels the reassignment in progress.
+func (t *HTTPTransport) CancelReassignment(ctx context.Context) (Reassignment, error) {
+	return t.reassignment(ctx, http.MethodDelete, "/v1/reassignment", struct{}{})
+}
+
+func (t *HTTPTransport) reassignment(ctx context.Context, method, path string, request interface{}) (Reassignment, error) {
+	var response Reassignment
+
+	err := t.do(ctx, method, path, request, &response)
+	if isNotFound(err) {
+		return Reassignment{}, ErrReassignmentNotFound
+	}
+
+	if err != nil {
+		return Reassignment{}, err
+	}
+
+	return response, nil
+}
+
+// nonNil returns an empty slice for nil, so the request asks for no
+// followers rather than missing them.
+func nonNil(ids []string) []string {
+	if ids == nil {
+		return []string{}
+	}
+
+	return ids
+}
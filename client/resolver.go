@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default resolver settings used for the zero values of ResolverConfig.
+const (
+	DefaultRefreshInterval = 30 * time.Second
+	DefaultResolveTimeout  = 5 * time.Second
+)
+
+// ErrNoServers is returned if the resolver is created without server URLs.
+var ErrNoServers = fmt.Errorf("no servers")
+
+// Server is a server of the cluster. A server that does not serve HTTP or
+// gRPC to clients has an empty URL or gRPC address.
+type Server struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+	Leader   bool   `json:"leader"`
+}
+
+// ResolverConfig configures a Resolver.
+type ResolverConfig struct {
+	// URLs are the servers asked for the cluster until the first servers are
+	// resolved, e.g. http://localhost:8080. They are also used if no server
+	// answers.
+	URLs []string
+
+	// Client sends the requests. The default HTTP client is used if it is
+	// nil.
+	Client *http.Client
+
+	// RefreshInterval is the period of resolving the servers again.
+	RefreshInterval time.Duration
+
+	// ResolveTimeout is the time after which asking a server for the cluster
+	// is considered failed.
+	ResolveTimeout time.Duration
+}
+
+// Resolver finds the servers of the cluster and the leader by asking any known
+// server with GET /v1/cluster. It resolves the servers periodically and when
+// ResolveNow is called, so clients follow membership and leader changes.
+type Resolver struct {
+	config ResolverConfig
+	client *http.Client
+
+	mu      sync.RWMutex
+	servers []Server
+
+	resolveNow chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewResolver creates a new Resolver, resolves the servers and starts
+// refreshing them in the background. If no server answers, the URLs are used
+// as servers without a known leader.
+func NewResolver(config ResolverConfig) (*Resolver, error) {
+	if len(config.URLs) == 0 {
+		return nil, ErrNoServers
+	}
+
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = DefaultRefreshInterval
+	}
+
+	if config.ResolveTimeout == 0 {
+		config.ResolveTimeout = DefaultResolveTimeout
+	}
+
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	servers := make([]Server, 0, len(config.URLs))
+	for _, url := range config.URLs {
+		servers = append(servers, Server{
+			ID:       "",
+			URL:      strings.TrimSuffix(url, "/"),
+			GRPCAddr: "",
+			Leader:   false,
+		})
+	}
+
+	r := &Resolver{
+		config:     config,
+		client:     client,
+		mu:         sync.RWMutex{},
+		servers:    servers,
+		resolveNow: make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		closeOnce:  sync.Once{},
+	}
+
+	r.resolve()
+
+	go r.refresh()
+
+	return r, nil
+}
+
+// Servers returns the resolved servers.
+func (r *Resolver) Servers() []Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	servers := make([]Server, len(r.servers))
+	copy(servers, r.servers)
+
+	return servers
+}
+
+// ResolveNow asks the resolver to resolve the servers again without waiting
+// for the refresh interval, for example after the leader has changed. It does
+// not wait for the servers to be resolved.
+func (r *Resolver) ResolveNow() {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops refreshing the servers. Closing it again does nothing.
+func (r *Resolver) Close() {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
+
+func (r *Resolver) refresh() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.resolve()
+		case <-r.resolveNow:
+			r.resolve()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// resolve asks the known servers, then the configured URLs, for the cluster
+// and keeps the servers of the first answer. The servers are kept if no
+// server answers.
+func (r *Resolver) resolve() {
+	for _, url := range r.candidates() {
+		servers, err := r.cluster(url)
+		if err != nil || len(servers) == 0 {
+			continue
+		}
+
+		r.mu.Lock()
+		r.servers = servers
+		r.mu.Unlock()
+
+		return
+	}
+}
+
+// cluster asks the server at the URL for the servers of the cluster that
+// serve HTTP.
+func (r *Resolver) cluster(url string) ([]Server, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.ResolveTimeout)
+	defer cancel()
+
+	servers, err := NewHTTPTransport(url, r.client).Cluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	httpServers := servers[:0]
+
+	for _, server := range servers {
+		if server.URL != "" {
+			httpServers = append(httpServers, server)
+		}
+	}
+
+	return httpServers, nil
+}
+
+// candidates returns the URLs of the known servers, the leader first, and
+// then the configured URLs.
+func (r *Resolver) candidates() []string {
+	servers := r.Servers()
+	urls := make([]string, 0, len(servers)+len(r.config.URLs))
+	seen := make(map[string]bool, cap(urls))
+
+	add := func(url string) {
+		url = strings.TrimSuffix(url, "/")
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	for _, server := range servers {
+		if server.Leader {
+			add(server.URL)
+		}
+	}
+
+	for _, server := range servers {
+		add(server.URL)
+	}
+
+	for _, url := range r.config.URLs {
+		add(url)
+	}
+
+	return urls
+}
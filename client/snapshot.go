@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrSnapshotExists is returned if a snapshot with the name exists.
+var ErrSnapshotExists = fmt.Errorf("snapshot exists")
+
+// Snapshot describes a point-in-time snapshot of the log: the offsets of its
+// records, the files with their sizes and SHA-256 checksums and the uploaded
+// segments with the records before the lowest offset, which were evicted to
+// the tier.
+type Snapshot struct {
+	Version          int                   `json:"version"`
+	CreatedAt        time.Time             `json:"created_at"`
+	LowestOffset     uint64                `json:"lowest_offset"`
+	EndOffset        uint64                `json:"end_offset"`
+	LastStableOffset uint64                `json:"last_stable_offset"`
+	Files            []SnapshotFile        `json:"files"`
+	TierSegments     []SnapshotTierSegment `json:"tier_segments,omitempty"`
+}
+
+// SnapshotFile is a file of the snapshot.
+type SnapshotFile struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SnapshotTierSegment is an uploaded segment with the evicted records from
+// the base offset up to the end offset, stored in the object store by the key.
+type SnapshotTierSegment struct {
+	BaseOffset uint64 `json:"base_offset"`
+	EndOffset  uint64 `json:"end_offset"`
+	Key        string `json:"key"`
+}
+
+type snapshotRequest struct {
+	Name string `json:"name"`
+}
+
+// Snapshot snapshots the log into the named directory of the server's backup
+// directory.
+func (t *HTTPTransport) Snapshot(ctx context.Context, name string) (Snapshot, error) {
+	var response Snapshot
+
+	err := t.do(ctx, http.MethodPost, "/v1/snapshots", snapshotRequest{Name: name}, &response)
+
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusConflict {
+		return Snapshot{}, ErrSnapshotExists
+	}
+
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Topic describes a topic of the log and its offsets.
+type Topic struct {
+	Name             string `json:"name"`
+	LowestOffset     uint64 `json:"lowest_offset"`
+	EndOffset        uint64 `json:"end_offset"`
+	LastStableOffset uint64 `json:"last_stable_offset"`
+}
+
+type topicsResponse struct {
+	Topics []Topic `json:"topics"`
+}
+
+// Topics returns the topics of the log. The server does not split the log
+// into topics yet, so it returns the default topic only.
+func (t *HTTPTransport) Topics(ctx context.Context) ([]Topic, error) {
+	var response topicsResponse
+
+	if err := t.do(ctx, http.MethodGet, "/v1/topics", struct{}{}, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Topics, nil
+}
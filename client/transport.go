@@ -0,0 +1,148 @@
+// Package client implements producers and consumers of the log server.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrOffsetNotFound is returned if there is no record at or after the offset.
+var ErrOffsetNotFound = fmt.Errorf("offset not found")
+
+// ErrOffsetEvicted is returned if the record at the offset has been evicted
+// by the retention of the server, so it will never be returned.
+var ErrOffsetEvicted = fmt.Errorf("offset evicted")
+
+// evictedMessage is the message of the not found responses to the requests
+// of evicted records.
+const evictedMessage = "Record evicted"
+
+// Isolation levels of consumers.
+const (
+	// ReadUncommitted returns records of open and aborted transactions too.
+	ReadUncommitted = "read_uncommitted"
+
+	// ReadCommitted returns only records of committed transactions and records
+	// written outside of transactions.
+	ReadCommitted = "read_committed"
+)
+
+// Record is a record read from the log.
+type Record struct {
+	Value   []byte
+	Offset  uint64
+	Headers []Header
+}
+
+// Header is a key and a value attached to a record. The server may add the
+// W3C trace context of the producer as the traceparent header.
+type Header struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Acknowledgements of produce requests.
+const (
+	// AcksLeader waits until the leader has appended the record.
+	AcksLeader = "leader"
+
+	// AcksAll waits until all in-sync replicas have replicated the record.
+	AcksAll = "all"
+)
+
+// ProduceRequest is a request to write a record into the log. Records with a
+// producer ID are deduplicated by the sequence number. The server waits for
+// the leader only if Acks is empty.
+type ProduceRequest struct {
+	Value      []byte
+	ProducerID string
+	Sequence   uint64
+	Headers    []Header
+	Acks       string
+}
+
+// ProduceBatchRequest is a request to write records into the log at once.
+// The records of a producer have consecutive sequence numbers from Sequence,
+// and a retried batch returns the offsets of the records appended before
+// instead of appending them again. Resume lets the sequence number skip the
+// records the producer has given up on. The server waits for the leader only
+// if Acks is empty.
+type ProduceBatchRequest struct {
+	Records    []BatchRecord
+	ProducerID string
+	Sequence   uint64
+	Resume     bool
+	Acks       string
+}
+
+// BatchRecord is a record of a batch request.
+type BatchRecord struct {
+	Value   []byte
+	Headers []Header
+}
+
+// ConsumeRequest is a request to read the first record at or after the offset.
+// The server waits up to MaxWaitMs for the record if it is not in the log yet.
+//
+// A follower serves only the records replicated by all in-sync replicas. If it
+// has not replicated the records before MinOffset, or has not been up to date
+// with the leader within MaxStalenessMs, it waits up to MaxWaitMs to catch up
+// and then redirects the request to the leader, or responds with 503 if the
+// leader is not known. The leader ignores both.
+type ConsumeRequest struct {
+	Offset         uint64
+	Isolation      string
+	MaxWaitMs      uint64
+	MinOffset      uint64
+	MaxStalenessMs uint64
+}
+
+// Transport sends requests to the server.
+type Transport interface {
+	// Produce writes the record into the log and returns its offset.
+	Produce(ctx context.Context, request ProduceRequest) (uint64, error)
+
+	// ProduceBatch writes the records into the log and returns their offsets
+	// in the order of the request.
+	ProduceBatch(ctx context.Context, request ProduceBatchRequest) ([]uint64, error)
+
+	// Consume reads a record from the log. It returns ErrOffsetNotFound if
+	// there is no record to read yet and ErrOffsetEvicted if the record has
+	// been evicted.
+	Consume(ctx context.Context, request ConsumeRequest) (Record, error)
+}
+
+// ResponseError is an error returned by the server.
+type ResponseError struct {
+	StatusCode int
+	Message    string
+
+	// RetryAfter is the time the server asks to wait before retrying, for
+	// example when the client is over its quota. It is zero if the server
+	// has not set it.
+	RetryAfter time.Duration
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if it is retried.
+// Throttled requests are temporary.
+func (e *ResponseError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests // nolint:gomnd
+}
+
+// retryDelay returns the delay before retrying the failed request: the time
+// the server asks to wait if it is longer than the backoff.
+func retryDelay(err error, backoff time.Duration) time.Duration {
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) && responseErr.RetryAfter > backoff {
+		return responseErr.RetryAfter
+	}
+
+	return backoff
+}
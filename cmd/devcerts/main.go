@@ -0,0 +1,30 @@
+// Command devcerts generates a local CA and server and client certificates
+// signed by it for development and tests of TLS and mutual TLS.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ivanlemeshev/proglog/internal/tlsconfig"
+)
+
+func main() {
+	dir := flag.String("dir", "certs", "directory to write the certificates to")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma-separated host names and IPs of the server")
+	clients := flag.String("clients", tlsconfig.DefaultClient, "comma-separated common names of client certificates")
+
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0700); err != nil { // nolint:gomnd
+		fmt.Fprintln(os.Stderr, "devcerts:", err)
+		os.Exit(1)
+	}
+
+	if err := tlsconfig.GenerateDev(*dir, strings.Split(*hosts, ","), strings.Split(*clients, ",")...); err != nil {
+		fmt.Fprintln(os.Stderr, "devcerts:", err)
+		os.Exit(1)
+	}
+}
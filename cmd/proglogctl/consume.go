@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+)
+
+type consumed struct {
+	Value   []byte          `json:"value"`
+	Offset  uint64          `json:"offset"`
+	Headers []client.Header `json:"headers,omitempty"`
+}
+
+// consume prints records starting from the offset. It stops at the end of the
+// log unless it follows the log.
+func (c *cli) consume(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("consume", flag.ContinueOnError)
+	offset := flags.Uint64("offset", 0, "offset of the first record")
+	count := flags.Uint64("n", 0, "maximum number of records, 0 for no limit")
+	follow := flags.Bool("f", false, "wait for new records at the end of the log")
+	isolation := flags.String("isolation", client.ReadUncommitted, "read_uncommitted or read_committed")
+	maxStaleness := flags.Duration("max-staleness", 0, "maximum time a follower may be behind the leader, 0 for no limit")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) // nolint:errorlint
+	}
+
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	if *follow {
+		return c.follow(ctx, *offset, *count, *isolation, *maxStaleness)
+	}
+
+	var n uint64
+
+	for *count == 0 || n < *count {
+		record, err := c.transport.Consume(ctx, client.ConsumeRequest{
+			Offset:         *offset,
+			Isolation:      *isolation,
+			MaxWaitMs:      0,
+			MinOffset:      0,
+			MaxStalenessMs: uint64(*maxStaleness / time.Millisecond),
+		})
+		if errors.Is(err, client.ErrOffsetNotFound) && n > 0 {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to consume offset %d: %w", *offset, err)
+		}
+
+		if err := c.printRecord(record); err != nil {
+			return err
+		}
+
+		*offset = record.Offset + 1
+		n++
+	}
+
+	return nil
+}
+
+// tail follows the log starting from the offset.
+func (c *cli) tail(ctx context.Context, args []string) error {
+	return c.consume(ctx, append([]string{"-f"}, args...))
+}
+
+// follow prints records as they are appended until the context is canceled.
+func (c *cli) follow(ctx context.Context, offset, count uint64, isolation string, maxStaleness time.Duration) error {
+	consumer := client.NewConsumer(c.transport, client.ConsumerConfig{
+		Offset:       offset,
+		Isolation:    isolation,
+		MaxWait:      0,
+		MaxStaleness: maxStaleness,
+		RetryBackoff: 0,
+	})
+
+	for n := uint64(0); count == 0 || n < count; n++ {
+		record, err := consumer.Next(ctx)
+		if ctx.Err() != nil {
+			// Interrupting the command is the normal way to stop following.
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to consume offset %d: %w", consumer.Offset(), err)
+		}
+
+		if err := c.printRecord(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) printRecord(record client.Record) error {
+	printed := consumed{
+		Value:   record.Value,
+		Offset:  record.Offset,
+		Headers: record.Headers,
+	}
+
+	return c.out.print(printed, func(w io.Writer) {
+		fmt.Fprintf(w, "%d\t%s\n", record.Offset, record.Value)
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/server"
+)
+
+type dumped struct {
+	Offset     uint64          `json:"offset"`
+	Position   uint64          `json:"position"`
+	Size       uint64          `json:"size"`
+	Type       string          `json:"type"`
+	ProducerID string          `json:"producer_id,omitempty"`
+	Owner      string          `json:"owner,omitempty"`
+	Sequence   uint64          `json:"sequence"`
+	Headers    []server.Header `json:"headers,omitempty"`
+	Value      []byte          `json:"value"`
+}
+
+// dump decodes the records of a log store file without the server.
+func (c *cli) dump(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	maxRecordSize := flags.Uint64("max-record-size", store.MaxRecordLength, "maximum record size of the file")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) // nolint:errorlint
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: dump [-max-record-size n] <file>", errUsage)
+	}
+
+	file, err := os.Open(filepath.Clean(flags.Arg(0)))
+	if err != nil {
+		return fmt.Errorf("failed to open the file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	scanner := store.NewScannerWithConfig(file, store.Config{MaxRecordLength: *maxRecordSize})
+
+	for offset := uint64(0); scanner.Scan(); offset++ {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to dump the file: %w", ctx.Err())
+		}
+
+		frame := scanner.Frame()
+
+		record, err := server.DecodeStoredRecord(frame.Record)
+		if err != nil {
+			return fmt.Errorf("failed to decode the record at %d: %w", frame.Position, err)
+		}
+
+		d := dumped{
+			Offset:     offset,
+			Position:   frame.Position,
+			Size:       uint64(len(frame.Record)),
+			Type:       recordType(record),
+			ProducerID: record.ProducerID,
+			Owner:      record.Owner,
+			Sequence:   record.Sequence,
+			Headers:    record.Headers,
+			Value:      record.Value,
+		}
+
+		err = c.out.print(d, func(w io.Writer) {
+			fmt.Fprintf(w, "offset=%d\tposition=%d\tsize=%d\ttype=%s", d.Offset, d.Position, d.Size, d.Type)
+
+			if d.ProducerID != "" {
+				fmt.Fprintf(w, "\tproducer=%s\tsequence=%d", d.ProducerID, d.Sequence)
+			}
+
+			if d.Owner != "" {
+				fmt.Fprintf(w, "\towner=%s", d.Owner)
+			}
+
+			for _, h := range d.Headers {
+				fmt.Fprintf(w, "\theader.%s=%q", h.Key, h.Value)
+			}
+
+			fmt.Fprintf(w, "\tvalue=%q\n", d.Value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the file: %w", err)
+	}
+
+	return nil
+}
+
+func recordType(record server.StoredRecord) string {
+	switch {
+	case record.GroupOffset:
+		return "offset"
+	case record.Control && record.Commit:
+		return "commit"
+	case record.Control:
+		return "abort"
+	case record.Transactional:
+		return "transactional"
+	default:
+		return "data"
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ivanlemeshev/proglog/client"
+)
+
+// groups describes consumer groups.
+func (c *cli) groups(ctx context.Context, args []string) error {
+	if len(args) != 2 { // nolint:gomnd
+		return fmt.Errorf("%w: groups describe|lag <group>", errUsage)
+	}
+
+	description, err := c.transport.DescribeGroup(ctx, args[1])
+	if err != nil {
+		return fmt.Errorf("failed to describe the group: %w", err)
+	}
+
+	switch args[0] {
+	case "describe":
+		return c.out.print(description, func(w io.Writer) {
+			fmt.Fprintf(w, "Group:\t%s\n", description.Group)
+			fmt.Fprintf(w, "Strategy:\t%s\n", description.Strategy)
+			fmt.Fprintf(w, "Generation:\t%d\n", description.Generation)
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "MEMBER\tPARTITIONS")
+
+			for _, member := range description.Members {
+				partitions := make([]string, 0, len(member.Partitions))
+				for _, p := range member.Partitions {
+					partitions = append(partitions, fmt.Sprint(p))
+				}
+
+				fmt.Fprintf(w, "%s\t%s\n", member.MemberID, strings.Join(partitions, ","))
+			}
+		})
+	case "lag":
+		return c.out.print(description.Partitions, func(w io.Writer) {
+			printLag(w, description.Partitions)
+		})
+	default:
+		return fmt.Errorf("%w: unknown groups command %q", errUsage, args[0])
+	}
+}
+
+func printLag(w io.Writer, partitions []client.PartitionLag) {
+	fmt.Fprintln(w, "PARTITION\tMEMBER\tCOMMITTED\tEND\tLAG")
+
+	for _, p := range partitions {
+		member, committed := p.MemberID, "-"
+
+		if member == "" {
+			member = "-"
+		}
+
+		if p.CommittedOffset != nil {
+			committed = fmt.Sprint(*p.CommittedOffset)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\n", p.Partition, member, committed, p.EndOffset, p.Lag)
+	}
+}
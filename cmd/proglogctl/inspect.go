@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/server"
+)
+
+// errCorruptFile is returned if the inspected file has invalid records.
+var errCorruptFile = fmt.Errorf("corrupt file")
+
+// Checksum statuses of inspected records.
+const (
+	checksumOK       = "ok"
+	checksumMismatch = "mismatch"
+	checksumInvalid  = "invalid" // the record is too short to hold a checksum
+)
+
+type inspectedFrame struct {
+	Position uint64 `json:"position"`
+	Size     uint64 `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+type inspectSummary struct {
+	Records       uint64  `json:"records"`
+	ValidRecords  uint64  `json:"valid_records"`
+	FileSize      uint64  `json:"file_size"`
+	ValidSize     uint64  `json:"valid_size"`
+	FirstBadFrame *uint64 `json:"first_bad_frame,omitempty"`
+	Problem       string  `json:"problem,omitempty"`
+}
+
+// inspect checks the frames and the checksums of a log store file without the
+// server. With -repair it writes the valid records before the first bad frame
+// to a new file, so the offsets of the kept records do not change.
+func (c *cli) inspect(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	repair := flags.String("repair", "", "write the valid records to a new file")
+	maxRecordSize := flags.Uint64("max-record-size", store.MaxRecordLength, "maximum record size of the file")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) // nolint:errorlint
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: inspect [-repair file] [-max-record-size n] <file>", errUsage)
+	}
+
+	file, err := os.Open(filepath.Clean(flags.Arg(0)))
+	if err != nil {
+		return fmt.Errorf("failed to open the file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	fileStat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read the file stat: %w", err)
+	}
+
+	summary := inspectSummary{
+		Records:       0,
+		ValidRecords:  0,
+		FileSize:      uint64(fileStat.Size()),
+		ValidSize:     0,
+		FirstBadFrame: nil,
+		Problem:       "",
+	}
+
+	var valid [][]byte
+
+	config := store.Config{MaxRecordLength: *maxRecordSize}
+	scanner := store.NewScannerWithConfig(file, config)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to inspect the file: %w", ctx.Err())
+		}
+
+		frame := scanner.Frame()
+		status := checksumStatus(frame.Record)
+
+		summary.Records++
+
+		if status == checksumOK {
+			summary.ValidRecords++
+
+			if summary.FirstBadFrame == nil {
+				summary.ValidSize = scanner.Position()
+				valid = append(valid, frame.Record)
+			}
+		} else if summary.FirstBadFrame == nil {
+			position := frame.Position
+			summary.FirstBadFrame = &position
+			summary.Problem = fmt.Sprintf("checksum %s at %d", status, position)
+		}
+
+		if err := c.printFrame(frame, status); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil && summary.FirstBadFrame == nil {
+		position := scanner.Position()
+		summary.FirstBadFrame = &position
+		summary.Problem = err.Error()
+	}
+
+	if err := c.printSummary(summary); err != nil {
+		return err
+	}
+
+	if *repair != "" {
+		if err := writeRepaired(*repair, valid, config); err != nil {
+			return err
+		}
+	}
+
+	if summary.FirstBadFrame != nil {
+		return fmt.Errorf("%w: %s", errCorruptFile, summary.Problem)
+	}
+
+	return nil
+}
+
+func checksumStatus(record []byte) string {
+	_, err := server.DecodeStoredRecord(record)
+
+	switch {
+	case err == nil:
+		return checksumOK
+	case errors.Is(err, server.ErrChecksumMismatch):
+		return checksumMismatch
+	default:
+		return checksumInvalid
+	}
+}
+
+func (c *cli) printFrame(frame store.Frame, status string) error {
+	f := inspectedFrame{
+		Position: frame.Position,
+		Size:     uint64(len(frame.Record)),
+		Checksum: status,
+	}
+
+	return c.out.print(f, func(w io.Writer) {
+		fmt.Fprintf(w, "position=%d\tsize=%d\tchecksum=%s\n", f.Position, f.Size, f.Checksum)
+	})
+}
+
+func (c *cli) printSummary(summary inspectSummary) error {
+	return c.out.print(summary, func(w io.Writer) {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Records:\t%d\n", summary.Records)
+		fmt.Fprintf(w, "Valid records:\t%d\n", summary.ValidRecords)
+		fmt.Fprintf(w, "File size:\t%d\n", summary.FileSize)
+		fmt.Fprintf(w, "Valid size:\t%d\n", summary.ValidSize)
+
+		if summary.FirstBadFrame != nil {
+			fmt.Fprintf(w, "First bad frame:\t%d\n", *summary.FirstBadFrame)
+			fmt.Fprintf(w, "Problem:\t%s\n", summary.Problem)
+		}
+	})
+}
+
+// writeRepaired writes the records to a new store file. It refuses to
+// overwrite an existing file.
+func writeRepaired(name string, records [][]byte, config store.Config) error {
+	file, err := os.OpenFile(
+		filepath.Clean(name),
+		os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_APPEND,
+		0600, // nolint:gomnd
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create the repaired file: %w", err)
+	}
+
+	s, err := store.NewWithConfig(file, config)
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to open the repaired store: %w", err)
+	}
+
+	for _, record := range records {
+		if _, _, err := s.Append(record); err != nil {
+			_ = s.Close()
+
+			return fmt.Errorf("failed to write the repaired record: %w", err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		return fmt.Errorf("failed to close the repaired store: %w", err)
+	}
+
+	return nil
+}
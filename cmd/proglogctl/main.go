@@ -0,0 +1,181 @@
+// Command proglogctl produces and consumes records, lists topics, inspects
+// consumer groups, reassigns followers, snapshots the log, and restores
+// snapshots and dumps, checks and repairs log store files offline.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/tlsconfig"
+)
+
+// Exit codes of the command.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitCorrupt  = 4
+)
+
+const usage = `Usage: proglogctl [flags] <command> [arguments]
+
+Commands:
+  produce [-file name] [value ...]    produce values, lines of the file or stdin
+  consume [-offset n] [-n count] [-f] [-max-staleness d]
+                                      consume records starting from the offset
+  tail [-offset n] [-max-staleness d] follow records starting from the offset
+  topics list                         list the topics and their offsets
+  topics create|delete <topic>        not supported: the server serves the
+                                      default topic only
+  groups describe <group>             describe members of the consumer group
+  groups lag <group>                  show the lag of the consumer group
+  reassign plan <replica,...>         show the followers added and removed
+  reassign execute [-throttle n] [-wait] <replica,...>
+                                      reassign the log to the followers
+  reassign status|cancel              show or cancel the reassignment
+  reassign throttle <bytes/s>         throttle followers catching up
+  snapshot <name>                     snapshot the log into the backup directory
+  restore <snapshot dir> <log dir>    verify a snapshot and restore it offline
+  dump [-max-record-size n] <file>    decode a log store file offline
+  inspect [-repair output] [-max-record-size n] <file>
+                                      check records of a log store file offline
+
+Flags:
+`
+
+// errUsage is returned if the command is called with wrong arguments.
+var errUsage = fmt.Errorf("wrong usage")
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+
+	cancel()
+	os.Exit(code)
+}
+
+// cli holds the global flags and the streams of the command.
+type cli struct {
+	transport *client.HTTPTransport
+	out       *printer
+	stdin     io.Reader
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("proglogctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	addr := flags.String("addr", "http://localhost:8080", "URL of the server")
+	output := flags.String("o", formatText, "output format: text or json")
+	tlsCA := flags.String("tls-ca", "", "path of the CA that verifies the server")
+	tlsCert := flags.String("tls-cert", "", "path of the client TLS certificate")
+	tlsKey := flags.String("tls-key", "", "path of the client TLS key")
+	token := flags.String("token", os.Getenv("PROGLOG_TOKEN"), "bearer token: an API key or a JWT")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 || (*output != formatText && *output != formatJSON) {
+		flags.Usage()
+
+		return exitUsage
+	}
+
+	httpClient, err := newHTTPClient(tlsconfig.ClientConfig{CAFile: *tlsCA, CertFile: *tlsCert, KeyFile: *tlsKey}, *token)
+	if err != nil {
+		fmt.Fprintln(stderr, "proglogctl:", err)
+
+		return exitUsage
+	}
+
+	c := &cli{
+		transport: client.NewHTTPTransport(*addr, httpClient),
+		out:       newPrinter(stdout, *output),
+		stdin:     stdin,
+	}
+
+	commands := map[string]func(context.Context, []string) error{
+		"produce":  c.produce,
+		"consume":  c.consume,
+		"tail":     c.tail,
+		"topics":   c.topics,
+		"groups":   c.groups,
+		"reassign": c.reassign,
+		"snapshot": c.snapshot,
+		"restore":  c.restore,
+		"dump":     c.dump,
+		"inspect":  c.inspect,
+	}
+
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+
+		return exitUsage
+	}
+
+	err = command(ctx, flags.Args()[1:])
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintln(stderr, "proglogctl:", err)
+
+	switch {
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	case errors.Is(err, client.ErrOffsetNotFound), errors.Is(err, client.ErrOffsetEvicted),
+		errors.Is(err, client.ErrGroupNotFound), errors.Is(err, client.ErrReassignmentNotFound):
+		return exitNotFound
+	case errors.Is(err, errCorruptFile):
+		return exitCorrupt
+	default:
+		return exitError
+	}
+}
+
+// newHTTPClient creates the HTTP client that uses the given TLS settings and
+// sends the bearer token, or the default client if there are none.
+func newHTTPClient(config tlsconfig.ClientConfig, token string) (*http.Client, error) {
+	if config == (tlsconfig.ClientConfig{}) && token == "" {
+		return nil, nil
+	}
+
+	var tlsConfig *tls.Config
+
+	if config != (tlsconfig.ClientConfig{}) {
+		var err error
+
+		tlsConfig, err = tlsconfig.NewClient(config)
+		if err != nil {
+			return nil, err // nolint:wrapcheck
+		}
+	}
+
+	return client.NewHTTPClient(tlsConfig, token), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Output formats.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// printer writes values as JSON lines or as human readable text.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{
+		w:      w,
+		format: format,
+	}
+}
+
+// print writes the value as a JSON line or writes the text produced by the
+// text function.
+func (p *printer) print(v interface{}, text func(w io.Writer)) error {
+	if p.format == formatJSON {
+		if err := json.NewEncoder(p.w).Encode(v); err != nil {
+			return fmt.Errorf("failed to write the output: %w", err)
+		}
+
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0) // nolint:gomnd
+	text(tw)
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the output: %w", err)
+	}
+
+	return nil
+}
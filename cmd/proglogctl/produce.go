@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ivanlemeshev/proglog/client"
+)
+
+type produced struct {
+	Offset uint64 `json:"offset"`
+}
+
+// produce writes the values given as arguments or the lines of the file or
+// stdin into the log and prints their offsets.
+func (c *cli) produce(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("produce", flag.ContinueOnError)
+	file := flags.String("file", "", "produce the lines of the file")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) // nolint:errorlint
+	}
+
+	if *file != "" && flags.NArg() > 0 {
+		return fmt.Errorf("%w: values and a file are given", errUsage)
+	}
+
+	producer, err := client.NewProducer(c.transport, client.ProducerConfig{})
+	if err != nil {
+		return fmt.Errorf("failed to create the producer: %w", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	// Callbacks are called in order by the sending goroutine, so the offsets
+	// are printed in the order of the values.
+	callback := func(offset uint64, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err == nil {
+			err = c.out.print(produced{Offset: offset}, func(w io.Writer) {
+				fmt.Fprintln(w, offset)
+			})
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	err = c.produceValues(ctx, producer, callback, *file, flags.Args())
+	if closeErr := producer.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close the producer: %w", closeErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	return firstErr
+}
+
+func (c *cli) produceValues(
+	ctx context.Context,
+	producer *client.Producer,
+	callback client.DeliveryCallback,
+	file string,
+	values []string,
+) error {
+	if len(values) > 0 {
+		for _, value := range values {
+			if err := producer.ProduceAsync([]byte(value), callback); err != nil {
+				return fmt.Errorf("failed to produce: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	r := c.stdin
+
+	if file != "" {
+		f, err := os.Open(filepath.Clean(file))
+		if err != nil {
+			return fmt.Errorf("failed to open the file: %w", err)
+		}
+		defer f.Close() // nolint:errcheck
+
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to produce: %w", ctx.Err())
+		}
+
+		// The scanner reuses its buffer, so the line is copied.
+		if err := producer.ProduceAsync([]byte(scanner.Text()), callback); err != nil {
+			return fmt.Errorf("failed to produce: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the input: %w", err)
+	}
+
+	return nil
+}
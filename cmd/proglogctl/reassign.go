@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+)
+
+// reassignPollInterval is the period of checking the progress of a
+// reassignment that is waited for.
+const reassignPollInterval = time.Second
+
+// reassign plans, executes and controls reassignments of the followers.
+func (c *cli) reassign(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: reassign plan|execute|status|throttle|cancel", errUsage)
+	}
+
+	switch args[0] {
+	case "plan":
+		if len(args) != 2 { // nolint:gomnd
+			return fmt.Errorf("%w: reassign plan <replica,...>", errUsage)
+		}
+
+		plan, err := c.transport.PlanReassignment(ctx, splitReplicas(args[1]))
+		if err != nil {
+			return fmt.Errorf("failed to plan the reassignment: %w", err)
+		}
+
+		return c.out.print(plan, func(w io.Writer) { printPlan(w, plan) })
+	case "execute":
+		return c.executeReassignment(ctx, args[1:])
+	case "status":
+		reassignment, err := c.transport.Reassignment(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe the reassignment: %w", err)
+		}
+
+		return c.printReassignment(reassignment)
+	case "throttle":
+		if len(args) != 2 { // nolint:gomnd
+			return fmt.Errorf("%w: reassign throttle <bytes per second>", errUsage)
+		}
+
+		throttle, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return fmt.Errorf("%w: the throttle %q: %v", errUsage, args[1], err) // nolint:errorlint
+		}
+
+		reassignment, err := c.transport.SetReassignmentThrottle(ctx, throttle)
+		if err != nil {
+			return fmt.Errorf("failed to throttle the reassignment: %w", err)
+		}
+
+		return c.printReassignment(reassignment)
+	case "cancel":
+		reassignment, err := c.transport.CancelReassignment(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to cancel the reassignment: %w", err)
+		}
+
+		return c.printReassignment(reassignment)
+	default:
+		return fmt.Errorf("%w: unknown reassign command %q", errUsage, args[0])
+	}
+}
+
+// executeReassignment starts the reassignment and, if asked to, waits until
+// it ends, printing its progress.
+func (c *cli) executeReassignment(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("execute", flag.ContinueOnError)
+	throttle := flags.Float64("throttle", 0, "bytes per second of catching up replicas, 0 for no limit")
+	wait := flags.Bool("wait", false, "wait until the reassignment ends")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) // nolint:errorlint
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: reassign execute [-throttle n] [-wait] <replica,...>", errUsage)
+	}
+
+	reassignment, err := c.transport.Reassign(ctx, splitReplicas(flags.Arg(0)), *throttle)
+	if err != nil {
+		return fmt.Errorf("failed to start the reassignment: %w", err)
+	}
+
+	for {
+		if err := c.printReassignment(reassignment); err != nil {
+			return err
+		}
+
+		if !*wait || reassignment.State != client.ReassignmentInProgress {
+			return nil
+		}
+
+		select {
+		case <-time.After(reassignPollInterval):
+		case <-ctx.Done():
+			// Interrupting the command stops waiting, not the reassignment.
+			return nil
+		}
+
+		reassignment, err = c.transport.Reassignment(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe the reassignment: %w", err)
+		}
+	}
+}
+
+func (c *cli) printReassignment(reassignment client.Reassignment) error {
+	return c.out.print(reassignment, func(w io.Writer) {
+		fmt.Fprintf(w, "State:\t%s\n", reassignment.State)
+		fmt.Fprintf(w, "Throttle:\t%s\n", formatThrottle(reassignment.ThrottleBytesPerSecond))
+		printPlan(w, reassignment.Plan)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "REPLICA\tROLE\tOFFSET\tLAG\tIN SYNC")
+
+		for _, r := range reassignment.Replicas {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%t\n", r.ID, r.Role, r.Offset, r.Lag, r.InSync)
+		}
+	})
+}
+
+func printPlan(w io.Writer, plan client.ReassignmentPlan) {
+	fmt.Fprintf(w, "Current:\t%s\n", formatReplicas(plan.Current))
+	fmt.Fprintf(w, "Target:\t%s\n", formatReplicas(plan.Target))
+	fmt.Fprintf(w, "Adding:\t%s\n", formatReplicas(plan.Adding))
+	fmt.Fprintf(w, "Removing:\t%s\n", formatReplicas(plan.Removing))
+}
+
+func formatReplicas(ids []string) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func formatThrottle(bytesPerSecond float64) string {
+	if bytesPerSecond == 0 {
+		return "none"
+	}
+
+	return strconv.FormatFloat(bytesPerSecond, 'f', -1, 64) + " B/s"
+}
+
+// splitReplicas splits the comma-separated replica IDs. An empty list
+// removes all followers.
+func splitReplicas(list string) []string {
+	ids := []string{}
+
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+)
+
+// snapshot snapshots the log into the named directory of the server's backup
+// directory.
+func (c *cli) snapshot(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: snapshot <name>", errUsage)
+	}
+
+	snapshot, err := c.transport.Snapshot(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to snapshot the log: %w", err)
+	}
+
+	return c.printSnapshot(snapshot)
+}
+
+// restore rebuilds a log directory from a snapshot without the server. The
+// files are verified against the manifest first, and a snapshot that does
+// not match is not restored.
+func (c *cli) restore(ctx context.Context, args []string) error {
+	if len(args) != 2 { // nolint:gomnd
+		return fmt.Errorf("%w: restore <snapshot dir> <log dir>", errUsage)
+	}
+
+	manifest, err := server.RestoreSnapshot(args[0], args[1])
+	if errors.Is(err, server.ErrInvalidSnapshot) {
+		return fmt.Errorf("%w: %v", errCorruptFile, err) // nolint:errorlint
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to restore the snapshot: %w", err)
+	}
+
+	snapshot := client.Snapshot{
+		Version:          manifest.Version,
+		CreatedAt:        manifest.CreatedAt,
+		LowestOffset:     manifest.LowestOffset,
+		EndOffset:        manifest.EndOffset,
+		LastStableOffset: manifest.LastStableOffset,
+		Files:            make([]client.SnapshotFile, 0, len(manifest.Files)),
+		TierSegments:     make([]client.SnapshotTierSegment, 0, len(manifest.TierSegments)),
+	}
+
+	for _, f := range manifest.Files {
+		snapshot.Files = append(snapshot.Files, client.SnapshotFile(f))
+	}
+
+	for _, s := range manifest.TierSegments {
+		snapshot.TierSegments = append(snapshot.TierSegments, client.SnapshotTierSegment{
+			BaseOffset: s.BaseOffset,
+			EndOffset:  s.EndOffset,
+			Key:        s.Key,
+		})
+	}
+
+	return c.printSnapshot(snapshot)
+}
+
+func (c *cli) printSnapshot(snapshot client.Snapshot) error {
+	return c.out.print(snapshot, func(w io.Writer) {
+		fmt.Fprintf(w, "Created:\t%s\n", snapshot.CreatedAt.Format(time.RFC3339))
+		fmt.Fprintf(w, "Offsets:\t%d-%d\n", snapshot.LowestOffset, snapshot.EndOffset)
+		fmt.Fprintf(w, "Last stable offset:\t%d\n", snapshot.LastStableOffset)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "FILE\tSIZE\tSHA256")
+
+		for _, f := range snapshot.Files {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", f.Name, f.Size, f.SHA256)
+		}
+
+		if len(snapshot.TierSegments) != 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "EVICTED\tKEY")
+
+			for _, s := range snapshot.TierSegments {
+				fmt.Fprintf(w, "%d-%d\t%s\n", s.BaseOffset, s.EndOffset, s.Key)
+			}
+		}
+	})
+}
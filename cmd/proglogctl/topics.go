@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// errTopicsNotSupported is returned by the topic commands that need a log
+// split into topics, which the server does not support yet.
+var errTopicsNotSupported = fmt.Errorf("the server serves the default topic only")
+
+// topics lists the topics of the log. Creating and deleting topics is
+// rejected until the server splits the log into topics.
+func (c *cli) topics(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: topics list|create|delete", errUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: topics list", errUsage)
+		}
+
+		topics, err := c.transport.Topics(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list the topics: %w", err)
+		}
+
+		return c.out.print(topics, func(w io.Writer) {
+			fmt.Fprintln(w, "TOPIC\tLOWEST\tEND\tLAST STABLE")
+
+			for _, topic := range topics {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", topic.Name, topic.LowestOffset, topic.EndOffset, topic.LastStableOffset)
+			}
+		})
+	case "create", "delete":
+		if len(args) != 2 { // nolint:gomnd
+			return fmt.Errorf("%w: topics %s <topic>", errUsage, args[0])
+		}
+
+		return fmt.Errorf("failed to %s the topic %q: %w", args[0], args[1], errTopicsNotSupported)
+	default:
+		return fmt.Errorf("%w: unknown topics command %q", errUsage, args[0])
+	}
+}
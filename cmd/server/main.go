@@ -1,13 +1,789 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/config"
+	"github.com/ivanlemeshev/proglog/internal/discovery"
+	"github.com/ivanlemeshev/proglog/internal/objstore"
+	"github.com/ivanlemeshev/proglog/internal/quota"
 	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/ivanlemeshev/proglog/internal/tlsconfig"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// Exit codes of the server.
+const (
+	exitOK     = 0 // the server was stopped by a signal and shut down cleanly
+	exitError  = 1 // the server failed or did not shut down cleanly
+	exitConfig = 2 // the configuration is invalid
+)
+
+// version is the version of the server. It is set on build with
+// -ldflags "-X main.version=...".
+// nolint:gochecknoglobals
+var version = "dev"
+
 func main() {
-	const addr = ":8080" // TODO: make the address configurable
-	srv := server.NewHTTPServer(addr)
-	log.Fatal(srv.ListenAndServe())
+	os.Exit(run())
+}
+
+func run() int {
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	if err != nil {
+		log.Println(err)
+
+		return exitConfig
+	}
+
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		log.Println(err)
+
+		return exitConfig
+	}
+
+	logger, err := newLogger(level)
+	if err != nil {
+		log.Println("Failed to create the logger:", err)
+
+		return exitError
+	}
+
+	defer logger.Sync() // nolint:errcheck
+
+	metrics := server.NewMetrics()
+
+	tracerProvider, shutdownTracing, err := newTracerProvider(cfg)
+	if err != nil {
+		logger.Error("Failed to create the tracer provider", zap.Error(err))
+
+		return exitError
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Failed to export spans", zap.Error(err))
+		}
+	}()
+
+	// The signals are caught before anything is opened, so a signal during a
+	// slow start, e.g. while the Raft log is replayed, does not kill the
+	// server before the log and the Raft node are closed. The server shuts
+	// down as soon as it is started.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	defer signal.Stop(signals)
+
+	// The configuration of the audit log, the access control lists, the
+	// tokens, the quotas and TLS is loaded before the log is opened, so a
+	// mistake there does not leave a log or a Raft node behind.
+	audit, err := openAuditLog(cfg, logger)
+	if err != nil {
+		logger.Error("Failed to open the audit log", zap.Error(err), zap.String("audit_dir", cfg.AuditDir))
+
+		return exitError
+	}
+
+	res := resources{audit: audit, log: nil, membership: nil, follower: nil, tier: nil}
+
+	authorizer, err := newAuthorizer(cfg, logger, audit)
+	if err != nil {
+		logger.Error("Failed to load the access control lists", zap.Error(err), zap.String("file", cfg.ACLFile))
+		res.close(logger)
+
+		return exitError
+	}
+
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		logger.Error("Failed to load the token keys", zap.Error(err))
+		res.close(logger)
+
+		return exitError
+	}
+
+	quotas, err := newQuotas(cfg)
+	if err != nil {
+		logger.Error("Failed to load the quotas", zap.Error(err), zap.String("file", cfg.QuotaFile))
+		res.close(logger)
+
+		return exitError
+	}
+
+	tlsConfig, err := newTLSConfig(cfg, authenticator != nil, logger)
+	if err != nil {
+		logger.Error("Failed to load TLS certificates", zap.Error(err))
+		res.close(logger)
+
+		return exitError
+	}
+
+	l, err := openLog(cfg, metrics, tracerProvider, logger)
+	if err != nil {
+		logger.Error("Failed to open the log", zap.Error(err), zap.String("data_dir", cfg.DataDir))
+		res.close(logger)
+
+		return exitError
+	}
+
+	res.log = l
+
+	membership, err := joinCluster(cfg, l, logger)
+	if err != nil {
+		logger.Error("Failed to join the cluster", zap.Error(err), zap.String("gossip_addr", cfg.GossipAddr))
+		res.close(logger)
+
+		return exitError
+	}
+
+	res.membership = membership
+
+	replicas := server.NewReplicas(l, server.ReplicasConfig{
+		LagMax:    cfg.ReplicaLagMax,
+		MinInSync: cfg.MinInSyncReplicas,
+	})
+
+	follower, err := startFollower(cfg, l, logger)
+	if err != nil {
+		logger.Error("Failed to follow the leader", zap.Error(err))
+		res.close(logger)
+
+		return exitError
+	}
+
+	res.follower = follower
+
+	tier, err := startTier(cfg, l, logger)
+	if err != nil {
+		logger.Error("Failed to start offloading the log", zap.Error(err))
+		res.close(logger)
+
+		return exitError
+	}
+
+	res.tier = tier
+
+	var cluster server.Cluster
+	if membership != nil {
+		cluster = clusterServers{membership: membership, log: l}
+	}
+
+	srv := server.NewHTTPServer(server.HTTPConfig{
+		Addr:                cfg.HTTPAddr,
+		Log:                 l,
+		GroupSessionTimeout: cfg.GroupSessionTimeout,
+		Metrics:             metrics,
+		TracerProvider:      tracerProvider,
+		Logger:              logger,
+		LogLevel:            &level,
+		Version:             version,
+		Settings:            cfg,
+		TraceRecordHeaders:  cfg.TraceRecordHeaders,
+		Authorizer:          authorizer,
+		Authenticator:       authenticator,
+		Audit:               audit,
+		Quotas:              quotas,
+		Replicas:            replicas,
+		Follower:            follower,
+		Cluster:             cluster,
+		Tier:                tier,
+		BackupDir:           cfg.BackupDir,
+	})
+
+	srv.TLSConfig = tlsConfig
+
+	logger.Info(
+		"Serving HTTP",
+		zap.String("addr", cfg.HTTPAddr),
+		zap.Bool("tls", cfg.TLSCertFile != ""),
+		zap.Bool("mtls", cfg.TLSClientCAFile != ""),
+	)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- serve(srv)
+	}()
+
+	grpcSrv, grpcServed, err := serveGRPC(cfg, server.GRPCConfig{
+		Log:                l,
+		Replicas:           replicas,
+		Metrics:            metrics,
+		TracerProvider:     tracerProvider,
+		Logger:             logger,
+		TraceRecordHeaders: cfg.TraceRecordHeaders,
+		Authorizer:         authorizer,
+		Authenticator:      authenticator,
+		Audit:              audit,
+		Quotas:             quotas,
+		Cluster:            cluster,
+	}, tlsConfig, logger)
+	if err != nil {
+		logger.Error("Failed to serve gRPC", zap.Error(err), zap.String("addr", cfg.GRPCAddr))
+
+		_ = srv.Close()
+		res.close(logger)
+
+		return exitError
+	}
+
+	code := exitOK
+
+	select {
+	case err := <-served:
+		logger.Error("Failed to serve HTTP", zap.Error(err))
+
+		code = exitError
+	case err := <-grpcServed:
+		logger.Error("Failed to serve gRPC", zap.Error(err))
+
+		code = exitError
+	case sig := <-signals:
+		logger.Info("Shutting down", zap.Stringer("signal", sig))
+
+		// Stop accepting connections and wait for in-flight requests. Long
+		// polls are stopped by the server.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Error("Failed to finish in-flight requests", zap.Error(err))
+
+			code = exitError
+		}
+
+		if grpcSrv != nil && !stopGRPC(ctx, grpcSrv) {
+			logger.Error("Failed to finish in-flight gRPC requests", zap.Error(ctx.Err()))
+
+			code = exitError
+		}
+
+		cancel()
+	}
+
+	if !res.close(logger) {
+		code = exitError
+	}
+
+	return code
+}
+
+// resources are the parts of the server that are stopped on shutdown. Parts
+// that are not started yet are nil.
+type resources struct {
+	audit      *server.AuditLog
+	log        *server.Log
+	membership *discovery.Membership
+	follower   *server.Follower
+	tier       *server.Tier
+}
+
+// close stops the started parts in the reverse order of starting them and
+// reports whether all of them stopped cleanly.
+func (r resources) close(logger *zap.Logger) bool {
+	ok := true
+
+	if r.follower != nil {
+		r.follower.Stop()
+	}
+
+	if r.tier != nil {
+		r.tier.Stop()
+	}
+
+	if r.membership != nil {
+		if err := r.membership.Leave(); err != nil {
+			logger.Error("Failed to leave the cluster", zap.Error(err))
+
+			ok = false
+		}
+	}
+
+	if r.log != nil {
+		if err := r.log.Close(); err != nil {
+			logger.Error("Failed to close the log", zap.Error(err))
+
+			ok = false
+		}
+	}
+
+	if r.audit != nil {
+		if err := r.audit.Close(); err != nil {
+			logger.Error("Failed to close the audit log", zap.Error(err))
+
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// newTLSConfig creates the TLS configuration of the server if the
+// certificate is set. Clients that authenticate with a bearer token need no
+// client certificate.
+func newTLSConfig(cfg config.Config, tokens bool, logger *zap.Logger) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	return tlsconfig.NewServer(tlsconfig.ServerConfig{ // nolint:wrapcheck
+		CertFile:           cfg.TLSCertFile,
+		KeyFile:            cfg.TLSKeyFile,
+		ClientCAFile:       cfg.TLSClientCAFile,
+		OptionalClientCert: tokens,
+		ReloadInterval:     0,
+		Logger:             logger,
+	})
+}
+
+// serveGRPC starts the gRPC server if its address is set. It returns the
+// server and the channel of the error it fails with, both nil if the address
+// is not set.
+func serveGRPC(
+	cfg config.Config,
+	grpcConfig server.GRPCConfig,
+	tlsConfig *tls.Config,
+	logger *zap.Logger,
+) (*grpc.Server, <-chan error, error) {
+	if cfg.GRPCAddr == "" {
+		return nil, nil, nil
+	}
+
+	listener, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := server.NewGRPCServer(grpcConfig, opts...)
+
+	logger.Info("Serving gRPC", zap.String("addr", cfg.GRPCAddr), zap.Bool("tls", tlsConfig != nil))
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- srv.Serve(listener)
+	}()
+
+	return srv, served, nil
+}
+
+// stopGRPC stops the gRPC server gracefully, and forcibly once the context
+// is done. It reports whether the in-flight requests finished.
+func stopGRPC(ctx context.Context, srv *grpc.Server) bool {
+	stopped := make(chan struct{})
+
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return true
+	case <-ctx.Done():
+		srv.Stop()
+
+		return false
+	}
+}
+
+// serve serves HTTP until the server is closed or fails. The certificates are
+// taken from the TLS configuration of the server, which reloads them.
+func serve(srv *http.Server) error {
+	var err error
+
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err // nolint:wrapcheck
+}
+
+// openLog opens the log in the data directory, the log replicated by Raft if
+// the Raft node is configured, or creates an in-memory log if the directory is
+// not set.
+func openLog(
+	cfg config.Config,
+	metrics *server.Metrics,
+	tracerProvider trace.TracerProvider,
+	logger *zap.Logger,
+) (*server.Log, error) {
+	if cfg.DataDir == "" {
+		return server.NewLog(), nil
+	}
+
+	logConfig := server.LogConfig{
+		MaxRecordSize:  cfg.MaxRecordSize,
+		SyncPolicy:     server.SyncPolicy(cfg.SyncPolicy),
+		SyncInterval:   cfg.SyncInterval,
+		Metrics:        metrics,
+		TracerProvider: tracerProvider,
+		Logger:         logger,
+		SegmentBytes:   cfg.TierSegmentBytes,
+	}
+
+	if cfg.RaftNodeID != "" {
+		return server.OpenReplicatedLog(cfg.DataDir, logConfig, raftConfig(cfg))
+	}
+
+	return server.OpenLog(cfg.DataDir, logConfig)
+}
+
+// raftConfig returns the Raft node settings of the configuration.
+func raftConfig(cfg config.Config) server.RaftConfig {
+	peers := make([]server.RaftPeer, 0, len(cfg.RaftPeers))
+
+	for _, peer := range cfg.RaftPeers {
+		id, addr, _ := config.RaftPeer(peer)
+		peers = append(peers, server.RaftPeer{ID: id, Addr: addr})
+	}
+
+	return server.RaftConfig{ // nolint:exhaustivestruct
+		NodeID: cfg.RaftNodeID,
+		Addr:   cfg.RaftAddr,
+		Peers:  peers,
+		Join:   len(peers) == 0 && len(cfg.GossipSeeds) != 0,
+	}
+}
+
+// startFollower starts replicating the leader's log if the server is a
+// follower. The follower verifies the leader with the replica CAs, presents
+// the server certificate and sends the replica token if they are configured.
+func startFollower(cfg config.Config, l *server.Log, logger *zap.Logger) (*server.Follower, error) {
+	if cfg.ReplicaOf == "" {
+		return nil, nil
+	}
+
+	tlsConfig, err := tlsconfig.NewClient(tlsconfig.ClientConfig{
+		CAFile:   cfg.ReplicaCAFile,
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+	})
+	if err != nil {
+		return nil, err // nolint:wrapcheck
+	}
+
+	var token string
+
+	if cfg.ReplicaTokenFile != "" {
+		data, err := ioutil.ReadFile(filepath.Clean(cfg.ReplicaTokenFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the replica token: %w", err)
+		}
+
+		token = strings.TrimSpace(string(data))
+	}
+
+	logger.Info("Following the leader", zap.String("leader", cfg.ReplicaOf), zap.String("replica_id", cfg.ReplicaID))
+
+	return server.StartFollower(l, server.FollowerConfig{
+		ReplicaID: cfg.ReplicaID,
+		LeaderURL: cfg.ReplicaOf,
+		Transport: client.NewHTTPTransport(cfg.ReplicaOf, client.NewHTTPClient(tlsConfig, token)),
+		MaxWait:   0,
+		MaxBytes:  0,
+		Backoff:   0,
+		Logger:    logger,
+	}), nil
+}
+
+// startTier starts uploading the sealed segments of the log to the object
+// store and evicting them locally beyond the local retention if one is
+// configured.
+func startTier(cfg config.Config, l *server.Log, logger *zap.Logger) (*server.Tier, error) {
+	var store objstore.Store
+
+	switch {
+	case cfg.TierDir != "":
+		fileStore, err := objstore.NewFileStore(cfg.TierDir)
+		if err != nil {
+			return nil, err // nolint:wrapcheck
+		}
+
+		store = fileStore
+	case cfg.TierS3Endpoint != "":
+		s3Store, err := objstore.NewS3Store(objstore.S3Config{
+			Endpoint:        cfg.TierS3Endpoint,
+			Bucket:          cfg.TierS3Bucket,
+			Region:          cfg.TierS3Region,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			HTTPClient:      nil,
+		})
+		if err != nil {
+			return nil, err // nolint:wrapcheck
+		}
+
+		store = s3Store
+	default:
+		return nil, nil
+	}
+
+	logger.Info("Offloading the log", zap.String("tier_dir", cfg.TierDir),
+		zap.String("tier_s3_endpoint", cfg.TierS3Endpoint), zap.String("tier_s3_bucket", cfg.TierS3Bucket))
+
+	return server.StartTier(l, server.TierConfig{ // nolint:wrapcheck
+		Store:               store,
+		LocalRetentionBytes: cfg.TierLocalRetentionBytes,
+		CacheBytes:          cfg.TierCacheBytes,
+		Interval:            cfg.TierInterval,
+		ReadTimeout:         0,
+		Logger:              logger,
+	})
+}
+
+// joinCluster starts discovering the members of the Raft cluster by gossip if
+// the gossip address is configured.
+func joinCluster(cfg config.Config, l *server.Log, logger *zap.Logger) (*discovery.Membership, error) {
+	if cfg.GossipAddr == "" {
+		return nil, nil
+	}
+
+	tags := map[string]string{discovery.RPCAddrTag: cfg.RaftAddr}
+	if cfg.Rack != "" {
+		tags[discovery.RackTag] = cfg.Rack
+	}
+
+	if cfg.AdvertiseURL != "" {
+		tags[discovery.HTTPURLTag] = cfg.AdvertiseURL
+	}
+
+	if cfg.AdvertiseGRPCAddr != "" {
+		tags[discovery.GRPCAddrTag] = cfg.AdvertiseGRPCAddr
+	}
+
+	return discovery.New(raftMembers{log: l}, discovery.Config{ // nolint:wrapcheck
+		NodeName:          cfg.RaftNodeID,
+		BindAddr:          cfg.GossipAddr,
+		Tags:              tags,
+		SeedAddrs:         cfg.GossipSeeds,
+		ReconcileInterval: 0,
+		Logger:            logger,
+	})
+}
+
+// raftMembers adds and removes the Raft voters of the discovered members.
+// Only the leader changes the membership, so the other nodes ignore the
+// events.
+type raftMembers struct {
+	log *server.Log
+}
+
+func (m raftMembers) Join(name, rpcAddr string) error {
+	if err := m.log.Join(name, rpcAddr); err != nil && !errors.Is(err, server.ErrNotLeader) {
+		return err // nolint:wrapcheck
+	}
+
+	return nil
+}
+
+func (m raftMembers) Leave(name string) error {
+	if err := m.log.Leave(name); err != nil && !errors.Is(err, server.ErrNotLeader) {
+		return err // nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// clusterServers lists the alive members that advertise their URL or gRPC
+// address to clients. The member at the Raft address of the leader is the leader.
+type clusterServers struct {
+	membership *discovery.Membership
+	log        *server.Log
+}
+
+func (c clusterServers) Servers() []server.ClusterServer {
+	leaderAddr := c.log.LeaderAddr()
+
+	var servers []server.ClusterServer
+
+	for _, member := range c.membership.Members() {
+		url := member.Tags[discovery.HTTPURLTag]
+		grpcAddr := member.Tags[discovery.GRPCAddrTag]
+
+		if member.Status != "alive" || (url == "" && grpcAddr == "") {
+			continue
+		}
+
+		servers = append(servers, server.ClusterServer{
+			ID:       member.Name,
+			URL:      url,
+			GRPCAddr: grpcAddr,
+			Leader:   leaderAddr != "" && member.Tags[discovery.RPCAddrTag] == leaderAddr,
+		})
+	}
+
+	return servers
+}
+
+// openAuditLog opens the audit log if its directory is configured.
+func openAuditLog(cfg config.Config, logger *zap.Logger) (*server.AuditLog, error) {
+	if cfg.AuditDir == "" {
+		return nil, nil
+	}
+
+	return server.OpenAuditLog(server.AuditConfig{ // nolint:wrapcheck
+		Dir:       cfg.AuditDir,
+		Retention: cfg.AuditRetention,
+		Consume:   cfg.AuditConsume,
+		Log:       server.LogConfig{Logger: logger}, // nolint:exhaustivestruct
+	})
+}
+
+// newAuthorizer loads the access control lists if they are configured and
+// reloads them on SIGHUP. The current lists are kept if the reload fails.
+// Reloads are recorded in the audit log if it is not nil.
+func newAuthorizer(cfg config.Config, logger *zap.Logger, audit *server.AuditLog) (*auth.Authorizer, error) {
+	if cfg.ACLFile == "" {
+		return nil, nil
+	}
+
+	authorizer, err := auth.NewAuthorizer(cfg.ACLFile)
+	if err != nil {
+		return nil, err // nolint:wrapcheck
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	go func() {
+		for range hangups {
+			event := server.AuditEvent{ // nolint:exhaustivestruct
+				Principal: "system",
+				Action:    server.AuditACLReload,
+				Resource:  cfg.ACLFile,
+				Outcome:   server.AuditSuccess,
+			}
+
+			if err := authorizer.Reload(); err != nil {
+				logger.Error("Failed to reload the access control lists", zap.Error(err))
+
+				event.Outcome = server.AuditFailure
+				event.Details = map[string]string{"error": err.Error()}
+			} else {
+				logger.Info("Reloaded the access control lists", zap.String("file", cfg.ACLFile))
+			}
+
+			if audit != nil {
+				if err := audit.Record(event); err != nil {
+					logger.Error("Failed to record the audit event", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return authorizer, nil
+}
+
+// newAuthenticator loads the API keys and the JWKS if they are configured.
+// Bearer tokens are not accepted if neither is configured.
+func newAuthenticator(cfg config.Config) (*auth.Authenticator, error) {
+	if cfg.APIKeysFile == "" && cfg.JWKSFile == "" {
+		return nil, nil
+	}
+
+	var (
+		apiKeys *auth.APIKeys
+		jwt     *auth.JWTVerifier
+		err     error
+	)
+
+	if cfg.APIKeysFile != "" {
+		if apiKeys, err = auth.LoadAPIKeys(cfg.APIKeysFile); err != nil {
+			return nil, err // nolint:wrapcheck
+		}
+	}
+
+	if cfg.JWKSFile != "" {
+		jwt, err = auth.NewJWTVerifier(auth.JWTConfig{
+			JWKSFile: cfg.JWKSFile,
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+			Leeway:   0,
+		})
+		if err != nil {
+			return nil, err // nolint:wrapcheck
+		}
+	}
+
+	return auth.NewAuthenticator(apiKeys, jwt), nil
+}
+
+// newQuotas loads the quotas if they are configured.
+func newQuotas(cfg config.Config) (*quota.Manager, error) {
+	if cfg.QuotaFile == "" {
+		return nil, nil
+	}
+
+	quotas, err := quota.Load(cfg.QuotaFile)
+	if err != nil {
+		return nil, err // nolint:wrapcheck
+	}
+
+	return quota.NewManager(quotas), nil
+}
+
+// newLogger creates the JSON logger with the level that can be changed at
+// runtime.
+func newLogger(level zap.AtomicLevel) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	config.Level = level
+
+	return config.Build() // nolint:wrapcheck
+}
+
+// newTracerProvider creates the tracer provider that exports spans to the
+// configured exporter and the function that exports the remaining spans on
+// shutdown. Spans are not recorded if there is no exporter.
+func newTracerProvider(cfg config.Config) (trace.TracerProvider, func(context.Context) error, error) {
+	if cfg.TraceExporter != config.TraceExporterStdout {
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := stdouttrace.New()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create the stdout exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+
+	return provider, provider.Shutdown, nil
 }
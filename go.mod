@@ -4,7 +4,17 @@ go 1.15
 
 require (
 	github.com/gorilla/mux v1.8.0
+	github.com/hashicorp/raft v1.3.1
+	github.com/hashicorp/serf v0.9.5
+	github.com/prometheus/client_golang v1.11.0
 	github.com/steinfletcher/apitest v1.5.4
 	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	go.uber.org/zap v1.19.1
+	google.golang.org/grpc v1.38.0
 	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
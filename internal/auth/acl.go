@@ -0,0 +1,176 @@
+// Package auth authenticates clients and authorizes their actions on topics
+// with access control lists.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrPermissionDenied is returned if the principal is not allowed to
+	// perform the action on the topic.
+	ErrPermissionDenied = fmt.Errorf("permission denied")
+
+	// ErrInvalidPolicy is returned if the policy file cannot be parsed or has
+	// wrong rules.
+	ErrInvalidPolicy = fmt.Errorf("invalid policy")
+)
+
+// Action is an action on a topic.
+type Action string
+
+// Actions on topics. Replicate lets followers fetch the persisted records,
+// including aborted ones and control markers, and join the in-sync replicas.
+const (
+	ActionProduce   Action = "produce"
+	ActionConsume   Action = "consume"
+	ActionAdmin     Action = "admin"
+	ActionReplicate Action = "replicate"
+)
+
+// Anonymous is the principal of clients that are not authenticated.
+const Anonymous = "anonymous"
+
+// Rule allows the principals to perform the actions on the topics. Principals
+// and topics are shell patterns, so "*" matches all of them including
+// Anonymous.
+type Rule struct {
+	Principals []string `yaml:"principals"`
+	Topics     []string `yaml:"topics"`
+	Actions    []Action `yaml:"actions"`
+}
+
+// Policy is a list of rules. Everything that no rule allows is denied.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadPolicy reads the policy from the YAML file.
+func LoadPolicy(name string) (*Policy, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the policy file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPolicy, name, err) // nolint:errorlint
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPolicy, name, err) // nolint:errorlint
+	}
+
+	return &policy, nil
+}
+
+func (p *Policy) validate() error {
+	for i, rule := range p.Rules {
+		for _, pattern := range append(append([]string{}, rule.Principals...), rule.Topics...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: pattern %q: %w", i, pattern, err)
+			}
+		}
+
+		for _, action := range rule.Actions {
+			switch action {
+			case ActionProduce, ActionConsume, ActionAdmin, ActionReplicate:
+			default:
+				return fmt.Errorf("rule %d: unknown action %q", i, action) // nolint:goerr113
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allowed reports whether a rule allows the principal to perform the action
+// on the topic.
+func (p *Policy) Allowed(principal, topic string, action Action) bool {
+	for _, rule := range p.Rules {
+		if matchAny(rule.Principals, principal) && matchAny(rule.Topics, topic) && containsAction(rule.Actions, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// The patterns are checked when the policy is loaded.
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorizer authorizes actions with the policy loaded from a file. The policy
+// can be reloaded while the authorizer is used.
+type Authorizer struct {
+	file   string
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// NewAuthorizer creates an authorizer with the policy of the file.
+func NewAuthorizer(file string) (*Authorizer, error) {
+	policy, err := LoadPolicy(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authorizer{file: file, mu: sync.RWMutex{}, policy: policy}, nil
+}
+
+// Reload reads the policy file again. The current policy is kept if the file
+// cannot be loaded.
+func (a *Authorizer) Reload() error {
+	policy, err := LoadPolicy(a.file)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.policy = policy
+	a.mu.Unlock()
+
+	return nil
+}
+
+// Authorize returns ErrPermissionDenied if the principal is not allowed to
+// perform the action on the topic.
+func (a *Authorizer) Authorize(principal, topic string, action Action) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if !a.policy.Allowed(principal, topic, action) {
+		return fmt.Errorf("%w: %s cannot %s topic %s", ErrPermissionDenied, principal, action, topic)
+	}
+
+	return nil
+}
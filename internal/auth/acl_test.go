@@ -0,0 +1,143 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+const policy = `
+rules:
+  - principals: [producer]
+    topics: [orders]
+    actions: [produce]
+  - principals: ["*"]
+    topics: ["orders*"]
+    actions: [consume]
+  - principals: [admin]
+    topics: ["*"]
+    actions: [produce, consume, admin]
+  - principals: [replica-*]
+    topics: ["*"]
+    actions: [replicate]
+`
+
+func writePolicy(t *testing.T, name, content string) {
+	t.Helper()
+
+	err := ioutil.WriteFile(name, []byte(content), 0600)
+	assert.Nil(t, err)
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "acl.yaml")
+	writePolicy(t, name, policy)
+
+	p, err := auth.LoadPolicy(name)
+	assert.Nil(t, err)
+
+	tt := []struct {
+		principal string
+		topic     string
+		action    auth.Action
+		allowed   bool
+	}{
+		{principal: "producer", topic: "orders", action: auth.ActionProduce, allowed: true},
+		{principal: "producer", topic: "payments", action: auth.ActionProduce, allowed: false},
+		{principal: "producer", topic: "orders-eu", action: auth.ActionConsume, allowed: true},
+		{principal: auth.Anonymous, topic: "orders", action: auth.ActionConsume, allowed: true},
+		{principal: auth.Anonymous, topic: "orders", action: auth.ActionProduce, allowed: false},
+		{principal: "producer", topic: "orders", action: auth.ActionAdmin, allowed: false},
+		{principal: "admin", topic: "payments", action: auth.ActionAdmin, allowed: true},
+		{principal: "replica-1", topic: "orders", action: auth.ActionReplicate, allowed: true},
+		{principal: "replica-1", topic: "orders", action: auth.ActionConsume, allowed: true},
+		{principal: "producer", topic: "orders", action: auth.ActionReplicate, allowed: false},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.allowed, p.Allowed(tc.principal, tc.topic, tc.action),
+			"%s %s %s", tc.principal, tc.action, tc.topic)
+	}
+}
+
+func TestLoadPolicy_Errors(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name    string
+		content string
+	}{
+		{name: "unknown field", content: "rules:\n  - principal: [a]\n"},
+		{name: "unknown action", content: "rules:\n  - principals: [a]\n    topics: [b]\n    actions: [delete]\n"},
+		{name: "bad pattern", content: "rules:\n  - principals: [\"[a\"]\n    topics: [b]\n    actions: [produce]\n"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := filepath.Join(t.TempDir(), "acl.yaml")
+			writePolicy(t, name, tc.content)
+
+			_, err := auth.LoadPolicy(name)
+			assert.ErrorIs(t, err, auth.ErrInvalidPolicy)
+		})
+	}
+}
+
+func TestAuthorizer_Reload(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "acl.yaml")
+	writePolicy(t, name, policy)
+
+	a, err := auth.NewAuthorizer(name)
+	assert.Nil(t, err)
+
+	err = a.Authorize("producer", "payments", auth.ActionProduce)
+	assert.ErrorIs(t, err, auth.ErrPermissionDenied)
+
+	writePolicy(t, name, policy+"  - principals: [producer]\n    topics: [payments]\n    actions: [produce]\n")
+
+	err = a.Reload()
+	assert.Nil(t, err)
+
+	err = a.Authorize("producer", "payments", auth.ActionProduce)
+	assert.Nil(t, err)
+
+	// A broken file keeps the current policy.
+	writePolicy(t, name, "rules: [")
+
+	err = a.Reload()
+	assert.ErrorIs(t, err, auth.ErrInvalidPolicy)
+
+	err = a.Authorize("producer", "payments", auth.ActionProduce)
+	assert.Nil(t, err)
+}
+
+func TestCertificatePrincipal(t *testing.T) {
+	t.Parallel()
+
+	_, ok := auth.CertificatePrincipal(nil)
+	assert.False(t, ok)
+
+	_, ok = auth.CertificatePrincipal(&tls.ConnectionState{}) // nolint:exhaustivestruct
+	assert.False(t, ok)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "producer"}}        // nolint:exhaustivestruct
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}} // nolint:exhaustivestruct
+
+	principal, ok := auth.CertificatePrincipal(state)
+	assert.True(t, ok)
+	assert.Equal(t, "producer", principal)
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrInvalidToken is returned if a bearer token is not a known API key or
+	// a valid JWT.
+	ErrInvalidToken = fmt.Errorf("invalid token")
+
+	// ErrInvalidKeyFile is returned if the API key file or the JWKS file
+	// cannot be parsed.
+	ErrInvalidKeyFile = fmt.Errorf("invalid key file")
+)
+
+// APIKey is the SHA-256 hash of a static API key and its principal. Keys are
+// stored hashed, so the file does not leak them.
+type APIKey struct {
+	Principal string `yaml:"principal"`
+	SHA256    string `yaml:"sha256"`
+}
+
+// APIKeys authenticates clients by static API keys.
+type APIKeys struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	principal string
+	hash      []byte
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash of the key as it is stored
+// in the API key file.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// LoadAPIKeys reads the API keys from the YAML file.
+func LoadAPIKeys(name string) (*APIKeys, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the API key file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	var content struct {
+		Keys []APIKey `yaml:"keys"`
+	}
+
+	if err := decoder.Decode(&content); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKeyFile, name, err) // nolint:errorlint
+	}
+
+	keys := make([]apiKey, 0, len(content.Keys))
+
+	for i, key := range content.Keys {
+		hash, err := hex.DecodeString(key.SHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%w: %s: key %d: the hash is not a hex SHA-256", ErrInvalidKeyFile, name, i)
+		}
+
+		if key.Principal == "" {
+			return nil, fmt.Errorf("%w: %s: key %d: the principal is empty", ErrInvalidKeyFile, name, i)
+		}
+
+		keys = append(keys, apiKey{principal: key.Principal, hash: hash})
+	}
+
+	return &APIKeys{keys: keys}, nil
+}
+
+// Principal returns the principal of the API key or ErrInvalidToken if the
+// key is unknown.
+func (k *APIKeys) Principal(key string) (string, error) {
+	hash := sha256.Sum256([]byte(key))
+
+	for _, known := range k.keys {
+		if subtle.ConstantTimeCompare(hash[:], known.hash) == 1 {
+			return known.principal, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: unknown API key", ErrInvalidToken)
+}
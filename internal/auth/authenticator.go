@@ -0,0 +1,30 @@
+package auth
+
+import "fmt"
+
+// Authenticator resolves the principals of bearer tokens, which are static
+// API keys or JWTs.
+type Authenticator struct {
+	apiKeys *APIKeys
+	jwt     *JWTVerifier
+}
+
+// NewAuthenticator creates an authenticator. Any of the API keys and the JWT
+// verifier can be nil, then such tokens are rejected.
+func NewAuthenticator(apiKeys *APIKeys, jwt *JWTVerifier) *Authenticator {
+	return &Authenticator{apiKeys: apiKeys, jwt: jwt}
+}
+
+// Authenticate returns the principal of the token. Tokens of the JWT form are
+// verified as JWTs, other tokens are looked up in the API keys.
+func (a *Authenticator) Authenticate(token string) (string, error) {
+	if a.jwt != nil && LooksLikeJWT(token) {
+		return a.jwt.Verify(token)
+	}
+
+	if a.apiKeys != nil {
+		return a.apiKeys.Principal(token)
+	}
+
+	return "", fmt.Errorf("%w: unsupported token", ErrInvalidToken)
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Register the hashes of the supported algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// DefaultJWTLeeway is the allowed clock skew for the expiry and not before
+// checks.
+const DefaultJWTLeeway = time.Minute
+
+// JWTConfig configures the verification of JWTs.
+type JWTConfig struct {
+	// JWKSFile is the path of the JSON Web Key Set with the public keys that
+	// sign the tokens. RSA and EC keys are supported.
+	JWKSFile string
+
+	// Issuer and Audience are the required iss and aud claims. They are not
+	// checked if they are empty.
+	Issuer   string
+	Audience string
+
+	// Leeway is the allowed clock skew. DefaultJWTLeeway is used if it is
+	// zero.
+	Leeway time.Duration
+}
+
+// JWTVerifier verifies JWTs signed with RS256, RS384, RS512, ES256, ES384
+// or ES512. The subject of a valid token is its principal.
+type JWTVerifier struct {
+	keys     map[string]crypto.PublicKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// signingAlgorithm is a JWT signing algorithm.
+type signingAlgorithm struct {
+	hash crypto.Hash
+	kty  string
+}
+
+// nolint:gochecknoglobals
+var signingAlgorithms = map[string]signingAlgorithm{
+	"RS256": {hash: crypto.SHA256, kty: "RSA"},
+	"RS384": {hash: crypto.SHA384, kty: "RSA"},
+	"RS512": {hash: crypto.SHA512, kty: "RSA"},
+	"ES256": {hash: crypto.SHA256, kty: "EC"},
+	"ES384": {hash: crypto.SHA384, kty: "EC"},
+	"ES512": {hash: crypto.SHA512, kty: "EC"},
+}
+
+// jsonWebKey is a public key of a JSON Web Key Set.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWTVerifier creates a verifier with the keys of the JWKS file.
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	keys, err := loadJWKS(config.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Leeway == 0 {
+		config.Leeway = DefaultJWTLeeway
+	}
+
+	return &JWTVerifier{
+		keys:     keys,
+		issuer:   config.Issuer,
+		audience: config.Audience,
+		leeway:   config.Leeway,
+	}, nil
+}
+
+func loadJWKS(name string) (map[string]crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKeyFile, name, err) // nolint:errorlint
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for i, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: key %d: %v", ErrInvalidKeyFile, name, i, err) // nolint:errorlint
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("the exponent is too big") // nolint:goerr113
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", k.Crv) // nolint:goerr113
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("the point is not on the curve") // nolint:goerr113
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unknown key type %q", k.Kty) // nolint:goerr113
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer %q", s) // nolint:goerr113
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// jwtHeader is the JOSE header of a JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims are the registered claims of a JWT checked by the verifier.
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+}
+
+// audience is the aud claim, which is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err // nolint:wrapcheck
+	}
+
+	*a = many
+
+	return nil
+}
+
+// LooksLikeJWT reports whether the token has the three parts of a JWT.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 // nolint:gomnd
+}
+
+// Verify checks the signature, the issuer, the audience and the expiry of the
+// token and returns its subject. An expiry is required.
+func (v *JWTVerifier) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 { // nolint:gomnd
+		return "", fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", err
+	}
+
+	if err := v.verifySignature(header, parts[0]+"."+parts[1], parts[2]); err != nil {
+		return "", err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", err
+	}
+
+	if err := v.checkClaims(claims); err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed JWT segment", ErrInvalidToken)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed JWT segment", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed, signature string) error {
+	algorithm, ok := signingAlgorithms[header.Alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	key, ok := v.keys[header.Kid]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidToken, header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	hasher := algorithm.hash.New()
+	_, _ = hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if algorithm.kty != "RSA" || rsa.VerifyPKCS1v15(key, algorithm.hash, digest, sig) != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8 // nolint:gomnd
+		if algorithm.kty != "EC" || len(sig) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	}
+
+	return nil
+}
+
+func (v *JWTVerifier) checkClaims(claims jwtClaims) error {
+	now := time.Now()
+
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	}
+
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(v.leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: wrong issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+
+	if v.audience != "" && !containsString(claims.Audience, v.audience) {
+		return fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	}
+
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context with the principal.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of the context or Anonymous if
+// the context has none.
+func PrincipalFromContext(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok {
+		return principal
+	}
+
+	return Anonymous
+}
+
+// CertificatePrincipal returns the common name of the verified client
+// certificate of the connection. It returns false if the client has not
+// presented a verified certificate.
+func CertificatePrincipal(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	name := state.VerifiedChains[0][0].Subject.CommonName
+
+	return name, name != ""
+}
@@ -0,0 +1,215 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	assert.Nil(t, err)
+
+	return encode(data)
+}
+
+// signJWT signs the claims with RS256 if the key is an RSA key and with ES256
+// if it is an EC key.
+func signJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+
+	signed := encodeJSON(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeJSON(t, claims)
+	digest := crypto.SHA256.New()
+	_, _ = digest.Write([]byte(signed))
+
+	var signature []byte
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+		assert.Nil(t, err)
+
+		signature = sig
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest.Sum(nil))
+		assert.Nil(t, err)
+
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signed + "." + encode(signature)
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"n":   encode(rsaKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   encode(ecKey.X.Bytes()),
+				"y":   encode(ecKey.Y.Bytes()),
+			},
+		},
+	}
+
+	data, err := json.Marshal(jwks)
+	assert.Nil(t, err)
+
+	name := filepath.Join(t.TempDir(), "jwks.json")
+	err = ioutil.WriteFile(name, data, 0600)
+	assert.Nil(t, err)
+
+	return name
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	verifier, err := auth.NewJWTVerifier(auth.JWTConfig{
+		JWKSFile: writeJWKS(t, rsaKey, ecKey),
+		Issuer:   "https://issuer.example",
+		Audience: "proglog",
+	})
+	assert.Nil(t, err)
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": "https://issuer.example",
+			"aud": []string{"other", "proglog"},
+			"sub": "service-a",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+
+		return c
+	}
+
+	tt := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "RSA", token: signJWT(t, rsaKey, "rsa", claims(nil)), valid: true},
+		{name: "EC", token: signJWT(t, ecKey, "ec", claims(nil)), valid: true},
+		{name: "audience string", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"aud": "proglog"})), valid: true},
+		{name: "unknown key", token: signJWT(t, ecKey, "other", claims(nil))},
+		{name: "wrong key", token: signJWT(t, otherKey, "ec", claims(nil))},
+		{name: "algorithm of another key type", token: signJWT(t, ecKey, "rsa", claims(nil))},
+		{name: "expired", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}))},
+		{name: "no expiry", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"exp": nil}))},
+		{name: "not valid yet", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()}))},
+		{name: "wrong issuer", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"iss": "someone"}))},
+		{name: "wrong audience", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"aud": "other"}))},
+		{name: "no subject", token: signJWT(t, ecKey, "ec", claims(map[string]interface{}{"sub": nil}))},
+		{name: "malformed", token: "a.b.c"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			principal, err := verifier.Verify(tc.token)
+			if tc.valid {
+				assert.Nil(t, err)
+				assert.Equal(t, "service-a", principal)
+			} else {
+				assert.ErrorIs(t, err, auth.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "keys.yaml")
+	content := "keys:\n  - principal: ci\n    sha256: " + auth.HashAPIKey("secret") + "\n"
+
+	err := ioutil.WriteFile(name, []byte(content), 0600)
+	assert.Nil(t, err)
+
+	apiKeys, err := auth.LoadAPIKeys(name)
+	assert.Nil(t, err)
+
+	authenticator := auth.NewAuthenticator(apiKeys, nil)
+
+	principal, err := authenticator.Authenticate("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", principal)
+
+	_, err = authenticator.Authenticate("guess")
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = auth.NewAuthenticator(nil, nil).Authenticate("secret")
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestLoadAPIKeys_Errors(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		"keys:\n  - principal: ci\n    sha256: plain\n",
+		"keys:\n  - sha256: " + auth.HashAPIKey("secret") + "\n",
+		"keys:\n  - principal: ci\n    key: secret\n",
+	} {
+		name := filepath.Join(t.TempDir(), "keys.yaml")
+
+		err := ioutil.WriteFile(name, []byte(content), 0600)
+		assert.Nil(t, err)
+
+		_, err = auth.LoadAPIKeys(name)
+		assert.ErrorIs(t, err, auth.ErrInvalidKeyFile)
+	}
+}
@@ -0,0 +1,1039 @@
+// Package config loads the server configuration from a file, environment
+// variables and command-line flags.
+//
+// Settings are applied in the following order, so a later source overrides an
+// earlier one: defaults, the YAML file, PROGLOG_* environment variables and
+// flags set explicitly on the command line.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned if a setting cannot be parsed or has a wrong
+// value.
+var ErrInvalidConfig = fmt.Errorf("invalid configuration")
+
+// envPrefix is the prefix of environment variables with settings.
+const envPrefix = "PROGLOG_"
+
+// fileSetting is the name of the flag and the environment variable, without
+// the prefix, with the path of the configuration file.
+const fileSetting = "config"
+
+// Sync policies of the log.
+const (
+	SyncAlways   = "always"
+	SyncInterval = "interval"
+	SyncNever    = "never"
+)
+
+// Log levels of the server.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Config is the server configuration. It is encoded as JSON in the status of
+// the server.
+type Config struct {
+	// HTTPAddr is the address the HTTP server listens on.
+	HTTPAddr string `yaml:"http_addr" json:"http_addr"`
+
+	// GRPCAddr is the address the gRPC server listens on. The gRPC server is
+	// not started if it is empty.
+	GRPCAddr string `yaml:"grpc_addr" json:"grpc_addr"`
+
+	// DataDir is the directory of the log files. The log is kept in memory if
+	// it is empty.
+	DataDir string `yaml:"data_dir" json:"data_dir"`
+
+	// MaxRecordSize is the maximum size of a persisted record.
+	MaxRecordSize uint64 `yaml:"max_record_size" json:"max_record_size"`
+
+	// SyncPolicy defines when the records are committed to stable storage:
+	// always, interval or never.
+	SyncPolicy string `yaml:"sync_policy" json:"sync_policy"`
+
+	// SyncInterval is the period of commits for the interval sync policy.
+	SyncInterval time.Duration `yaml:"sync_interval" json:"sync_interval"`
+
+	// TLSCertFile and TLSKeyFile are the paths of the server certificate and
+	// its key. The server uses plain HTTP if they are empty.
+	TLSCertFile string `yaml:"tls_cert_file" json:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file" json:"tls_key_file"`
+
+	// TLSClientCAFile is the path of the CA certificates that verify client
+	// certificates. Clients must present a certificate if it is set, unless
+	// they can authenticate with a bearer token.
+	TLSClientCAFile string `yaml:"tls_client_ca_file" json:"tls_client_ca_file"`
+
+	// ACLFile is the path of the access control lists. All requests are
+	// allowed if it is empty.
+	ACLFile string `yaml:"acl_file" json:"acl_file"`
+
+	// APIKeysFile is the path of the hashed API keys accepted as bearer
+	// tokens.
+	APIKeysFile string `yaml:"api_keys_file" json:"api_keys_file"`
+
+	// JWKSFile is the path of the JSON Web Key Set that verifies JWTs
+	// accepted as bearer tokens. JWTIssuer and JWTAudience are the required
+	// iss and aud claims, they are not checked if they are empty.
+	JWKSFile    string `yaml:"jwks_file" json:"jwks_file"`
+	JWTIssuer   string `yaml:"jwt_issuer" json:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience" json:"jwt_audience"`
+
+	// LogLevel is the minimum level of server logs: debug, info, warn or
+	// error.
+	LogLevel string `yaml:"log_level" json:"log_level"`
+
+	// ShutdownTimeout is the time to finish in-flight requests on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+
+	// GroupSessionTimeout is the time after which a consumer group member
+	// without heartbeats is removed from the group, unless the member asks
+	// for another one when it joins.
+	GroupSessionTimeout time.Duration `yaml:"group_session_timeout" json:"group_session_timeout"`
+
+	// TraceExporter is where spans are exported: none or stdout.
+	TraceExporter string `yaml:"trace_exporter" json:"trace_exporter"`
+
+	// TraceRecordHeaders adds the trace context of produce requests to the
+	// record headers.
+	TraceRecordHeaders bool `yaml:"trace_record_headers" json:"trace_record_headers"`
+
+	// QuotaFile is the path of the request and byte rate quotas of
+	// principals and topics. Nothing is limited if it is empty.
+	QuotaFile string `yaml:"quota_file" json:"quota_file"`
+
+	// AuditDir is the directory of the audit log. Nothing is audited if it
+	// is empty.
+	AuditDir string `yaml:"audit_dir" json:"audit_dir"`
+
+	// AuditRetention is the time audit events are kept for.
+	AuditRetention time.Duration `yaml:"audit_retention" json:"audit_retention"`
+
+	// AuditConsume makes the server audit consume requests too.
+	AuditConsume bool `yaml:"audit_consume" json:"audit_consume"`
+
+	// RaftNodeID and RaftAddr are the ID of the node in the Raft cluster and
+	// the address it listens on for Raft RPCs. The log is replicated by Raft
+	// if they are set, and it is kept in the data directory.
+	RaftNodeID string `yaml:"raft_node_id" json:"raft_node_id"`
+	RaftAddr   string `yaml:"raft_addr" json:"raft_addr"`
+
+	// RaftPeers are the voting members of the Raft cluster as ID=address
+	// pairs, including this node. A node without peers forms a single node
+	// cluster.
+	RaftPeers []string `yaml:"raft_peers" json:"raft_peers"`
+
+	// GossipAddr is the address of the gossip protocol that discovers the
+	// members of the Raft cluster. Members are not discovered if it is empty.
+	GossipAddr string `yaml:"gossip_addr" json:"gossip_addr"`
+
+	// GossipSeeds are the gossip addresses of members to join on start. A
+	// node without seeds and Raft peers starts a new cluster.
+	GossipSeeds []string `yaml:"gossip_seeds" json:"gossip_seeds"`
+
+	// Rack is the rack or zone of the node, announced to the other members.
+	Rack string `yaml:"rack" json:"rack"`
+
+	// AdvertiseURL is the URL clients use to reach the node, e.g.
+	// http://10.0.0.1:8080. It is announced to the other members, so any
+	// node can list it to clients discovering the cluster.
+	AdvertiseURL string `yaml:"advertise_url" json:"advertise_url"`
+
+	// AdvertiseGRPCAddr is the address gRPC clients use to reach the node,
+	// e.g. 10.0.0.1:8400. It is announced to the other members like the
+	// advertise URL.
+	AdvertiseGRPCAddr string `yaml:"advertise_grpc_addr" json:"advertise_grpc_addr"`
+
+	// ReplicaOf is the URL of the leader whose log the server replicates as
+	// a follower. The server is a leader if it is empty.
+	ReplicaOf string `yaml:"replica_of" json:"replica_of"`
+
+	// ReplicaID identifies the follower to the leader.
+	ReplicaID string `yaml:"replica_id" json:"replica_id"`
+
+	// ReplicaCAFile is the path of the CA certificates that verify the
+	// leader. The system CAs are used if it is empty. The follower presents
+	// the server certificate to the leader if it is set.
+	ReplicaCAFile string `yaml:"replica_ca_file" json:"replica_ca_file"`
+
+	// ReplicaTokenFile is the path of the file with the bearer token the
+	// follower sends to the leader, an API key or a JWT.
+	ReplicaTokenFile string `yaml:"replica_token_file" json:"replica_token_file"`
+
+	// ReplicaLagMax is the time after which a follower that has not caught
+	// up is dropped from the in-sync replicas of the leader.
+	ReplicaLagMax time.Duration `yaml:"replica_lag_max" json:"replica_lag_max"`
+
+	// MinInSyncReplicas is the minimum number of in-sync replicas, including
+	// the leader, for records produced with acks=all.
+	MinInSyncReplicas int `yaml:"min_insync_replicas" json:"min_insync_replicas"`
+
+	// BackupDir is the directory of the log snapshots taken with POST
+	// /v1/snapshots. Snapshots cannot be taken if it is empty.
+	BackupDir string `yaml:"backup_dir" json:"backup_dir"`
+
+	// TierDir is the directory, e.g. a mounted network file system, the
+	// sealed segments of the log are uploaded to.
+	TierDir string `yaml:"tier_dir" json:"tier_dir"`
+
+	// TierS3Endpoint, TierS3Bucket and TierS3Region are the S3-compatible
+	// object store the sealed segments are uploaded to instead. The
+	// credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY,
+	// so they are not reported in the status.
+	TierS3Endpoint string `yaml:"tier_s3_endpoint" json:"tier_s3_endpoint"`
+	TierS3Bucket   string `yaml:"tier_s3_bucket" json:"tier_s3_bucket"`
+	TierS3Region   string `yaml:"tier_s3_region" json:"tier_s3_region"`
+
+	// TierSegmentBytes is the size from which the log store starts a new
+	// segment file. Only sealed segments are uploaded and evicted.
+	TierSegmentBytes uint64 `yaml:"tier_segment_bytes" json:"tier_segment_bytes"`
+
+	// TierLocalRetentionBytes is the size of the log segments kept locally.
+	// The oldest uploaded segments beyond it are evicted and read from the
+	// object store. Nothing is evicted if it is zero.
+	TierLocalRetentionBytes uint64 `yaml:"tier_local_retention_bytes" json:"tier_local_retention_bytes"`
+
+	// TierCacheBytes is the size of the segments downloaded from the object
+	// store that are kept to read evicted records.
+	TierCacheBytes uint64 `yaml:"tier_cache_bytes" json:"tier_cache_bytes"`
+
+	// TierInterval is the period of checking for new segments to upload.
+	TierInterval time.Duration `yaml:"tier_interval" json:"tier_interval"`
+}
+
+// Trace exporters of the server.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+)
+
+// Default returns the default configuration.
+func Default() Config {
+	return Config{
+		HTTPAddr:                ":8080",
+		GRPCAddr:                "",
+		DataDir:                 "",
+		MaxRecordSize:           256, // nolint:gomnd
+		SyncPolicy:              SyncNever,
+		SyncInterval:            time.Second,
+		TLSCertFile:             "",
+		TLSKeyFile:              "",
+		TLSClientCAFile:         "",
+		ACLFile:                 "",
+		APIKeysFile:             "",
+		JWKSFile:                "",
+		JWTIssuer:               "",
+		JWTAudience:             "",
+		LogLevel:                LogLevelInfo,
+		ShutdownTimeout:         10 * time.Second, // nolint:gomnd
+		GroupSessionTimeout:     10 * time.Second, // nolint:gomnd
+		TraceExporter:           TraceExporterNone,
+		TraceRecordHeaders:      false,
+		QuotaFile:               "",
+		AuditDir:                "",
+		AuditRetention:          30 * 24 * time.Hour, // nolint:gomnd
+		AuditConsume:            false,
+		RaftNodeID:              "",
+		RaftAddr:                "",
+		RaftPeers:               nil,
+		GossipAddr:              "",
+		GossipSeeds:             nil,
+		Rack:                    "",
+		AdvertiseURL:            "",
+		AdvertiseGRPCAddr:       "",
+		ReplicaOf:               "",
+		ReplicaID:               "",
+		ReplicaCAFile:           "",
+		ReplicaTokenFile:        "",
+		ReplicaLagMax:           10 * time.Second, // nolint:gomnd
+		MinInSyncReplicas:       1,
+		BackupDir:               "",
+		TierDir:                 "",
+		TierS3Endpoint:          "",
+		TierS3Bucket:            "",
+		TierS3Region:            "us-east-1",
+		TierSegmentBytes:        16 << 20, // nolint:gomnd
+		TierLocalRetentionBytes: 0,
+		TierCacheBytes:          256 << 20, // nolint:gomnd
+		TierInterval:            time.Minute,
+	}
+}
+
+// setting is a configuration setting that can be set by a flag and an
+// environment variable.
+type setting struct {
+	name  string // the flag name, the environment variable is derived from it
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, v string) error
+}
+
+// nolint:gochecknoglobals
+var settings = []setting{
+	{
+		name:  "http-addr",
+		usage: "address of the HTTP server",
+		get:   func(c *Config) string { return c.HTTPAddr },
+		set:   func(c *Config, v string) error { c.HTTPAddr = v; return nil },
+	},
+	{
+		name:  "grpc-addr",
+		usage: "address of the gRPC server, it is not started if empty",
+		get:   func(c *Config) string { return c.GRPCAddr },
+		set:   func(c *Config, v string) error { c.GRPCAddr = v; return nil },
+	},
+	{
+		name:  "data-dir",
+		usage: "directory of the log files, the log is kept in memory if empty",
+		get:   func(c *Config) string { return c.DataDir },
+		set:   func(c *Config, v string) error { c.DataDir = v; return nil },
+	},
+	{
+		name:  "max-record-size",
+		usage: "maximum size of a persisted record in bytes",
+		get:   func(c *Config) string { return strconv.FormatUint(c.MaxRecordSize, 10) },
+		set: func(c *Config, v string) error {
+			size, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse the size: %w", err)
+			}
+
+			c.MaxRecordSize = size
+
+			return nil
+		},
+	},
+	{
+		name:  "sync-policy",
+		usage: "when records are committed to stable storage: always, interval or never",
+		get:   func(c *Config) string { return c.SyncPolicy },
+		set:   func(c *Config, v string) error { c.SyncPolicy = v; return nil },
+	},
+	{
+		name:  "sync-interval",
+		usage: "period of commits for the interval sync policy",
+		get:   func(c *Config) string { return c.SyncInterval.String() },
+		set: func(c *Config, v string) error {
+			interval, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the interval: %w", err)
+			}
+
+			c.SyncInterval = interval
+
+			return nil
+		},
+	},
+	{
+		name:  "tls-cert-file",
+		usage: "path of the server TLS certificate",
+		get:   func(c *Config) string { return c.TLSCertFile },
+		set:   func(c *Config, v string) error { c.TLSCertFile = v; return nil },
+	},
+	{
+		name:  "tls-key-file",
+		usage: "path of the server TLS key",
+		get:   func(c *Config) string { return c.TLSKeyFile },
+		set:   func(c *Config, v string) error { c.TLSKeyFile = v; return nil },
+	},
+	{
+		name:  "tls-client-ca-file",
+		usage: "path of the CA that verifies client certificates",
+		get:   func(c *Config) string { return c.TLSClientCAFile },
+		set:   func(c *Config, v string) error { c.TLSClientCAFile = v; return nil },
+	},
+	{
+		name:  "acl-file",
+		usage: "path of the access control lists, reloaded on SIGHUP",
+		get:   func(c *Config) string { return c.ACLFile },
+		set:   func(c *Config, v string) error { c.ACLFile = v; return nil },
+	},
+	{
+		name:  "api-keys-file",
+		usage: "path of the hashed API keys accepted as bearer tokens",
+		get:   func(c *Config) string { return c.APIKeysFile },
+		set:   func(c *Config, v string) error { c.APIKeysFile = v; return nil },
+	},
+	{
+		name:  "jwks-file",
+		usage: "path of the JWKS that verifies JWTs accepted as bearer tokens",
+		get:   func(c *Config) string { return c.JWKSFile },
+		set:   func(c *Config, v string) error { c.JWKSFile = v; return nil },
+	},
+	{
+		name:  "jwt-issuer",
+		usage: "required issuer of JWTs",
+		get:   func(c *Config) string { return c.JWTIssuer },
+		set:   func(c *Config, v string) error { c.JWTIssuer = v; return nil },
+	},
+	{
+		name:  "jwt-audience",
+		usage: "required audience of JWTs",
+		get:   func(c *Config) string { return c.JWTAudience },
+		set:   func(c *Config, v string) error { c.JWTAudience = v; return nil },
+	},
+	{
+		name:  "log-level",
+		usage: "minimum log level: debug, info, warn or error",
+		get:   func(c *Config) string { return c.LogLevel },
+		set:   func(c *Config, v string) error { c.LogLevel = v; return nil },
+	},
+	{
+		name:  "shutdown-timeout",
+		usage: "time to finish in-flight requests on shutdown",
+		get:   func(c *Config) string { return c.ShutdownTimeout.String() },
+		set: func(c *Config, v string) error {
+			timeout, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the timeout: %w", err)
+			}
+
+			c.ShutdownTimeout = timeout
+
+			return nil
+		},
+	},
+	{
+		name:  "group-session-timeout",
+		usage: "time after which a consumer group member without heartbeats is removed",
+		get:   func(c *Config) string { return c.GroupSessionTimeout.String() },
+		set: func(c *Config, v string) error {
+			timeout, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the timeout: %w", err)
+			}
+
+			c.GroupSessionTimeout = timeout
+
+			return nil
+		},
+	},
+	{
+		name:  "trace-exporter",
+		usage: "where spans are exported: none or stdout",
+		get:   func(c *Config) string { return c.TraceExporter },
+		set:   func(c *Config, v string) error { c.TraceExporter = v; return nil },
+	},
+	{
+		name:  "trace-record-headers",
+		usage: "add the trace context of produce requests to the record headers",
+		get:   func(c *Config) string { return strconv.FormatBool(c.TraceRecordHeaders) },
+		set: func(c *Config, v string) error {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the flag: %w", err)
+			}
+
+			c.TraceRecordHeaders = enabled
+
+			return nil
+		},
+	},
+	{
+		name:  "quota-file",
+		usage: "path of the request and byte rate quotas of principals and topics",
+		get:   func(c *Config) string { return c.QuotaFile },
+		set:   func(c *Config, v string) error { c.QuotaFile = v; return nil },
+	},
+	{
+		name:  "audit-dir",
+		usage: "directory of the audit log, nothing is audited if it is empty",
+		get:   func(c *Config) string { return c.AuditDir },
+		set:   func(c *Config, v string) error { c.AuditDir = v; return nil },
+	},
+	{
+		name:  "audit-retention",
+		usage: "time audit events are kept for",
+		get:   func(c *Config) string { return c.AuditRetention.String() },
+		set: func(c *Config, v string) error {
+			retention, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the retention: %w", err)
+			}
+
+			c.AuditRetention = retention
+
+			return nil
+		},
+	},
+	{
+		name:  "audit-consume",
+		usage: "audit consume requests too",
+		get:   func(c *Config) string { return strconv.FormatBool(c.AuditConsume) },
+		set: func(c *Config, v string) error {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the flag: %w", err)
+			}
+
+			c.AuditConsume = enabled
+
+			return nil
+		},
+	},
+	{
+		name:  "raft-node-id",
+		usage: "ID of the node in the Raft cluster, the log is replicated if it is set",
+		get:   func(c *Config) string { return c.RaftNodeID },
+		set:   func(c *Config, v string) error { c.RaftNodeID = v; return nil },
+	},
+	{
+		name:  "raft-addr",
+		usage: "address of Raft RPCs",
+		get:   func(c *Config) string { return c.RaftAddr },
+		set:   func(c *Config, v string) error { c.RaftAddr = v; return nil },
+	},
+	{
+		name:  "raft-peers",
+		usage: "comma-separated ID=address pairs of all Raft voters",
+		get:   func(c *Config) string { return strings.Join(c.RaftPeers, ",") },
+		set: func(c *Config, v string) error {
+			c.RaftPeers = splitList(v)
+
+			return nil
+		},
+	},
+	{
+		name:  "gossip-addr",
+		usage: "address of the gossip protocol that discovers the Raft members",
+		get:   func(c *Config) string { return c.GossipAddr },
+		set:   func(c *Config, v string) error { c.GossipAddr = v; return nil },
+	},
+	{
+		name:  "gossip-seeds",
+		usage: "comma-separated gossip addresses of members to join on start",
+		get:   func(c *Config) string { return strings.Join(c.GossipSeeds, ",") },
+		set:   func(c *Config, v string) error { c.GossipSeeds = splitList(v); return nil },
+	},
+	{
+		name:  "rack",
+		usage: "rack or zone of the node",
+		get:   func(c *Config) string { return c.Rack },
+		set:   func(c *Config, v string) error { c.Rack = v; return nil },
+	},
+	{
+		name:  "advertise-url",
+		usage: "URL clients use to reach the node, announced to the other members",
+		get:   func(c *Config) string { return c.AdvertiseURL },
+		set:   func(c *Config, v string) error { c.AdvertiseURL = v; return nil },
+	},
+	{
+		name:  "advertise-grpc-addr",
+		usage: "address gRPC clients use to reach the node, announced to the other members",
+		get:   func(c *Config) string { return c.AdvertiseGRPCAddr },
+		set:   func(c *Config, v string) error { c.AdvertiseGRPCAddr = v; return nil },
+	},
+	{
+		name:  "replica-of",
+		usage: "URL of the leader whose log is replicated, the server is a leader if empty",
+		get:   func(c *Config) string { return c.ReplicaOf },
+		set:   func(c *Config, v string) error { c.ReplicaOf = v; return nil },
+	},
+	{
+		name:  "replica-id",
+		usage: "ID of the follower reported to the leader",
+		get:   func(c *Config) string { return c.ReplicaID },
+		set:   func(c *Config, v string) error { c.ReplicaID = v; return nil },
+	},
+	{
+		name:  "replica-ca-file",
+		usage: "path of the CA certificates that verify the leader",
+		get:   func(c *Config) string { return c.ReplicaCAFile },
+		set:   func(c *Config, v string) error { c.ReplicaCAFile = v; return nil },
+	},
+	{
+		name:  "replica-token-file",
+		usage: "path of the bearer token the follower sends to the leader",
+		get:   func(c *Config) string { return c.ReplicaTokenFile },
+		set:   func(c *Config, v string) error { c.ReplicaTokenFile = v; return nil },
+	},
+	{
+		name:  "replica-lag-max",
+		usage: "time after which a follower that has not caught up is not in sync",
+		get:   func(c *Config) string { return c.ReplicaLagMax.String() },
+		set: func(c *Config, v string) error {
+			lag, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the lag: %w", err)
+			}
+
+			c.ReplicaLagMax = lag
+
+			return nil
+		},
+	},
+	{
+		name:  "min-insync-replicas",
+		usage: "minimum in-sync replicas including the leader for acks=all",
+		get:   func(c *Config) string { return strconv.Itoa(c.MinInSyncReplicas) },
+		set: func(c *Config, v string) error {
+			replicas, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the number: %w", err)
+			}
+
+			c.MinInSyncReplicas = replicas
+
+			return nil
+		},
+	},
+	{
+		name:  "backup-dir",
+		usage: "directory of the log snapshots, snapshots cannot be taken if it is empty",
+		get:   func(c *Config) string { return c.BackupDir },
+		set:   func(c *Config, v string) error { c.BackupDir = v; return nil },
+	},
+	{
+		name:  "tier-dir",
+		usage: "directory the sealed log segments are uploaded to",
+		get:   func(c *Config) string { return c.TierDir },
+		set:   func(c *Config, v string) error { c.TierDir = v; return nil },
+	},
+	{
+		name:  "tier-s3-endpoint",
+		usage: "URL of the S3-compatible object store the sealed log segments are uploaded to",
+		get:   func(c *Config) string { return c.TierS3Endpoint },
+		set:   func(c *Config, v string) error { c.TierS3Endpoint = v; return nil },
+	},
+	{
+		name:  "tier-s3-bucket",
+		usage: "bucket of the uploaded log segments",
+		get:   func(c *Config) string { return c.TierS3Bucket },
+		set:   func(c *Config, v string) error { c.TierS3Bucket = v; return nil },
+	},
+	{
+		name:  "tier-s3-region",
+		usage: "region the object store requests are signed for",
+		get:   func(c *Config) string { return c.TierS3Region },
+		set:   func(c *Config, v string) error { c.TierS3Region = v; return nil },
+	},
+	{
+		name:  "tier-segment-bytes",
+		usage: "size in bytes from which the log store starts a new segment to upload",
+		get:   func(c *Config) string { return strconv.FormatUint(c.TierSegmentBytes, 10) },
+		set: func(c *Config, v string) error {
+			size, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse the size: %w", err)
+			}
+
+			c.TierSegmentBytes = size
+
+			return nil
+		},
+	},
+	{
+		name:  "tier-local-retention-bytes",
+		usage: "size in bytes of the log segments kept locally, 0 keeps all of them",
+		get:   func(c *Config) string { return strconv.FormatUint(c.TierLocalRetentionBytes, 10) },
+		set: func(c *Config, v string) error {
+			size, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse the size: %w", err)
+			}
+
+			c.TierLocalRetentionBytes = size
+
+			return nil
+		},
+	},
+	{
+		name:  "tier-cache-bytes",
+		usage: "size in bytes of the downloaded log segments kept to read evicted records",
+		get:   func(c *Config) string { return strconv.FormatUint(c.TierCacheBytes, 10) },
+		set: func(c *Config, v string) error {
+			size, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse the size: %w", err)
+			}
+
+			c.TierCacheBytes = size
+
+			return nil
+		},
+	},
+	{
+		name:  "tier-interval",
+		usage: "period of checking for new log segments to upload",
+		get:   func(c *Config) string { return c.TierInterval.String() },
+		set: func(c *Config, v string) error {
+			interval, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("failed to parse the interval: %w", err)
+			}
+
+			c.TierInterval = interval
+
+			return nil
+		},
+	},
+}
+
+// splitList splits the comma-separated list.
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+
+	return strings.Split(v, ",")
+}
+
+// RaftPeer splits a Raft peer into its ID and address.
+func RaftPeer(peer string) (id string, addr string, ok bool) {
+	i := strings.Index(peer, "=")
+	if i <= 0 || i == len(peer)-1 {
+		return "", "", false
+	}
+
+	return peer[:i], peer[i+1:], true
+}
+
+// envName returns the environment variable of the setting.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// flagValue is a flag.Value that keeps the flag as a string until all sources
+// are loaded.
+type flagValue string
+
+func (v *flagValue) String() string {
+	return string(*v)
+}
+
+func (v *flagValue) Set(s string) error {
+	*v = flagValue(s)
+
+	return nil
+}
+
+// Load loads the configuration from the command-line arguments without the
+// program name and from the environment. The file is read from the path in the
+// -config flag or the PROGLOG_CONFIG environment variable. Load returns
+// flag.ErrHelp if the arguments contain -h or -help.
+func Load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	values := make(map[string]*flagValue, len(settings)+1)
+
+	file := flagValue("")
+	values[fileSetting] = &file
+	flags.Var(&file, fileSetting, "path of the YAML configuration file")
+
+	for _, s := range settings {
+		value := flagValue(s.get(&config))
+		values[s.name] = &value
+		flags.Var(&value, s.name, s.usage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err // nolint:wrapcheck
+	}
+
+	if flags.NArg() != 0 {
+		return Config{}, fmt.Errorf("%w: unexpected arguments: %s", ErrInvalidConfig, strings.Join(flags.Args(), " "))
+	}
+
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	path, _ := lookupEnv(envName(fileSetting))
+	if set[fileSetting] {
+		path = string(file)
+	}
+
+	if path != "" {
+		if err := loadFile(path, &config); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(envName(s.name)); ok {
+			if err := s.set(&config, v); err != nil {
+				return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, envName(s.name), err) // nolint:errorlint
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if set[s.name] {
+			if err := s.set(&config, values[s.name].String()); err != nil {
+				return Config{}, fmt.Errorf("%w: -%s: %v", ErrInvalidConfig, s.name, err) // nolint:errorlint
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// loadFile overrides the configuration with the settings of the YAML file.
+// Unknown settings are rejected, so typos do not go unnoticed.
+func loadFile(path string, config *Config) error {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to open the configuration file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err) // nolint:errorlint
+	}
+
+	return nil
+}
+
+// Validate checks the settings and reports all wrong ones at once.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.HTTPAddr == "" {
+		problems = append(problems, "the HTTP address is empty")
+	}
+
+	if c.MaxRecordSize == 0 {
+		problems = append(problems, "the max record size is zero")
+	}
+
+	switch c.SyncPolicy {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if c.SyncInterval <= 0 {
+			problems = append(problems, fmt.Sprintf("the sync interval %s is not positive", c.SyncInterval))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown sync policy %q", c.SyncPolicy))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "the TLS certificate and key must be set together")
+	}
+
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		problems = append(problems, "the TLS client CA requires the TLS certificate")
+	}
+
+	if (c.JWTIssuer != "" || c.JWTAudience != "") && c.JWKSFile == "" {
+		problems = append(problems, "the JWT issuer and audience require the JWKS file")
+	}
+
+	if c.AuditDir != "" && filepath.Clean(c.AuditDir) == filepath.Clean(c.DataDir) {
+		problems = append(problems, "the audit directory must differ from the data directory")
+	}
+
+	if c.AuditRetention <= 0 {
+		problems = append(problems, fmt.Sprintf("the audit retention %s is not positive", c.AuditRetention))
+	}
+
+	problems = append(problems, c.validateRaft()...)
+	problems = append(problems, c.validateGossip()...)
+	problems = append(problems, c.validateFollower()...)
+	problems = append(problems, c.validateBackup()...)
+	problems = append(problems, c.validateTier()...)
+
+	switch c.LogLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown log level %q", c.LogLevel))
+	}
+
+	switch c.TraceExporter {
+	case TraceExporterNone, TraceExporterStdout:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown trace exporter %q", c.TraceExporter))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("the shutdown timeout %s is not positive", c.ShutdownTimeout))
+	}
+
+	if c.GroupSessionTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("the group session timeout %s is not positive", c.GroupSessionTimeout))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// validateRaft checks the Raft settings.
+func (c Config) validateRaft() []string {
+	if c.RaftNodeID == "" && c.RaftAddr == "" && len(c.RaftPeers) == 0 {
+		return nil
+	}
+
+	var problems []string
+
+	if c.RaftNodeID == "" || c.RaftAddr == "" {
+		problems = append(problems, "the Raft node ID and address must be set together")
+	}
+
+	if c.DataDir == "" {
+		problems = append(problems, "the Raft node requires the data directory")
+	}
+
+	member := len(c.RaftPeers) == 0
+
+	for _, peer := range c.RaftPeers {
+		id, _, ok := RaftPeer(peer)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("the Raft peer %q is not an ID=address pair", peer))
+		}
+
+		member = member || id == c.RaftNodeID
+	}
+
+	if !member {
+		problems = append(problems, fmt.Sprintf("the Raft peers do not include the node %q", c.RaftNodeID))
+	}
+
+	return problems
+}
+
+// validateGossip checks the gossip settings.
+func (c Config) validateGossip() []string {
+	var problems []string
+
+	if c.GossipAddr != "" && c.RaftNodeID == "" {
+		problems = append(problems, "the gossip address requires the Raft node")
+	}
+
+	if len(c.GossipSeeds) != 0 && c.GossipAddr == "" {
+		problems = append(problems, "the gossip seeds require the gossip address")
+	}
+
+	if c.AdvertiseURL != "" && c.GossipAddr == "" {
+		problems = append(problems, "the advertise URL requires the gossip address")
+	}
+
+	if u, err := url.Parse(c.AdvertiseURL); c.AdvertiseURL != "" &&
+		(err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		problems = append(problems, fmt.Sprintf("the advertise URL %q is not an HTTP URL", c.AdvertiseURL))
+	}
+
+	if c.AdvertiseGRPCAddr != "" && c.GossipAddr == "" {
+		problems = append(problems, "the advertise gRPC address requires the gossip address")
+	}
+
+	if c.AdvertiseGRPCAddr != "" && c.GRPCAddr == "" {
+		problems = append(problems, "the advertise gRPC address requires the gRPC address")
+	}
+
+	return problems
+}
+
+// validateBackup checks the snapshot settings.
+func (c Config) validateBackup() []string {
+	if c.BackupDir == "" {
+		return nil
+	}
+
+	var problems []string
+
+	if c.DataDir == "" {
+		problems = append(problems, "the backup directory requires the data directory")
+	}
+
+	if filepath.Clean(c.BackupDir) == filepath.Clean(c.DataDir) {
+		problems = append(problems, "the backup directory must differ from the data directory")
+	}
+
+	if c.RaftNodeID != "" {
+		problems = append(problems, "the backup directory cannot be used by a Raft node")
+	}
+
+	return problems
+}
+
+// validateTier checks the settings of offloading the log to an object store.
+func (c Config) validateTier() []string {
+	var problems []string
+
+	if c.TierSegmentBytes == 0 {
+		problems = append(problems, "the tier segment size is zero")
+	}
+
+	if c.TierCacheBytes == 0 {
+		problems = append(problems, "the tier cache size is zero")
+	}
+
+	if c.TierInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("the tier interval %s is not positive", c.TierInterval))
+	}
+
+	if c.TierDir == "" && c.TierS3Endpoint == "" && c.TierS3Bucket == "" {
+		return problems
+	}
+
+	if c.TierDir != "" && (c.TierS3Endpoint != "" || c.TierS3Bucket != "") {
+		problems = append(problems, "the tier directory and the tier S3 settings cannot be set together")
+	}
+
+	if c.TierDir == "" && (c.TierS3Endpoint == "" || c.TierS3Bucket == "") {
+		problems = append(problems, "the tier S3 endpoint and bucket must be set together")
+	}
+
+	if c.DataDir == "" {
+		problems = append(problems, "the tier requires the data directory")
+	}
+
+	if c.RaftNodeID != "" {
+		problems = append(problems, "the tier cannot be used by a Raft node")
+	}
+
+	return problems
+}
+
+// validateFollower checks the leader and follower replication settings.
+func (c Config) validateFollower() []string {
+	var problems []string
+
+	if c.ReplicaOf != "" && c.ReplicaID == "" {
+		problems = append(problems, "the follower requires the replica ID")
+	}
+
+	if c.ReplicaOf != "" && c.RaftNodeID != "" {
+		problems = append(problems, "the follower cannot be a Raft node")
+	}
+
+	if c.ReplicaLagMax <= 0 {
+		problems = append(problems, fmt.Sprintf("the replica lag max %s is not positive", c.ReplicaLagMax))
+	}
+
+	if c.MinInSyncReplicas < 1 {
+		problems = append(problems, fmt.Sprintf("the min in-sync replicas %d is less than 1", c.MinInSyncReplicas))
+	}
+
+	return problems
+}
@@ -0,0 +1,178 @@
+package config_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := ioutil.WriteFile(name, []byte(content), 0600)
+	assert.Nil(t, err)
+
+	return name
+}
+
+func TestLoad_Default(t *testing.T) {
+	t.Parallel()
+
+	c, err := config.Load(nil, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, config.Default(), c)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	t.Parallel()
+
+	name := writeFile(t, `
+http_addr: ":9000"
+data_dir: /var/lib/proglog
+max_record_size: 1024
+sync_policy: interval
+sync_interval: 5s
+`)
+
+	c, err := config.Load(
+		[]string{"-config", name, "-http-addr", ":9002"},
+		env(map[string]string{
+			"PROGLOG_HTTP_ADDR":   ":9001",
+			"PROGLOG_SYNC_POLICY": "always",
+		}),
+		ioutil.Discard,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, ":9002", c.HTTPAddr)
+	assert.Equal(t, "/var/lib/proglog", c.DataDir)
+	assert.Equal(t, uint64(1024), c.MaxRecordSize)
+	assert.Equal(t, config.SyncAlways, c.SyncPolicy)
+	assert.Equal(t, 5*time.Second, c.SyncInterval)
+	assert.Equal(t, config.LogLevelInfo, c.LogLevel)
+}
+
+func TestLoad_FileFromEnv(t *testing.T) {
+	t.Parallel()
+
+	name := writeFile(t, "log_level: debug\n")
+
+	c, err := config.Load(nil, env(map[string]string{"PROGLOG_CONFIG": name}), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, config.LogLevelDebug, c.LogLevel)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+	}{
+		{
+			name: "unknown file setting",
+			file: "http_adr: \":9000\"\n",
+		},
+		{
+			name: "bad env value",
+			env:  map[string]string{"PROGLOG_MAX_RECORD_SIZE": "big"},
+		},
+		{
+			name: "bad flag value",
+			args: []string{"-sync-interval", "soon"},
+		},
+		{
+			name: "unexpected argument",
+			args: []string{"serve"},
+		},
+		{
+			name: "invalid settings",
+			args: []string{"-sync-policy", "sometimes", "-tls-cert-file", "cert.pem", "-log-level", "trace"},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeFile(t, tc.file)}, args...)
+			}
+
+			_, err := config.Load(args, env(tc.env), ioutil.Discard)
+			assert.ErrorIs(t, err, config.ErrInvalidConfig)
+		})
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	t.Parallel()
+
+	_, err := config.Load([]string{"-h"}, env(nil), ioutil.Discard)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	c := config.Default()
+	c.HTTPAddr = ""
+	c.SyncPolicy = config.SyncInterval
+	c.SyncInterval = 0
+	c.TLSClientCAFile = "ca.pem"
+	c.JWTIssuer = "issuer"
+	c.DataDir = "data"
+	c.AuditDir = "data/"
+	c.RaftNodeID = "node-1"
+	c.RaftPeers = []string{"node-2=127.0.0.1:7001", "node-3"}
+	c.GossipSeeds = []string{"127.0.0.1:7946"}
+	c.ReplicaOf = "http://leader:8080"
+	c.AdvertiseURL = "localhost:8080"
+	c.AdvertiseGRPCAddr = "localhost:8400"
+	c.MinInSyncReplicas = 0
+	c.BackupDir = "./data"
+	c.TierDir = "tier"
+	c.TierS3Bucket = "segments"
+	c.TierInterval = 0
+
+	err := c.Validate()
+	assert.ErrorIs(t, err, config.ErrInvalidConfig)
+	assert.Contains(t, err.Error(), "the HTTP address is empty")
+	assert.Contains(t, err.Error(), "the sync interval 0s is not positive")
+	assert.Contains(t, err.Error(), "the TLS client CA requires the TLS certificate")
+	assert.Contains(t, err.Error(), "the JWT issuer and audience require the JWKS file")
+	assert.Contains(t, err.Error(), "the audit directory must differ from the data directory")
+	assert.Contains(t, err.Error(), "the Raft node ID and address must be set together")
+	assert.Contains(t, err.Error(), `the Raft peer "node-3" is not an ID=address pair`)
+	assert.Contains(t, err.Error(), `the Raft peers do not include the node "node-1"`)
+	assert.Contains(t, err.Error(), "the gossip seeds require the gossip address")
+	assert.Contains(t, err.Error(), "the advertise URL \"localhost:8080\" is not an HTTP URL")
+	assert.Contains(t, err.Error(), "the advertise gRPC address requires the gRPC address")
+	assert.Contains(t, err.Error(), "the follower requires the replica ID")
+	assert.Contains(t, err.Error(), "the follower cannot be a Raft node")
+	assert.Contains(t, err.Error(), "the min in-sync replicas 0 is less than 1")
+	assert.Contains(t, err.Error(), "the backup directory must differ from the data directory")
+	assert.Contains(t, err.Error(), "the backup directory cannot be used by a Raft node")
+	assert.Contains(t, err.Error(), "the tier interval 0s is not positive")
+	assert.Contains(t, err.Error(), "the tier directory and the tier S3 settings cannot be set together")
+	assert.Contains(t, err.Error(), "the tier cannot be used by a Raft node")
+}
@@ -0,0 +1,289 @@
+// Package discovery finds the members of the cluster with the gossip protocol
+// of Serf, so nodes can form a cluster from a few seed addresses instead of a
+// static list of all members.
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/ivanlemeshev/proglog/internal/logwriter"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidConfig is returned if the node name or the bind address is
+// missing or wrong.
+var ErrInvalidConfig = fmt.Errorf("invalid discovery config")
+
+// Tags of the members.
+const (
+	// RPCAddrTag is the address of the replication RPCs of the member.
+	RPCAddrTag = "rpc_addr"
+
+	// RackTag is the rack or zone of the member.
+	RackTag = "rack"
+
+	// HTTPURLTag is the URL clients use to reach the member.
+	HTTPURLTag = "http_url"
+
+	// GRPCAddrTag is the address gRPC clients use to reach the member.
+	GRPCAddrTag = "grpc_addr"
+)
+
+// DefaultReconcileInterval is the period of reconciling the handler with all
+// known members, which repeats events the handler has failed to handle, for
+// example because the node was not the leader at the time.
+const DefaultReconcileInterval = 10 * time.Second
+
+// eventBufferSize is the number of Serf events buffered before Serf blocks.
+const eventBufferSize = 256
+
+// Handler adds and removes the replication peers of the members. Handler
+// errors are logged, and the events are repeated on the next reconciliation.
+type Handler interface {
+	// Join is called when the member joins the cluster or is alive on
+	// reconciliation. It must do nothing if the member is already added.
+	Join(name, rpcAddr string) error
+
+	// Leave is called when the member leaves or fails, or has left or failed
+	// on reconciliation. It must do nothing if the member is already removed.
+	Leave(name string) error
+}
+
+// Config configures the membership of the node.
+type Config struct {
+	// NodeName is the unique name of the node in the cluster.
+	NodeName string
+
+	// BindAddr is the host and port of the gossip protocol. Other nodes
+	// connect to it, so it must not be an unspecified address.
+	BindAddr string
+
+	// Tags are the tags of the node, such as RPCAddrTag, RackTag,
+	// HTTPURLTag and GRPCAddrTag.
+	Tags map[string]string
+
+	// SeedAddrs are the gossip addresses of the members to join on start.
+	// The node starts a new cluster if it is empty.
+	SeedAddrs []string
+
+	// ReconcileInterval is the period of reconciliation, the
+	// DefaultReconcileInterval is used if it is zero.
+	ReconcileInterval time.Duration
+
+	// Logger logs the membership events and the Serf logs if it is not nil.
+	Logger *zap.Logger
+}
+
+// Member is a member of the cluster.
+type Member struct {
+	Name   string            `json:"name"`
+	Addr   string            `json:"addr"` // the gossip address
+	Tags   map[string]string `json:"tags"`
+	Status string            `json:"status"` // alive, leaving, left or failed
+}
+
+// Membership is the membership of the node in the cluster. It calls the
+// handler for the other members joining, leaving and failing.
+type Membership struct {
+	handler   Handler
+	serf      *serf.Serf
+	events    chan serf.Event
+	logger    *zap.Logger
+	interval  time.Duration
+	stop      chan struct{}
+	done      sync.WaitGroup
+	leaveOnce sync.Once
+	leaveErr  error
+}
+
+// New joins the node to the cluster of the seed addresses or starts a new
+// cluster if there are no seeds.
+func New(handler Handler, config Config) (*Membership, error) {
+	host, portString, err := net.SplitHostPort(config.BindAddr)
+	if err != nil || config.NodeName == "" {
+		return nil, fmt.Errorf("%w: the node name and the bind address are required", ErrInvalidConfig)
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: the port %q: %v", ErrInvalidConfig, portString, err) // nolint:errorlint
+	}
+
+	logger := zap.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger
+	}
+
+	interval := config.ReconcileInterval
+	if interval == 0 {
+		interval = DefaultReconcileInterval
+	}
+
+	m := &Membership{
+		handler:   handler,
+		serf:      nil,
+		events:    make(chan serf.Event, eventBufferSize),
+		logger:    logger,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      sync.WaitGroup{},
+		leaveOnce: sync.Once{},
+		leaveErr:  nil,
+	}
+
+	logOutput := logwriter.New(logger.With(zap.String("component", "serf")))
+
+	serfConfig := serf.DefaultConfig()
+	serfConfig.Init()
+	serfConfig.NodeName = config.NodeName
+	serfConfig.Tags = config.Tags
+	serfConfig.EventCh = m.events
+	serfConfig.LogOutput = logOutput
+	serfConfig.MemberlistConfig.BindAddr = host
+	serfConfig.MemberlistConfig.BindPort = port
+	serfConfig.MemberlistConfig.LogOutput = logOutput
+
+	m.serf, err = serf.Create(serfConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start gossip: %w", err)
+	}
+
+	m.done.Add(2) // nolint:gomnd
+
+	go m.handleEvents()
+	go m.reconcilePeriodically()
+
+	if len(config.SeedAddrs) != 0 {
+		if _, err := m.serf.Join(config.SeedAddrs, true); err != nil {
+			_ = m.Leave()
+
+			return nil, fmt.Errorf("failed to join the cluster: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Members returns the known members of the cluster including the node.
+func (m *Membership) Members() []Member {
+	serfMembers := m.serf.Members()
+	members := make([]Member, 0, len(serfMembers))
+
+	for _, member := range serfMembers {
+		members = append(members, Member{
+			Name:   member.Name,
+			Addr:   net.JoinHostPort(member.Addr.String(), strconv.Itoa(int(member.Port))),
+			Tags:   member.Tags,
+			Status: member.Status.String(),
+		})
+	}
+
+	return members
+}
+
+// Leave leaves the cluster gracefully, so the other members handle it as a
+// leave rather than a failure, and stops gossiping. Leaving again does
+// nothing.
+func (m *Membership) Leave() error {
+	m.leaveOnce.Do(func() {
+		if err := m.serf.Leave(); err != nil {
+			m.leaveErr = fmt.Errorf("failed to leave the cluster: %w", err)
+		}
+
+		if err := m.serf.Shutdown(); err != nil && m.leaveErr == nil {
+			m.leaveErr = fmt.Errorf("failed to stop gossip: %w", err)
+		}
+
+		close(m.stop)
+		m.done.Wait()
+	})
+
+	return m.leaveErr
+}
+
+func (m *Membership) handleEvents() {
+	defer m.done.Done()
+
+	for {
+		select {
+		case event := <-m.events:
+			memberEvent, ok := event.(serf.MemberEvent)
+			if !ok {
+				continue
+			}
+
+			for _, member := range memberEvent.Members {
+				switch memberEvent.Type {
+				case serf.EventMemberJoin:
+					m.join(member)
+				case serf.EventMemberLeave, serf.EventMemberFailed:
+					m.leave(member)
+				default:
+				}
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// reconcilePeriodically repeats the join and leave events of all members.
+func (m *Membership) reconcilePeriodically() {
+	defer m.done.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, member := range m.serf.Members() {
+				switch member.Status {
+				case serf.StatusAlive:
+					m.join(member)
+				case serf.StatusLeft, serf.StatusFailed:
+					m.leave(member)
+				default:
+				}
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Membership) join(member serf.Member) {
+	if m.isLocal(member) {
+		return
+	}
+
+	addr, ok := member.Tags[RPCAddrTag]
+	if !ok {
+		m.logger.Warn("The member has no RPC address", zap.String("member", member.Name))
+
+		return
+	}
+
+	if err := m.handler.Join(member.Name, addr); err != nil {
+		m.logger.Debug("Failed to handle the member join", zap.String("member", member.Name), zap.Error(err))
+	}
+}
+
+func (m *Membership) leave(member serf.Member) {
+	if m.isLocal(member) {
+		return
+	}
+
+	if err := m.handler.Leave(member.Name); err != nil {
+		m.logger.Debug("Failed to handle the member leave", zap.String("member", member.Name), zap.Error(err))
+	}
+}
+
+func (m *Membership) isLocal(member serf.Member) bool {
+	return member.Name == m.serf.LocalMember().Name
+}
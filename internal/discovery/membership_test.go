@@ -0,0 +1,126 @@
+package discovery_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+type handler struct {
+	mu      sync.Mutex
+	members map[string]string
+	left    []string
+}
+
+func (h *handler) Join(name, rpcAddr string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.members[name] = rpcAddr
+
+	return nil
+}
+
+func (h *handler) Leave(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.members[name]; ok {
+		delete(h.members, name)
+		h.left = append(h.left, name)
+	}
+
+	return nil
+}
+
+func (h *handler) state() (map[string]string, []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	members := make(map[string]string, len(h.members))
+	for name, addr := range h.members {
+		members[name] = addr
+	}
+
+	return members, append([]string(nil), h.left...)
+}
+
+func TestMembership(t *testing.T) {
+	seed := &handler{members: make(map[string]string)} // nolint:exhaustivestruct
+	memberships := make([]*discovery.Membership, 3)
+
+	for i := range memberships {
+		config := discovery.Config{ // nolint:exhaustivestruct
+			NodeName: fmt.Sprintf("node-%d", i),
+			BindAddr: freeAddr(t),
+			Tags: map[string]string{
+				discovery.RPCAddrTag: fmt.Sprintf("127.0.0.1:%d", 7000+i),
+				discovery.RackTag:    "rack-a",
+			},
+		}
+
+		h := &handler{members: make(map[string]string)} // nolint:exhaustivestruct
+		if i == 0 {
+			h = seed
+		} else {
+			config.SeedAddrs = []string{memberships[0].Members()[0].Addr}
+		}
+
+		m, err := discovery.New(h, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer m.Leave() // nolint:errcheck
+
+		memberships[i] = m
+	}
+
+	assert.Eventually(t, func() bool {
+		members, _ := seed.state()
+
+		return len(members) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	members, _ := seed.state()
+	assert.Equal(t, map[string]string{"node-1": "127.0.0.1:7001", "node-2": "127.0.0.1:7002"}, members)
+	assert.Len(t, memberships[0].Members(), 3)
+	assert.Equal(t, "rack-a", memberships[1].Members()[0].Tags[discovery.RackTag])
+
+	assert.Nil(t, memberships[2].Leave())
+
+	assert.Eventually(t, func() bool {
+		_, left := seed.state()
+
+		return len(left) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	members, left := seed.state()
+	assert.Equal(t, []string{"node-2"}, left)
+	assert.Equal(t, map[string]string{"node-1": "127.0.0.1:7001"}, members)
+}
+
+func TestNew_Config(t *testing.T) {
+	t.Parallel()
+
+	_, err := discovery.New(nil, discovery.Config{NodeName: "node", BindAddr: "localhost"}) // nolint:exhaustivestruct
+	assert.ErrorIs(t, err, discovery.ErrInvalidConfig)
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close() // nolint:errcheck
+
+	return listener.Addr().String()
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTornFrame is returned if the file ends in the middle of a record, for
+// example because the process crashed while writing it.
+var ErrTornFrame = fmt.Errorf("torn frame")
+
+// ErrCorruptFrame is returned if the record size is more than the maximum
+// length, so the record boundaries cannot be trusted anymore.
+var ErrCorruptFrame = fmt.Errorf("corrupt frame")
+
+// Frame is a record read from the store file with its position.
+type Frame struct {
+	Position uint64
+	Record   []byte
+}
+
+// Scanner reads records of a store file one by one without opening the store.
+// Scanning stops at the end of the file or at the first torn or corrupt frame.
+type Scanner struct {
+	r               *bufio.Reader
+	maxRecordLength uint64
+	position        uint64
+	frame           Frame
+	err             error
+}
+
+// NewScanner returns a new Scanner that reads the store file from r.
+func NewScanner(r io.Reader) *Scanner {
+	return NewScannerWithConfig(r, Config{MaxRecordLength: MaxRecordLength})
+}
+
+// NewScannerWithConfig returns a new Scanner that reads the store file written
+// with the given configuration from r.
+func NewScannerWithConfig(r io.Reader, config Config) *Scanner {
+	if config.MaxRecordLength == 0 {
+		config.MaxRecordLength = MaxRecordLength
+	}
+
+	return &Scanner{
+		r:               bufio.NewReader(r),
+		maxRecordLength: config.MaxRecordLength,
+		position:        0,
+		frame:           Frame{Position: 0, Record: nil},
+		err:             nil,
+	}
+}
+
+// Scan reads the next frame. It returns false at the end of the file or on
+// error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	recordSize := make([]byte, RecordSizeLength)
+
+	if _, err := io.ReadFull(s.r, recordSize); err != nil {
+		if !errors.Is(err, io.EOF) {
+			s.err = fmt.Errorf("%w: failed to read the record size at %d: %v", ErrTornFrame, s.position, err) // nolint:errorlint
+		}
+
+		return false
+	}
+
+	size := binary.BigEndian.Uint64(recordSize)
+	if size > s.maxRecordLength {
+		s.err = fmt.Errorf("%w: record size %d at %d", ErrCorruptFrame, size, s.position)
+
+		return false
+	}
+
+	record := make([]byte, size)
+	if _, err := io.ReadFull(s.r, record); err != nil {
+		s.err = fmt.Errorf("%w: failed to read the record at %d: %v", ErrTornFrame, s.position, err) // nolint:errorlint
+
+		return false
+	}
+
+	s.frame = Frame{
+		Position: s.position,
+		Record:   record,
+	}
+	s.position += RecordSizeLength + size
+
+	return true
+}
+
+// Frame returns the frame read by the last call to Scan.
+func (s *Scanner) Frame() Frame {
+	return s.frame
+}
+
+// Position returns the position of the next frame. After an error it is the
+// position of the torn or corrupt frame, the file is valid up to it.
+func (s *Scanner) Position() uint64 {
+	return s.position
+}
+
+// Err returns the first error that stopped scanning. It is nil at the end of
+// the file.
+func (s *Scanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanner(t *testing.T) {
+	t.Parallel()
+
+	file, err := ioutil.TempFile("", "store_scanner_test")
+	if err == nil {
+		defer os.Remove(file.Name()) // nolint:errcheck
+	}
+
+	assert.Nil(t, err)
+
+	s, err := store.New(file)
+	assert.Nil(t, err)
+
+	records := [][]byte{
+		[]byte("record1"),
+		[]byte(""),
+		[]byte("record3"),
+	}
+
+	for _, r := range records {
+		_, _, err := s.Append(r)
+		assert.Nil(t, err)
+	}
+
+	err = s.Close()
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(file.Name())
+	assert.Nil(t, err)
+
+	t.Run("valid file", func(t *testing.T) {
+		scanner := store.NewScanner(bytes.NewReader(data))
+
+		var position uint64
+
+		for _, r := range records {
+			assert.True(t, scanner.Scan())
+			assert.Equal(t, position, scanner.Frame().Position)
+			assert.Equal(t, r, scanner.Frame().Record)
+
+			position += store.RecordSizeLength + uint64(len(r))
+		}
+
+		assert.False(t, scanner.Scan())
+		assert.Nil(t, scanner.Err())
+		assert.Equal(t, uint64(len(data)), scanner.Position())
+	})
+
+	t.Run("torn record", func(t *testing.T) {
+		scanner := store.NewScanner(bytes.NewReader(data[:len(data)-2]))
+
+		assert.True(t, scanner.Scan())
+		assert.True(t, scanner.Scan())
+		assert.False(t, scanner.Scan())
+		assert.ErrorIs(t, scanner.Err(), store.ErrTornFrame)
+		assert.Equal(t, uint64(2*store.RecordSizeLength+7), scanner.Position())
+	})
+
+	t.Run("torn record size", func(t *testing.T) {
+		scanner := store.NewScanner(bytes.NewReader(data[:3]))
+
+		assert.False(t, scanner.Scan())
+		assert.ErrorIs(t, scanner.Err(), store.ErrTornFrame)
+		assert.Equal(t, uint64(0), scanner.Position())
+	})
+
+	t.Run("corrupt record size", func(t *testing.T) {
+		corrupt := make([]byte, len(data))
+		copy(corrupt, data)
+		binary.BigEndian.PutUint64(corrupt, store.MaxRecordLength+1)
+
+		scanner := store.NewScanner(bytes.NewReader(corrupt))
+
+		assert.False(t, scanner.Scan())
+		assert.ErrorIs(t, scanner.Err(), store.ErrCorruptFrame)
+	})
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrEvicted is returned if a position is before the first segment of a
+// segmented store because the segment has been removed.
+var ErrEvicted = fmt.Errorf("position evicted")
+
+// ErrMissingSegment is returned if the segment files of a segmented store do
+// not follow each other without gaps.
+var ErrMissingSegment = fmt.Errorf("missing segment")
+
+// segmentFileSuffix is the suffix of segment files. They are named by the
+// position of their first record, padded with zeros so they sort in order.
+const segmentFileSuffix = ".store"
+
+// Segment describes a segment file of a segmented store.
+type Segment struct {
+	Name     string // the path of the file
+	Position uint64 // the position of the first record in the store
+	Size     uint64
+}
+
+// Segmented is a store split into segment files in a directory. Records are
+// appended to the last segment until it reaches the segment size, then the
+// segment is synced, sealed and a new one is started. Positions are the
+// positions in all segments one after another, so they do not change when the
+// oldest segments are removed.
+type Segmented struct {
+	mu       sync.Mutex
+	dir      string
+	config   Config
+	segments []segment // in the order of positions, the last one is active
+}
+
+type segment struct {
+	name     string
+	position uint64
+	store    Store
+}
+
+// OpenSegmented opens the store whose segment files are in the directory.
+// The directory and the first segment are created if they do not exist. The
+// store rolls to a new segment once the active one has SegmentBytes of the
+// configuration, it does not roll if it is zero.
+func OpenSegmented(dir string, config Config) (*Segmented, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the segments directory: %w", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the segments directory: %w", err)
+	}
+
+	var positions []uint64
+
+	for _, file := range files {
+		if position, ok := ParseSegmentName(file.Name()); ok {
+			positions = append(positions, position)
+		}
+	}
+
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	if len(positions) == 0 {
+		positions = append(positions, 0)
+	}
+
+	s := &Segmented{
+		mu:       sync.Mutex{},
+		dir:      dir,
+		config:   config,
+		segments: make([]segment, 0, len(positions)),
+	}
+
+	for _, position := range positions {
+		if n := len(s.segments); n != 0 {
+			last := s.segments[n-1]
+			if end := last.position + last.store.Size(); end != position {
+				_ = s.Close()
+
+				return nil, fmt.Errorf("%w: the segment %s ends at %d, the next one starts at %d",
+					ErrMissingSegment, last.name, end, position)
+			}
+		}
+
+		seg, err := s.openSegment(position)
+		if err != nil {
+			_ = s.Close()
+
+			return nil, err
+		}
+
+		s.segments = append(s.segments, seg)
+	}
+
+	return s, nil
+}
+
+// SegmentName returns the name of the segment file that starts at the
+// position.
+func SegmentName(position uint64) string {
+	return fmt.Sprintf("%020d%s", position, segmentFileSuffix)
+}
+
+// ParseSegmentName returns the position of the first record of the segment
+// file with the name. It returns false if the name is not a segment name.
+func ParseSegmentName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, segmentFileSuffix) {
+		return 0, false
+	}
+
+	position, err := strconv.ParseUint(strings.TrimSuffix(name, segmentFileSuffix), 10, 64) // nolint:gomnd
+	if err != nil {
+		return 0, false
+	}
+
+	return position, true
+}
+
+func (s *Segmented) openSegment(position uint64) (segment, error) {
+	name := filepath.Join(s.dir, SegmentName(position))
+
+	file, err := os.OpenFile(filepath.Clean(name), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600) // nolint:gomnd
+	if err != nil {
+		return segment{}, fmt.Errorf("failed to open the segment file: %w", err)
+	}
+
+	st, err := NewWithConfig(file, s.config)
+	if err != nil {
+		_ = file.Close()
+
+		return segment{}, err
+	}
+
+	return segment{name: name, position: position, store: st}, nil
+}
+
+// Append persists the record to the active segment, rolling to a new segment
+// first if the active one is full.
+func (s *Segmented) Append(record []byte) (uint64, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := s.segments[len(s.segments)-1]
+
+	if size := active.store.Size(); s.config.SegmentBytes != 0 && size >= s.config.SegmentBytes {
+		next, err := s.roll(active)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		active = next
+	}
+
+	n, position, err := active.store.Append(record)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return n, active.position + position, nil
+}
+
+// Roll seals the active segment and starts a new one, so the records appended
+// so far are in sealed segments that do not change anymore. An empty active
+// segment is only synced.
+func (s *Segmented) Roll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := s.segments[len(s.segments)-1]
+	if active.store.Size() == 0 {
+		return active.store.Sync() // nolint:wrapcheck
+	}
+
+	_, err := s.roll(active)
+
+	return err
+}
+
+// roll syncs and seals the active segment and starts the next one.
+func (s *Segmented) roll(active segment) (segment, error) {
+	if err := active.store.Sync(); err != nil {
+		return segment{}, fmt.Errorf("failed to seal the segment: %w", err)
+	}
+
+	next, err := s.openSegment(active.position + active.store.Size())
+	if err != nil {
+		return segment{}, err
+	}
+
+	s.segments = append(s.segments, next)
+
+	return next, nil
+}
+
+// Read returns the record stored at the given position.
+func (s *Segmented) Read(position uint64) ([]byte, error) {
+	s.mu.Lock()
+	seg, err := s.segment(position)
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return seg.store.Read(position - seg.position) // nolint:wrapcheck
+}
+
+// ReadAt reads bytes of b length beginning at the offset, across segments.
+func (s *Segmented) ReadAt(b []byte, offset int64) (int, error) {
+	var read int
+
+	for read < len(b) {
+		position := uint64(offset) + uint64(read)
+
+		s.mu.Lock()
+		seg, err := s.segment(position)
+		s.mu.Unlock()
+
+		if err != nil {
+			return read, err
+		}
+
+		end := seg.position + seg.store.Size()
+		if position >= end {
+			return read, io.EOF
+		}
+
+		chunk := b[read:]
+		if left := end - position; uint64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+
+		n, err := seg.store.ReadAt(chunk, int64(position-seg.position))
+		read += n
+
+		if err != nil {
+			return read, err // nolint:wrapcheck
+		}
+	}
+
+	return read, nil
+}
+
+// segment returns the segment that has the position.
+func (s *Segmented) segment(position uint64) (segment, error) {
+	if position < s.segments[0].position {
+		return segment{}, fmt.Errorf("%w: %d", ErrEvicted, position)
+	}
+
+	i := sort.Search(len(s.segments), func(i int) bool { return s.segments[i].position > position })
+
+	return s.segments[i-1], nil
+}
+
+// Sync persists any buffered data of the active segment and commits it to
+// stable storage. Sealed segments are synced when they are sealed.
+func (s *Segmented) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.segments[len(s.segments)-1].store.Sync() // nolint:wrapcheck
+}
+
+// Size returns the end position of the store including buffered data.
+func (s *Segmented) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := s.segments[len(s.segments)-1]
+
+	return active.position + active.store.Size()
+}
+
+// Base returns the position of the first record that has not been removed.
+func (s *Segmented) Base() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.segments[0].position
+}
+
+// Buffered returns the number of bytes not written to the file yet.
+func (s *Segmented) Buffered() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.segments[len(s.segments)-1].store.Buffered()
+}
+
+// Segments returns the segments in the order of their positions. All but the
+// last one are sealed and do not change anymore.
+func (s *Segmented) Segments() []Segment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segments := make([]Segment, 0, len(s.segments))
+	for _, seg := range s.segments {
+		segments = append(segments, Segment{Name: seg.name, Position: seg.position, Size: seg.store.Size()})
+	}
+
+	return segments
+}
+
+// RemoveBefore closes and deletes the sealed segments that end at or before
+// the position. The active segment is never removed.
+func (s *Segmented) RemoveBefore(position uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+		if seg.position+seg.store.Size() > position {
+			return nil
+		}
+
+		if err := seg.store.Close(); err != nil {
+			return fmt.Errorf("failed to close the segment %s: %w", seg.name, err)
+		}
+
+		if err := os.Remove(seg.name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove the segment %s: %w", seg.name, err)
+		}
+
+		s.segments = s.segments[1:]
+	}
+
+	return nil
+}
+
+// Close persists any buffered data and closes the segment files.
+func (s *Segmented) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var closeErr error
+
+	for _, seg := range s.segments {
+		if err := seg.store.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+
+	return closeErr
+}
@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmented(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	dir := t.TempDir()
+	config := store.Config{MaxRecordLength: store.MaxRecordLength, SegmentBytes: 20} // nolint:exhaustivestruct
+
+	s, err := store.OpenSegmented(dir, config)
+	assert.Nil(t, err)
+
+	var positions []uint64
+
+	// Every frame has 8 bytes of length and 8 bytes of record, so a segment
+	// is full after two records.
+	for _, record := range []string{"record-0", "record-1", "record-2", "record-3", "record-4"} {
+		_, position, err := s.Append([]byte(record))
+		assert.Nil(t, err)
+
+		positions = append(positions, position)
+	}
+
+	assert.Equal(t, []uint64{0, 16, 32, 48, 64}, positions)
+	assert.Equal(t, uint64(80), s.Size())
+
+	segments := s.Segments()
+	assert.Equal(t, []store.Segment{
+		{Name: filepath.Join(dir, "00000000000000000000.store"), Position: 0, Size: 32},
+		{Name: filepath.Join(dir, "00000000000000000032.store"), Position: 32, Size: 32},
+		{Name: filepath.Join(dir, "00000000000000000064.store"), Position: 64, Size: 16},
+	}, segments)
+
+	b, err := s.Read(48)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record-3"), b)
+
+	// ReadAt reads across segments.
+	b = make([]byte, 24)
+	n, err := s.ReadAt(b, 24)
+	assert.Nil(t, err)
+	assert.Equal(t, 24, n)
+	assert.Equal(t, []byte("record-1"), b[:8])
+	assert.Equal(t, []byte("record-2"), b[16:])
+
+	// Only the sealed segments that end before the position are removed.
+	assert.Nil(t, s.RemoveBefore(40))
+	assert.Equal(t, uint64(32), s.Base())
+
+	_, err = s.Read(16)
+	assert.ErrorIs(t, err, store.ErrEvicted)
+
+	assert.Nil(t, s.Close())
+
+	// The positions do not change when the store is opened again.
+	s, err = store.OpenSegmented(dir, config)
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(32), s.Base())
+	assert.Equal(t, uint64(80), s.Size())
+
+	b, err = s.Read(64)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record-4"), b)
+
+	// Rolling seals the active segment, an empty one is not sealed again.
+	assert.Nil(t, s.Roll())
+	assert.Nil(t, s.Roll())
+
+	segments = s.Segments()
+	assert.Len(t, segments, 3)
+	assert.Equal(t, store.Segment{Name: filepath.Join(dir, "00000000000000000080.store"), Position: 80, Size: 0},
+		segments[2])
+
+	assert.Nil(t, s.Close())
+
+	// A missing segment in the middle is detected.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "00000000000000000100.store"), nil, 0600))
+
+	_, err = store.OpenSegmented(dir, config)
+	assert.ErrorIs(t, err, store.ErrMissingSegment)
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "00000000000000000100.store")))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 )
 
 // Store is an interface for the byte store.
@@ -22,6 +23,15 @@ type Store interface {
 	// It implements io.ReaderAt on the store type.
 	ReadAt(b []byte, offset int64) (int, error)
 
+	// Sync persists any buffered data and commits it to stable storage.
+	Sync() error
+
+	// Size returns the size of the store in bytes including buffered data.
+	Size() uint64
+
+	// Buffered returns the number of bytes not written to the file yet.
+	Buffered() uint64
+
 	// Close persists any buffered data before closing the store.
 	Close() error
 }
@@ -33,19 +43,48 @@ const RecordSizeLength = 8
 const MaxRecordLength = 1 << RecordSizeLength
 
 // ErrMaxRecordLength is returned if the record more the the maximum length.
-var ErrMaxRecordLength = fmt.Errorf("the record to long: max length is %d", MaxRecordLength)
+var ErrMaxRecordLength = fmt.Errorf("the record to long")
+
+// Config configures the store.
+type Config struct {
+	// MaxRecordLength is the maximum length of the single record. The
+	// MaxRecordLength constant is used if it is zero.
+	MaxRecordLength uint64
+
+	// ObserveFlush is called with the duration of every explicit buffer flush
+	// if it is not nil.
+	ObserveFlush func(time.Duration)
+
+	// ObserveSync is called with the duration of every file sync if it is
+	// not nil.
+	ObserveSync func(time.Duration)
+
+	// SegmentBytes is the size at which a segmented store starts a new
+	// segment. The segmented store does not roll if it is zero, other stores
+	// ignore it.
+	SegmentBytes uint64
+}
 
 // store struct is a simple wrapper around a file to read and write bytes to it.
 // This struct implements the Store interface.
 type store struct {
-	mu   sync.Mutex // to prevent cincurrent read/write to the file
-	file *os.File
-	buf  *bufio.Writer
-	size uint64
+	mu              sync.Mutex // to prevent cincurrent read/write to the file
+	file            *os.File
+	buf             *bufio.Writer
+	size            uint64
+	maxRecordLength uint64
+	observeFlush    func(time.Duration)
+	observeSync     func(time.Duration)
 }
 
 // New returns a new store that wraps the given file.
 func New(file *os.File) (Store, error) {
+	return NewWithConfig(file, Config{MaxRecordLength: MaxRecordLength})
+}
+
+// NewWithConfig returns a new store that wraps the given file and uses the
+// given configuration.
+func NewWithConfig(file *os.File, config Config) (Store, error) {
 	// File could be not empty, so it is necessary to get its size. It equals
 	// to 0 if the file is new and empty. The file size is used as the store size.
 	fileStat, err := os.Stat(file.Name())
@@ -55,11 +94,18 @@ func New(file *os.File) (Store, error) {
 
 	fileSize := uint64(fileStat.Size())
 
+	if config.MaxRecordLength == 0 {
+		config.MaxRecordLength = MaxRecordLength
+	}
+
 	store := &store{
-		mu:   sync.Mutex{},
-		file: file,
-		size: fileSize,
-		buf:  bufio.NewWriter(file),
+		mu:              sync.Mutex{},
+		file:            file,
+		size:            fileSize,
+		buf:             bufio.NewWriter(file),
+		maxRecordLength: config.MaxRecordLength,
+		observeFlush:    config.ObserveFlush,
+		observeSync:     config.ObserveSync,
 	}
 
 	return store, nil
@@ -71,8 +117,8 @@ func (s *store) Append(record []byte) (uint64, uint64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if len(record) > MaxRecordLength {
-		return 0, 0, ErrMaxRecordLength
+	if uint64(len(record)) > s.maxRecordLength {
+		return 0, 0, fmt.Errorf("%w: max length is %d", ErrMaxRecordLength, s.maxRecordLength)
 	}
 
 	// Remember current position to return at the end.
@@ -112,7 +158,7 @@ func (s *store) Read(position uint64) ([]byte, error) {
 
 	// Flush the buffer to write all records from the buffer to disk before
 	// reading from the file.
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flush(); err != nil {
 		return nil, fmt.Errorf("failed to flush the buffer: %w", err)
 	}
 
@@ -139,7 +185,7 @@ func (s *store) ReadAt(b []byte, offset int64) (int, error) {
 
 	// Flush the buffer to write all records from the buffer to disk before
 	// reading from the file.
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flush(); err != nil {
 		return 0, fmt.Errorf("failed to flush the buffer: %w", err)
 	}
 
@@ -151,6 +197,45 @@ func (s *store) ReadAt(b []byte, offset int64) (int, error) {
 	return n, nil
 }
 
+// Sync persists any buffered data to file and commits the file to stable
+// storage.
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.flush(); err != nil {
+		return fmt.Errorf("failed to flush the buffer: %w", err)
+	}
+
+	start := time.Now()
+
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the file: %w", err)
+	}
+
+	if s.observeSync != nil {
+		s.observeSync(time.Since(start))
+	}
+
+	return nil
+}
+
+// Size returns the size of the store in bytes including buffered data.
+func (s *store) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Buffered returns the number of bytes not written to the file yet.
+func (s *store) Buffered() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return uint64(s.buf.Buffered())
+}
+
 // Close persists any buffered data to file before closing the file.
 func (s *store) Close() error {
 	s.mu.Lock()
@@ -158,7 +243,7 @@ func (s *store) Close() error {
 
 	// Flush the buffer to write all records from the buffer to disk before
 	// closing the file.
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flush(); err != nil {
 		return fmt.Errorf("failed to flush the buffer: %w", err)
 	}
 
@@ -168,3 +253,18 @@ func (s *store) Close() error {
 
 	return nil
 }
+
+// flush writes the buffered data to the file.
+func (s *store) flush() error {
+	start := time.Now()
+
+	if err := s.buf.Flush(); err != nil {
+		return err // nolint:wrapcheck
+	}
+
+	if s.observeFlush != nil {
+		s.observeFlush(time.Since(start))
+	}
+
+	return nil
+}
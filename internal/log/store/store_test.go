@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ivanlemeshev/proglog/internal/log/store"
 	"github.com/stretchr/testify/assert"
@@ -213,6 +214,85 @@ func TestStore_Close(t *testing.T) {
 	assert.Equal(t, expectedAfterSize, afterSize)
 }
 
+func TestStore_Sync(t *testing.T) {
+	file, err := ioutil.TempFile("", "store_sync_test")
+	if err == nil {
+		defer os.Remove(file.Name()) // nolint:errcheck
+	}
+
+	assert.Nil(t, err)
+
+	s, err := store.New(file)
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	record := []byte("record")
+	_, _, err = s.Append(record)
+	assert.Nil(t, err)
+
+	err = s.Sync()
+	assert.Nil(t, err)
+
+	expectedSize := int64(store.RecordSizeLength + len(record))
+	size, err := fileSize(file.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, expectedSize, size)
+}
+
+func TestStore_Observe(t *testing.T) {
+	file, err := ioutil.TempFile("", "store_observe_test")
+	if err == nil {
+		defer os.Remove(file.Name()) // nolint:errcheck
+	}
+
+	assert.Nil(t, err)
+
+	var flushes, syncs int
+
+	s, err := store.NewWithConfig(file, store.Config{
+		MaxRecordLength: 0,
+		ObserveFlush:    func(time.Duration) { flushes++ },
+		ObserveSync:     func(time.Duration) { syncs++ },
+	})
+	assert.Nil(t, err)
+
+	_, _, err = s.Append([]byte("record"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(store.RecordSizeLength+6), s.Size())
+	assert.Equal(t, uint64(store.RecordSizeLength+6), s.Buffered())
+
+	err = s.Sync()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), s.Buffered())
+
+	err = s.Close()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, flushes)
+	assert.Equal(t, 1, syncs)
+}
+
+func TestNewWithConfig(t *testing.T) {
+	file, err := ioutil.TempFile("", "store_config_test")
+	if err == nil {
+		defer os.Remove(file.Name()) // nolint:errcheck
+	}
+
+	assert.Nil(t, err)
+
+	s, err := store.NewWithConfig(file, store.Config{MaxRecordLength: 4})
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	_, _, err = s.Append([]byte("four"))
+	assert.Nil(t, err)
+
+	_, _, err = s.Append([]byte("five!"))
+	assert.ErrorIs(t, err, store.ErrMaxRecordLength)
+}
+
 func fileSize(name string) (int64, error) {
 	file, err := os.OpenFile(
 		filepath.Clean(name),
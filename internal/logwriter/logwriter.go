@@ -0,0 +1,48 @@
+// Package logwriter adapts the zap logger to libraries that write their log
+// lines to an io.Writer, such as Raft and Serf.
+package logwriter
+
+import (
+	"bytes"
+	"io"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// writer logs every written line at the level found in it.
+type writer struct {
+	logger *zap.Logger
+}
+
+// New returns a writer that logs the lines written to it with the logger.
+// Lines are expected in the "[LEVEL] message" format of the standard library
+// and hclog loggers, anything before the level is dropped. Lines without a
+// known level are logged at the info level.
+func New(logger *zap.Logger) io.Writer {
+	// The caller and the stack trace would point to the writer, not to the
+	// library.
+	return &writer{logger: logger.WithOptions(zap.WithCaller(false), zap.AddStacktrace(zapcore.FatalLevel))}
+}
+
+// Write logs the line.
+func (w *writer) Write(p []byte) (int, error) {
+	message := string(bytes.TrimSpace(p))
+
+	if i := bytes.IndexByte(p, ']'); i >= 0 {
+		message = string(bytes.TrimSpace(p[i+1:]))
+	}
+
+	switch {
+	case bytes.Contains(p, []byte("[ERR]")), bytes.Contains(p, []byte("[ERROR]")):
+		w.logger.Error(message)
+	case bytes.Contains(p, []byte("[WARN]")):
+		w.logger.Warn(message)
+	case bytes.Contains(p, []byte("[DEBUG]")), bytes.Contains(p, []byte("[TRACE]")):
+		w.logger.Debug(message)
+	default:
+		w.logger.Info(message)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,41 @@
+package logwriter_test
+
+import (
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/logwriter"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	w := logwriter.New(zap.New(core))
+
+	lines := []string{
+		"2021/10/19 12:00:00 [ERR] serf: failed to send ack\n",
+		"2021-10-19T12:00:00.000Z [WARN]  raft: heartbeat timeout reached\n",
+		"2021-10-19T12:00:00.000Z [DEBUG] raft: votes\n",
+		"no level\n",
+	}
+
+	for _, line := range lines {
+		n, err := w.Write([]byte(line))
+		assert.Nil(t, err)
+		assert.Equal(t, len(line), n)
+	}
+
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, len(lines))
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Equal(t, "serf: failed to send ack", entries[0].Message)
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, "raft: heartbeat timeout reached", entries[1].Message)
+	assert.Equal(t, zapcore.DebugLevel, entries[2].Level)
+	assert.Equal(t, zapcore.InfoLevel, entries[3].Level)
+	assert.Equal(t, "no level", entries[3].Message)
+}
@@ -0,0 +1,185 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// tmpPrefix is the prefix of the files being written, they are not listed.
+const tmpPrefix = ".objstore-"
+
+// FileStore stores objects as files of a local directory, e.g. a mounted
+// network file system.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates the store of the directory. The directory is created
+// if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("%w: the directory is empty", ErrInvalidConfig)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the object store directory: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Put writes the object to a temporary file, syncs it and renames it to the
+// file of the key.
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	name := s.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil { // nolint:gomnd
+		return fmt.Errorf("failed to create the object directory: %w", err)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(name), tmpPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create the object file: %w", err)
+	}
+
+	if err := writeFile(ctx, file, r, size); err != nil {
+		_ = os.Remove(file.Name())
+
+		return err
+	}
+
+	if err := os.Rename(file.Name(), name); err != nil {
+		_ = os.Remove(file.Name())
+
+		return fmt.Errorf("failed to rename the object file: %w", err)
+	}
+
+	return nil
+}
+
+// Get opens the file of the key.
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the object file: %w", err)
+	}
+
+	return file, nil
+}
+
+// Delete removes the file of the key.
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the object file: %w", err)
+	}
+
+	return nil
+}
+
+// List walks the directory and returns the keys of the files that start with
+// the prefix.
+func (s *FileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+
+	err := filepath.Walk(s.dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err() // nolint:wrapcheck
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), tmpPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, name)
+		if err != nil {
+			return err // nolint:wrapcheck
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the objects: %w", err)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+// writeFile copies the object into the file, checks its size, syncs and
+// closes the file.
+func writeFile(ctx context.Context, file *os.File, r io.Reader, size int64) error {
+	n, err := io.Copy(file, &contextReader{ctx: ctx, r: r})
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to write the object file: %w", err)
+	}
+
+	if n != size {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to write the object file: wrote %d of %d bytes", n, size)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to sync the object file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close the object file: %w", err)
+	}
+
+	return nil
+}
+
+// contextReader stops reading when the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err // nolint:wrapcheck
+	}
+
+	return r.r.Read(p) // nolint:wrapcheck
+}
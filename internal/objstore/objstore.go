@@ -0,0 +1,56 @@
+// Package objstore stores objects by key in a local directory or an
+// S3-compatible object store, so the log can offload its history from local
+// disks.
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned if there is no object with the key.
+var ErrNotFound = fmt.Errorf("object not found")
+
+// ErrInvalidKey is returned if the key is empty, starts with a slash or has
+// empty, "." or ".." elements.
+var ErrInvalidKey = fmt.Errorf("invalid object key")
+
+// ErrInvalidConfig is returned if the object store is not configured
+// correctly.
+var ErrInvalidConfig = fmt.Errorf("invalid object store config")
+
+// Store stores objects by slash-separated keys. Objects are written at once
+// and are not visible until they are written completely.
+type Store interface {
+	// Put writes the object of the given size, replacing an object with the
+	// same key.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Get returns the content of the object. It returns ErrNotFound if there
+	// is no object with the key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete deletes the object. Deleting a missing object does nothing.
+	Delete(ctx context.Context, key string) error
+
+	// List returns the sorted keys of the objects that start with the prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// validateKey checks that the key is a relative slash-separated path without
+// empty, "." or ".." elements.
+func validateKey(key string) error {
+	if key == "" || strings.ContainsRune(key, '\\') {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	for _, element := range strings.Split(key, "/") {
+		if element == "" || element == "." || element == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+
+	return nil
+}
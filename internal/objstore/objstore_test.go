@@ -0,0 +1,182 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/objstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	store, err := objstore.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	testStore(t, store)
+}
+
+func TestS3Store(t *testing.T) {
+	t.Parallel()
+
+	s3 := newFakeS3("test-key")
+	srv := httptest.NewServer(s3)
+
+	defer srv.Close()
+
+	store, err := objstore.NewS3Store(objstore.S3Config{ // nolint:exhaustivestruct
+		Endpoint:        srv.URL,
+		Bucket:          "backups",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "secret",
+	})
+	assert.Nil(t, err)
+
+	testStore(t, store)
+
+	unsigned, err := objstore.NewS3Store(objstore.S3Config{Endpoint: srv.URL, Bucket: "backups"}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	err = unsigned.Put(context.Background(), "a", strings.NewReader("a"), 1)
+	assert.NotNil(t, err)
+
+	_, err = objstore.NewS3Store(objstore.S3Config{Endpoint: "localhost:9000", Bucket: "backups"}) // nolint:exhaustivestruct
+	assert.ErrorIs(t, err, objstore.ErrInvalidConfig)
+}
+
+func testStore(t *testing.T, store objstore.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	for _, key := range []string{"segments/2.store", "segments/1.store", "segments/3.store", "manifest.json"} {
+		err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)))
+		assert.Nil(t, err)
+	}
+
+	err := store.Put(ctx, "manifest.json", strings.NewReader("new"), 3)
+	assert.Nil(t, err)
+
+	r, err := store.Get(ctx, "manifest.json")
+	assert.Nil(t, err)
+
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(b))
+	assert.Nil(t, r.Close())
+
+	keys, err := store.List(ctx, "segments/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"segments/1.store", "segments/2.store", "segments/3.store"}, keys)
+
+	assert.Nil(t, store.Delete(ctx, "segments/2.store"))
+	assert.Nil(t, store.Delete(ctx, "segments/2.store"))
+
+	_, err = store.Get(ctx, "segments/2.store")
+	assert.ErrorIs(t, err, objstore.ErrNotFound)
+
+	keys, err = store.List(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"manifest.json", "segments/1.store", "segments/3.store"}, keys)
+
+	err = store.Put(ctx, "../outside", strings.NewReader("x"), 1)
+	assert.ErrorIs(t, err, objstore.ErrInvalidKey)
+}
+
+// fakeS3 is a stand-in for an S3-compatible service with a single bucket. It
+// requires signed requests and returns lists in pages of two keys.
+type fakeS3 struct {
+	accessKeyID string
+	mu          sync.Mutex
+	objects     map[string][]byte
+}
+
+func newFakeS3(accessKeyID string) *fakeS3 {
+	return &fakeS3{accessKeyID: accessKeyID, mu: sync.Mutex{}, objects: map[string][]byte{}}
+}
+
+type fakeListResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/") ||
+		r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/backups/")
+
+	switch {
+	case r.URL.Path == "/backups" && r.Method == http.MethodGet:
+		s.list(w, r)
+	case r.Method == http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		s.objects[key] = b
+	case r.Method == http.MethodGet:
+		b, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, _ = w.Write(b)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	keys := []string{}
+
+	for key := range s.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+
+	var result fakeListResult
+
+	for i := start; i < len(keys) && i < start+2; i++ {
+		result.Contents = append(result.Contents, struct {
+			Key string `xml:"Key"`
+		}{Key: keys[i]})
+	}
+
+	if start+2 < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(start + 2)
+	}
+
+	var b bytes.Buffer
+	_ = xml.NewEncoder(&b).Encode(result)
+	_, _ = w.Write(b.Bytes())
+}
@@ -0,0 +1,361 @@
+package objstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultS3Region is the region requests are signed for if none is set.
+const DefaultS3Region = "us-east-1"
+
+// unsignedPayload is the payload hash of requests whose body is not signed,
+// so objects are streamed instead of being hashed before the upload.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Config configures an S3-compatible object store.
+type S3Config struct {
+	// Endpoint is the URL of the service without a path, e.g.
+	// https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+	Endpoint string
+
+	// Bucket is the bucket of the objects. It is addressed in the path, so
+	// it works with any S3-compatible service.
+	Bucket string
+
+	// Region is the region requests are signed for. DefaultS3Region is used
+	// if it is empty.
+	Region string
+
+	// AccessKeyID and SecretAccessKey sign the requests with AWS Signature
+	// Version 4. Requests are not signed if the access key ID is empty.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// HTTPClient sends the requests. The default client is used if it is
+	// nil.
+	HTTPClient *http.Client
+}
+
+// S3Store stores objects in a bucket of an S3-compatible object store.
+type S3Store struct {
+	endpoint *url.URL
+	config   S3Config
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Store creates the store of the bucket.
+func NewS3Store(config S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" ||
+		strings.Trim(endpoint.Path, "/") != "" {
+		return nil, fmt.Errorf("%w: the endpoint %q is not an HTTP URL without a path", ErrInvalidConfig, config.Endpoint)
+	}
+
+	if config.Bucket == "" || strings.Contains(config.Bucket, "/") {
+		return nil, fmt.Errorf("%w: the bucket %q is empty or has a slash", ErrInvalidConfig, config.Bucket)
+	}
+
+	if config.Region == "" {
+		config.Region = DefaultS3Region
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3Store{
+		endpoint: endpoint,
+		config:   config,
+		client:   client,
+		now:      time.Now,
+	}, nil
+}
+
+// s3Error is the error response of the service.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// listResult is the response of ListObjectsV2.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Put uploads the object with a PUT request.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	body := ioutil.NopCloser(r)
+	if size == 0 {
+		body = http.NoBody
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPut, key, resp)
+	}
+
+	return nil
+}
+
+// Get downloads the object with a GET request.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close() // nolint:errcheck
+
+		return nil, responseError(http.MethodGet, key, resp)
+	}
+
+	return resp.Body, nil
+}
+
+// Delete deletes the object with a DELETE request.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return responseError(http.MethodDelete, key, resp)
+	}
+}
+
+// List lists the objects with ListObjectsV2 requests, following the
+// continuation tokens of truncated responses.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		result, err := s.list(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (s *S3Store) list(ctx context.Context, query url.Values) (listResult, error) {
+	resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0)
+	if err != nil {
+		return listResult{}, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return listResult{}, responseError(http.MethodGet, "", resp)
+	}
+
+	var result listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return listResult{}, fmt.Errorf("failed to decode the object list: %w", err)
+	}
+
+	return result, nil
+}
+
+// do sends the signed request for the object of the key, or for the bucket
+// if the key is empty.
+func (s *S3Store) do(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	body io.ReadCloser,
+	size int64,
+) (*http.Response, error) {
+	path := "/" + uriEncode(s.config.Bucket, true)
+	if key != "" {
+		path += "/" + uriEncode(key, false)
+	}
+
+	u := *s.endpoint
+	u.RawPath = path
+	u.Path, _ = url.PathUnescape(path)
+	u.RawQuery = canonicalQuery(query)
+
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the object store request: %w", err)
+	}
+
+	if body != nil {
+		r.ContentLength = size
+	}
+
+	signV4(r, unsignedPayload, s.config, s.now())
+
+	resp, err := s.client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send the object store request: %w", err)
+	}
+
+	return resp, nil
+}
+
+func responseError(method, key string, resp *http.Response) error {
+	var e s3Error
+	_ = xml.NewDecoder(resp.Body).Decode(&e)
+
+	return fmt.Errorf("object store %s %q failed: %s: %s %s", method, key, resp.Status, e.Code, e.Message)
+}
+
+// signV4 signs the request with AWS Signature Version 4. The host, the
+// payload hash and the date headers are signed.
+func signV4(r *http.Request, payloadHash string, config S3Config, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if config.AccessKeyID == "" {
+		return
+	}
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		path,
+		canonicalQuery(r.URL.Query()),
+		"host:" + r.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), date)
+	key = hmacSHA256(key, config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by the names, as it is signed.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes all bytes but the unreserved characters and, if
+// it is not encoded, the slash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,251 @@
+// Package quota limits the request and byte rates of principals and topics
+// with token buckets.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidQuotas is returned if the quota file cannot be parsed or has
+// negative limits.
+var ErrInvalidQuotas = fmt.Errorf("invalid quotas")
+
+// Limit is a request and byte rate. A zero rate is unlimited. Up to one
+// second of the rate, and at least one request or byte, can be used at once.
+type Limit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	BytesPerSecond    float64 `yaml:"bytes_per_second"`
+}
+
+// Config defines the limits of principals and topics.
+type Config struct {
+	// Default is the limit of every principal without its own limit.
+	Default Limit `yaml:"default"`
+
+	// Principals are the limits of the principals.
+	Principals map[string]Limit `yaml:"principals"`
+
+	// Topics are the limits of the topics shared by all principals.
+	Topics map[string]Limit `yaml:"topics"`
+}
+
+// Load reads the quotas from the YAML file.
+func Load(name string) (Config, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to open the quota file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	var config Config
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidQuotas, name, err) // nolint:errorlint
+	}
+
+	limits := []Limit{config.Default}
+	for _, limit := range config.Principals {
+		limits = append(limits, limit)
+	}
+
+	for _, limit := range config.Topics {
+		limits = append(limits, limit)
+	}
+
+	for _, limit := range limits {
+		if limit.RequestsPerSecond < 0 || limit.BytesPerSecond < 0 {
+			return Config{}, fmt.Errorf("%w: %s: negative rate", ErrInvalidQuotas, name)
+		}
+	}
+
+	return config, nil
+}
+
+// Resources limited by quotas.
+const (
+	Requests = "requests"
+	Bytes    = "bytes"
+)
+
+// Throttle tells why and how long a caller is throttled.
+type Throttle struct {
+	// Quota is "principal" or "topic".
+	Quota string
+
+	// Resource is Requests or Bytes.
+	Resource string
+
+	// RetryAfter is the time until the quota allows the request.
+	RetryAfter time.Duration
+}
+
+// Manager enforces the quotas. Requests take a request token when they start
+// and are charged their bytes when they end, so a request that exceeds the
+// byte rate throttles the next requests until the debt is paid.
+type Manager struct {
+	config     Config
+	mu         sync.Mutex
+	principals map[string]*buckets
+	topics     map[string]*buckets
+}
+
+// NewManager creates a manager of the quotas.
+func NewManager(config Config) *Manager {
+	return &Manager{
+		config:     config,
+		mu:         sync.Mutex{},
+		principals: make(map[string]*buckets),
+		topics:     make(map[string]*buckets),
+	}
+}
+
+// Allow takes a request token of the principal and the topic. It returns
+// false and the throttle if any of their quotas is exhausted, then no token
+// is taken.
+func (m *Manager) Allow(principal, topic string) (Throttle, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	principalBuckets := m.principalBuckets(principal)
+	topicBuckets := m.topicBuckets(topic)
+
+	if throttle, ok := principalBuckets.check(now); !ok {
+		throttle.Quota = "principal"
+
+		return throttle, false
+	}
+
+	if throttle, ok := topicBuckets.check(now); !ok {
+		throttle.Quota = "topic"
+
+		return throttle, false
+	}
+
+	principalBuckets.requests.take(1)
+	topicBuckets.requests.take(1)
+
+	return Throttle{}, true
+}
+
+// Charge takes the transferred bytes from the byte quotas of the principal
+// and the topic.
+func (m *Manager) Charge(principal, topic string, bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for _, b := range []*buckets{m.principalBuckets(principal), m.topicBuckets(topic)} {
+		b.bytes.refill(now)
+		b.bytes.take(float64(bytes))
+	}
+}
+
+func (m *Manager) principalBuckets(principal string) *buckets {
+	b, ok := m.principals[principal]
+	if !ok {
+		limit, ok := m.config.Principals[principal]
+		if !ok {
+			limit = m.config.Default
+		}
+
+		b = newBuckets(limit)
+		m.principals[principal] = b
+	}
+
+	return b
+}
+
+func (m *Manager) topicBuckets(topic string) *buckets {
+	b, ok := m.topics[topic]
+	if !ok {
+		b = newBuckets(m.config.Topics[topic])
+		m.topics[topic] = b
+	}
+
+	return b
+}
+
+// buckets are the request and byte buckets of a principal or a topic.
+type buckets struct {
+	requests *bucket
+	bytes    *bucket
+}
+
+func newBuckets(limit Limit) *buckets {
+	return &buckets{
+		requests: newBucket(limit.RequestsPerSecond),
+		bytes:    newBucket(limit.BytesPerSecond),
+	}
+}
+
+// check reports whether a request token is available and the bytes are not
+// in debt.
+func (b *buckets) check(now time.Time) (Throttle, bool) {
+	b.requests.refill(now)
+	b.bytes.refill(now)
+
+	if wait := b.requests.wait(1); wait > 0 {
+		return Throttle{Quota: "", Resource: Requests, RetryAfter: wait}, false
+	}
+
+	if wait := b.bytes.wait(0); wait > 0 {
+		return Throttle{Quota: "", Resource: Bytes, RetryAfter: wait}, false
+	}
+
+	return Throttle{}, true
+}
+
+// bucket is a token bucket that holds up to one second of its rate. Its
+// tokens may become negative when bytes are charged after the fact.
+type bucket struct {
+	rate     float64 // tokens per second, zero if unlimited
+	capacity float64 // at least one token, so rates below one are not throttled forever
+	tokens   float64
+	updated  time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	capacity := math.Max(rate, 1)
+
+	return &bucket{rate: rate, capacity: capacity, tokens: capacity, updated: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.rate == 0 || !now.After(b.updated) {
+		return
+	}
+
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+}
+
+func (b *bucket) take(tokens float64) {
+	if b.rate == 0 {
+		return
+	}
+
+	b.tokens -= tokens
+}
+
+// wait returns the time until the bucket has more than the given tokens, or
+// zero if it has them now.
+func (b *bucket) wait(tokens float64) time.Duration {
+	if b.rate == 0 || b.tokens >= tokens {
+		return 0
+	}
+
+	return time.Duration((tokens - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,122 @@
+package quota_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Requests(t *testing.T) {
+	t.Parallel()
+
+	m := quota.NewManager(quota.Config{
+		Default:    quota.Limit{RequestsPerSecond: 2},
+		Principals: map[string]quota.Limit{"batch": {RequestsPerSecond: 1}, "admin": {}},
+		Topics:     nil,
+	})
+
+	for i := 0; i < 2; i++ {
+		_, ok := m.Allow("client", "orders")
+		assert.True(t, ok)
+	}
+
+	throttle, ok := m.Allow("client", "orders")
+	assert.False(t, ok)
+	assert.Equal(t, "principal", throttle.Quota)
+	assert.Equal(t, quota.Requests, throttle.Resource)
+	assert.True(t, throttle.RetryAfter > 0 && throttle.RetryAfter <= 500*time.Millisecond, throttle.RetryAfter)
+
+	// Principals have their own buckets and limits.
+	_, ok = m.Allow("batch", "orders")
+	assert.True(t, ok)
+
+	_, ok = m.Allow("batch", "orders")
+	assert.False(t, ok)
+
+	for i := 0; i < 100; i++ {
+		_, ok = m.Allow("admin", "orders")
+		assert.True(t, ok)
+	}
+}
+
+func TestManager_SlowRate(t *testing.T) {
+	t.Parallel()
+
+	m := quota.NewManager(quota.Config{
+		Default:    quota.Limit{},
+		Principals: map[string]quota.Limit{"slow": {RequestsPerSecond: 0.5}},
+		Topics:     nil,
+	})
+
+	// A rate below one still allows one request at a time.
+	_, ok := m.Allow("slow", "orders")
+	assert.True(t, ok)
+
+	throttle, ok := m.Allow("slow", "orders")
+	assert.False(t, ok)
+	assert.True(t, throttle.RetryAfter > time.Second && throttle.RetryAfter <= 2*time.Second, throttle.RetryAfter)
+}
+
+func TestManager_Bytes(t *testing.T) {
+	t.Parallel()
+
+	m := quota.NewManager(quota.Config{
+		Default:    quota.Limit{},
+		Principals: nil,
+		Topics:     map[string]quota.Limit{"orders": {BytesPerSecond: 100}},
+	})
+
+	_, ok := m.Allow("client", "orders")
+	assert.True(t, ok)
+
+	// The bytes are charged after the request, so the debt throttles the
+	// next requests of all principals on the topic.
+	m.Charge("client", "orders", 300)
+
+	throttle, ok := m.Allow("other", "orders")
+	assert.False(t, ok)
+	assert.Equal(t, "topic", throttle.Quota)
+	assert.Equal(t, quota.Bytes, throttle.Resource)
+	assert.True(t, throttle.RetryAfter > time.Second && throttle.RetryAfter <= 2*time.Second, throttle.RetryAfter)
+
+	_, ok = m.Allow("other", "payments")
+	assert.True(t, ok)
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "quotas.yaml")
+	content := `
+default:
+  requests_per_second: 100
+principals:
+  batch:
+    bytes_per_second: 1048576
+topics:
+  default:
+    requests_per_second: 1000
+`
+
+	err := ioutil.WriteFile(name, []byte(content), 0600)
+	assert.Nil(t, err)
+
+	config, err := quota.Load(name)
+	assert.Nil(t, err)
+	assert.Equal(t, quota.Limit{RequestsPerSecond: 100}, config.Default)
+	assert.Equal(t, quota.Limit{BytesPerSecond: 1048576}, config.Principals["batch"])
+	assert.Equal(t, quota.Limit{RequestsPerSecond: 1000}, config.Topics["default"])
+
+	for _, content := range []string{"default:\n  requests_per_second: -1\n", "defaults: {}\n"} {
+		err := ioutil.WriteFile(name, []byte(content), 0600)
+		assert.Nil(t, err)
+
+		_, err = quota.Load(name)
+		assert.ErrorIs(t, err, quota.ErrInvalidQuotas)
+	}
+}
@@ -0,0 +1,540 @@
+// Package raftstore implements the Raft log store on the log store files and
+// a file stable store, so a replicated log keeps its Raft state in the same
+// durable format as a single log.
+package raftstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+)
+
+// ErrCorruptEntry is returned if a persisted entry cannot be decoded.
+var ErrCorruptEntry = fmt.Errorf("corrupt raft entry")
+
+// ErrStoreFailed is returned by every call after the store file could not be
+// reopened during a compaction. The store must be opened again.
+var ErrStoreFailed = fmt.Errorf("raft log store failed")
+
+// logFileName is the name of the store file with the Raft log.
+const logFileName = "raft.store"
+
+// DefaultMaxEntrySize is the maximum size of a persisted Raft log entry. It is
+// also the maximum size of the entries that are not commands, such as cluster
+// configurations, whatever the maximum size of the commands is.
+const DefaultMaxEntrySize = 1 << 20
+
+// compactThreshold is the minimum number of dead records in the store file
+// before it is compacted.
+const compactThreshold = 1024
+
+// Record kinds of the store file. The store is append-only, so deleted
+// entries are recorded as ranges and dropped when the file is compacted.
+const (
+	entryRecord byte = iota + 1
+	deleteRecord
+)
+
+// Encoded entries are the kind, the index, the term, the type, the append
+// time in Unix nanoseconds, the length-prefixed extensions and the data.
+// Deletions are the kind and the first and the last deleted index.
+const (
+	kindLength       = 1
+	indexLength      = 8
+	termLength       = 8
+	typeLength       = 1
+	timeLength       = 8
+	extensionsLength = 4
+	entryHeaderSize  = kindLength + indexLength + termLength + typeLength + timeLength + extensionsLength
+	deleteRecordSize = kindLength + 2*indexLength
+)
+
+// LogStore is a raft.LogStore that appends entries to a store file. Entries
+// are synced to stable storage before StoreLogs returns.
+type LogStore struct {
+	mu           sync.Mutex
+	dir          string
+	maxEntrySize uint64
+	file         *os.File
+	store        store.Store
+	positions    map[uint64]uint64 // positions of the entries by index
+	first        uint64            // the first index, zero if the log is empty
+	last         uint64            // the last index, zero if the log is empty
+	records      int               // records in the file including dead ones
+	failed       error             // set if the file could not be reopened
+}
+
+// NewLogStore opens the Raft log in the directory. A torn entry at the end of
+// the file, left by a crash during a write, is removed. Commands of up to
+// maxEntrySize bytes are accepted, DefaultMaxEntrySize is used if it is zero.
+// Other entries are limited by DefaultMaxEntrySize, so the configurations of
+// large clusters are not limited by the size of the commands.
+func NewLogStore(dir string, maxEntrySize uint64) (*LogStore, error) {
+	if maxEntrySize == 0 {
+		maxEntrySize = DefaultMaxEntrySize
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the raft directory: %w", err)
+	}
+
+	s := &LogStore{
+		mu:           sync.Mutex{},
+		dir:          dir,
+		maxEntrySize: maxEntrySize,
+		file:         nil,
+		store:        nil,
+		positions:    nil,
+		first:        0,
+		last:         0,
+		records:      0,
+		failed:       nil,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open opens the store file and rebuilds the positions of the entries.
+func (s *LogStore) open() error {
+	name := filepath.Join(s.dir, logFileName)
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600) // nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("failed to open the raft log file: %w", err)
+	}
+
+	positions, records, err := s.scan(file)
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	st, err := store.NewWithConfig(file, store.Config{MaxRecordLength: s.recordLength()}) // nolint:exhaustivestruct
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to open the raft log store: %w", err)
+	}
+
+	s.file = file
+	s.store = st
+	s.positions = positions
+	s.records = records
+	s.first, s.last = 0, 0
+
+	for index := range positions {
+		s.track(index)
+	}
+
+	return nil
+}
+
+// track extends the first and the last index to the stored index.
+func (s *LogStore) track(index uint64) {
+	if s.first == 0 || index < s.first {
+		s.first = index
+	}
+
+	if index > s.last {
+		s.last = index
+	}
+}
+
+// untrack moves the first and the last index to the remaining entries after
+// the entries from min to max are deleted. Raft keeps its log contiguous, so
+// the next remaining entry is usually right after the deleted range.
+func (s *LogStore) untrack(min, max uint64) {
+	if len(s.positions) == 0 {
+		s.first, s.last = 0, 0
+
+		return
+	}
+
+	if s.first >= min && s.first <= max {
+		for s.first = max + 1; s.first < s.last; s.first++ {
+			if _, ok := s.positions[s.first]; ok {
+				break
+			}
+		}
+	}
+
+	if s.last >= min && s.last <= max {
+		for s.last = min - 1; s.last > s.first; s.last-- {
+			if _, ok := s.positions[s.last]; ok {
+				break
+			}
+		}
+	}
+}
+
+// maxSize returns the maximum size of the data and the extensions of the
+// entry.
+func (s *LogStore) maxSize(log *raft.Log) uint64 {
+	if log.Type != raft.LogCommand && s.maxEntrySize < DefaultMaxEntrySize {
+		return DefaultMaxEntrySize
+	}
+
+	return s.maxEntrySize
+}
+
+func (s *LogStore) recordLength() uint64 {
+	if s.maxEntrySize < DefaultMaxEntrySize {
+		return DefaultMaxEntrySize + entryHeaderSize
+	}
+
+	return s.maxEntrySize + entryHeaderSize
+}
+
+// scan reads the records of the file and truncates a torn record at its end.
+func (s *LogStore) scan(file *os.File) (map[uint64]uint64, int, error) {
+	positions := make(map[uint64]uint64)
+	records := 0
+
+	scanner := store.NewScannerWithConfig(file, store.Config{MaxRecordLength: s.recordLength()}) // nolint:exhaustivestruct
+	for scanner.Scan() {
+		frame := scanner.Frame()
+		records++
+
+		if err := applyRecord(positions, frame); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if !errors.Is(err, store.ErrTornFrame) {
+			return nil, 0, fmt.Errorf("failed to read the raft log: %w", err)
+		}
+
+		if err := file.Truncate(int64(scanner.Position())); err != nil {
+			return nil, 0, fmt.Errorf("failed to remove the torn raft entry: %w", err)
+		}
+	}
+
+	return positions, records, nil
+}
+
+func applyRecord(positions map[uint64]uint64, frame store.Frame) error {
+	b := frame.Record
+
+	switch {
+	case len(b) >= entryHeaderSize && b[0] == entryRecord:
+		positions[binary.BigEndian.Uint64(b[kindLength:])] = frame.Position
+	case len(b) == deleteRecordSize && b[0] == deleteRecord:
+		deleteRange(positions, binary.BigEndian.Uint64(b[kindLength:]), binary.BigEndian.Uint64(b[kindLength+indexLength:]))
+	default:
+		return fmt.Errorf("%w at %d", ErrCorruptEntry, frame.Position)
+	}
+
+	return nil
+}
+
+// deleteRange deletes the indexes from min to max, walking the range or the
+// map, whichever is smaller.
+func deleteRange(positions map[uint64]uint64, min, max uint64) {
+	if max < min {
+		return
+	}
+
+	if max-min < uint64(len(positions)) {
+		for index := min; ; index++ {
+			delete(positions, index)
+
+			if index == max {
+				return
+			}
+		}
+	}
+
+	for index := range positions {
+		if index >= min && index <= max {
+			delete(positions, index)
+		}
+	}
+}
+
+// FirstIndex returns the first index of the log or zero if it is empty.
+func (s *LogStore) FirstIndex() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return 0, s.failed
+	}
+
+	return s.first, nil
+}
+
+// LastIndex returns the last index of the log or zero if it is empty.
+func (s *LogStore) LastIndex() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return 0, s.failed
+	}
+
+	return s.last, nil
+}
+
+// GetLog reads the entry at the index. It returns raft.ErrLogNotFound if the
+// log has no such entry.
+func (s *LogStore) GetLog(index uint64, log *raft.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return s.failed
+	}
+
+	position, ok := s.positions[index]
+	if !ok {
+		return raft.ErrLogNotFound
+	}
+
+	b, err := s.store.Read(position)
+	if err != nil {
+		return fmt.Errorf("failed to read the raft entry %d: %w", index, err)
+	}
+
+	return decodeEntry(b, log)
+}
+
+// StoreLog appends the entry.
+func (s *LogStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs appends the entries and syncs them to stable storage.
+func (s *LogStore) StoreLogs(logs []*raft.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return s.failed
+	}
+
+	for _, log := range logs {
+		if uint64(len(log.Data)+len(log.Extensions)) > s.maxSize(log) {
+			return fmt.Errorf("%w: raft entry %d", store.ErrMaxRecordLength, log.Index)
+		}
+
+		_, position, err := s.store.Append(encodeEntry(log))
+		if err != nil {
+			return fmt.Errorf("failed to append the raft entry %d: %w", log.Index, err)
+		}
+
+		s.positions[log.Index] = position
+		s.track(log.Index)
+		s.records++
+	}
+
+	if err := s.store.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the raft log: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRange deletes the entries from min to max inclusive. The file is
+// compacted when most of its records are dead.
+func (s *LogStore) DeleteRange(min, max uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return s.failed
+	}
+
+	b := make([]byte, deleteRecordSize)
+	b[0] = deleteRecord
+	binary.BigEndian.PutUint64(b[kindLength:], min)
+	binary.BigEndian.PutUint64(b[kindLength+indexLength:], max)
+
+	if _, _, err := s.store.Append(b); err != nil {
+		return fmt.Errorf("failed to delete the raft entries: %w", err)
+	}
+
+	if err := s.store.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the raft log: %w", err)
+	}
+
+	deleteRange(s.positions, min, max)
+	s.untrack(min, max)
+	s.records++
+
+	if dead := s.records - len(s.positions); dead > compactThreshold && dead > len(s.positions) {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// compact rewrites the live entries to a new file and replaces the current
+// file with it. If the file cannot be reopened after it is closed, the store
+// fails and returns ErrStoreFailed from then on, as it has no open file.
+func (s *LogStore) compact() error {
+	indexes := make([]uint64, 0, len(s.positions))
+	for index := range s.positions {
+		indexes = append(indexes, index)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	name := filepath.Join(s.dir, logFileName)
+	compactName := name + ".compact"
+
+	file, err := os.OpenFile(compactName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600) // nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("failed to create the compacted raft log: %w", err)
+	}
+
+	compacted, err := store.NewWithConfig(file, store.Config{MaxRecordLength: s.recordLength()}) // nolint:exhaustivestruct
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to create the compacted raft log: %w", err)
+	}
+
+	for _, index := range indexes {
+		b, err := s.store.Read(s.positions[index])
+		if err != nil {
+			_ = compacted.Close()
+
+			return fmt.Errorf("failed to read the raft entry %d: %w", index, err)
+		}
+
+		if _, _, err := compacted.Append(b); err != nil {
+			_ = compacted.Close()
+
+			return fmt.Errorf("failed to compact the raft entry %d: %w", index, err)
+		}
+	}
+
+	if err := compacted.Sync(); err != nil {
+		_ = compacted.Close()
+
+		return fmt.Errorf("failed to sync the compacted raft log: %w", err)
+	}
+
+	if err := compacted.Close(); err != nil {
+		return fmt.Errorf("failed to close the compacted raft log: %w", err)
+	}
+
+	if err := s.store.Close(); err != nil {
+		return fmt.Errorf("failed to close the raft log: %w", err)
+	}
+
+	if err := os.Rename(compactName, name); err != nil {
+		// The current file is still complete, it is opened again.
+		if openErr := s.open(); openErr != nil {
+			s.failed = fmt.Errorf("%w: %v", ErrStoreFailed, openErr) // nolint:errorlint
+		}
+
+		return fmt.Errorf("failed to replace the raft log: %w", err)
+	}
+
+	if err := s.open(); err != nil {
+		s.failed = fmt.Errorf("%w: %v", ErrStoreFailed, err) // nolint:errorlint
+
+		return s.failed
+	}
+
+	return nil
+}
+
+// Close closes the store file. A failed store has no open file.
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return nil
+	}
+
+	if err := s.store.Close(); err != nil {
+		return fmt.Errorf("failed to close the raft log: %w", err)
+	}
+
+	return nil
+}
+
+func encodeEntry(log *raft.Log) []byte {
+	b := make([]byte, entryHeaderSize+len(log.Extensions)+len(log.Data))
+	n := 0
+	b[n] = entryRecord
+	n += kindLength
+	binary.BigEndian.PutUint64(b[n:], log.Index)
+	n += indexLength
+	binary.BigEndian.PutUint64(b[n:], log.Term)
+	n += termLength
+	b[n] = byte(log.Type)
+	n += typeLength
+
+	appendedAt := int64(0)
+	if !log.AppendedAt.IsZero() {
+		appendedAt = log.AppendedAt.UnixNano()
+	}
+
+	binary.BigEndian.PutUint64(b[n:], uint64(appendedAt))
+	n += timeLength
+	binary.BigEndian.PutUint32(b[n:], uint32(len(log.Extensions)))
+	n += extensionsLength
+	n += copy(b[n:], log.Extensions)
+	copy(b[n:], log.Data)
+
+	return b
+}
+
+func decodeEntry(b []byte, log *raft.Log) error {
+	if len(b) < entryHeaderSize || b[0] != entryRecord {
+		return ErrCorruptEntry
+	}
+
+	n := kindLength
+	log.Index = binary.BigEndian.Uint64(b[n:])
+	n += indexLength
+	log.Term = binary.BigEndian.Uint64(b[n:])
+	n += termLength
+	log.Type = raft.LogType(b[n])
+	n += typeLength
+
+	log.AppendedAt = time.Time{}
+	if appendedAt := int64(binary.BigEndian.Uint64(b[n:])); appendedAt != 0 {
+		log.AppendedAt = time.Unix(0, appendedAt)
+	}
+
+	n += timeLength
+	extensions := int(binary.BigEndian.Uint32(b[n:]))
+	n += extensionsLength
+
+	if len(b) < n+extensions {
+		return ErrCorruptEntry
+	}
+
+	log.Extensions = nil
+	if extensions > 0 {
+		log.Extensions = b[n : n+extensions]
+	}
+
+	n += extensions
+
+	log.Data = nil
+	if len(b) > n {
+		log.Data = b[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package raftstore_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/raftstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := raftstore.NewLogStore(dir, 0)
+	assert.Nil(t, err)
+
+	appendedAt := time.Unix(0, time.Now().UnixNano())
+	logs := make([]*raft.Log, 0, 3)
+
+	for i := uint64(1); i <= 3; i++ {
+		logs = append(logs, &raft.Log{
+			Index:      i,
+			Term:       2,
+			Type:       raft.LogCommand,
+			Data:       []byte{byte(i)},
+			Extensions: []byte("ext"),
+			AppendedAt: appendedAt,
+		})
+	}
+
+	assert.Nil(t, s.StoreLogs(logs))
+
+	var log raft.Log
+	assert.Nil(t, s.GetLog(2, &log))
+	assert.Equal(t, *logs[1], log)
+	assert.ErrorIs(t, s.GetLog(4, &log), raft.ErrLogNotFound)
+
+	assert.Nil(t, s.DeleteRange(1, 1))
+	assert.Nil(t, s.Close())
+
+	s, err = raftstore.NewLogStore(dir, 0)
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	first, err := s.FirstIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), first)
+
+	last, err := s.LastIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), last)
+
+	assert.ErrorIs(t, s.GetLog(1, &log), raft.ErrLogNotFound)
+	assert.Nil(t, s.GetLog(3, &log))
+	assert.Equal(t, []byte{3}, log.Data)
+}
+
+func TestLogStore_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := raftstore.NewLogStore(dir, 0)
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	const count = 3000
+
+	for i := uint64(1); i <= count; i++ {
+		assert.Nil(t, s.StoreLog(&raft.Log{Index: i, Term: 1, Data: []byte("value")})) // nolint:exhaustivestruct
+	}
+
+	stat, err := os.Stat(filepath.Join(dir, "raft.store"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.DeleteRange(1, count-10))
+
+	compacted, err := os.Stat(filepath.Join(dir, "raft.store"))
+	assert.Nil(t, err)
+	assert.Less(t, compacted.Size(), stat.Size()/10)
+
+	first, err := s.FirstIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(count-9), first)
+
+	var log raft.Log
+	assert.Nil(t, s.GetLog(count, &log))
+	assert.Equal(t, []byte("value"), log.Data)
+}
+
+func TestLogStore_Indexes(t *testing.T) {
+	s, err := raftstore.NewLogStore(t.TempDir(), 0)
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	assertIndexes := func(first, last uint64) {
+		t.Helper()
+
+		index, err := s.FirstIndex()
+		assert.Nil(t, err)
+		assert.Equal(t, first, index)
+
+		index, err = s.LastIndex()
+		assert.Nil(t, err)
+		assert.Equal(t, last, index)
+	}
+
+	assertIndexes(0, 0)
+
+	for i := uint64(1); i <= 10; i++ {
+		assert.Nil(t, s.StoreLog(&raft.Log{Index: i, Term: 1, Data: []byte("value")})) // nolint:exhaustivestruct
+	}
+
+	assertIndexes(1, 10)
+
+	// A conflicting suffix is deleted and replaced.
+	assert.Nil(t, s.DeleteRange(8, 10))
+	assertIndexes(1, 7)
+
+	assert.Nil(t, s.StoreLog(&raft.Log{Index: 8, Term: 2, Data: []byte("value")})) // nolint:exhaustivestruct
+	assertIndexes(1, 8)
+
+	// The prefix is deleted after a snapshot.
+	assert.Nil(t, s.DeleteRange(1, 5))
+	assertIndexes(6, 8)
+
+	assert.Nil(t, s.DeleteRange(6, 8))
+	assertIndexes(0, 0)
+}
+
+func TestLogStore_TornEntry(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := raftstore.NewLogStore(dir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, s.StoreLog(&raft.Log{Index: 1, Term: 1, Data: []byte("value")})) // nolint:exhaustivestruct
+	assert.Nil(t, s.Close())
+
+	file, err := os.OpenFile(filepath.Join(dir, "raft.store"), os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Nil(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 0, 0, 0, 0, 40, 1, 2})
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	s, err = raftstore.NewLogStore(dir, 0)
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	assert.Nil(t, s.StoreLog(&raft.Log{Index: 2, Term: 1, Data: []byte("next")})) // nolint:exhaustivestruct
+
+	var log raft.Log
+	assert.Nil(t, s.GetLog(1, &log))
+	assert.Equal(t, []byte("value"), log.Data)
+	assert.Nil(t, s.GetLog(2, &log))
+	assert.Equal(t, []byte("next"), log.Data)
+}
+
+func TestStableStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := raftstore.NewStableStore(dir)
+	assert.Nil(t, err)
+
+	_, err = s.Get([]byte("key"))
+	assert.EqualError(t, err, "not found")
+
+	_, err = s.GetUint64([]byte("term"))
+	assert.ErrorIs(t, err, raftstore.ErrKeyNotFound)
+
+	assert.Nil(t, s.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, s.SetUint64([]byte("term"), 42))
+
+	s, err = raftstore.NewStableStore(dir)
+	assert.Nil(t, err)
+
+	value, err := s.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	term, err := s.GetUint64([]byte("term"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), term)
+}
+
+func TestLogStore_MaxEntrySize(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := raftstore.NewLogStore(dir, 64)
+	assert.Nil(t, err)
+
+	var configuration raft.Configuration
+
+	for i := 1; i <= 5; i++ {
+		configuration.Servers = append(configuration.Servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(fmt.Sprintf("node-%d", i)),
+			Address:  raft.ServerAddress(fmt.Sprintf("node-%d.proglog.default.svc.cluster.local:7000", i)),
+		})
+	}
+
+	data := raft.EncodeConfiguration(configuration)
+	assert.Greater(t, len(data), 64)
+
+	// The limit applies to commands only, so the configuration of a larger
+	// cluster is stored.
+	assert.Nil(t, s.StoreLog(&raft.Log{Index: 1, Term: 1, Type: raft.LogConfiguration, Data: data})) // nolint:exhaustivestruct
+
+	err = s.StoreLog(&raft.Log{Index: 2, Term: 1, Type: raft.LogCommand, Data: data}) // nolint:exhaustivestruct
+	assert.ErrorIs(t, err, store.ErrMaxRecordLength)
+
+	assert.Nil(t, s.Close())
+
+	s, err = raftstore.NewLogStore(dir, 64)
+	assert.Nil(t, err)
+
+	defer s.Close() // nolint:errcheck
+
+	var log raft.Log
+	assert.Nil(t, s.GetLog(1, &log))
+	assert.Equal(t, raft.LogConfiguration, log.Type)
+	assert.Equal(t, configuration, raft.DecodeConfiguration(log.Data))
+}
@@ -0,0 +1,150 @@
+package raftstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrKeyNotFound is returned if the stable store has no value for the key.
+// Raft recognizes missing keys by the "not found" text of the error.
+var ErrKeyNotFound = fmt.Errorf("not found")
+
+// stableFileName is the name of the file with the Raft stable state.
+const stableFileName = "raft.stable"
+
+// StableStore is a raft.StableStore that keeps the values in a JSON file. The
+// file is replaced atomically on every change, which is fine for the few
+// rarely changed values Raft keeps there, such as the current term and vote.
+type StableStore struct {
+	mu     sync.Mutex
+	name   string
+	values map[string][]byte
+}
+
+// NewStableStore opens the stable store in the directory.
+func NewStableStore(dir string) (*StableStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the raft directory: %w", err)
+	}
+
+	s := &StableStore{
+		mu:     sync.Mutex{},
+		name:   filepath.Join(dir, stableFileName),
+		values: make(map[string][]byte),
+	}
+
+	b, err := ioutil.ReadFile(s.name)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the raft stable store: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &s.values); err != nil {
+		return nil, fmt.Errorf("failed to decode the raft stable store: %w", err)
+	}
+
+	return s, nil
+}
+
+// Set stores the value of the key.
+func (s *StableStore) Set(key []byte, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make(map[string][]byte, len(s.values)+1)
+	for k, v := range s.values {
+		values[k] = v
+	}
+
+	values[string(key)] = append([]byte(nil), value...)
+
+	if err := s.write(values); err != nil {
+		return err
+	}
+
+	s.values = values
+
+	return nil
+}
+
+// Get returns the value of the key or ErrKeyNotFound.
+func (s *StableStore) Get(key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return append([]byte(nil), value...), nil
+}
+
+// SetUint64 stores the number as the value of the key.
+func (s *StableStore) SetUint64(key []byte, value uint64) error {
+	b := make([]byte, 8) // nolint:gomnd
+	binary.BigEndian.PutUint64(b, value)
+
+	return s.Set(key, b)
+}
+
+// GetUint64 returns the number stored as the value of the key. It returns zero
+// with ErrKeyNotFound if the key is not set.
+func (s *StableStore) GetUint64(key []byte) (uint64, error) {
+	b, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(b) != 8 { // nolint:gomnd
+		return 0, fmt.Errorf("%w: value of %q", ErrCorruptEntry, key)
+	}
+
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// write replaces the file with the values: it writes and syncs a temporary
+// file and renames it.
+func (s *StableStore) write(values map[string][]byte) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode the raft stable store: %w", err)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(s.name), ".raft.stable")
+	if err != nil {
+		return fmt.Errorf("failed to write the raft stable store: %w", err)
+	}
+
+	defer os.Remove(file.Name()) // nolint:errcheck
+
+	if _, err := file.Write(b); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to write the raft stable store: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to sync the raft stable store: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write the raft stable store: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), s.name); err != nil {
+		return fmt.Errorf("failed to replace the raft stable store: %w", err)
+	}
+
+	return nil
+}
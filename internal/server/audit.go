@@ -0,0 +1,403 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// auditDayLayout is the layout of the names of the daily audit log
+// directories. Retention removes whole days.
+const auditDayLayout = "2006-01-02"
+
+// auditMaxEventSize is the maximum size of a persisted audit event.
+const auditMaxEventSize = 4096
+
+// DefaultAuditRetention is the time audit events are kept for.
+const DefaultAuditRetention = 30 * 24 * time.Hour
+
+// Outcomes of audited actions.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// Audited actions.
+const (
+	AuditACLReload      = "acl.reload"
+	AuditLogLevelChange = "log_level.change"
+	AuditConsume        = "consume"
+	AuditAuthorize      = "authorize"
+	AuditReassign       = "reassignment.start"
+	AuditReassignCancel = "reassignment.cancel"
+	AuditReassignLimit  = "reassignment.throttle"
+	AuditSnapshot       = "snapshot.create"
+)
+
+// AuditEvent is an administrative or data-access action of a principal.
+type AuditEvent struct {
+	Time      time.Time         `json:"time"`
+	Principal string            `json:"principal"`
+	Action    string            `json:"action"`
+	Resource  string            `json:"resource,omitempty"`
+	Outcome   string            `json:"outcome"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// AuditFilter selects audit events. Empty fields match all events.
+type AuditFilter struct {
+	Principal string
+	Action    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+func (f AuditFilter) match(event AuditEvent) bool {
+	return (f.Principal == "" || event.Principal == f.Principal) &&
+		(f.Action == "" || event.Action == f.Action) &&
+		(f.Since.IsZero() || !event.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || event.Time.Before(f.Until))
+}
+
+// AuditConfig configures the audit log.
+type AuditConfig struct {
+	// Dir is the directory of the audit log. It must not be the directory of
+	// the user log.
+	Dir string
+
+	// Retention is the time events are kept for. Events are removed by whole
+	// days. DefaultAuditRetention is used if it is zero.
+	Retention time.Duration
+
+	// Consume makes the server audit consume requests too.
+	Consume bool
+
+	// Log configures the daily logs. Events are synced to stable storage
+	// before they are acknowledged if the sync policy is empty.
+	Log LogConfig
+}
+
+// AuditLog keeps audit events in a log of the same durable format as user
+// records, one log per day, separately from the user log.
+type AuditLog struct {
+	mu        sync.Mutex
+	dir       string
+	retention time.Duration
+	consume   bool
+	config    LogConfig
+	day       string
+	log       *Log // the log of the current day, nil until the first event
+}
+
+// OpenAuditLog opens the audit log in the directory and removes the days
+// beyond the retention.
+func OpenAuditLog(config AuditConfig) (*AuditLog, error) {
+	if config.Retention == 0 {
+		config.Retention = DefaultAuditRetention
+	}
+
+	if config.Log.SyncPolicy == "" {
+		config.Log.SyncPolicy = SyncAlways
+	}
+
+	if config.Log.MaxRecordSize == 0 {
+		config.Log.MaxRecordSize = auditMaxEventSize
+	}
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the audit log directory: %w", err)
+	}
+
+	a := &AuditLog{
+		mu:        sync.Mutex{},
+		dir:       config.Dir,
+		retention: config.Retention,
+		consume:   config.Consume,
+		config:    config.Log,
+		day:       "",
+		log:       nil,
+	}
+
+	if err := a.removeExpired(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Record appends the event to the log of its day. The time of the event is
+// set if it is zero.
+func (a *AuditLog) Record(event AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	event.Time = event.Time.UTC()
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode the audit event: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	day := event.Time.Format(auditDayLayout)
+	if day != a.day {
+		if err := a.rotate(day, event.Time); err != nil {
+			return err
+		}
+	}
+
+	if _, err := a.log.Append(value); err != nil {
+		return fmt.Errorf("failed to append the audit event: %w", err)
+	}
+
+	return nil
+}
+
+// rotate closes the log of the previous day, opens the log of the day and
+// removes the days beyond the retention.
+func (a *AuditLog) rotate(day string, now time.Time) error {
+	if a.log != nil {
+		if err := a.log.Close(); err != nil {
+			return fmt.Errorf("failed to close the audit log of %s: %w", a.day, err)
+		}
+
+		a.log = nil
+	}
+
+	log, err := OpenLog(filepath.Join(a.dir, day), a.config)
+	if err != nil {
+		return fmt.Errorf("failed to open the audit log of %s: %w", day, err)
+	}
+
+	a.day = day
+	a.log = log
+
+	return a.removeExpired(now)
+}
+
+// removeExpired removes the days that ended before the retention.
+func (a *AuditLog) removeExpired(now time.Time) error {
+	days, err := a.days()
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		start, _ := time.Parse(auditDayLayout, day) // the names are checked by days
+		if start.Add(24 * time.Hour).Add(a.retention).After(now) {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(a.dir, day)); err != nil {
+			return fmt.Errorf("failed to remove the audit log of %s: %w", day, err)
+		}
+	}
+
+	return nil
+}
+
+// days returns the days of the audit log in chronological order.
+func (a *AuditLog) days() ([]string, error) {
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the audit log directory: %w", err)
+	}
+
+	var days []string
+
+	for _, file := range files {
+		if _, err := time.Parse(auditDayLayout, file.Name()); file.IsDir() && err == nil {
+			days = append(days, file.Name())
+		}
+	}
+
+	sort.Strings(days)
+
+	return days, nil
+}
+
+// Query returns the events that match the filter in chronological order, up
+// to the limit if it is positive.
+func (a *AuditLog) Query(filter AuditFilter) ([]AuditEvent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	days, err := a.days()
+	if err != nil {
+		return nil, err
+	}
+
+	events := []AuditEvent{}
+
+	for _, day := range days {
+		if !filter.Until.IsZero() && day > filter.Until.UTC().Format(auditDayLayout) {
+			break
+		}
+
+		if !filter.Since.IsZero() && day < filter.Since.UTC().Format(auditDayLayout) {
+			continue
+		}
+
+		if events, err = a.queryDay(day, filter, events); err != nil {
+			return nil, err
+		}
+
+		if filter.Limit > 0 && len(events) >= filter.Limit {
+			return events[:filter.Limit], nil
+		}
+	}
+
+	return events, nil
+}
+
+func (a *AuditLog) queryDay(day string, filter AuditFilter, events []AuditEvent) ([]AuditEvent, error) {
+	log := a.log
+
+	if day != a.day {
+		var err error
+		if log, err = OpenLog(filepath.Join(a.dir, day), a.config); err != nil {
+			return nil, fmt.Errorf("failed to open the audit log of %s: %w", day, err)
+		}
+
+		defer log.Close() // nolint:errcheck
+	}
+
+	for offset := uint64(0); ; offset++ {
+		record, err := log.Read(offset)
+		if errors.Is(err, ErrOffsetNotFound) {
+			return events, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the audit log of %s: %w", day, err)
+		}
+
+		var event AuditEvent
+		if err := json.Unmarshal(record.Value, &event); err != nil {
+			return nil, fmt.Errorf("%w: audit event %d of %s: %v", ErrCorruptRecord, offset, day, err) // nolint:errorlint
+		}
+
+		if filter.match(event) {
+			events = append(events, event)
+		}
+	}
+}
+
+// Close closes the log of the current day.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.log == nil {
+		return nil
+	}
+
+	return a.log.Close()
+}
+
+// auditing wraps the handler to record the action of its requests on the
+// resource in the audit log with the outcome by the response status. The
+// details function adds details of the action after the request if it is not
+// nil. Handlers are not wrapped if the audit log is nil.
+func auditing(audit *AuditLog) func(string, string, func() map[string]string, http.Handler) http.Handler {
+	return func(action, resource string, details func() map[string]string, next http.Handler) http.Handler {
+		if audit == nil || (action == AuditConsume && !audit.consume) {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r)
+
+			outcome := AuditSuccess
+			if recorder.status >= http.StatusBadRequest {
+				outcome = AuditFailure
+			}
+
+			event := AuditEvent{
+				Principal: auth.PrincipalFromContext(r.Context()),
+				Action:    action,
+				Resource:  resource,
+				Outcome:   outcome,
+				RequestID: w.Header().Get(requestIDHeader),
+				Details:   map[string]string{"status": strconv.Itoa(recorder.status)},
+			}
+
+			if details != nil {
+				for k, v := range details() {
+					event.Details[k] = v
+				}
+			}
+
+			recordAudit(r.Context(), audit, event)
+		})
+	}
+}
+
+// auditingGRPC is a gRPC middleware that records the audited actions of the
+// methods in grpcMethods on the log topic like auditing, with the outcome by
+// the status code of the call. Nothing is recorded if the audit log is nil.
+func auditingGRPC(audit *AuditLog) grpcMiddleware {
+	return func(ctx context.Context, call *grpcCall, next func(context.Context) error) error {
+		action := grpcMethods[call.method].audit
+		if audit == nil || action == "" || (action == AuditConsume && !audit.consume) {
+			return next(ctx)
+		}
+
+		err := next(ctx)
+
+		code := status.Code(err)
+
+		outcome := AuditSuccess
+		if code != codes.OK {
+			outcome = AuditFailure
+		}
+
+		recordAudit(ctx, audit, AuditEvent{
+			Principal: auth.PrincipalFromContext(ctx),
+			Action:    action,
+			Resource:  logTopic,
+			Outcome:   outcome,
+			RequestID: requestIDFromContext(ctx),
+			Details:   map[string]string{"code": code.String()},
+		})
+
+		return err
+	}
+}
+
+// recordAudit records the event if the audit log is not nil and logs a
+// failure to record it.
+func recordAudit(ctx context.Context, audit *AuditLog, event AuditEvent) {
+	if audit == nil {
+		return
+	}
+
+	if err := audit.Record(event); err != nil {
+		loggerFromContext(ctx).Error("Failed to record the audit event",
+			zap.Error(err),
+			zap.String("action", event.Action),
+		)
+	}
+}
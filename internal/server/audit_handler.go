@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits of the number of events returned by an audit query.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditResponse is a response on the audit query.
+type AuditResponse struct {
+	Events []AuditEvent `json:"events"`
+}
+
+// NewAuditHandler creates a handler function that returns the audit events
+// selected by the principal, action, since and until (RFC 3339) and limit
+// query parameters.
+func NewAuditHandler(audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		filter := AuditFilter{
+			Principal: query.Get("principal"),
+			Action:    query.Get("action"),
+			Since:     time.Time{},
+			Until:     time.Time{},
+			Limit:     defaultAuditLimit,
+		}
+
+		var err error
+
+		if v := query.Get("since"); v != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "Bad since time")
+
+				return
+			}
+		}
+
+		if v := query.Get("until"); v != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "Bad until time")
+
+				return
+			}
+		}
+
+		if v := query.Get("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+				writeErrorResponse(w, http.StatusBadRequest, "Bad limit")
+
+				return
+			}
+		}
+
+		events, err := audit.Query(filter)
+		if err != nil {
+			writeInternalError(w, r, err)
+
+			return
+		}
+
+		writeResponse(w, http.StatusOK, AuditResponse{Events: events})
+	}
+}
@@ -0,0 +1,180 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAuditLog_Query(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	audit, err := server.OpenAuditLog(server.AuditConfig{Dir: dir})
+	assert.Nil(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	yesterday := now.Add(-24 * time.Hour)
+
+	events := []server.AuditEvent{
+		{Time: yesterday, Principal: "alice", Action: server.AuditLogLevelChange, Outcome: server.AuditSuccess},
+		{Time: now, Principal: "bob", Action: server.AuditConsume, Resource: "default", Outcome: server.AuditSuccess},
+		{Time: now, Principal: "alice", Action: server.AuditAuthorize, Outcome: server.AuditDenied},
+	}
+
+	for _, event := range events {
+		err := audit.Record(event)
+		assert.Nil(t, err)
+	}
+
+	all, err := audit.Query(server.AuditFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, events, all)
+
+	byPrincipal, err := audit.Query(server.AuditFilter{Principal: "alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, []server.AuditEvent{events[0], events[2]}, byPrincipal)
+
+	since, err := audit.Query(server.AuditFilter{Since: now})
+	assert.Nil(t, err)
+	assert.Equal(t, events[1:], since)
+
+	limited, err := audit.Query(server.AuditFilter{Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, events[:1], limited)
+
+	err = audit.Close()
+	assert.Nil(t, err)
+
+	// The events are durable and kept in a log per day.
+	days, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, days, 2)
+
+	audit, err = server.OpenAuditLog(server.AuditConfig{Dir: dir})
+	assert.Nil(t, err)
+
+	all, err = audit.Query(server.AuditFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, events, all)
+
+	err = audit.Close()
+	assert.Nil(t, err)
+}
+
+func TestAuditLog_Retention(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	audit, err := server.OpenAuditLog(server.AuditConfig{Dir: dir})
+	assert.Nil(t, err)
+
+	old := server.AuditEvent{Time: time.Now().Add(-10 * 24 * time.Hour), Principal: "alice", Action: "old"}
+	err = audit.Record(old)
+	assert.Nil(t, err)
+
+	err = audit.Close()
+	assert.Nil(t, err)
+
+	audit, err = server.OpenAuditLog(server.AuditConfig{Dir: dir, Retention: 7 * 24 * time.Hour})
+	assert.Nil(t, err)
+
+	events, err := audit.Query(server.AuditFilter{})
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	_, err = os.Stat(filepath.Join(dir, old.Time.UTC().Format("2006-01-02")))
+	assert.True(t, os.IsNotExist(err))
+
+	err = audit.Close()
+	assert.Nil(t, err)
+}
+
+func TestHTTPServer_Audit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	acl := filepath.Join(dir, "acl.yaml")
+
+	err := ioutil.WriteFile(acl, []byte("rules:\n  - principals: [admin]\n    topics: [\"*\"]\n    actions: [admin, consume]\n"), 0600)
+	assert.Nil(t, err)
+
+	authorizer, err := auth.NewAuthorizer(acl)
+	assert.Nil(t, err)
+
+	audit, err := server.OpenAuditLog(server.AuditConfig{Dir: filepath.Join(dir, "audit"), Consume: true})
+	assert.Nil(t, err)
+
+	defer audit.Close() // nolint:errcheck
+
+	keys := filepath.Join(dir, "keys.yaml")
+	err = ioutil.WriteFile(keys, []byte("keys:\n  - principal: admin\n    sha256: "+auth.HashAPIKey("secret")+"\n"), 0600)
+	assert.Nil(t, err)
+
+	apiKeys, err := auth.LoadAPIKeys(keys)
+	assert.Nil(t, err)
+
+	level := zap.NewAtomicLevel()
+
+	srv := server.NewHTTPServer(server.HTTPConfig{
+		Log:           server.NewLog(),
+		LogLevel:      &level,
+		Authorizer:    authorizer,
+		Authenticator: auth.NewAuthenticator(apiKeys, nil),
+		Audit:         audit,
+	})
+
+	request := func(method, path, body, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPut, "/log/level", `{"level":"debug"}`, "secret").Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/", `{"value":"dGVzdA=="}`, "").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/", `{"offset":0}`, "secret").Code)
+
+	w := request(http.MethodGet, "/v1/audit?principal=admin", "", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response server.AuditResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Len(t, response.Events, 2)
+	assert.Equal(t, server.AuditLogLevelChange, response.Events[0].Action)
+	assert.Equal(t, "debug", response.Events[0].Details["level"])
+	assert.Equal(t, server.AuditConsume, response.Events[1].Action)
+	assert.Equal(t, server.AuditFailure, response.Events[1].Outcome)
+
+	w = request(http.MethodGet, "/v1/audit?action=authorize", "", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Len(t, response.Events, 1)
+	assert.Equal(t, auth.Anonymous, response.Events[0].Principal)
+	assert.Equal(t, server.AuditDenied, response.Events[0].Outcome)
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/v1/audit?since=yesterday", "", "secret").Code)
+}
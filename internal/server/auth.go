@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// logTopic is the topic of the log in access control lists. The log is not
+// split into topics yet, so it is the only topic.
+const logTopic = "default"
+
+// bearerPrefix is the prefix of bearer tokens in the Authorization header.
+const bearerPrefix = "Bearer "
+
+// authentication is a middleware that adds the principal of the client to the
+// context and the logger of the request. The principal is taken from the
+// bearer token if the request has one and the authenticator is not nil, then
+// from the verified client certificate. Other clients are anonymous. Requests
+// with invalid tokens are rejected with 401.
+func authentication(authenticator *auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.CertificatePrincipal(r.TLS)
+			if !ok {
+				principal = auth.Anonymous
+			}
+
+			header := r.Header.Get("Authorization")
+			if authenticator != nil && strings.HasPrefix(header, bearerPrefix) {
+				var err error
+
+				principal, err = authenticator.Authenticate(strings.TrimPrefix(header, bearerPrefix))
+				if err != nil {
+					loggerFromContext(r.Context()).Warn("Authentication failed", zap.Error(err))
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					writeErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+
+					return
+				}
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			ctx = withLogger(ctx, loggerFromContext(ctx).With(zap.String("principal", principal)))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authorization wraps the handler to allow requests only if the authorizer
+// allows the action of the handler to the principal. Denials are logged and
+// recorded in the audit log if it is not nil. All requests are allowed if the
+// authorizer is nil.
+func authorization(authorizer *auth.Authorizer, audit *AuditLog) func(auth.Action, http.Handler) http.Handler {
+	return func(action auth.Action, next http.Handler) http.Handler {
+		if authorizer == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.PrincipalFromContext(r.Context())
+
+			if err := authorizer.Authorize(principal, logTopic, action); err != nil {
+				loggerFromContext(r.Context()).Warn("Permission denied",
+					zap.String("action", string(action)),
+					zap.String("topic", logTopic),
+				)
+				recordAudit(r.Context(), audit, AuditEvent{
+					Principal: principal,
+					Action:    AuditAuthorize,
+					Resource:  logTopic,
+					Outcome:   AuditDenied,
+					RequestID: w.Header().Get(requestIDHeader),
+					Details:   map[string]string{"action": string(action), "path": r.URL.Path},
+				})
+				writeErrorResponse(w, http.StatusForbidden, "Permission denied")
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticationGRPC is a gRPC middleware that adds the principal of the
+// client to the context and the logger of the call like authentication. The
+// bearer token is taken from the authorization metadata. Calls with invalid
+// tokens are rejected with Unauthenticated.
+func authenticationGRPC(authenticator *auth.Authenticator) grpcMiddleware {
+	return func(ctx context.Context, _ *grpcCall, next func(context.Context) error) error {
+		principal := auth.Anonymous
+
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				if certificatePrincipal, ok := auth.CertificatePrincipal(&info.State); ok {
+					principal = certificatePrincipal
+				}
+			}
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("authorization"); authenticator != nil && len(values) != 0 &&
+			strings.HasPrefix(values[0], bearerPrefix) {
+			var err error
+
+			principal, err = authenticator.Authenticate(strings.TrimPrefix(values[0], bearerPrefix))
+			if err != nil {
+				loggerFromContext(ctx).Warn("Authentication failed", zap.Error(err))
+
+				return status.Error(codes.Unauthenticated, "Invalid token")
+			}
+		}
+
+		ctx = auth.WithPrincipal(ctx, principal)
+		ctx = withLogger(ctx, loggerFromContext(ctx).With(zap.String("principal", principal)))
+
+		return next(ctx)
+	}
+}
+
+// authorizationGRPC is a gRPC middleware that allows calls of the methods in
+// grpcMethods only if the authorizer allows their actions to the principal
+// like authorization. Denied calls get PermissionDenied. All calls are
+// allowed if the authorizer is nil.
+func authorizationGRPC(authorizer *auth.Authorizer, audit *AuditLog) grpcMiddleware {
+	return func(ctx context.Context, call *grpcCall, next func(context.Context) error) error {
+		method, ok := grpcMethods[call.method]
+		if authorizer == nil || !ok {
+			return next(ctx)
+		}
+
+		principal := auth.PrincipalFromContext(ctx)
+
+		if err := authorizer.Authorize(principal, logTopic, method.action); err != nil {
+			loggerFromContext(ctx).Warn("Permission denied",
+				zap.String("action", string(method.action)),
+				zap.String("topic", logTopic),
+			)
+			recordAudit(ctx, audit, AuditEvent{
+				Principal: principal,
+				Action:    AuditAuthorize,
+				Resource:  logTopic,
+				Outcome:   AuditDenied,
+				RequestID: requestIDFromContext(ctx),
+				Details:   map[string]string{"action": string(method.action), "method": call.method},
+			})
+
+			return status.Error(codes.PermissionDenied, "Permission denied")
+		}
+
+		return next(ctx)
+	}
+}
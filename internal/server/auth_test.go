@@ -0,0 +1,125 @@
+package server_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHTTPServer_Authorization(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "acl.yaml")
+	policy := `
+rules:
+  - principals: [producer]
+    topics: [default]
+    actions: [produce]
+  - principals: ["*"]
+    topics: ["*"]
+    actions: [consume]
+  - principals: [replica]
+    topics: ["*"]
+    actions: [replicate]
+`
+
+	err := ioutil.WriteFile(name, []byte(policy), 0600)
+	assert.Nil(t, err)
+
+	authorizer, err := auth.NewAuthorizer(name)
+	assert.Nil(t, err)
+
+	core, logs := observer.New(zap.WarnLevel)
+
+	srv := server.NewHTTPServer(server.HTTPConfig{
+		Log:        server.NewLog(),
+		Logger:     zap.New(core),
+		Authorizer: authorizer,
+	})
+
+	request := func(method, path, body, principal string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+
+		if principal != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: principal}}        // nolint:exhaustivestruct
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}} // nolint:exhaustivestruct
+		}
+
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/", `{"value":"dGVzdA=="}`, "producer"))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/", `{"value":"dGVzdA=="}`, "consumer"))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/", `{"value":"dGVzdA=="}`, ""))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/", `{"offset":0}`, "consumer"))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/v1/status", "", "consumer"))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/v1/replicas/fetch", `{"replica_id":"consumer"}`, "consumer"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/v1/replicas/fetch", `{"replica_id":"replica"}`, "replica"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/healthz", "", ""))
+
+	denials := logs.FilterMessage("Permission denied").All()
+	assert.Len(t, denials, 4)
+	assert.Equal(t, "consumer", denials[0].ContextMap()["principal"])
+	assert.Equal(t, "produce", denials[0].ContextMap()["action"])
+	assert.Equal(t, auth.Anonymous, denials[1].ContextMap()["principal"])
+}
+
+func TestHTTPServer_Authentication(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.yaml")
+	acl := filepath.Join(dir, "acl.yaml")
+
+	err := ioutil.WriteFile(keys, []byte("keys:\n  - principal: ci\n    sha256: "+auth.HashAPIKey("secret")+"\n"), 0600)
+	assert.Nil(t, err)
+
+	err = ioutil.WriteFile(acl, []byte("rules:\n  - principals: [ci]\n    topics: [\"*\"]\n    actions: [admin]\n"), 0600)
+	assert.Nil(t, err)
+
+	apiKeys, err := auth.LoadAPIKeys(keys)
+	assert.Nil(t, err)
+
+	authorizer, err := auth.NewAuthorizer(acl)
+	assert.Nil(t, err)
+
+	srv := server.NewHTTPServer(server.HTTPConfig{
+		Log:           server.NewLog(),
+		Authorizer:    authorizer,
+		Authenticator: auth.NewAuthenticator(apiKeys, nil),
+	})
+
+	request := func(authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/status", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("Bearer secret").Code)
+	assert.Equal(t, http.StatusForbidden, request("").Code)
+
+	w := request("Bearer guess")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+}
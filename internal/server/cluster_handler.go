@@ -0,0 +1,42 @@
+package server
+
+import "net/http"
+
+// ClusterServer is a server of the cluster that clients can send requests to.
+// A server that does not serve HTTP or gRPC to clients has an empty URL or
+// gRPC address.
+type ClusterServer struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+	Leader   bool   `json:"leader"`
+}
+
+// Cluster lists the servers of the cluster, so clients can find the leader
+// and the followers from any server.
+type Cluster interface {
+	// Servers returns the servers that are alive, including the local one.
+	Servers() []ClusterServer
+}
+
+// ClusterResponse is a response on the cluster request.
+type ClusterResponse struct {
+	Servers []ClusterServer `json:"servers"`
+}
+
+// NewClusterHandler creates a handler function that returns the servers of
+// the cluster.
+func NewClusterHandler(cluster Cluster) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		servers := cluster.Servers()
+		if servers == nil {
+			servers = []ClusterServer{}
+		}
+
+		response := ClusterResponse{
+			Servers: servers,
+		}
+
+		writeResponse(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,39 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/steinfletcher/apitest"
+)
+
+type staticCluster []server.ClusterServer
+
+func (c staticCluster) Servers() []server.ClusterServer {
+	return c
+}
+
+func TestClusterHandler(t *testing.T) {
+	t.Parallel()
+
+	apitest.New().
+		HandlerFunc(server.NewClusterHandler(staticCluster{
+			{ID: "1", URL: "http://10.0.0.1:8080", Leader: true},
+			{ID: "2", URL: "http://10.0.0.2:8080", Leader: false},
+		})).
+		Get("/v1/cluster").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"servers":[{"id":"1","url":"http://10.0.0.1:8080","leader":true},` +
+			`{"id":"2","url":"http://10.0.0.2:8080","leader":false}]}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewClusterHandler(staticCluster(nil))).
+		Get("/v1/cluster").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"servers":[]}`).
+		End()
+}
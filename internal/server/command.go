@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// command is a change of the log. The log executes commands in the order they
+// are submitted, a replicated log executes them in the order of the Raft log
+// on every node. The time of the command is set once on submission, so
+// transaction deadlines are the same on every node.
+type command struct {
+	kind    byte
+	time    time.Time
+	timeout time.Duration // the timeout of the begin command
+	resume  bool          // the batch may skip sequence numbers of the producer
+	entry   entry
+	batch   []entry // the entries of the batch command
+}
+
+// Command kinds.
+const (
+	appendCommand byte = iota + 1
+	appendIdempotentCommand
+	appendTransactionalCommand
+	beginCommand
+	commitCommand
+	abortCommand
+	tickCommand // aborts expired transactions only
+	appendBatchCommand
+)
+
+// Encoded commands are the kind, the time in Unix nanoseconds, the timeout in
+// nanoseconds and the entry encoded as it is persisted.
+const (
+	commandKindLength    = 1
+	commandTimeLength    = 8
+	commandTimeoutLength = 8
+	commandHeaderSize    = commandKindLength + commandTimeLength + commandTimeoutLength
+)
+
+// Encoded batch commands have the flags and the entries, each prefixed by its
+// length, instead of the entry.
+const (
+	batchFlagsLength     = 1
+	batchEntrySizeLength = 4
+	batchOverhead        = batchFlagsLength + batchEntrySizeLength // of a batch of one entry
+
+	resumeFlag byte = 1
+)
+
+// submit executes the command on this log or, if the log is replicated,
+// replicates it and waits until it is executed. It returns the offset of the
+// record appended by the command.
+func (c *Log) submit(cmd command) (uint64, error) {
+	offsets, err := c.submitBatch(cmd)
+	if err != nil || len(offsets) == 0 {
+		return 0, err
+	}
+
+	return offsets[0], nil
+}
+
+// submitBatch submits the command and returns the offsets of all records
+// appended by it.
+func (c *Log) submitBatch(cmd command) ([]uint64, error) {
+	for _, e := range append([]entry{cmd.entry}, cmd.batch...) {
+		if len(e.producerID) > math.MaxUint16 {
+			return nil, fmt.Errorf("%w: %d bytes", ErrInvalidProducerID, len(e.producerID))
+		}
+
+		if len(e.owner) > math.MaxUint16 {
+			return nil, fmt.Errorf("%w: the owner has %d bytes", ErrInvalidProducerID, len(e.owner))
+		}
+	}
+
+	if c.replication != nil {
+		return c.replication.submit(cmd)
+	}
+
+	cmd.time = time.Now()
+
+	return c.execute(cmd)
+}
+
+// execute aborts the transactions expired at the command time and applies the
+// command to the log.
+func (c *Log) execute(cmd command) ([]uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.following {
+		return nil, fmt.Errorf("%w: the log follows the leader's log", ErrNotLeader)
+	}
+
+	c.abortExpiredTransactions(cmd.time)
+
+	switch cmd.kind {
+	case appendCommand:
+		return appended(c.append(cmd.entry, cmd.time))
+	case appendIdempotentCommand:
+		return appended(c.appendIdempotent(cmd.entry, cmd.time))
+	case appendTransactionalCommand:
+		return appended(c.appendTransactional(cmd.entry, cmd.time))
+	case appendBatchCommand:
+		return c.appendBatch(cmd.batch, cmd.resume, cmd.time)
+	case beginCommand:
+		return nil, c.beginTransaction(cmd.entry.producerID, cmd.entry.owner, cmd.timeout, cmd.time)
+	case commitCommand:
+		return appended(c.endTransaction(cmd.entry.producerID, cmd.entry.owner, true, cmd.time))
+	case abortCommand:
+		return appended(c.endTransaction(cmd.entry.producerID, cmd.entry.owner, false, cmd.time))
+	default:
+		return nil, nil
+	}
+}
+
+// appended returns the offset of the record appended by a command as the
+// offsets of the command.
+func appended(offset uint64, err error) ([]uint64, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return []uint64{offset}, nil
+}
+
+func encodeCommand(cmd command) []byte {
+	var e []byte
+	if cmd.kind == appendBatchCommand {
+		e = encodeBatch(cmd.batch, cmd.resume)
+	} else {
+		e = encodeEntry(cmd.entry)
+	}
+
+	b := make([]byte, commandHeaderSize+len(e))
+	b[0] = cmd.kind
+	binary.BigEndian.PutUint64(b[commandKindLength:], uint64(cmd.time.UnixNano()))
+	binary.BigEndian.PutUint64(b[commandKindLength+commandTimeLength:], uint64(cmd.timeout))
+	copy(b[commandHeaderSize:], e)
+
+	return b
+}
+
+func encodeBatch(batch []entry, resume bool) []byte {
+	b := make([]byte, batchFlagsLength, batchFlagsLength+len(batch)*batchEntrySizeLength)
+	if resume {
+		b[0] = resumeFlag
+	}
+
+	for _, e := range batch {
+		encoded := encodeEntry(e)
+		b = append(b, make([]byte, batchEntrySizeLength)...)
+		binary.BigEndian.PutUint32(b[len(b)-batchEntrySizeLength:], uint32(len(encoded)))
+		b = append(b, encoded...)
+	}
+
+	return b
+}
+
+func decodeCommand(b []byte) (command, error) {
+	if len(b) < commandHeaderSize {
+		return command{}, ErrCorruptRecord
+	}
+
+	cmd := command{
+		kind:    b[0],
+		time:    time.Unix(0, int64(binary.BigEndian.Uint64(b[commandKindLength:]))),
+		timeout: time.Duration(binary.BigEndian.Uint64(b[commandKindLength+commandTimeLength:])),
+		resume:  false,
+		entry:   entry{},
+		batch:   nil,
+	}
+
+	var err error
+
+	if cmd.kind == appendBatchCommand {
+		cmd.batch, cmd.resume, err = decodeBatch(b[commandHeaderSize:])
+	} else {
+		cmd.entry, err = decodeEntry(b[commandHeaderSize:])
+	}
+
+	if err != nil {
+		return command{}, err
+	}
+
+	return cmd, nil
+}
+
+func decodeBatch(b []byte) ([]entry, bool, error) {
+	if len(b) < batchFlagsLength {
+		return nil, false, ErrCorruptRecord
+	}
+
+	resume := b[0]&resumeFlag != 0
+	b = b[batchFlagsLength:]
+
+	var batch []entry
+
+	for len(b) != 0 {
+		if len(b) < batchEntrySizeLength {
+			return nil, false, ErrCorruptRecord
+		}
+
+		size := binary.BigEndian.Uint32(b)
+		b = b[batchEntrySizeLength:]
+
+		if uint64(len(b)) < uint64(size) {
+			return nil, false, ErrCorruptRecord
+		}
+
+		e, err := decodeEntry(b[:size])
+		if err != nil {
+			return nil, false, err
+		}
+
+		batch = append(batch, e)
+		b = b[size:]
+	}
+
+	return batch, resume, nil
+}
@@ -1,30 +1,57 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ConsumeRequest is a consume request to read a record from the log.
+// maxConsumeWait limits the time a consume request waits for a record.
+const maxConsumeWait = 30 * time.Second
+
+// ConsumeRequest is a consume request to read a record from the log. The
+// isolation level is read_uncommitted if it is not set. If the record is not
+// in the log yet, the request waits up to the given time for it.
+//
+// A follower that has not replicated the records before the minimum offset,
+// or has not been up to date with the leader within the maximum staleness,
+// waits up to the same time to catch up and then redirects the request to the
+// leader.
 type ConsumeRequest struct {
-	Offset uint64 `json:"offset"`
+	Offset         uint64    `json:"offset"`
+	Isolation      Isolation `json:"isolation"`
+	MaxWaitMs      uint64    `json:"max_wait_ms"`
+	MinOffset      uint64    `json:"min_offset"`
+	MaxStalenessMs uint64    `json:"max_staleness_ms"`
 }
 
 // ConsumeResponse is a response on the consume request.
 type ConsumeResponse struct {
-	Value  []byte `json:"value"`
-	Offset uint64 `json:"offset"`
+	Value   []byte   `json:"value"`
+	Offset  uint64   `json:"offset"`
+	Headers []Header `json:"headers,omitempty"`
 }
 
 type consumeHandler struct {
-	log *Log
+	log       *Log
+	leaderURL func() string
 }
 
 // NewConsumeHandler creates a new consume handler function.
 func NewConsumeHandler(log *Log) http.HandlerFunc {
+	return newConsumeHandler(log, func() string { return "" })
+}
+
+func newConsumeHandler(log *Log, leaderURL func() string) http.HandlerFunc {
 	handler := &consumeHandler{
-		log: log,
+		log:       log,
+		leaderURL: leaderURL,
 	}
 
 	return handler.handle
@@ -40,20 +67,104 @@ func (h *consumeHandler) handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, err := h.log.Read(request.Offset)
+	switch request.Isolation {
+	case "":
+		request.Isolation = ReadUncommitted
+	case ReadUncommitted, ReadCommitted:
+	default:
+		writeErrorResponse(w, http.StatusBadRequest, "Bad isolation level")
+
+		return
+	}
+
+	maxWait := time.Duration(request.MaxWaitMs) * time.Millisecond
+	if maxWait > maxConsumeWait {
+		maxWait = maxConsumeWait
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), maxWait)
+	defer cancel()
+
+	if request.MinOffset != 0 || request.MaxStalenessMs != 0 {
+		maxStaleness := time.Duration(request.MaxStalenessMs) * time.Millisecond
+
+		err := h.log.WaitCaughtUp(ctx, request.MinOffset, maxStaleness)
+		if errors.Is(err, ErrReplicaBehind) {
+			h.redirectToLeader(w, r)
+
+			return
+		}
+
+		if errors.Is(err, ErrLogClosed) {
+			writeErrorResponse(w, http.StatusServiceUnavailable, "Log closed")
+
+			return
+		}
+	}
+
+	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "Log.Read",
+		trace.WithAttributes(
+			attribute.Int64("record.offset", int64(request.Offset)),
+			attribute.String("isolation", string(request.Isolation)),
+		),
+	)
+
+	record, err := h.log.ReadWait(ctx, request.Offset, request.Isolation)
+
+	switch {
+	case err == nil:
+		span.SetAttributes(attribute.Int64("record.offset", int64(record.Offset)))
+		span.End()
+	case errors.Is(err, ErrOffsetNotFound):
+		// Waiting for a record that is not appended yet is not a failure.
+		span.End()
+	default:
+		endSpan(span, err)
+	}
+
 	if errors.Is(err, ErrOffsetNotFound) {
 		writeErrorResponse(w, http.StatusNotFound, "Record not found")
 
 		return
 	}
 
+	if errors.Is(err, ErrOffsetEvicted) {
+		writeErrorResponse(w, http.StatusNotFound, "Record evicted")
+
+		return
+	}
+
+	if errors.Is(err, ErrLogClosed) {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Log closed")
+
+		return
+	}
+
 	if err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		writeInternalError(w, r, err)
 
 		return
 	}
 
-	resp := ConsumeResponse(record)
+	resp := ConsumeResponse{
+		Value:   record.Value,
+		Offset:  record.Offset,
+		Headers: record.Headers,
+	}
 
 	writeResponse(w, http.StatusOK, resp)
 }
+
+// redirectToLeader redirects the request of a follower that is behind to the
+// leader. It responds with 503 if the leader is not known.
+func (h *consumeHandler) redirectToLeader(w http.ResponseWriter, r *http.Request) {
+	leaderURL := h.leaderURL()
+	if leaderURL == "" {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Replica behind")
+
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(leaderURL, "/")+r.URL.RequestURI())
+	writeErrorResponse(w, http.StatusTemporaryRedirect, "Replica behind")
+}
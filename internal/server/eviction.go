@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+)
+
+// evictionFileName is the name of the checkpoint of the evicted records in
+// the log directory.
+const evictionFileName = "evicted.json"
+
+// evictionCheckpoint is the state of the records evicted from the local store
+// that the log cannot restore from the store anymore. It is written before the
+// segments are removed, so the segments left behind by an interrupted eviction
+// are removed when the log is opened.
+type evictionCheckpoint struct {
+	EndOffset    uint64                       `json:"end_offset"`
+	Position     uint64                       `json:"position"` // the position of the first record that is not evicted
+	Producers    map[string]evictedProducer   `json:"producers"`
+	GroupOffsets map[string]map[uint32]uint64 `json:"group_offsets"`
+	Aborted      []uint64                     `json:"aborted"` // the evicted records of aborted transactions
+}
+
+type evictedProducer struct {
+	Sequence uint64 `json:"sequence"`
+	Offset   uint64 `json:"offset"`
+}
+
+// evict drops the records before the end offset, which are uploaded to the
+// tier up to the position in the store, and removes the local segments before
+// the position. Only records before the last stable offset that the log serves
+// are evicted, so their transactions are complete. It returns false if the
+// records cannot be evicted yet.
+func (c *Log) evict(endOffset, position uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if endOffset <= c.start {
+		return true, nil
+	}
+
+	if endOffset > c.lastStableOffset() || endOffset > c.readableEnd() {
+		return false, nil
+	}
+
+	aborted := append([]uint64{}, c.aborted...)
+
+	for offset := c.start; offset < endOffset; offset++ {
+		if c.entries[offset-c.start].aborted {
+			aborted = append(aborted, offset)
+		}
+	}
+
+	checkpoint := evictionCheckpoint{
+		EndOffset:    endOffset,
+		Position:     position,
+		Producers:    make(map[string]evictedProducer, len(c.producers)),
+		GroupOffsets: c.groupOffsets,
+		Aborted:      aborted,
+	}
+
+	for id, p := range c.producers {
+		checkpoint.Producers[id] = evictedProducer{Sequence: p.sequence, Offset: p.offset}
+	}
+
+	b, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("failed to encode the eviction checkpoint: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(c.dir, evictionFileName), b); err != nil {
+		return false, err
+	}
+
+	c.entries = append([]entry(nil), c.entries[endOffset-c.start:]...)
+	c.start = endOffset
+	c.aborted = aborted
+
+	if err := c.store.RemoveBefore(position); err != nil {
+		return true, fmt.Errorf("failed to remove the evicted segments: %w", err)
+	}
+
+	return true, nil
+}
+
+// restoreEvicted restores the state of the evicted records from the eviction
+// checkpoint and removes the segments left behind by an interrupted eviction.
+// It returns the position of the first record that is not evicted.
+func (c *Log) restoreEvicted() (uint64, error) {
+	var checkpoint evictionCheckpoint
+
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, evictionFileName))
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return 0, fmt.Errorf("failed to read the eviction checkpoint: %w", err)
+	default:
+		if err := json.Unmarshal(b, &checkpoint); err != nil {
+			return 0, fmt.Errorf("failed to decode the eviction checkpoint: %w", err)
+		}
+	}
+
+	if base := c.store.Base(); base > checkpoint.Position {
+		return 0, fmt.Errorf("%w: the records from %d to %d are neither in the store nor evicted",
+			store.ErrMissingSegment, checkpoint.Position, base)
+	}
+
+	if err := c.store.RemoveBefore(checkpoint.Position); err != nil {
+		return 0, fmt.Errorf("failed to remove the evicted segments: %w", err)
+	}
+
+	c.start = checkpoint.EndOffset
+	c.aborted = checkpoint.Aborted
+
+	for id, p := range checkpoint.Producers {
+		c.producers[id] = producer{sequence: p.Sequence, offset: p.Offset}
+	}
+
+	for groupID, offsets := range checkpoint.GroupOffsets {
+		c.groupOffsets[groupID] = offsets
+	}
+
+	return checkpoint.Position, nil
+}
+
+// isEvictedAborted reports whether the evicted record at the offset belongs
+// to an aborted transaction.
+func (c *Log) isEvictedAborted(offset uint64) bool {
+	i := sort.Search(len(c.aborted), func(i int) bool { return c.aborted[i] >= offset })
+
+	return i < len(c.aborted) && c.aborted[i] == offset
+}
+
+// readEvicted reads the first record at or after the offset that is visible
+// with the isolation level from the tier while the offset is evicted. It
+// returns nil and the offset to read the local records from once there are
+// no more evicted records.
+func (c *Log) readEvicted(ctx context.Context, offset uint64, isolation Isolation) (*Record, uint64, error) {
+	for {
+		c.mu.Lock()
+		start, tier := c.start, c.tier
+		c.mu.Unlock()
+
+		if offset >= start {
+			return nil, offset, nil
+		}
+
+		if tier == nil {
+			return nil, 0, fmt.Errorf("%w: %d", ErrOffsetEvicted, offset)
+		}
+
+		b, err := tier.read(ctx, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e, err := decodeEntry(b)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to decode the evicted record %d: %w", offset, err)
+		}
+
+		c.mu.Lock()
+		visible := e.attributes&controlAttribute == 0 && (isolation != ReadCommitted || !c.isEvictedAborted(offset))
+
+		if visible {
+			c.stats.ReadBytes += uint64(len(e.record.Value))
+		}
+		c.mu.Unlock()
+
+		if visible {
+			e.record.Offset = offset
+
+			return &e.record, offset, nil
+		}
+
+		offset++
+	}
+}
+
+// evictedEntries returns the persisted records from the evicted offset up to
+// the maximum total size, and at least one record, read from the tier. It
+// returns false if the offset is not evicted.
+func (c *Log) evictedEntries(ctx context.Context, offset uint64, maxBytes int) ([][]byte, bool, error) {
+	c.mu.Lock()
+	start, tier := c.start, c.tier
+	c.mu.Unlock()
+
+	if offset >= start {
+		return nil, false, nil
+	}
+
+	if tier == nil {
+		return nil, true, fmt.Errorf("%w: %d", ErrOffsetEvicted, offset)
+	}
+
+	var (
+		entries [][]byte
+		size    int
+	)
+
+	for ; offset < start; offset++ {
+		entry, err := tier.read(ctx, offset)
+		if err != nil {
+			return nil, true, err
+		}
+
+		if size += len(entry); len(entries) != 0 && size > maxBytes {
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, true, nil
+}
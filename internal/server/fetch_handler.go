@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultFetchMaxBytes is the maximum size of the records returned by a fetch
+// request if the follower does not set one.
+const DefaultFetchMaxBytes = 1 << 20
+
+// FetchRequest is a request of a follower to fetch the persisted records from
+// the offset, including control markers. The follower reports that it has
+// replicated the records before the offset, and the request waits up to the
+// given time for a record or for the high watermark to advance past the one
+// known to the follower.
+type FetchRequest struct {
+	ReplicaID     string `json:"replica_id"`
+	Offset        uint64 `json:"offset"`
+	HighWatermark uint64 `json:"high_watermark"`
+	MaxWaitMs     uint64 `json:"max_wait_ms"`
+	MaxBytes      int    `json:"max_bytes"`
+}
+
+// FetchResponse is a response on the fetch request. The entries are the
+// persisted records from the offset, and the high watermark is the end of the
+// records replicated by all in-sync replicas.
+type FetchResponse struct {
+	Offset        uint64   `json:"offset"`
+	Entries       [][]byte `json:"entries"`
+	HighWatermark uint64   `json:"high_watermark"`
+}
+
+type fetchHandler struct {
+	replicas *Replicas
+}
+
+// NewFetchHandler creates a new handler function that serves the fetch
+// requests of followers.
+func NewFetchHandler(replicas *Replicas) http.HandlerFunc {
+	handler := &fetchHandler{
+		replicas: replicas,
+	}
+
+	return handler.handle
+}
+
+func (h *fetchHandler) handle(w http.ResponseWriter, r *http.Request) {
+	var request FetchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.ReplicaID == "" || request.MaxBytes < 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	if request.MaxBytes == 0 {
+		request.MaxBytes = DefaultFetchMaxBytes
+	}
+
+	maxWait := time.Duration(request.MaxWaitMs) * time.Millisecond
+	if maxWait > maxConsumeWait {
+		maxWait = maxConsumeWait
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), maxWait)
+	defer cancel()
+
+	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "Replicas.Fetch",
+		trace.WithAttributes(
+			attribute.Int64("record.offset", int64(request.Offset)),
+			attribute.String("replica.id", request.ReplicaID),
+		),
+	)
+
+	entries, highWatermark, err := h.replicas.Fetch(ctx, request.ReplicaID, request.Offset, request.HighWatermark,
+		request.MaxBytes)
+	endSpan(span, err)
+
+	if errors.Is(err, ErrReplicaNotAssigned) {
+		writeErrorResponse(w, http.StatusGone, "Replica not assigned")
+
+		return
+	}
+
+	if errors.Is(err, ErrLogClosed) {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Log closed")
+
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, err)
+
+		return
+	}
+
+	if entries == nil {
+		entries = [][]byte{}
+	}
+
+	resp := FetchResponse{
+		Offset:        request.Offset,
+		Entries:       entries,
+		HighWatermark: highWatermark,
+	}
+
+	writeResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,452 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"go.uber.org/zap"
+)
+
+// ErrOffsetMismatch is returned if a replicated record is not appended at the
+// end of the follower's log, so the logs have diverged.
+var ErrOffsetMismatch = fmt.Errorf("offset mismatch")
+
+// Default settings of the follower.
+const (
+	DefaultFollowerMaxWait = time.Second
+	DefaultFollowerBackoff = 100 * time.Millisecond
+	maxFollowerBackoff     = 5 * time.Second
+)
+
+// ErrReplicaBehind is returned if a follower has not replicated the records
+// a consumer asks for, or has not been up to date with the leader recently
+// enough.
+var ErrReplicaBehind = fmt.Errorf("replica behind")
+
+// catchUpCheckInterval is the period of checking the staleness of a follower
+// that a consumer waits for.
+const catchUpCheckInterval = 50 * time.Millisecond
+
+// ReadEntry returns the record at the offset as it is persisted in the log
+// store file, including control markers. It waits until the record is
+// appended or the context is done like ReadWait. Followers replicate the log
+// with it.
+func (c *Log) ReadEntry(ctx context.Context, offset uint64) ([]byte, error) {
+	for {
+		entries, evicted, err := c.evictedEntries(ctx, offset, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if evicted {
+			return entries[0], nil
+		}
+
+		entry, appended := c.entryAt(offset)
+		if entry != nil {
+			return entry, nil
+		}
+
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return nil, ErrOffsetNotFound
+		case <-c.closing:
+			return nil, ErrLogClosed
+		}
+	}
+}
+
+// entryAt returns the persisted record at the offset, or nil and the channel
+// closed on the next append if the record is not appended yet. The channel is
+// closed already if the record has been evicted meanwhile.
+func (c *Log) entryAt(offset uint64) ([]byte, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case offset < c.start:
+		evicted := make(chan struct{})
+		close(evicted)
+
+		return nil, evicted
+	case offset < c.endOffset():
+		return encodeEntry(c.entries[offset-c.start]), nil
+	default:
+		return nil, c.appended
+	}
+}
+
+// entriesFrom returns the persisted records from the offset up to the
+// maximum total size, and at least one record, or nil and the channel closed
+// on the next append if the record at the offset is not appended yet. Evicted
+// records are read from the tier.
+func (c *Log) entriesFrom(ctx context.Context, offset uint64, maxBytes int) ([][]byte, <-chan struct{}, error) {
+	for {
+		entries, evicted, err := c.evictedEntries(ctx, offset, maxBytes)
+		if evicted || err != nil {
+			return entries, nil, err
+		}
+
+		if entries, appended, ok := c.localEntriesFrom(offset, maxBytes); ok {
+			return entries, appended, nil
+		}
+	}
+}
+
+// localEntriesFrom is entriesFrom for the records that are not evicted. It
+// returns false if the record at the offset has been evicted meanwhile.
+func (c *Log) localEntriesFrom(offset uint64, maxBytes int) ([][]byte, <-chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if offset < c.start {
+		return nil, nil, false
+	}
+
+	if offset >= c.endOffset() {
+		return nil, c.appended, true
+	}
+
+	entries := [][]byte{encodeEntry(c.entries[offset-c.start])}
+	size := len(entries[0])
+
+	for next := offset + 1; next < c.endOffset(); next++ {
+		entry := encodeEntry(c.entries[next-c.start])
+		if size += len(entry); size > maxBytes {
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil, true
+}
+
+// IsFollower reports whether the log follows a leader: a follower replicates
+// the leader's log into it, or it is replicated by Raft and the node is not
+// the leader.
+func (c *Log) IsFollower() bool {
+	if c.replication != nil {
+		return !c.replication.leading()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.following
+}
+
+// HighWatermark returns the end of the records the log serves. A follower
+// serves only the records it has replicated that all in-sync replicas of the
+// leader have replicated too, and a Raft node only the committed records, so
+// consumers never read a record that another replica may not have.
+func (c *Log) HighWatermark() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.readableEnd()
+}
+
+func (c *Log) readableEnd() uint64 {
+	end := c.endOffset()
+	if c.following && c.highWatermark < end {
+		end = c.highWatermark
+	}
+
+	return end
+}
+
+// setHighWatermark advances the high watermark of the leader known to the
+// follower and records whether the follower has caught up with it.
+func (c *Log) setHighWatermark(highWatermark uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if highWatermark > c.highWatermark {
+		c.highWatermark = highWatermark
+
+		close(c.appended)
+		c.appended = make(chan struct{})
+	}
+
+	if c.endOffset() >= c.highWatermark {
+		c.caughtUpAt = now
+	}
+}
+
+// Staleness returns the time since the follower was last known to be up to
+// date with the leader: since it last replicated up to the high watermark, or
+// since the Raft leader last contacted the node. It is zero on the leader.
+func (c *Log) Staleness() time.Duration {
+	if c.replication != nil {
+		return c.replication.staleness()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case !c.following:
+		return 0
+	case c.caughtUpAt.IsZero():
+		return math.MaxInt64
+	default:
+		return time.Since(c.caughtUpAt)
+	}
+}
+
+// WaitCaughtUp waits until the follower serves the records before the minimum
+// offset and, if the maximum staleness is not zero, has been up to date with
+// the leader within it. The leader is always caught up. It returns
+// ErrReplicaBehind if the context is done first and ErrLogClosed if the log
+// starts closing first.
+func (c *Log) WaitCaughtUp(ctx context.Context, minOffset uint64, maxStaleness time.Duration) error {
+	ticker := time.NewTicker(catchUpCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if !c.IsFollower() {
+			return nil
+		}
+
+		c.mu.Lock()
+		appended := c.appended
+		end := c.readableEnd()
+		c.mu.Unlock()
+
+		if end >= minOffset && (maxStaleness == 0 || c.Staleness() <= maxStaleness) {
+			return nil
+		}
+
+		select {
+		case <-appended:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: it serves the records before %d", ErrReplicaBehind, end)
+		case <-c.closing:
+			return ErrLogClosed
+		}
+	}
+}
+
+// AppendReplicated appends the record read from the leader with ReadEntry at
+// the same offset. It returns ErrOffsetMismatch if the offset is not the end
+// of the log.
+func (c *Log) AppendReplicated(offset uint64, b []byte) error {
+	e, err := decodeEntry(b)
+	if err != nil {
+		return fmt.Errorf("failed to decode the replicated record %d: %w", offset, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if end := c.endOffset(); offset != end {
+		return fmt.Errorf("%w: the record %d is replicated at %d", ErrOffsetMismatch, offset, end)
+	}
+
+	_, err = c.append(e, time.Now())
+
+	return err
+}
+
+// FollowerConfig configures a follower.
+type FollowerConfig struct {
+	// ReplicaID identifies the follower to the leader.
+	ReplicaID string
+
+	// LeaderURL is the URL of the leader, it is reported in the status.
+	LeaderURL string
+
+	// Transport sends the fetch requests to the leader.
+	Transport client.Fetcher
+
+	// MaxWait is the time a fetch request waits for a new record.
+	// DefaultFollowerMaxWait is used if it is zero.
+	MaxWait time.Duration
+
+	// MaxBytes is the maximum size of the records fetched by a request.
+	// The leader's DefaultFetchMaxBytes is used if it is zero.
+	MaxBytes int
+
+	// Backoff is the delay before retrying a failed fetch, it doubles on
+	// every next failure. DefaultFollowerBackoff is used if it is zero.
+	Backoff time.Duration
+
+	// Logger logs failed fetches if it is not nil.
+	Logger *zap.Logger
+}
+
+// FollowerStatus describes the replication of a follower.
+type FollowerStatus struct {
+	ReplicaID        string    `json:"replica_id"`
+	Leader           string    `json:"leader"`
+	ReplicatedOffset uint64    `json:"replicated_offset"` // the end of the follower's log
+	HighWatermark    uint64    `json:"high_watermark"`    // the end of the records the follower serves
+	LastFetchAt      time.Time `json:"last_fetch_at"`
+	Error            string    `json:"error,omitempty"` // the last failure
+}
+
+// Follower replicates the leader's log into the local log. It fetches the
+// records from the leader in batches, including control markers, and appends
+// them at the same offsets. The fetched offset tells the leader how far the
+// follower has replicated, and the leader returns its high watermark, which
+// bounds the records the follower serves. The local log rejects other writes with
+// ErrNotLeader while it is following.
+type Follower struct {
+	log     *Log
+	config  FollowerConfig
+	logger  *zap.Logger
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	status  FollowerStatus
+	stopped sync.Once
+}
+
+// StartFollower starts replicating the leader's log into the log.
+func StartFollower(log *Log, config FollowerConfig) *Follower {
+	if config.MaxWait == 0 {
+		config.MaxWait = DefaultFollowerMaxWait
+	}
+
+	if config.Backoff == 0 {
+		config.Backoff = DefaultFollowerBackoff
+	}
+
+	logger := zap.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger
+	}
+
+	log.mu.Lock()
+	log.following = true
+	log.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f := &Follower{
+		log:    log,
+		config: config,
+		logger: logger,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		mu:     sync.Mutex{},
+		status: FollowerStatus{
+			ReplicaID:        config.ReplicaID,
+			Leader:           config.LeaderURL,
+			ReplicatedOffset: 0,
+			HighWatermark:    0,
+			LastFetchAt:      time.Time{},
+			Error:            "",
+		},
+		stopped: sync.Once{},
+	}
+
+	go f.run(ctx)
+
+	return f
+}
+
+// Status returns the status of the replication.
+func (f *Follower) Status() FollowerStatus {
+	f.mu.Lock()
+	status := f.status
+	f.mu.Unlock()
+
+	status.ReplicatedOffset = f.log.EndOffset()
+	status.HighWatermark = f.log.HighWatermark()
+
+	return status
+}
+
+// Stop stops replicating and waits for the current fetch to finish. The log
+// keeps rejecting writes. Stopping again does nothing.
+func (f *Follower) Stop() {
+	f.stopped.Do(func() {
+		f.cancel()
+		<-f.done
+	})
+}
+
+func (f *Follower) run(ctx context.Context) {
+	defer close(f.done)
+
+	backoff := f.config.Backoff
+
+	for ctx.Err() == nil {
+		err := f.fetch(ctx)
+
+		f.mu.Lock()
+		f.status.LastFetchAt = time.Now()
+		f.status.Error = ""
+
+		if err != nil {
+			f.status.Error = err.Error()
+		}
+		f.mu.Unlock()
+
+		if err == nil || ctx.Err() != nil {
+			backoff = f.config.Backoff
+
+			continue
+		}
+
+		f.logger.Warn("Failed to replicate the leader's log", zap.Error(err), zap.String("leader", f.config.LeaderURL))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+
+		if backoff *= 2; backoff > maxFollowerBackoff {
+			backoff = maxFollowerBackoff
+		}
+	}
+}
+
+// fetch replicates the next records and the high watermark of the leader.
+// Waiting for a record that is not appended yet is not a failure.
+func (f *Follower) fetch(ctx context.Context) error {
+	offset := f.log.EndOffset()
+
+	f.log.mu.Lock()
+	highWatermark := f.log.highWatermark
+	f.log.mu.Unlock()
+
+	resp, err := f.config.Transport.Fetch(ctx, client.FetchRequest{
+		ReplicaID:     f.config.ReplicaID,
+		Offset:        offset,
+		HighWatermark: highWatermark,
+		MaxWaitMs:     uint64(f.config.MaxWait / time.Millisecond),
+		MaxBytes:      f.config.MaxBytes,
+	})
+	if errors.Is(err, client.ErrOffsetNotFound) || ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch the records from %d: %w", offset, err)
+	}
+
+	if resp.Offset != offset {
+		return fmt.Errorf("%w: the leader returned the records from %d for %d", ErrOffsetMismatch, resp.Offset, offset)
+	}
+
+	// The leader returns no entries if only the high watermark has advanced.
+	for i, entry := range resp.Entries {
+		if err := f.log.AppendReplicated(offset+uint64(i), entry); err != nil {
+			return err
+		}
+	}
+
+	f.log.setHighWatermark(resp.HighWatermark, time.Now())
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollower(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	leader := server.NewLog()
+	replicas := server.NewReplicas(leader, server.ReplicasConfig{LagMax: 300 * time.Millisecond, MinInSync: 2})
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{ // nolint:exhaustivestruct
+		Log:      leader,
+		Replicas: replicas,
+	}).Handler)
+
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	// acks=all fails without enough in-sync replicas.
+	_, err := transport.Produce(context.Background(), client.ProduceRequest{ // nolint:exhaustivestruct
+		Value: []byte("rejected"),
+		Acks:  client.AcksAll,
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode(err))
+	assert.Equal(t, uint64(0), leader.EndOffset())
+
+	_, err = leader.Append([]byte("first"), server.Header{Key: "key", Value: "value"})
+	assert.Nil(t, err)
+	assert.Nil(t, leader.BeginTransaction("aborted", "app", 0))
+	_, err = leader.AppendTransactional("aborted", "app", []byte("aborted"))
+	assert.Nil(t, err)
+	_, err = leader.AbortTransaction("aborted", "app")
+	assert.Nil(t, err)
+	_, err = leader.AppendIdempotent("producer", 7, []byte("idempotent"))
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	follower, err := server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	f := server.StartFollower(follower, server.FollowerConfig{ // nolint:exhaustivestruct
+		ReplicaID: "replica-1",
+		LeaderURL: srv.URL,
+		Transport: transport,
+		MaxWait:   50 * time.Millisecond,
+	})
+
+	assertRecords(t, follower, "first", "idempotent")
+
+	// A record produced with acks=all is replicated before the response.
+	offset, err := transport.Produce(context.Background(), client.ProduceRequest{ // nolint:exhaustivestruct
+		Value: []byte("replicated"),
+		Acks:  client.AcksAll,
+	})
+	assert.Nil(t, err)
+	assert.Less(t, offset, follower.EndOffset())
+	assert.Equal(t, leader.EndOffset(), follower.EndOffset())
+
+	statuses := replicas.Describe()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "replica-1", statuses[0].ID)
+	assert.True(t, statuses[0].InSync)
+
+	status := f.Status()
+	assert.Equal(t, leader.EndOffset(), status.ReplicatedOffset)
+	assert.Empty(t, status.Error)
+
+	// The follower keeps the producer state and rejects other writes.
+	_, err = follower.Append([]byte("write"))
+	assert.ErrorIs(t, err, server.ErrNotLeader)
+
+	f.Stop()
+	assert.Nil(t, follower.Close())
+
+	// The follower drops from the in-sync replicas after the maximum lag.
+	_, err = transport.Produce(context.Background(), client.ProduceRequest{ // nolint:exhaustivestruct
+		Value: []byte("lagging"),
+		Acks:  client.AcksAll,
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode(err))
+	assert.False(t, replicas.Describe()[0].InSync)
+
+	// A restarted follower continues from the end of its log and catches up.
+	follower, err = server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer follower.Close() // nolint:errcheck
+
+	f = server.StartFollower(follower, server.FollowerConfig{ // nolint:exhaustivestruct
+		ReplicaID: "replica-1",
+		Transport: transport,
+		MaxWait:   50 * time.Millisecond,
+	})
+	defer f.Stop()
+
+	assertRecords(t, follower, "first", "idempotent", "replicated", "lagging")
+
+	_, err = transport.Produce(context.Background(), client.ProduceRequest{ // nolint:exhaustivestruct
+		Value: []byte("in sync"),
+		Acks:  client.AcksAll,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, leader.EndOffset(), follower.EndOffset())
+
+	for offset := uint64(0); offset < leader.EndOffset(); offset++ {
+		expected, err := leader.ReadEntry(context.Background(), offset)
+		assert.Nil(t, err)
+
+		actual, err := follower.ReadEntry(context.Background(), offset)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestFollower_Reads(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	leader := server.NewLog()
+	replicas := server.NewReplicas(leader, server.ReplicasConfig{LagMax: 300 * time.Millisecond, MinInSync: 1})
+	leaderSrv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{ // nolint:exhaustivestruct
+		Log:      leader,
+		Replicas: replicas,
+	}).Handler)
+
+	defer leaderSrv.Close()
+
+	leaderTransport := client.NewHTTPTransport(leaderSrv.URL, nil)
+
+	_, err := leader.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	startFollower := func(id, leaderURL string) (*server.Log, *server.Follower, *client.HTTPTransport) {
+		l := server.NewLog()
+		f := server.StartFollower(l, server.FollowerConfig{ // nolint:exhaustivestruct
+			ReplicaID: id,
+			LeaderURL: leaderURL,
+			Transport: leaderTransport,
+			MaxWait:   50 * time.Millisecond,
+		})
+		srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{ // nolint:exhaustivestruct
+			Log:      l,
+			Follower: f,
+		}).Handler)
+
+		t.Cleanup(srv.Close)
+		t.Cleanup(f.Stop)
+
+		return l, f, client.NewHTTPTransport(srv.URL, nil)
+	}
+
+	follower, f, transport := startFollower("replica-1", leaderSrv.URL)
+	lagging, laggingFollower, laggingTransport := startFollower("replica-2", "")
+
+	assert.Eventually(t, func() bool {
+		return follower.HighWatermark() == 1 && lagging.HighWatermark() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// A follower does not serve a record before all in-sync replicas have it.
+	laggingFollower.Stop()
+
+	_, err = leader.Append([]byte("second"))
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool { return follower.EndOffset() == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(1), follower.HighWatermark())
+
+	_, err = transport.Consume(context.Background(), client.ConsumeRequest{Offset: 1}) // nolint:exhaustivestruct
+	assert.Equal(t, client.ErrOffsetNotFound, err)
+
+	// It serves the record once the lagging replica drops from the in-sync
+	// replicas.
+	assert.Eventually(t, func() bool { return follower.HighWatermark() == 2 }, time.Second, 10*time.Millisecond)
+
+	r, err := transport.Consume(context.Background(), client.ConsumeRequest{Offset: 1}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), r.Value)
+	assert.Equal(t, uint64(2), f.Status().HighWatermark)
+
+	// A follower that is behind the minimum offset redirects to the leader.
+	f.Stop()
+
+	_, err = leader.Append([]byte("third"))
+	assert.Nil(t, err)
+
+	r, err = transport.Consume(context.Background(), client.ConsumeRequest{ // nolint:exhaustivestruct
+		Offset:    2,
+		MaxWaitMs: 50,
+		MinOffset: 3,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("third"), r.Value)
+
+	// So does a follower that has been behind for too long.
+	time.Sleep(20 * time.Millisecond)
+
+	r, err = transport.Consume(context.Background(), client.ConsumeRequest{ // nolint:exhaustivestruct
+		Offset:         2,
+		MaxStalenessMs: 10,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("third"), r.Value)
+
+	// A follower that does not know the leader responds with an error.
+	_, err = laggingTransport.Consume(context.Background(), client.ConsumeRequest{ // nolint:exhaustivestruct
+		Offset:    0,
+		MinOffset: 3,
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode(err))
+
+	// The leader ignores both.
+	r, err = leaderTransport.Consume(context.Background(), client.ConsumeRequest{ // nolint:exhaustivestruct
+		Offset:         0,
+		MinOffset:      10,
+		MaxStalenessMs: 1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), r.Value)
+}
+
+func TestLog_AppendReplicated(t *testing.T) {
+	t.Parallel()
+
+	leader := server.NewLog()
+	_, err := leader.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	entry, err := leader.ReadEntry(context.Background(), 0)
+	assert.Nil(t, err)
+
+	follower := server.NewLog()
+	assert.ErrorIs(t, follower.AppendReplicated(1, entry), server.ErrOffsetMismatch)
+	assert.Nil(t, follower.AppendReplicated(0, entry))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = leader.ReadEntry(ctx, 1)
+	assert.ErrorIs(t, err, server.ErrOffsetNotFound)
+}
+
+func statusCode(err error) int {
+	responseErr, ok := err.(*client.ResponseError) // nolint:errorlint
+	if !ok {
+		return 0
+	}
+
+	return responseErr.StatusCode
+}
+
+func TestFollower_FetchBatch(t *testing.T) {
+	t.Parallel()
+
+	leader := server.NewLog()
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{ // nolint:exhaustivestruct
+		Log: leader,
+	}).Handler)
+
+	defer srv.Close()
+
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := leader.Append([]byte(value))
+		assert.Nil(t, err)
+	}
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	resp, err := transport.Fetch(context.Background(), client.FetchRequest{ // nolint:exhaustivestruct
+		ReplicaID: "replica-1",
+		Offset:    1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), resp.Offset)
+	assert.Len(t, resp.Entries, 2)
+
+	// A fetch returns at least one record, even if it exceeds the maximum size.
+	resp, err = transport.Fetch(context.Background(), client.FetchRequest{ // nolint:exhaustivestruct
+		ReplicaID: "replica-1",
+		MaxBytes:  1,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Entries, 1)
+
+	follower := server.NewLog()
+	f := server.StartFollower(follower, server.FollowerConfig{ // nolint:exhaustivestruct
+		ReplicaID: "replica-1",
+		Transport: transport,
+		MaxWait:   50 * time.Millisecond,
+	})
+	defer f.Stop()
+
+	assertRecords(t, follower, "first", "second", "third")
+}
@@ -0,0 +1,473 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Partition assignment strategies supported by the group coordinator.
+const (
+	// RangeStrategy assigns each member a contiguous range of partitions.
+	RangeStrategy = "range"
+
+	// RoundRobinStrategy deals partitions to members one by one.
+	RoundRobinStrategy = "roundrobin"
+)
+
+// ErrUnknownGroup is returned if the group does not exist.
+var ErrUnknownGroup = fmt.Errorf("unknown group")
+
+// ErrUnknownMember is returned if the member is not in the group, for example
+// because its session has expired.
+var ErrUnknownMember = fmt.Errorf("unknown member")
+
+// ErrUnknownStrategy is returned if the assignment strategy is not supported.
+var ErrUnknownStrategy = fmt.Errorf("unknown assignment strategy")
+
+// ErrInconsistentStrategy is returned if a member asks for an assignment
+// strategy different from the one used by the group.
+var ErrInconsistentStrategy = fmt.Errorf("inconsistent assignment strategy")
+
+// ErrStaleGeneration is returned if a member acts on behalf of a generation
+// that has been replaced by a rebalance.
+var ErrStaleGeneration = fmt.Errorf("stale generation")
+
+// ErrPartitionNotAssigned is returned if a member commits an offset for a
+// partition it does not own.
+var ErrPartitionNotAssigned = fmt.Errorf("partition not assigned")
+
+// ErrInvalidSessionTimeout is returned if a member asks for a negative
+// session timeout or one longer than MaxGroupSessionTimeout.
+var ErrInvalidSessionTimeout = fmt.Errorf("invalid session timeout")
+
+// ErrNoCommittedOffset is returned if the group has not committed an offset
+// for the partition yet.
+var ErrNoCommittedOffset = fmt.Errorf("no committed offset")
+
+// Session timeouts of consumer group members.
+const (
+	// DefaultGroupSessionTimeout is the session timeout of members that do not
+	// ask for one if the coordinator has no other default.
+	DefaultGroupSessionTimeout = 10 * time.Second
+
+	// MaxGroupSessionTimeout is the longest session timeout a member may ask
+	// for, so a member that has failed does not keep its partitions for long.
+	MaxGroupSessionTimeout = 5 * time.Minute
+)
+
+// Assignment describes the partitions owned by a group member in the given
+// generation of the group.
+type Assignment struct {
+	MemberID   string
+	Generation uint64
+	Partitions []uint32
+}
+
+// GroupDescription describes the state of a consumer group.
+type GroupDescription struct {
+	Strategy   string
+	Generation uint64
+	Members    []Assignment
+	Offsets    map[uint32]uint64 // committed offsets by partition
+}
+
+// GroupCoordinator tracks consumer group members via heartbeats and spreads
+// partitions between them. Every change of the membership rebalances the group
+// and bumps its generation. The committed offsets are persisted in the log,
+// while the members and their assignments are kept in memory.
+type GroupCoordinator struct {
+	mu             sync.Mutex
+	log            *Log
+	partitions     uint32
+	sessionTimeout time.Duration
+	groups         map[string]*group
+}
+
+type group struct {
+	strategy    string
+	generation  uint64
+	members     map[string]member
+	assignments map[string][]uint32
+}
+
+// member is the session of a group member.
+type member struct {
+	heartbeat      time.Time // the last heartbeat time
+	sessionTimeout time.Duration
+}
+
+// NewGroupCoordinator creates a new GroupCoordinator that assigns the given
+// number of partitions and commits the offsets to the log. Members that do not
+// send a heartbeat within their session timeout are removed from their groups,
+// the given session timeout is used for members that do not ask for one.
+func NewGroupCoordinator(log *Log, partitions uint32, sessionTimeout time.Duration) *GroupCoordinator {
+	return &GroupCoordinator{
+		mu:             sync.Mutex{},
+		log:            log,
+		partitions:     partitions,
+		sessionTimeout: sessionTimeout,
+		groups:         make(map[string]*group),
+	}
+}
+
+// Join adds the member to the group and rebalances it. A new member ID is
+// generated if the given one is empty. The group uses the strategy of its first
+// member, the range strategy is used if the strategy is empty. The coordinator's
+// session timeout is used if the session timeout is zero.
+func (c *GroupCoordinator) Join(groupID, memberID, strategy string, sessionTimeout time.Duration) (Assignment, error) {
+	if strategy == "" {
+		strategy = RangeStrategy
+	}
+
+	if strategy != RangeStrategy && strategy != RoundRobinStrategy {
+		return Assignment{}, ErrUnknownStrategy
+	}
+
+	if sessionTimeout < 0 || sessionTimeout > MaxGroupSessionTimeout {
+		return Assignment{}, fmt.Errorf("%w: %s", ErrInvalidSessionTimeout, sessionTimeout)
+	}
+
+	if sessionTimeout == 0 {
+		sessionTimeout = c.sessionTimeout
+	}
+
+	if memberID == "" {
+		id, err := newMemberID()
+		if err != nil {
+			return Assignment{}, err
+		}
+
+		memberID = id
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	g, ok := c.groups[groupID]
+	if ok {
+		c.expire(g, now)
+	} else {
+		g = &group{
+			strategy:    strategy,
+			generation:  0,
+			members:     make(map[string]member),
+			assignments: make(map[string][]uint32),
+		}
+		c.groups[groupID] = g
+	}
+
+	// An empty group keeps its generation but may switch to another strategy.
+	if len(g.members) == 0 {
+		g.strategy = strategy
+	}
+
+	if g.strategy != strategy {
+		return Assignment{}, ErrInconsistentStrategy
+	}
+
+	_, known := g.members[memberID]
+	g.members[memberID] = member{heartbeat: now, sessionTimeout: sessionTimeout}
+
+	if !known {
+		c.rebalance(g)
+	}
+
+	return g.assignment(memberID), nil
+}
+
+// Heartbeat keeps the member session alive and returns its current assignment.
+// Members should join again if the generation of the assignment has changed.
+func (c *GroupCoordinator) Heartbeat(groupID, memberID string) (Assignment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, err := c.member(groupID, memberID)
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	m := g.members[memberID]
+	m.heartbeat = time.Now()
+	g.members[memberID] = m
+
+	return g.assignment(memberID), nil
+}
+
+// Leave removes the member from the group and rebalances it.
+func (c *GroupCoordinator) Leave(groupID, memberID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, err := c.member(groupID, memberID)
+	if err != nil {
+		return err
+	}
+
+	delete(g.members, memberID)
+	c.rebalance(g)
+
+	return nil
+}
+
+// Commit persists the offset of the next record the group reads from the
+// partition in the log. The commit is rejected if the generation is stale or
+// the member does not own the partition in the current generation. The lock
+// is not held while the offset is replicated, so the ownership is checked
+// again afterwards and ErrStaleGeneration is returned if the group has
+// rebalanced in the meantime.
+func (c *GroupCoordinator) Commit(groupID, memberID string, generation uint64, partition uint32, offset uint64) error {
+	if err := c.owns(groupID, memberID, generation, partition); err != nil {
+		return err
+	}
+
+	if err := c.log.CommitGroupOffset(groupID, partition, offset); err != nil {
+		return fmt.Errorf("failed to commit the offset: %w", err)
+	}
+
+	if err := c.owns(groupID, memberID, generation, partition); err != nil {
+		return ErrStaleGeneration
+	}
+
+	return nil
+}
+
+// owns returns nil if the member owns the partition in the generation.
+func (c *GroupCoordinator) owns(groupID, memberID string, generation uint64, partition uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, err := c.member(groupID, memberID)
+	if err != nil {
+		return err
+	}
+
+	if generation != g.generation {
+		return ErrStaleGeneration
+	}
+
+	for _, p := range g.assignments[memberID] {
+		if p == partition {
+			return nil
+		}
+	}
+
+	return ErrPartitionNotAssigned
+}
+
+// Describe returns the members of the group with their assignments and the
+// offsets committed by the group. A group that has only committed offsets,
+// e.g. before a restart, has no members and no strategy.
+func (c *GroupCoordinator) Describe(groupID string) (GroupDescription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	offsets, committed := c.log.GroupOffsets(groupID)
+
+	g, ok := c.groups[groupID]
+	if !ok && !committed {
+		return GroupDescription{}, ErrUnknownGroup
+	}
+
+	if !ok {
+		description := GroupDescription{
+			Strategy:   "",
+			Generation: 0,
+			Members:    []Assignment{},
+			Offsets:    offsets,
+		}
+
+		return description, nil
+	}
+
+	c.expire(g, time.Now())
+
+	members := make([]string, 0, len(g.members))
+	for id := range g.members {
+		members = append(members, id)
+	}
+
+	sort.Strings(members)
+
+	description := GroupDescription{
+		Strategy:   g.strategy,
+		Generation: g.generation,
+		Members:    make([]Assignment, 0, len(members)),
+		Offsets:    offsets,
+	}
+
+	if description.Offsets == nil {
+		description.Offsets = make(map[uint32]uint64)
+	}
+
+	for _, id := range members {
+		description.Members = append(description.Members, g.assignment(id))
+	}
+
+	return description, nil
+}
+
+// Groups returns the IDs of the known groups in order, including the groups
+// that have only committed offsets.
+func (c *GroupCoordinator) Groups() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groups := c.log.OffsetGroups()
+	for id := range c.groups {
+		if _, committed := c.log.GroupOffsets(id); !committed {
+			groups = append(groups, id)
+		}
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
+// Committed returns the offset committed by the group for the partition.
+func (c *GroupCoordinator) Committed(groupID string, partition uint32) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	offsets, committed := c.log.GroupOffsets(groupID)
+
+	if _, ok := c.groups[groupID]; !ok && !committed {
+		return 0, ErrUnknownGroup
+	}
+
+	offset, ok := offsets[partition]
+	if !ok {
+		return 0, ErrNoCommittedOffset
+	}
+
+	return offset, nil
+}
+
+// member returns the group of the member after removing expired members.
+func (c *GroupCoordinator) member(groupID, memberID string) (*group, error) {
+	g, ok := c.groups[groupID]
+	if !ok {
+		return nil, ErrUnknownGroup
+	}
+
+	c.expire(g, time.Now())
+
+	if _, ok := g.members[memberID]; !ok {
+		return nil, ErrUnknownMember
+	}
+
+	return g, nil
+}
+
+// expire removes members whose session has timed out and rebalances the group
+// if any member has been removed.
+func (c *GroupCoordinator) expire(g *group, now time.Time) {
+	expired := false
+
+	for id, m := range g.members {
+		if now.Sub(m.heartbeat) > m.sessionTimeout {
+			delete(g.members, id)
+
+			expired = true
+		}
+	}
+
+	if expired {
+		c.rebalance(g)
+	}
+}
+
+// rebalance starts a new generation and assigns partitions to the members.
+func (c *GroupCoordinator) rebalance(g *group) {
+	g.generation++
+
+	members := make([]string, 0, len(g.members))
+	for id := range g.members {
+		members = append(members, id)
+	}
+
+	sort.Strings(members)
+
+	if g.strategy == RoundRobinStrategy {
+		g.assignments = assignRoundRobin(members, c.partitions)
+	} else {
+		g.assignments = assignRange(members, c.partitions)
+	}
+}
+
+func (g *group) assignment(memberID string) Assignment {
+	partitions := make([]uint32, len(g.assignments[memberID]))
+	copy(partitions, g.assignments[memberID])
+
+	return Assignment{
+		MemberID:   memberID,
+		Generation: g.generation,
+		Partitions: partitions,
+	}
+}
+
+// assignRange splits partitions into contiguous ranges, the first members get
+// one more partition if the partitions cannot be split evenly.
+func assignRange(members []string, partitions uint32) map[string][]uint32 {
+	assignments := make(map[string][]uint32, len(members))
+	if len(members) == 0 {
+		return assignments
+	}
+
+	n := uint32(len(members))
+	size, extra := partitions/n, partitions%n
+
+	var next uint32
+
+	for i, id := range members {
+		count := size
+		if uint32(i) < extra {
+			count++
+		}
+
+		assigned := make([]uint32, 0, count)
+		for p := next; p < next+count; p++ {
+			assigned = append(assigned, p)
+		}
+
+		assignments[id] = assigned
+		next += count
+	}
+
+	return assignments
+}
+
+// assignRoundRobin deals partitions to members in turn.
+func assignRoundRobin(members []string, partitions uint32) map[string][]uint32 {
+	assignments := make(map[string][]uint32, len(members))
+	if len(members) == 0 {
+		return assignments
+	}
+
+	for _, id := range members {
+		assignments[id] = []uint32{}
+	}
+
+	for p := uint32(0); p < partitions; p++ {
+		id := members[p%uint32(len(members))]
+		assignments[id] = append(assignments[id], p)
+	}
+
+	return assignments
+}
+
+func newMemberID() (string, error) {
+	b := make([]byte, 8) // nolint:gomnd
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a member ID: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// JoinGroupRequest is a request to join a consumer group. The server's
+// session timeout is used if the session timeout is zero.
+type JoinGroupRequest struct {
+	Group            string `json:"group"`
+	MemberID         string `json:"member_id"`
+	Strategy         string `json:"strategy"`
+	SessionTimeoutMs uint64 `json:"session_timeout_ms"`
+}
+
+// HeartbeatRequest is a request to keep the member session alive.
+type HeartbeatRequest struct {
+	Group    string `json:"group"`
+	MemberID string `json:"member_id"`
+}
+
+// LeaveGroupRequest is a request to leave a consumer group.
+type LeaveGroupRequest struct {
+	Group    string `json:"group"`
+	MemberID string `json:"member_id"`
+}
+
+// CommitOffsetRequest is a request to commit the offset consumed by the group.
+type CommitOffsetRequest struct {
+	Group      string `json:"group"`
+	MemberID   string `json:"member_id"`
+	Generation uint64 `json:"generation"`
+	Partition  uint32 `json:"partition"`
+	Offset     uint64 `json:"offset"`
+}
+
+// CommittedOffsetRequest is a request to read the offset committed by the group.
+type CommittedOffsetRequest struct {
+	Group     string `json:"group"`
+	Partition uint32 `json:"partition"`
+}
+
+// DescribeGroupRequest is a request to describe a consumer group.
+type DescribeGroupRequest struct {
+	Group string `json:"group"`
+}
+
+// AssignmentResponse is a response on the join and heartbeat requests.
+type AssignmentResponse struct {
+	MemberID   string   `json:"member_id"`
+	Generation uint64   `json:"generation"`
+	Partitions []uint32 `json:"partitions"`
+}
+
+// CommittedOffsetResponse is a response on the committed offset request.
+type CommittedOffsetResponse struct {
+	Partition uint32 `json:"partition"`
+	Offset    uint64 `json:"offset"`
+}
+
+// DescribeGroupResponse is a response on the describe group request.
+type DescribeGroupResponse struct {
+	Group      string               `json:"group"`
+	Strategy   string               `json:"strategy"`
+	Generation uint64               `json:"generation"`
+	Members    []AssignmentResponse `json:"members"`
+	Partitions []PartitionLag       `json:"partitions"`
+}
+
+// PartitionLag describes how far the group is behind the end of the partition.
+// The group has not committed an offset if the committed offset is not set.
+type PartitionLag struct {
+	Partition       uint32  `json:"partition"`
+	MemberID        string  `json:"member_id"`
+	CommittedOffset *uint64 `json:"committed_offset,omitempty"`
+	EndOffset       uint64  `json:"end_offset"`
+	Lag             uint64  `json:"lag"`
+}
+
+type groupHandler struct {
+	coordinator *GroupCoordinator
+	log         *Log
+}
+
+// NewJoinGroupHandler creates a new handler function to join consumer groups.
+func NewJoinGroupHandler(coordinator *GroupCoordinator) http.HandlerFunc {
+	handler := &groupHandler{
+		coordinator: coordinator,
+		log:         nil,
+	}
+
+	return handler.join
+}
+
+// NewHeartbeatHandler creates a new handler function to receive heartbeats
+// from consumer group members.
+func NewHeartbeatHandler(coordinator *GroupCoordinator) http.HandlerFunc {
+	handler := &groupHandler{
+		coordinator: coordinator,
+		log:         nil,
+	}
+
+	return handler.heartbeat
+}
+
+// NewLeaveGroupHandler creates a new handler function to leave consumer groups.
+func NewLeaveGroupHandler(coordinator *GroupCoordinator) http.HandlerFunc {
+	handler := &groupHandler{
+		coordinator: coordinator,
+		log:         nil,
+	}
+
+	return handler.leave
+}
+
+// NewCommitOffsetHandler creates a new handler function to commit offsets
+// consumed by consumer groups.
+func NewCommitOffsetHandler(coordinator *GroupCoordinator) http.HandlerFunc {
+	handler := &groupHandler{
+		coordinator: coordinator,
+		log:         nil,
+	}
+
+	return handler.commit
+}
+
+// NewCommittedOffsetHandler creates a new handler function to read offsets
+// committed by consumer groups.
+func NewCommittedOffsetHandler(coordinator *GroupCoordinator) http.HandlerFunc {
+	handler := &groupHandler{
+		coordinator: coordinator,
+		log:         nil,
+	}
+
+	return handler.committed
+}
+
+// NewDescribeGroupHandler creates a new handler function to describe consumer
+// groups and their lag behind the end of the log.
+func NewDescribeGroupHandler(coordinator *GroupCoordinator, log *Log) http.HandlerFunc {
+	handler := &groupHandler{
+		coordinator: coordinator,
+		log:         log,
+	}
+
+	return handler.describe
+}
+
+func (h *groupHandler) join(w http.ResponseWriter, r *http.Request) {
+	var request JoinGroupRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	if request.SessionTimeoutMs > uint64(MaxGroupSessionTimeout/time.Millisecond) {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid session timeout")
+
+		return
+	}
+
+	sessionTimeout := time.Duration(request.SessionTimeoutMs) * time.Millisecond
+
+	assignment, err := h.coordinator.Join(request.Group, request.MemberID, request.Strategy, sessionTimeout)
+	if err != nil {
+		writeGroupErrorResponse(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, AssignmentResponse(assignment))
+}
+
+func (h *groupHandler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	var request HeartbeatRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	assignment, err := h.coordinator.Heartbeat(request.Group, request.MemberID)
+	if err != nil {
+		writeGroupErrorResponse(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, AssignmentResponse(assignment))
+}
+
+func (h *groupHandler) leave(w http.ResponseWriter, r *http.Request) {
+	var request LeaveGroupRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	err = h.coordinator.Leave(request.Group, request.MemberID)
+	if err != nil {
+		writeGroupErrorResponse(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, struct{}{})
+}
+
+func (h *groupHandler) commit(w http.ResponseWriter, r *http.Request) {
+	var request CommitOffsetRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	err = h.coordinator.Commit(
+		request.Group,
+		request.MemberID,
+		request.Generation,
+		request.Partition,
+		request.Offset,
+	)
+	if err != nil {
+		writeGroupErrorResponse(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, struct{}{})
+}
+
+func (h *groupHandler) committed(w http.ResponseWriter, r *http.Request) {
+	var request CommittedOffsetRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	offset, err := h.coordinator.Committed(request.Group, request.Partition)
+	if err != nil {
+		writeGroupErrorResponse(w, r, err)
+
+		return
+	}
+
+	response := CommittedOffsetResponse{
+		Partition: request.Partition,
+		Offset:    offset,
+	}
+
+	writeResponse(w, http.StatusOK, response)
+}
+
+func (h *groupHandler) describe(w http.ResponseWriter, r *http.Request) {
+	var request DescribeGroupRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	description, err := h.coordinator.Describe(request.Group)
+	if err != nil {
+		writeGroupErrorResponse(w, r, err)
+
+		return
+	}
+
+	response := DescribeGroupResponse{
+		Group:      request.Group,
+		Strategy:   description.Strategy,
+		Generation: description.Generation,
+		Members:    make([]AssignmentResponse, 0, len(description.Members)),
+		Partitions: make([]PartitionLag, 0, h.coordinator.partitions),
+	}
+
+	owners := make(map[uint32]string)
+
+	for _, member := range description.Members {
+		response.Members = append(response.Members, AssignmentResponse(member))
+
+		for _, partition := range member.Partitions {
+			owners[partition] = member.MemberID
+		}
+	}
+
+	// The log is the only partition, so every partition ends where the log
+	// ends.
+	end := h.log.EndOffset()
+
+	for partition := uint32(0); partition < h.coordinator.partitions; partition++ {
+		lag := PartitionLag{
+			Partition:       partition,
+			MemberID:        owners[partition],
+			CommittedOffset: nil,
+			EndOffset:       end,
+			Lag:             end,
+		}
+
+		if offset, ok := description.Offsets[partition]; ok {
+			lag.CommittedOffset = &offset
+			lag.Lag = 0
+
+			if offset < end {
+				lag.Lag = end - offset
+			}
+		}
+
+		response.Partitions = append(response.Partitions, lag)
+	}
+
+	writeResponse(w, http.StatusOK, response)
+}
+
+func writeGroupErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownGroup):
+		writeErrorResponse(w, http.StatusNotFound, "Group not found")
+	case errors.Is(err, ErrUnknownMember):
+		writeErrorResponse(w, http.StatusNotFound, "Member not found")
+	case errors.Is(err, ErrNoCommittedOffset):
+		writeErrorResponse(w, http.StatusNotFound, "Committed offset not found")
+	case errors.Is(err, ErrUnknownStrategy), errors.Is(err, ErrInconsistentStrategy):
+		writeErrorResponse(w, http.StatusBadRequest, "Bad assignment strategy")
+	case errors.Is(err, ErrInvalidSessionTimeout):
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid session timeout")
+	case errors.Is(err, ErrInvalidProducerID):
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid group ID")
+	case errors.Is(err, ErrStaleGeneration):
+		writeErrorResponse(w, http.StatusConflict, "Stale generation")
+	case errors.Is(err, ErrPartitionNotAssigned):
+		writeErrorResponse(w, http.StatusConflict, "Partition not assigned")
+	case errors.Is(err, ErrNotLeader), errors.Is(err, ErrNoLeader):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Not the leader")
+	case errors.Is(err, ErrLogClosed):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Log closed")
+	default:
+		writeInternalError(w, r, err)
+	}
+}
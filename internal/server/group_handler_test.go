@@ -0,0 +1,185 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/steinfletcher/apitest"
+)
+
+func TestGroupHandlers(t *testing.T) {
+	t.Parallel()
+
+	coordinator := server.NewGroupCoordinator(server.NewLog(), 2, time.Minute)
+
+	apitest.New().
+		HandlerFunc(server.NewJoinGroupHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"a","strategy":"range"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"member_id":"a","generation":1,"partitions":[0,1]}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewJoinGroupHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"b","strategy":"range"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"member_id":"b","generation":2,"partitions":[1]}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewHeartbeatHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"a"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"member_id":"a","generation":2,"partitions":[0]}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewCommitOffsetHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"a","generation":1,"partition":0,"offset":5}`).
+		Expect(t).
+		Status(http.StatusConflict).
+		Body(`{"error":"Stale generation"}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewCommitOffsetHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"a","generation":2,"partition":0,"offset":5}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewCommittedOffsetHandler(coordinator)).
+		Get("/").
+		JSON(`{"group":"group","partition":0}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"partition":0,"offset":5}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewLeaveGroupHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"b"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewHeartbeatHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","member_id":"b"}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		Body(`{"error":"Member not found"}`).
+		End()
+}
+
+func TestGroupHandlers_BadRequest(t *testing.T) {
+	t.Parallel()
+
+	coordinator := server.NewGroupCoordinator(server.NewLog(), 1, time.Minute)
+
+	handlers := []http.HandlerFunc{
+		server.NewJoinGroupHandler(coordinator),
+		server.NewHeartbeatHandler(coordinator),
+		server.NewLeaveGroupHandler(coordinator),
+		server.NewCommitOffsetHandler(coordinator),
+		server.NewCommittedOffsetHandler(coordinator),
+	}
+
+	for _, handler := range handlers {
+		apitest.New().
+			HandlerFunc(handler).
+			Post("/").
+			Expect(t).
+			Body(`{"error":"Bad request"}`).
+			Status(http.StatusBadRequest).
+			End()
+	}
+
+	apitest.New().
+		HandlerFunc(server.NewJoinGroupHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","strategy":"sticky"}`).
+		Expect(t).
+		Body(`{"error":"Bad assignment strategy"}`).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		HandlerFunc(server.NewJoinGroupHandler(coordinator)).
+		Post("/").
+		JSON(`{"group":"group","session_timeout_ms":3600000}`).
+		Expect(t).
+		Body(`{"error":"Invalid session timeout"}`).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestDescribeGroupHandler(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	coordinator := server.NewGroupCoordinator(log, 1, time.Minute)
+	handler := server.NewDescribeGroupHandler(coordinator, log)
+
+	for i := 0; i < 5; i++ {
+		_, _ = log.Append([]byte("record"))
+	}
+
+	apitest.New().
+		HandlerFunc(handler).
+		Get("/").
+		JSON(`{"group":"group"}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		Body(`{"error":"Group not found"}`).
+		End()
+
+	a, _ := coordinator.Join("group", "a", "", 0)
+
+	apitest.New().
+		HandlerFunc(handler).
+		Get("/").
+		JSON(`{"group":"group"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{
+			"group":"group",
+			"strategy":"range",
+			"generation":1,
+			"members":[{"member_id":"a","generation":1,"partitions":[0]}],
+			"partitions":[{"partition":0,"member_id":"a","end_offset":5,"lag":5}]
+		}`).
+		End()
+
+	// The committed offset is persisted in the log as a control marker.
+	_ = coordinator.Commit("group", "a", a.Generation, 0, 3)
+
+	apitest.New().
+		HandlerFunc(handler).
+		Get("/").
+		JSON(`{"group":"group"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{
+			"group":"group",
+			"strategy":"range",
+			"generation":1,
+			"members":[{"member_id":"a","generation":1,"partitions":[0]}],
+			"partitions":[{"partition":0,"member_id":"a","committed_offset":3,"end_offset":6,"lag":3}]
+		}`).
+		End()
+}
@@ -0,0 +1,261 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupCoordinator_RangeStrategy(t *testing.T) {
+	t.Parallel()
+
+	c := server.NewGroupCoordinator(server.NewLog(), 5, time.Minute)
+
+	a, err := c.Join("group", "a", server.RangeStrategy, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), a.Generation)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 4}, a.Partitions)
+
+	b, err := c.Join("group", "b", server.RangeStrategy, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), b.Generation)
+	assert.Equal(t, []uint32{3, 4}, b.Partitions)
+
+	a, err = c.Heartbeat("group", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), a.Generation)
+	assert.Equal(t, []uint32{0, 1, 2}, a.Partitions)
+}
+
+func TestGroupCoordinator_RoundRobinStrategy(t *testing.T) {
+	t.Parallel()
+
+	c := server.NewGroupCoordinator(server.NewLog(), 5, time.Minute)
+
+	_, err := c.Join("group", "a", server.RoundRobinStrategy, 0)
+	assert.Nil(t, err)
+
+	b, err := c.Join("group", "b", server.RoundRobinStrategy, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{1, 3}, b.Partitions)
+
+	a, err := c.Heartbeat("group", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{0, 2, 4}, a.Partitions)
+}
+
+func TestGroupCoordinator_Join(t *testing.T) {
+	t.Parallel()
+
+	c := server.NewGroupCoordinator(server.NewLog(), 2, time.Minute)
+
+	t.Run("generate member ID", func(t *testing.T) {
+		a, err := c.Join("generated", "", "", 0)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, a.MemberID)
+	})
+
+	t.Run("rejoin keeps generation", func(t *testing.T) {
+		a, err := c.Join("rejoin", "a", "", 0)
+		assert.Nil(t, err)
+
+		again, err := c.Join("rejoin", "a", "", 0)
+		assert.Nil(t, err)
+		assert.Equal(t, a.Generation, again.Generation)
+	})
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		_, err := c.Join("unknown", "a", "sticky", 0)
+		assert.Equal(t, server.ErrUnknownStrategy, err)
+	})
+
+	t.Run("inconsistent strategy", func(t *testing.T) {
+		_, err := c.Join("inconsistent", "a", server.RangeStrategy, 0)
+		assert.Nil(t, err)
+
+		_, err = c.Join("inconsistent", "b", server.RoundRobinStrategy, 0)
+		assert.Equal(t, server.ErrInconsistentStrategy, err)
+	})
+}
+
+func TestGroupCoordinator_Leave(t *testing.T) {
+	t.Parallel()
+
+	c := server.NewGroupCoordinator(server.NewLog(), 2, time.Minute)
+
+	_, err := c.Join("group", "a", "", 0)
+	assert.Nil(t, err)
+
+	_, err = c.Join("group", "b", "", 0)
+	assert.Nil(t, err)
+
+	err = c.Leave("group", "b")
+	assert.Nil(t, err)
+
+	a, err := c.Heartbeat("group", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), a.Generation)
+	assert.Equal(t, []uint32{0, 1}, a.Partitions)
+
+	err = c.Leave("group", "b")
+	assert.Equal(t, server.ErrUnknownMember, err)
+
+	err = c.Leave("unknown", "a")
+	assert.Equal(t, server.ErrUnknownGroup, err)
+}
+
+func TestGroupCoordinator_SessionTimeout(t *testing.T) {
+	t.Parallel()
+
+	const sessionTimeout = 50 * time.Millisecond
+
+	c := server.NewGroupCoordinator(server.NewLog(), 2, sessionTimeout)
+
+	_, err := c.Join("group", "a", "", 0)
+	assert.Nil(t, err)
+
+	_, err = c.Join("group", "b", "", 0)
+	assert.Nil(t, err)
+
+	deadline := time.Now().Add(2 * sessionTimeout)
+	for time.Now().Before(deadline) {
+		_, err = c.Heartbeat("group", "a")
+		assert.Nil(t, err)
+
+		time.Sleep(sessionTimeout / 5)
+	}
+
+	a, err := c.Heartbeat("group", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), a.Generation)
+	assert.Equal(t, []uint32{0, 1}, a.Partitions)
+
+	_, err = c.Heartbeat("group", "b")
+	assert.Equal(t, server.ErrUnknownMember, err)
+}
+
+func TestGroupCoordinator_Commit(t *testing.T) {
+	t.Parallel()
+
+	c := server.NewGroupCoordinator(server.NewLog(), 2, time.Minute)
+
+	a, err := c.Join("group", "a", "", 0)
+	assert.Nil(t, err)
+
+	err = c.Commit("group", "a", a.Generation, 1, 42)
+	assert.Nil(t, err)
+
+	offset, err := c.Committed("group", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), offset)
+
+	_, err = c.Committed("group", 0)
+	assert.Equal(t, server.ErrNoCommittedOffset, err)
+
+	_, err = c.Committed("unknown", 0)
+	assert.Equal(t, server.ErrUnknownGroup, err)
+
+	_, err = c.Join("group", "b", "", 0)
+	assert.Nil(t, err)
+
+	t.Run("stale generation", func(t *testing.T) {
+		err := c.Commit("group", "a", a.Generation, 0, 43)
+		assert.Equal(t, server.ErrStaleGeneration, err)
+	})
+
+	t.Run("partition not assigned", func(t *testing.T) {
+		a, err := c.Heartbeat("group", "a")
+		assert.Nil(t, err)
+
+		err = c.Commit("group", "a", a.Generation, 1, 43)
+		assert.Equal(t, server.ErrPartitionNotAssigned, err)
+	})
+
+	t.Run("unknown member", func(t *testing.T) {
+		err := c.Commit("group", "c", a.Generation, 0, 43)
+		assert.Equal(t, server.ErrUnknownMember, err)
+	})
+}
+
+func TestGroupCoordinator_MemberSessionTimeout(t *testing.T) {
+	t.Parallel()
+
+	const sessionTimeout = 50 * time.Millisecond
+
+	c := server.NewGroupCoordinator(server.NewLog(), 2, time.Minute)
+
+	_, err := c.Join("group", "a", "", 0)
+	assert.Nil(t, err)
+
+	_, err = c.Join("group", "b", "", sessionTimeout)
+	assert.Nil(t, err)
+
+	time.Sleep(2 * sessionTimeout)
+
+	a, err := c.Heartbeat("group", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{0, 1}, a.Partitions)
+
+	_, err = c.Heartbeat("group", "b")
+	assert.Equal(t, server.ErrUnknownMember, err)
+
+	_, err = c.Join("group", "c", "", -time.Second)
+	assert.ErrorIs(t, err, server.ErrInvalidSessionTimeout)
+
+	_, err = c.Join("group", "c", "", server.MaxGroupSessionTimeout+time.Second)
+	assert.ErrorIs(t, err, server.ErrInvalidSessionTimeout)
+}
+
+func TestGroupCoordinator_PersistedOffsets(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	c := server.NewGroupCoordinator(log, 2, time.Minute)
+
+	a, err := c.Join("group", "a", "", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Commit("group", "a", a.Generation, 1, 42))
+	assert.Nil(t, c.Commit("group", "a", a.Generation, 1, 43))
+
+	// Offset markers are not visible to consumers.
+	_, err = log.Read(0)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+	assert.Nil(t, log.Close())
+
+	log, err = server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer log.Close() // nolint:errcheck
+
+	c = server.NewGroupCoordinator(log, 2, time.Minute)
+
+	offset, err := c.Committed("group", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(43), offset)
+
+	_, err = c.Committed("group", 0)
+	assert.Equal(t, server.ErrNoCommittedOffset, err)
+
+	assert.Equal(t, []string{"group"}, c.Groups())
+
+	description, err := c.Describe("group")
+	assert.Nil(t, err)
+	assert.Empty(t, description.Members)
+	assert.Equal(t, map[uint32]uint64{1: 43}, description.Offsets)
+
+	// A new generation of the group continues from the persisted offsets.
+	a, err = c.Join("group", "a", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), a.Generation)
+
+	description, err = c.Describe("group")
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint32]uint64{1: 43}, description.Offsets)
+	assert.Equal(t, []string{"group"}, c.Groups())
+}
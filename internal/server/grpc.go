@@ -0,0 +1,545 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	api "github.com/ivanlemeshev/proglog/api/v1"
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GRPCConfig configures the gRPC server.
+type GRPCConfig struct {
+	// Log is the served log. It is not closed by the server.
+	Log *Log
+
+	// Replicas tracks the followers replicating the log and serves produce
+	// requests with acks=all. Replicas with the default settings are created
+	// if it is nil.
+	Replicas *Replicas
+
+	// Metrics records the metrics of the server, shared with the HTTP
+	// server. New metrics are created if it is nil.
+	Metrics *Metrics
+
+	// TracerProvider creates the spans of requests. The global provider is
+	// used if it is nil.
+	TracerProvider trace.TracerProvider
+
+	// Logger writes the access log and internal errors. Nothing is logged if
+	// it is nil.
+	Logger *zap.Logger
+
+	// TraceRecordHeaders makes the server add the trace context of produce
+	// requests to the headers of the records like the HTTP server.
+	TraceRecordHeaders bool
+
+	// Authorizer allows produce and consume requests by the access control
+	// lists. All requests are allowed if it is nil.
+	Authorizer *auth.Authorizer
+
+	// Authenticator resolves the principals of bearer tokens in the
+	// authorization metadata. Bearer tokens are ignored if it is nil, and
+	// clients are identified by their certificates only.
+	Authenticator *auth.Authenticator
+
+	// Audit records denied requests and, if it is configured, consume
+	// requests. Nothing is audited if it is nil. It is not closed by the
+	// server.
+	Audit *AuditLog
+
+	// Quotas limit the request and byte rates by principal and topic.
+	// Nothing is limited if it is nil.
+	Quotas *quota.Manager
+
+	// Cluster lists the servers of the cluster for the clients discovering
+	// it. No servers are listed if it is nil.
+	Cluster Cluster
+}
+
+// grpcMethod describes how a method of the gRPC server is handled like its
+// HTTP route.
+type grpcMethod struct {
+	action    auth.Action // the action the method is authorized for
+	throttled bool        // whether the method is limited by the quotas
+	audit     string      // the audited action, empty if it is not audited
+}
+
+// grpcMethods are the methods of the gRPC server that are authorized by their
+// full method names. Like /v1/cluster, GetServers is allowed for all clients
+// and not throttled.
+var grpcMethods = map[string]grpcMethod{ // nolint:gochecknoglobals
+	"/log.v1.Log/Produce":      {action: auth.ActionProduce, throttled: true, audit: ""},
+	"/log.v1.Log/ProduceBatch": {action: auth.ActionProduce, throttled: true, audit: ""},
+	"/log.v1.Log/Consume":      {action: auth.ActionConsume, throttled: true, audit: AuditConsume},
+}
+
+// retryAfterMetadata is the metadata key of the time in seconds a throttled
+// client waits before retrying, like the Retry-After header.
+const retryAfterMetadata = "retry-after"
+
+// NewGRPCServer creates a new gRPC server that serves the log like the HTTP
+// server. Its interceptors record the same metrics, spans, access log, audit
+// events and quotas as the middlewares of the HTTP server. The options
+// configure the server, for example its TLS credentials, the clients are
+// identified by their verified certificates.
+func NewGRPCServer(config GRPCConfig, opts ...grpc.ServerOption) *grpc.Server {
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	replicas := config.Replicas
+	if replicas == nil {
+		replicas = NewReplicas(config.Log, ReplicasConfig{}) // nolint:exhaustivestruct
+	}
+
+	middlewares := []grpcMiddleware{
+		metrics.instrumentGRPC,
+		tracingGRPC(tracerProvider),
+		loggingGRPC(logger),
+		authenticationGRPC(config.Authenticator),
+		authorizationGRPC(config.Authorizer, config.Audit),
+		throttlingGRPC(config.Quotas, metrics),
+		auditingGRPC(config.Audit),
+		internalErrors,
+	}
+
+	server := grpc.NewServer(append(opts,
+		grpc.ChainUnaryInterceptor(unaryInterceptor(middlewares)),
+		grpc.ChainStreamInterceptor(streamInterceptor(middlewares)),
+	)...)
+	api.RegisterLogServer(server, &grpcServer{
+		UnimplementedLogServer: api.UnimplementedLogServer{},
+		log:                    config.Log,
+		replicas:               replicas,
+		cluster:                config.Cluster,
+		traceHeaders:           config.TraceRecordHeaders,
+	})
+
+	return server
+}
+
+// grpcMiddleware is a step of the interceptors of the gRPC server, like a
+// middleware of the HTTP router. It continues the call by calling next with
+// the context of the call.
+type grpcMiddleware func(ctx context.Context, call *grpcCall, next func(context.Context) error) error
+
+// grpcCall is a unary or streaming call of a method of the gRPC server.
+type grpcCall struct {
+	method string // the full method name, e.g. /log.v1.Log/Produce
+	bytes  int64  // the size of the received and sent messages
+}
+
+// size returns the size of the received and sent messages so far.
+func (c *grpcCall) size() int {
+	return int(atomic.LoadInt64(&c.bytes))
+}
+
+func (c *grpcCall) count(message interface{}) {
+	if m, ok := message.(proto.Message); ok {
+		atomic.AddInt64(&c.bytes, int64(proto.Size(m)))
+	}
+}
+
+// runGRPC runs the middlewares in order and then the handler.
+func runGRPC(ctx context.Context, call *grpcCall, middlewares []grpcMiddleware, handler func(context.Context) error) error {
+	if len(middlewares) == 0 {
+		return handler(ctx)
+	}
+
+	return middlewares[0](ctx, call, func(ctx context.Context) error {
+		return runGRPC(ctx, call, middlewares[1:], handler)
+	})
+}
+
+// unaryInterceptor runs the middlewares around unary calls.
+func unaryInterceptor(middlewares []grpcMiddleware) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		call := &grpcCall{method: info.FullMethod, bytes: 0}
+		call.count(request)
+
+		var response interface{}
+
+		err := runGRPC(ctx, call, middlewares, func(ctx context.Context) error {
+			var err error
+
+			response, err = handler(ctx, request)
+			if err == nil {
+				call.count(response)
+			}
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return response, nil
+	}
+}
+
+// streamInterceptor runs the middlewares around streaming calls. The messages
+// are counted as they are received and sent.
+func streamInterceptor(middlewares []grpcMiddleware) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		call := &grpcCall{method: info.FullMethod, bytes: 0}
+
+		return runGRPC(stream.Context(), call, middlewares, func(ctx context.Context) error {
+			return handler(srv, &grpcStream{ServerStream: stream, ctx: ctx, call: call})
+		})
+	}
+}
+
+// grpcStream is a server stream with the context of the middlewares that
+// counts its messages.
+type grpcStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	call *grpcCall
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grpcStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err // nolint:wrapcheck
+	}
+
+	s.call.count(m)
+
+	return nil
+}
+
+func (s *grpcStream) SendMsg(m interface{}) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err // nolint:wrapcheck
+	}
+
+	s.call.count(m)
+
+	return nil
+}
+
+// internalErrors logs internal errors with the context of the call and
+// responds with a generic error like writeInternalError, so internal details
+// are not exposed to clients.
+func internalErrors(ctx context.Context, _ *grpcCall, next func(context.Context) error) error {
+	err := next(ctx)
+	if status.Code(err) == codes.Internal {
+		loggerFromContext(ctx).Error("Internal error", zap.Error(err))
+
+		return status.Error(codes.Internal, "Internal server error")
+	}
+
+	return err
+}
+
+// grpcServer implements the gRPC service of the log.
+type grpcServer struct {
+	api.UnimplementedLogServer
+	log          *Log
+	replicas     *Replicas
+	cluster      Cluster
+	traceHeaders bool // inject the trace context into the record headers
+}
+
+// Produce writes the record into the log and returns its offset.
+func (s *grpcServer) Produce(ctx context.Context, request *api.ProduceRequest) (*api.ProduceResponse, error) {
+	if err := s.checkAcks(request.Acks); err != nil {
+		return nil, err
+	}
+
+	headers := s.headers(ctx, request.Headers)
+
+	_, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "Log.Append",
+		trace.WithAttributes(attribute.Int("record.size", len(request.Value))),
+	)
+
+	var (
+		offset uint64
+		err    error
+	)
+
+	if request.ProducerId != "" {
+		offset, err = s.log.AppendIdempotent(request.ProducerId, request.Sequence, request.Value, headers...)
+	} else {
+		offset, err = s.log.Append(request.Value, headers...)
+	}
+
+	span.SetAttributes(attribute.Int64("record.offset", int64(offset)))
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, appendStatus(err)
+	}
+
+	if request.Acks == AcksAll {
+		if err := s.waitReplicated(ctx, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	return &api.ProduceResponse{Offset: offset}, nil
+}
+
+// ProduceBatch writes the records into the log and returns their offsets.
+func (s *grpcServer) ProduceBatch(
+	ctx context.Context,
+	request *api.ProduceBatchRequest,
+) (*api.ProduceBatchResponse, error) {
+	if len(request.Records) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Bad request")
+	}
+
+	if err := s.checkAcks(request.Acks); err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(request.Records))
+	size := 0
+
+	for _, record := range request.Records {
+		records = append(records, Record{Value: record.Value, Offset: 0, Headers: s.headers(ctx, record.Headers)})
+		size += len(record.Value)
+	}
+
+	_, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "Log.AppendBatch",
+		trace.WithAttributes(
+			attribute.Int("batch.records", len(records)),
+			attribute.Int("batch.size", size),
+		),
+	)
+
+	offsets, err := s.log.AppendBatch(request.ProducerId, request.Sequence, request.Resume, records)
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, appendStatus(err)
+	}
+
+	if request.Acks == AcksAll {
+		if err := s.waitReplicated(ctx, maxOffset(offsets)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &api.ProduceBatchResponse{Offsets: offsets}, nil
+}
+
+// Consume reads the first record at or after the offset. Like the consume
+// handler, it waits for the record up to the maximum wait time. A follower
+// that is behind responds with Unavailable instead of redirecting to the
+// leader.
+func (s *grpcServer) Consume(ctx context.Context, request *api.ConsumeRequest) (*api.ConsumeResponse, error) {
+	isolation := Isolation(request.Isolation)
+
+	switch isolation {
+	case "":
+		isolation = ReadUncommitted
+	case ReadUncommitted, ReadCommitted:
+	default:
+		return nil, status.Error(codes.InvalidArgument, "Bad isolation level")
+	}
+
+	maxWait := time.Duration(request.MaxWaitMs) * time.Millisecond
+	if maxWait > maxConsumeWait {
+		maxWait = maxConsumeWait
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	if request.MinOffset != 0 || request.MaxStalenessMs != 0 {
+		maxStaleness := time.Duration(request.MaxStalenessMs) * time.Millisecond
+
+		err := s.log.WaitCaughtUp(ctx, request.MinOffset, maxStaleness)
+		if errors.Is(err, ErrReplicaBehind) {
+			return nil, status.Error(codes.Unavailable, "Replica behind")
+		}
+
+		if errors.Is(err, ErrLogClosed) {
+			return nil, status.Error(codes.Unavailable, "Log closed")
+		}
+	}
+
+	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "Log.Read",
+		trace.WithAttributes(
+			attribute.Int64("record.offset", int64(request.Offset)),
+			attribute.String("isolation", string(isolation)),
+		),
+	)
+
+	record, err := s.log.ReadWait(ctx, request.Offset, isolation)
+
+	switch {
+	case err == nil:
+		span.SetAttributes(attribute.Int64("record.offset", int64(record.Offset)))
+		span.End()
+	case errors.Is(err, ErrOffsetNotFound):
+		// Waiting for a record that is not appended yet is not a failure.
+		span.End()
+	default:
+		endSpan(span, err)
+	}
+
+	switch {
+	case errors.Is(err, ErrOffsetNotFound):
+		return nil, status.Error(codes.NotFound, "Record not found")
+	case errors.Is(err, ErrOffsetEvicted):
+		return nil, status.Error(codes.NotFound, "Record evicted")
+	case errors.Is(err, ErrLogClosed):
+		return nil, status.Error(codes.Unavailable, "Log closed")
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &api.ConsumeResponse{
+		Record: &api.Record{
+			Value:   record.Value,
+			Offset:  record.Offset,
+			Headers: headersToProto(record.Headers),
+		},
+	}, nil
+}
+
+// GetServers returns the servers of the cluster that serve gRPC, so clients
+// can find the leader and the followers from any server.
+func (s *grpcServer) GetServers(context.Context, *api.GetServersRequest) (*api.GetServersResponse, error) {
+	servers := []*api.Server{}
+
+	if s.cluster != nil {
+		for _, server := range s.cluster.Servers() {
+			if server.GRPCAddr == "" {
+				continue
+			}
+
+			servers = append(servers, &api.Server{
+				Id:       server.ID,
+				GrpcAddr: server.GRPCAddr,
+				Leader:   server.Leader,
+			})
+		}
+	}
+
+	return &api.GetServersResponse{Servers: servers}, nil
+}
+
+// checkAcks checks the acknowledgements of the request like the produce
+// handler.
+func (s *grpcServer) checkAcks(acks string) error {
+	switch acks {
+	case "", AcksLeader:
+	case AcksAll:
+		if err := s.replicas.CheckInSync(); err != nil {
+			return status.Error(codes.Unavailable, "Not enough in-sync replicas")
+		}
+	default:
+		return status.Error(codes.InvalidArgument, "Bad acks")
+	}
+
+	return nil
+}
+
+// waitReplicated waits until the in-sync replicas have replicated the record.
+func (s *grpcServer) waitReplicated(ctx context.Context, offset uint64) error {
+	err := s.replicas.WaitReplicated(ctx, offset)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotEnoughReplicas):
+		return status.Error(codes.Unavailable, "Not enough in-sync replicas")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "Replication timed out")
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// appendStatus returns the status of a failed append with the codes that
+// match the status codes of the produce handler.
+func appendStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrOutOfOrderSequence):
+		return status.Error(codes.FailedPrecondition, "Out of order sequence")
+	case errors.Is(err, ErrDuplicateSequence):
+		return status.Error(codes.FailedPrecondition, "Duplicate sequence")
+	case errors.Is(err, ErrInvalidProducerID):
+		return status.Error(codes.InvalidArgument, "Invalid producer ID")
+	case errors.Is(err, ErrInvalidHeader):
+		return status.Error(codes.InvalidArgument, "Invalid header")
+	case errors.Is(err, store.ErrMaxRecordLength):
+		return status.Error(codes.InvalidArgument, "Record too large")
+	case errors.Is(err, ErrNotLeader), errors.Is(err, ErrNoLeader):
+		return status.Error(codes.Unavailable, "Not the leader")
+	case errors.Is(err, ErrLogClosed):
+		return status.Error(codes.Unavailable, "Log closed")
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// headers returns the headers of a record with the trace context of the call
+// if the server adds it.
+func (s *grpcServer) headers(ctx context.Context, requested []*api.Header) []Header {
+	headers := headerCarrier(headersFromProto(requested))
+
+	// Records keep the trace context of the producer if it has set one.
+	if s.traceHeaders && headers.Get("traceparent") == "" {
+		traceContext.Inject(ctx, &headers)
+	}
+
+	return headers
+}
+
+func headersFromProto(headers []*api.Header) []Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	converted := make([]Header, 0, len(headers))
+	for _, h := range headers {
+		converted = append(converted, Header{Key: h.Key, Value: h.Value})
+	}
+
+	return converted
+}
+
+func headersToProto(headers []Header) []*api.Header {
+	converted := make([]*api.Header, 0, len(headers))
+	for _, h := range headers {
+		converted = append(converted, &api.Header{Key: h.Key, Value: h.Value})
+	}
+
+	return converted
+}
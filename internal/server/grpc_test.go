@@ -0,0 +1,338 @@
+package server_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/ivanlemeshev/proglog/api/v1"
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serveGRPC serves the gRPC server on a local port and returns a client
+// connected to it.
+func serveGRPC(t *testing.T, config server.GRPCConfig) api.LogClient {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.NewGRPCServer(config)
+
+	go srv.Serve(listener) // nolint:errcheck
+
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return api.NewLogClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	c := serveGRPC(t, server.GRPCConfig{Log: log}) // nolint:exhaustivestruct
+	ctx := context.Background()
+
+	produced, err := c.Produce(ctx, &api.ProduceRequest{ // nolint:exhaustivestruct
+		Value:   []byte("first"),
+		Headers: []*api.Header{{Key: "key", Value: "value"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), produced.Offset)
+
+	batch := &api.ProduceBatchRequest{ // nolint:exhaustivestruct
+		Records:    []*api.Record{{Value: []byte("second")}, {Value: []byte("third")}},
+		ProducerId: "producer",
+	}
+
+	batchProduced, err := c.ProduceBatch(ctx, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, batchProduced.Offsets)
+
+	// A retried batch is not appended again.
+	batchProduced, err = c.ProduceBatch(ctx, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, batchProduced.Offsets)
+
+	batch.Sequence = 3
+	_, err = c.ProduceBatch(ctx, batch)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = c.ProduceBatch(ctx, &api.ProduceBatchRequest{}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.Produce(ctx, &api.ProduceRequest{Acks: "some"}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	consumed, err := c.Consume(ctx, &api.ConsumeRequest{Offset: 0}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), consumed.Record.Value)
+	assert.Equal(t, "value", consumed.Record.Headers[0].Value)
+
+	consumed, err = c.Consume(ctx, &api.ConsumeRequest{Offset: 2}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("third"), consumed.Record.Value)
+
+	_, err = c.Consume(ctx, &api.ConsumeRequest{Offset: 3, MaxWaitMs: 10}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.Consume(ctx, &api.ConsumeRequest{Isolation: "some"}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	assert.Nil(t, log.Close())
+
+	_, err = c.Produce(ctx, &api.ProduceRequest{Value: []byte("closed")}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCServer_Authorization(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.yaml")
+	acl := filepath.Join(dir, "acl.yaml")
+
+	err := ioutil.WriteFile(keys, []byte("keys:\n"+
+		"  - principal: producer\n    sha256: "+auth.HashAPIKey("producer-key")+"\n"+
+		"  - principal: consumer\n    sha256: "+auth.HashAPIKey("consumer-key")+"\n"), 0600)
+	assert.Nil(t, err)
+
+	err = ioutil.WriteFile(acl, []byte("rules:\n"+
+		"  - principals: [producer]\n    topics: [default]\n    actions: [produce]\n"+
+		"  - principals: [consumer]\n    topics: [default]\n    actions: [consume]\n"), 0600)
+	assert.Nil(t, err)
+
+	apiKeys, err := auth.LoadAPIKeys(keys)
+	assert.Nil(t, err)
+
+	authorizer, err := auth.NewAuthorizer(acl)
+	assert.Nil(t, err)
+
+	c := serveGRPC(t, server.GRPCConfig{ // nolint:exhaustivestruct
+		Log:           server.NewLog(),
+		Authorizer:    authorizer,
+		Authenticator: auth.NewAuthenticator(apiKeys, nil),
+	})
+
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	_, err = c.Produce(withToken("producer-key"), &api.ProduceRequest{Value: []byte("test")}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	_, err = c.Produce(withToken("consumer-key"), &api.ProduceRequest{Value: []byte("test")}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = c.Produce(context.Background(), &api.ProduceRequest{Value: []byte("test")}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = c.Consume(withToken("consumer-key"), &api.ConsumeRequest{Offset: 0}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	_, err = c.Consume(withToken("wrong-key"), &api.ConsumeRequest{Offset: 0}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCServer_GetServers(t *testing.T) {
+	t.Parallel()
+
+	c := serveGRPC(t, server.GRPCConfig{ // nolint:exhaustivestruct
+		Log: server.NewLog(),
+		Cluster: staticCluster{
+			{ID: "1", URL: "http://10.0.0.1:8080", GRPCAddr: "10.0.0.1:8400", Leader: true},
+			{ID: "2", URL: "http://10.0.0.2:8080", Leader: false},
+			{ID: "3", GRPCAddr: "10.0.0.3:8400", Leader: false},
+		},
+	})
+
+	response, err := c.GetServers(context.Background(), &api.GetServersRequest{})
+	assert.Nil(t, err)
+
+	if assert.Len(t, response.Servers, 2) {
+		assert.Equal(t, "1", response.Servers[0].Id)
+		assert.Equal(t, "10.0.0.1:8400", response.Servers[0].GrpcAddr)
+		assert.True(t, response.Servers[0].Leader)
+		assert.Equal(t, "3", response.Servers[1].Id)
+		assert.False(t, response.Servers[1].Leader)
+	}
+
+	c = serveGRPC(t, server.GRPCConfig{Log: server.NewLog()}) // nolint:exhaustivestruct
+
+	response, err = c.GetServers(context.Background(), &api.GetServersRequest{})
+	assert.Nil(t, err)
+	assert.Empty(t, response.Servers)
+}
+
+func TestGRPCServer_Telemetry(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	metrics := server.NewMetrics()
+	core, logs := observer.New(zap.InfoLevel)
+
+	c := serveGRPC(t, server.GRPCConfig{ // nolint:exhaustivestruct
+		Log:                server.NewLog(),
+		Metrics:            metrics,
+		TracerProvider:     provider,
+		Logger:             zap.New(core),
+		TraceRecordHeaders: true,
+	})
+
+	const (
+		traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+		traceparent = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", traceparent, "x-request-id", "request-1")
+
+	var header metadata.MD
+
+	_, err := c.Produce(ctx, &api.ProduceRequest{Value: []byte("test")}, grpc.Header(&header)) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"request-1"}, header.Get("x-request-id"))
+
+	consumed, err := c.Consume(context.Background(), &api.ConsumeRequest{Offset: 0}, grpc.Header(&header)) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+	assert.Len(t, header.Get("x-request-id")[0], 16)
+
+	// The record keeps the trace context of the produce request.
+	if assert.Len(t, consumed.Record.Headers, 1) {
+		assert.Equal(t, "traceparent", consumed.Record.Headers[0].Key)
+		assert.True(t, strings.HasPrefix(consumed.Record.Headers[0].Value, "00-"+traceID+"-"))
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	produce := spans["log.v1.Log/Produce"]
+	if assert.NotNil(t, produce) {
+		assert.Equal(t, traceID, produce.SpanContext().TraceID().String())
+		assert.True(t, produce.Parent().IsRemote())
+		assert.Equal(t, produce.SpanContext().SpanID(), spans["Log.Append"].Parent().SpanID())
+	}
+
+	assert.NotNil(t, spans["log.v1.Log/Consume"])
+
+	entries := logs.FilterMessage("Request").AllUntimed()
+	if assert.Len(t, entries, 2) {
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "request-1", fields["request_id"])
+		assert.Equal(t, traceID, fields["trace_id"])
+		assert.Equal(t, "/log.v1.Log/Produce", fields["method"])
+		assert.Equal(t, "OK", fields["code"])
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Contains(t, w.Body.String(), `proglog_grpc_requests_total{code="OK",method="/log.v1.Log/Produce"} 1`)
+	assert.Contains(t, w.Body.String(), `proglog_grpc_request_duration_seconds_count{code="OK",method="/log.v1.Log/Consume"} 1`)
+}
+
+func TestGRPCServer_Quotas(t *testing.T) {
+	t.Parallel()
+
+	metrics := server.NewMetrics()
+
+	c := serveGRPC(t, server.GRPCConfig{ // nolint:exhaustivestruct
+		Log:     server.NewLog(),
+		Metrics: metrics,
+		Quotas:  quota.NewManager(quota.Config{Default: quota.Limit{RequestsPerSecond: 1}}),
+	})
+	ctx := context.Background()
+
+	_, err := c.Produce(ctx, &api.ProduceRequest{Value: []byte("test")}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	var header metadata.MD
+
+	_, err = c.Produce(ctx, &api.ProduceRequest{Value: []byte("test")}, grpc.Header(&header)) // nolint:exhaustivestruct
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1"}, header.Get("retry-after"))
+
+	// Discovering the cluster is not throttled.
+	for i := 0; i < 3; i++ {
+		_, err = c.GetServers(ctx, &api.GetServersRequest{})
+		assert.Nil(t, err)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Contains(t, w.Body.String(), `proglog_quota_requests_total{principal="anonymous",topic="default"} 1`)
+	assert.Contains(t, w.Body.String(), `proglog_quota_bytes_total{principal="anonymous",topic="default"}`)
+	assert.Contains(t, w.Body.String(),
+		`proglog_quota_throttled_total{principal="anonymous",quota="principal",resource="requests",topic="default"} 1`)
+}
+
+func TestGRPCServer_Audit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	acl := filepath.Join(dir, "acl.yaml")
+
+	err := ioutil.WriteFile(acl, []byte("rules:\n  - principals: [anonymous]\n    topics: [\"*\"]\n    actions: [consume]\n"), 0600)
+	assert.Nil(t, err)
+
+	authorizer, err := auth.NewAuthorizer(acl)
+	assert.Nil(t, err)
+
+	audit, err := server.OpenAuditLog(server.AuditConfig{Dir: filepath.Join(dir, "audit"), Consume: true})
+	assert.Nil(t, err)
+
+	defer audit.Close() // nolint:errcheck
+
+	c := serveGRPC(t, server.GRPCConfig{ // nolint:exhaustivestruct
+		Log:        server.NewLog(),
+		Authorizer: authorizer,
+		Audit:      audit,
+	})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "request-1")
+
+	_, err = c.Produce(ctx, &api.ProduceRequest{Value: []byte("test")}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = c.Consume(ctx, &api.ConsumeRequest{Offset: 0}) // nolint:exhaustivestruct
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	events, err := audit.Query(server.AuditFilter{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, server.AuditAuthorize, events[0].Action)
+		assert.Equal(t, server.AuditDenied, events[0].Outcome)
+		assert.Equal(t, "request-1", events[0].RequestID)
+		assert.Equal(t, server.AuditConsume, events[1].Action)
+		assert.Equal(t, server.AuditFailure, events[1].Outcome)
+		assert.Equal(t, "NotFound", events[1].Details["code"])
+	}
+}
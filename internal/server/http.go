@@ -2,27 +2,237 @@ package server
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
-// NewHTTPServer creates a new HTTP server.
-func NewHTTPServer(addr string) *http.Server {
-	log := NewLog()
+// logPartitions is the number of partitions assigned to consumer groups. The
+// log is not partitioned yet, so it is the only partition.
+const logPartitions = 1
+
+// HTTPConfig configures the HTTP server.
+type HTTPConfig struct {
+	// Addr is the address the server listens on.
+	Addr string
+
+	// Log is the served log. It is not closed by the server.
+	Log *Log
+
+	// GroupSessionTimeout is the time after which a consumer group member
+	// without heartbeats is removed from the group, unless the member asks
+	// for another one. DefaultGroupSessionTimeout is used if it is zero.
+	GroupSessionTimeout time.Duration
+
+	// Metrics records the metrics of the server. New metrics are created if
+	// it is nil.
+	Metrics *Metrics
+
+	// TracerProvider creates the spans of requests. The global provider is
+	// used if it is nil.
+	TracerProvider trace.TracerProvider
+
+	// Logger writes the access log and internal errors. Nothing is logged if
+	// it is nil.
+	Logger *zap.Logger
+
+	// LogLevel is the level of the logger. If it is not nil, it can be read
+	// and changed at runtime with GET and PUT /log/level.
+	LogLevel *zap.AtomicLevel
+
+	// Version is the version of the server reported by /v1/status.
+	Version string
+
+	// Settings are the settings of the server reported by /v1/status. They
+	// are encoded as JSON and must not contain secrets.
+	Settings interface{}
+
+	// TraceRecordHeaders makes the server add the trace context of produce
+	// requests to the headers of the records, unless the producer has set it,
+	// so consumers can link their spans to the producer.
+	TraceRecordHeaders bool
+
+	// Authorizer allows produce, consume and admin requests by the access
+	// control lists. All requests are allowed if it is nil. The metrics and
+	// the health checks are always allowed.
+	Authorizer *auth.Authorizer
+
+	// Authenticator resolves the principals of bearer tokens. Bearer tokens
+	// are ignored if it is nil, and clients are identified by their
+	// certificates only.
+	Authenticator *auth.Authenticator
+
+	// Audit records administrative actions, denied requests and, if it is
+	// configured, consume requests. It can be queried with GET /v1/audit.
+	// Nothing is audited if it is nil. It is not closed by the server.
+	Audit *AuditLog
+
+	// Quotas limit the request and byte rates of produce, consume and
+	// transaction requests by principal and topic. Nothing is limited if it
+	// is nil.
+	Quotas *quota.Manager
+
+	// Replicas tracks the followers replicating the log and serves produce
+	// requests with acks=all. Replicas with the default settings are created
+	// if it is nil.
+	Replicas *Replicas
+
+	// Follower is the replication of the leader's log into the served log,
+	// reported by /v1/status. It is nil if the server is not a follower. It
+	// is not stopped by the server.
+	Follower *Follower
+
+	// Cluster lists the servers of the cluster for clients discovering the
+	// leader with GET /v1/cluster. The route is not served if it is nil. Like
+	// the health checks, it is allowed for all clients.
+	Cluster Cluster
+
+	// Tier uploads the sealed segments of the log to an object store,
+	// reported by /v1/status. It is nil if the log is not offloaded. It is
+	// not stopped by the server.
+	Tier *Tier
+
+	// BackupDir is the directory of the snapshots taken with POST
+	// /v1/snapshots. The route is not served if it is empty.
+	BackupDir string
+}
+
+// NewHTTPServer creates a new HTTP server that serves the log. Long polls of
+// the log are stopped when the server starts shutting down.
+func NewHTTPServer(config HTTPConfig) *http.Server {
+	log := config.Log
+
+	groupSessionTimeout := config.GroupSessionTimeout
+	if groupSessionTimeout == 0 {
+		groupSessionTimeout = DefaultGroupSessionTimeout
+	}
+
+	coordinator := NewGroupCoordinator(log, logPartitions, groupSessionTimeout)
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+
+	metrics.registerLog(log, coordinator)
+
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	replicas := config.Replicas
+	if replicas == nil {
+		replicas = NewReplicas(log, ReplicasConfig{}) // nolint:exhaustivestruct
+	}
+
+	authorize := authorization(config.Authorizer, config.Audit)
+	audit := auditing(config.Audit)
+	throttle := throttling(config.Quotas, metrics)
 
 	r := mux.NewRouter()
-	r.HandleFunc("/", NewProduceHandler(log)).Methods("POST")
-	r.HandleFunc("/", NewConsumeHandler(log)).Methods("GET")
+	r.Use(metrics.instrument, tracing(tracerProvider), logging(logger), authentication(config.Authenticator))
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", NewHealthHandler()).Methods("GET")
+	r.HandleFunc("/readyz", NewReadyHandler(log)).Methods("GET")
+	r.Handle("/v1/status", authorize(auth.ActionAdmin,
+		newStatusHandler(log, config.Version, time.Now(), config.Settings, replicas, config.Follower, config.Tier))).Methods("GET")
+
+	if config.Cluster != nil {
+		r.HandleFunc("/v1/cluster", NewClusterHandler(config.Cluster)).Methods("GET")
+	}
+
+	if config.LogLevel != nil {
+		level := config.LogLevel
+		levelDetails := func() map[string]string { return map[string]string{"level": level.String()} }
+
+		r.Handle("/log/level", authorize(auth.ActionAdmin, level)).Methods("GET")
+		r.Handle("/log/level", authorize(auth.ActionAdmin,
+			audit(AuditLogLevelChange, "log_level", levelDetails, level))).Methods("PUT")
+	}
+
+	r.Handle("/v1/reassignment", authorize(auth.ActionAdmin,
+		audit(AuditReassign, "replicas", nil, NewReassignHandler(replicas)))).Methods("POST")
+	r.Handle("/v1/reassignment", authorize(auth.ActionAdmin, NewReassignmentHandler(replicas))).Methods("GET")
+	r.Handle("/v1/reassignment", authorize(auth.ActionAdmin,
+		audit(AuditReassignCancel, "replicas", nil, NewCancelReassignmentHandler(replicas)))).Methods("DELETE")
+	r.Handle("/v1/reassignment/throttle", authorize(auth.ActionAdmin,
+		audit(AuditReassignLimit, "replicas", nil, NewReassignmentThrottleHandler(replicas)))).Methods("PUT")
+
+	r.Handle("/v1/topics", authorize(auth.ActionAdmin, NewTopicsHandler(log, config.Tier))).Methods("GET")
+
+	if config.BackupDir != "" {
+		r.Handle("/v1/snapshots", authorize(auth.ActionAdmin,
+			audit(AuditSnapshot, "log", nil, NewSnapshotHandler(log, config.BackupDir)))).Methods("POST")
+	}
+
+	if config.Audit != nil {
+		r.Handle("/v1/audit", authorize(auth.ActionAdmin, NewAuditHandler(config.Audit))).Methods("GET")
+	}
+
+	r.Handle("/", authorize(auth.ActionProduce,
+		throttle(newProduceHandler(log, replicas, config.TraceRecordHeaders)))).Methods("POST")
+	r.Handle("/batch", authorize(auth.ActionProduce,
+		throttle(newProduceBatchHandler(log, replicas, config.TraceRecordHeaders)))).Methods("POST")
+	r.Handle("/", authorize(auth.ActionConsume,
+		throttle(audit(AuditConsume, logTopic, nil,
+			newConsumeHandler(log, leaderURL(config.Follower, config.Cluster)))))).Methods("GET")
+	r.Handle("/v1/replicas/fetch", authorize(auth.ActionReplicate, NewFetchHandler(replicas))).Methods("POST")
+	r.Handle("/transactions/begin", authorize(auth.ActionProduce,
+		throttle(NewBeginTransactionHandler(log)))).Methods("POST")
+	r.Handle("/transactions/commit", authorize(auth.ActionProduce,
+		throttle(NewCommitTransactionHandler(log)))).Methods("POST")
+	r.Handle("/transactions/abort", authorize(auth.ActionProduce,
+		throttle(NewAbortTransactionHandler(log)))).Methods("POST")
+	r.Handle("/groups/join", authorize(auth.ActionConsume, NewJoinGroupHandler(coordinator))).Methods("POST")
+	r.Handle("/groups/heartbeat", authorize(auth.ActionConsume, NewHeartbeatHandler(coordinator))).Methods("POST")
+	r.Handle("/groups/leave", authorize(auth.ActionConsume, NewLeaveGroupHandler(coordinator))).Methods("POST")
+	r.Handle("/groups/offsets", authorize(auth.ActionConsume, NewCommitOffsetHandler(coordinator))).Methods("POST")
+	r.Handle("/groups/offsets", authorize(auth.ActionConsume, NewCommittedOffsetHandler(coordinator))).Methods("GET")
+	r.Handle("/groups/describe", authorize(auth.ActionAdmin, NewDescribeGroupHandler(coordinator, log))).Methods("GET")
 
 	var server http.Server
-	server.Addr = addr
+	server.Addr = config.Addr
 	server.Handler = r
+	server.RegisterOnShutdown(log.StopWaiting)
 
 	return &server
 }
 
+// leaderURL returns the function that finds the URL of the leader: the
+// leader a follower replicates or the leader of the cluster. The URL is empty
+// if the leader is not known.
+func leaderURL(follower *Follower, cluster Cluster) func() string {
+	return func() string {
+		if follower != nil {
+			return follower.config.LeaderURL
+		}
+
+		if cluster == nil {
+			return ""
+		}
+
+		for _, server := range cluster.Servers() {
+			if server.Leader {
+				return server.URL
+			}
+		}
+
+		return ""
+	}
+}
+
 // ErrorResponse is a response on error.
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -39,10 +249,8 @@ func writeResponse(w http.ResponseWriter, code int, v interface{}) {
 	w.WriteHeader(code)
 	w.Header().Set("Content-Type", "application/json")
 
-	_, err = w.Write(data)
-	if err != nil {
-		log.Println("Failed to write HTTP response:", err)
-	}
+	// A failed write is reported by the access log.
+	_, _ = w.Write(data)
 }
 
 func writeErrorResponse(w http.ResponseWriter, code int, err string) {
@@ -0,0 +1,59 @@
+package server_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPServer_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	srv := server.NewHTTPServer(server.HTTPConfig{Log: server.NewLog()})
+
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	polled := make(chan int, 1)
+
+	go func() {
+		body := strings.NewReader(`{"offset":0,"max_wait_ms":30000}`)
+
+		req, err := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/", body)
+		if err != nil {
+			polled <- 0
+
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			polled <- 0
+
+			return
+		}
+		defer resp.Body.Close() // nolint:errcheck
+
+		polled <- resp.StatusCode
+	}()
+
+	// Give the long poll time to start waiting.
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = srv.Shutdown(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, <-polled)
+}
@@ -2,57 +2,1041 @@
 package server
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 // ErrOffsetNotFound is an error on offest not found.
 var ErrOffsetNotFound = fmt.Errorf("offset not found")
 
+// ErrOutOfOrderSequence is returned if a producer skips sequence numbers.
+var ErrOutOfOrderSequence = fmt.Errorf("out of order sequence")
+
+// ErrDuplicateSequence is returned if a producer repeats a sequence number
+// older than its last one, so the original offset is not known anymore.
+var ErrDuplicateSequence = fmt.Errorf("duplicate sequence")
+
+// ErrCorruptRecord is returned if a persisted record cannot be decoded.
+var ErrCorruptRecord = fmt.Errorf("corrupt record")
+
+// ErrChecksumMismatch is returned if the checksum of a persisted record does
+// not match its content.
+var ErrChecksumMismatch = fmt.Errorf("checksum mismatch")
+
+// ErrUnknownSyncPolicy is returned if the sync policy is not supported.
+var ErrUnknownSyncPolicy = fmt.Errorf("unknown sync policy")
+
+// ErrInvalidSyncInterval is returned if the interval of periodic syncs is not
+// positive.
+var ErrInvalidSyncInterval = fmt.Errorf("invalid sync interval")
+
+// ErrInvalidHeader is returned if a record has too many headers or a header is
+// too long.
+var ErrInvalidHeader = fmt.Errorf("invalid header")
+
+// ErrInvalidProducerID is returned if a producer ID or the principal that owns
+// its transaction does not fit into its length prefix.
+var ErrInvalidProducerID = fmt.Errorf("invalid producer ID")
+
+// ErrLogClosed is returned if the log is closed or closing, so it does not
+// accept records anymore or cannot wait for them.
+var ErrLogClosed = fmt.Errorf("log closed")
+
+// ErrOffsetEvicted is returned if a record is evicted from the local store and
+// the log has no tier to read it from.
+var ErrOffsetEvicted = fmt.Errorf("offset evicted")
+
+// storeFileName is the name of the file that persisted the log records before
+// the store was split into segments. It is moved into the segments directory
+// when the log is opened, and it is the name of the store file in snapshots.
+const storeFileName = "log.store"
+
+// segmentsDirName is the name of the directory in the log directory with the
+// segment files of the store.
+const segmentsDirName = "segments"
+
+// Isolation defines which records of transactions are visible on reading.
+type Isolation string
+
+const (
+	// ReadUncommitted returns all records including records of open and
+	// aborted transactions.
+	ReadUncommitted Isolation = "read_uncommitted"
+
+	// ReadCommitted returns only records of committed transactions and records
+	// written outside of transactions. Reading stops before the first record of
+	// the oldest open transaction.
+	ReadCommitted Isolation = "read_committed"
+)
+
+// SyncPolicy defines when the records of a persisted log are committed to
+// stable storage.
+type SyncPolicy string
+
+const (
+	// SyncAlways commits every appended record before returning its offset.
+	SyncAlways SyncPolicy = "always"
+
+	// SyncInterval commits the appended records periodically.
+	SyncInterval SyncPolicy = "interval"
+
+	// SyncNever leaves committing the records to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+// LogConfig configures a persisted log.
+type LogConfig struct {
+	// MaxRecordSize is the maximum size of a persisted record including its
+	// header. The store.MaxRecordLength constant is used if it is zero.
+	MaxRecordSize uint64
+
+	// SyncPolicy defines when the records are committed to stable storage.
+	// SyncNever is used if it is empty.
+	SyncPolicy SyncPolicy
+
+	// SyncInterval is the period of commits for the SyncInterval policy.
+	SyncInterval time.Duration
+
+	// Metrics records the store flush and sync durations if it is not nil.
+	Metrics *Metrics
+
+	// TracerProvider creates the spans of store flushes and syncs if it is
+	// not nil.
+	TracerProvider trace.TracerProvider
+
+	// Logger logs failures of periodic syncs if it is not nil.
+	Logger *zap.Logger
+
+	// SegmentBytes is the size from which the store starts a new segment
+	// file. Only whole segments are uploaded to a tier and evicted, so the
+	// store is not split if it is zero.
+	SegmentBytes uint64
+}
+
+// LogStats is a snapshot of the log counters.
+type LogStats struct {
+	Dir              string // empty if the log is not persisted
+	LocalOffset      uint64 // the first record that is not evicted from the local store
+	EndOffset        uint64
+	LastStableOffset uint64 // the end of the log for read committed consumers
+	DiskSize         uint64 // zero if the log is not persisted
+	BufferedBytes    uint64 // bytes not written to the log file yet
+	AppendedBytes    uint64 // bytes of values appended since the log was opened
+	ReadBytes        uint64 // bytes of values read since the log was opened
+}
+
 // Log is an implementation of commit log.
 type Log struct {
-	mu      sync.Mutex
-	records []Record
+	mu           sync.Mutex
+	entries      []entry
+	producers    map[string]producer
+	transactions map[string]*transaction
+	store        *store.Segmented // nil if the log is not persisted
+	dir          string           // empty if the log is not persisted
+	maxEntrySize uint64           // zero if the log is not persisted
+	syncPolicy   SyncPolicy       // empty if the log is not persisted
+	syncErr      error            // the last failed periodic sync
+	logger       *zap.Logger
+	stopSync     chan struct{} // closed to stop periodic syncs
+	syncDone     chan struct{} // closed when periodic syncs are stopped
+	appended     chan struct{} // closed and replaced on every append and high watermark advance
+	closing      chan struct{} // closed to stop waiting for records
+	closeWaiters sync.Once
+	closed       bool
+	stats        LogStats
+	replication  *replication // nil if the log is not replicated
+	following    bool         // a follower replicates the leader's log into it
+
+	// The high watermark of the leader bounds the records a follower serves,
+	// and caughtUpAt is when the follower last replicated up to it.
+	highWatermark uint64
+	caughtUpAt    time.Time
+
+	// groupOffsets are the offsets committed by consumer groups by group ID
+	// and partition.
+	groupOffsets map[string]map[uint32]uint64
+
+	// start is the offset of the first entry. The records before it are
+	// evicted from the local store and read from the tier, and aborted are
+	// the evicted records of aborted transactions in the order of offsets.
+	start   uint64
+	aborted []uint64
+	tier    *Tier // nil if the log is not offloaded
+}
+
+// entry is a record with the attributes used by producers and transactions.
+type entry struct {
+	record     Record
+	producerID string
+	owner      string // the principal that owns the transaction of the record
+	sequence   uint64
+	attributes byte
+	aborted    bool // the record belongs to an aborted transaction
+}
+
+// Record attributes.
+const (
+	transactionalAttribute byte = 1 << iota // the record belongs to a transaction
+	controlAttribute                        // the record is a control marker
+	commitAttribute                         // the control marker commits the transaction
+	headersAttribute                        // the record has headers
+	ownerAttribute                          // the record has the owner of its transaction
+	offsetAttribute                         // the control marker commits an offset of a consumer group
+)
+
+// producer is the last record appended by an idempotent producer.
+type producer struct {
+	sequence uint64
+	offset   uint64
 }
 
 // NewLog creates a new Log.
 func NewLog() *Log {
 	var log Log
 
+	log.producers = make(map[string]producer)
+	log.transactions = make(map[string]*transaction)
+	log.groupOffsets = make(map[string]map[uint32]uint64)
+	log.appended = make(chan struct{})
+	log.closing = make(chan struct{})
+	log.logger = zap.NewNop()
+
 	return &log
 }
 
-// Append adds a new record to the log.
-func (c *Log) Append(value []byte) (uint64, error) {
+// OpenLog opens the log persisted in the directory. The directory and the log
+// files are created if they do not exist.
+func OpenLog(dir string, config LogConfig) (*Log, error) {
+	switch config.SyncPolicy {
+	case "":
+		config.SyncPolicy = SyncNever
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if config.SyncInterval <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSyncInterval, config.SyncInterval)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSyncPolicy, config.SyncPolicy)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the log directory: %w", err)
+	}
+
+	if err := migrateStoreFile(dir); err != nil {
+		return nil, err
+	}
+
+	storeConfig := store.Config{
+		MaxRecordLength: config.MaxRecordSize,
+		ObserveFlush:    observeStore(config, storeFlush),
+		ObserveSync:     observeStore(config, storeSync),
+		SegmentBytes:    config.SegmentBytes,
+	}
+
+	s, err := store.OpenSegmented(filepath.Join(dir, segmentsDirName), storeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the log store: %w", err)
+	}
+
+	log := NewLog()
+	log.store = s
+	log.dir = dir
+	log.maxEntrySize = config.MaxRecordSize
+	log.syncPolicy = config.SyncPolicy
+
+	if log.maxEntrySize == 0 {
+		log.maxEntrySize = store.MaxRecordLength
+	}
+
+	if config.Logger != nil {
+		log.logger = config.Logger
+	}
+
+	position, err := log.restoreEvicted()
+	if err != nil {
+		_ = s.Close()
+
+		return nil, err
+	}
+
+	if err := log.restore(position); err != nil {
+		_ = s.Close()
+
+		return nil, err
+	}
+
+	if config.SyncPolicy == SyncInterval {
+		log.stopSync = make(chan struct{})
+		log.syncDone = make(chan struct{})
+
+		go log.syncPeriodically(config.SyncInterval)
+	}
+
+	return log, nil
+}
+
+// migrateStoreFile moves the store file of a log written before the store was
+// split into segments into the segments directory as the first segment.
+func migrateStoreFile(dir string) error {
+	name := filepath.Join(dir, storeFileName)
+
+	if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	segments := filepath.Join(dir, segmentsDirName)
+	if _, err := os.Stat(segments); err == nil {
+		return fmt.Errorf("failed to migrate the log file: both %s and %s exist", name, segments)
+	}
+
+	if err := os.MkdirAll(segments, 0700); err != nil { // nolint:gomnd
+		return fmt.Errorf("failed to migrate the log file: %w", err)
+	}
+
+	if err := os.Rename(name, filepath.Join(segments, store.SegmentName(0))); err != nil {
+		return fmt.Errorf("failed to migrate the log file: %w", err)
+	}
+
+	return nil
+}
+
+// Store operations observed by the metrics and traces.
+const (
+	storeFlush = "store.Flush"
+	storeSync  = "store.Sync"
+)
+
+// observeStore returns the observer that records the duration of the store
+// operation in the metrics and as a span. It returns nil if the log has
+// neither metrics nor tracing.
+func observeStore(config LogConfig, operation string) func(time.Duration) {
+	if config.Metrics == nil && config.TracerProvider == nil {
+		return nil
+	}
+
+	var tracer trace.Tracer
+	if config.TracerProvider != nil {
+		tracer = config.TracerProvider.Tracer(tracerName)
+	}
+
+	return func(d time.Duration) {
+		if config.Metrics != nil {
+			config.Metrics.observeStore(operation, d)
+		}
+
+		if tracer != nil {
+			end := time.Now()
+			_, span := tracer.Start(context.Background(), operation, trace.WithTimestamp(end.Add(-d)))
+			span.End(trace.WithTimestamp(end))
+		}
+	}
+}
+
+// Append adds a new record with the headers to the log.
+func (c *Log) Append(value []byte, headers ...Header) (uint64, error) {
+	return c.submit(command{
+		kind:  appendCommand,
+		entry: entry{record: Record{Value: value, Headers: headers}},
+	})
+}
+
+// AppendIdempotent adds a new record produced by the producer with the given
+// sequence number. If the sequence number is the last one of the producer, the
+// record is not appended again and the original offset is returned. The first
+// record of a producer may have any sequence number, the next ones must follow
+// it without gaps.
+func (c *Log) AppendIdempotent(producerID string, sequence uint64, value []byte, headers ...Header) (uint64, error) {
+	return c.submit(command{
+		kind: appendIdempotentCommand,
+		entry: entry{
+			record:     Record{Value: value, Headers: headers},
+			producerID: producerID,
+			sequence:   sequence,
+		},
+	})
+}
+
+// appendIdempotent appends the record of the idempotent producer unless it is
+// a duplicate.
+func (c *Log) appendIdempotent(e entry, now time.Time) (uint64, error) {
+	if last, ok := c.producers[e.producerID]; ok {
+		switch {
+		case e.sequence == last.sequence:
+			return last.offset, nil
+		case e.sequence < last.sequence:
+			return 0, ErrDuplicateSequence
+		case e.sequence > last.sequence+1:
+			return 0, ErrOutOfOrderSequence
+		}
+	}
+
+	return c.append(e, now)
+}
+
+// AppendBatch adds the records produced by the producer with consecutive
+// sequence numbers from the given one and returns their offsets. The records
+// of the batch the producer has appended before, for example by a batch that
+// is retried after a timeout, are not appended again and their original
+// offsets are returned. If resume is set, the sequence number may skip the
+// sequence numbers of records the producer has given up on, otherwise it must
+// follow the last one without gaps. Records without a producer ID are
+// appended without deduplication.
+func (c *Log) AppendBatch(producerID string, sequence uint64, resume bool, records []Record) ([]uint64, error) {
+	batch := make([]entry, 0, len(records))
+
+	for i, record := range records {
+		e := entry{record: Record{Value: record.Value, Headers: record.Headers}}
+		if producerID != "" {
+			e.producerID = producerID
+			e.sequence = sequence + uint64(i)
+		}
+
+		batch = append(batch, e)
+	}
+
+	return c.submitBatch(command{
+		kind:   appendBatchCommand,
+		resume: resume,
+		batch:  batch,
+	})
+}
+
+// appendBatch appends the records of the batch that are not appended yet.
+// Either all records are checked and appended or none, unless persisting them
+// fails midway.
+func (c *Log) appendBatch(batch []entry, resume bool, now time.Time) ([]uint64, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	for _, e := range batch {
+		if err := validateHeaders(e.record.Headers); err != nil {
+			return nil, err
+		}
+
+		if size := uint64(len(encodeEntry(e))); c.store != nil && size > c.maxEntrySize {
+			return nil, fmt.Errorf("%w: max length is %d", store.ErrMaxRecordLength, c.maxEntrySize)
+		}
+	}
+
+	first := batch[0]
+	offsets := make([]uint64, 0, len(batch))
+
+	if last, ok := c.producers[first.producerID]; ok && first.producerID != "" {
+		switch {
+		case first.sequence <= last.sequence:
+			// The records up to the last one of the producer are retried.
+			// They are appended right before it, unless the producer has
+			// skipped sequence numbers or another record is in between.
+			n := last.sequence - first.sequence + 1
+			if n > uint64(len(batch)) {
+				n = uint64(len(batch))
+			}
+
+			for _, e := range batch[:n] {
+				distance := last.sequence - e.sequence
+				if distance > last.offset || distance != 0 && !c.appendedAt(last.offset-distance, e) {
+					return nil, ErrDuplicateSequence
+				}
+
+				offsets = append(offsets, last.offset-distance)
+			}
+
+			batch = batch[n:]
+		case first.sequence > last.sequence+1 && !resume:
+			return nil, ErrOutOfOrderSequence
+		}
+	}
+
+	for _, e := range batch {
+		offset, err := c.append(e, now)
+		if err != nil {
+			return nil, err
+		}
+
+		offsets = append(offsets, offset)
+	}
+
+	return offsets, nil
+}
+
+// appendedAt reports whether the local record at the offset is the record of
+// the idempotent producer with the sequence number of the entry.
+func (c *Log) appendedAt(offset uint64, e entry) bool {
+	if offset < c.start || offset >= c.endOffset() {
+		return false
+	}
+
+	appended := c.entries[offset-c.start]
+
+	return appended.producerID == e.producerID && appended.sequence == e.sequence &&
+		appended.attributes&(controlAttribute|transactionalAttribute) == 0
+}
+
+// Read reads a record form the log by the given offest. Control markers of
+// transactions are skipped, so the record may have a greater offset.
+func (c *Log) Read(offset uint64) (Record, error) {
+	return c.ReadIsolated(offset, ReadUncommitted)
+}
+
+// ReadIsolated reads the first record at or after the given offset that is
+// visible with the isolation level. Records evicted from the local store are
+// read from the tier.
+func (c *Log) ReadIsolated(offset uint64, isolation Isolation) (Record, error) {
+	return c.readIsolated(context.Background(), offset, isolation)
+}
+
+func (c *Log) readIsolated(ctx context.Context, offset uint64, isolation Isolation) (Record, error) {
+	record, offset, err := c.readEvicted(ctx, offset, isolation)
+	if err != nil {
+		return Record{}, err
+	}
+
+	if record != nil {
+		return *record, nil
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	offset := uint64(len(c.records))
+	c.abortExpiredLocally()
+
+	end := c.readableEnd()
+	if stable := c.lastStableOffset(); isolation == ReadCommitted && stable < end {
+		end = stable
+	}
+
+	if offset < c.start {
+		// The records were evicted while they were read.
+		offset = c.start
+	}
+
+	for ; offset < end; offset++ {
+		e := c.entries[offset-c.start]
+
+		if e.attributes&controlAttribute != 0 {
+			continue
+		}
 
-	record := Record{
-		Value:  value,
-		Offset: offset,
+		if isolation == ReadCommitted && e.aborted {
+			continue
+		}
+
+		c.stats.ReadBytes += uint64(len(e.record.Value))
+
+		return e.record, nil
 	}
 
-	c.records = append(c.records, record)
+	return Record{}, ErrOffsetNotFound
+}
 
-	return record.Offset, nil
+// EndOffset returns the offset of the next record appended to the log.
+func (c *Log) EndOffset() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.endOffset()
 }
 
-// Read reads a record form the log by the given offest.
-func (c *Log) Read(offset uint64) (Record, error) {
+func (c *Log) endOffset() uint64 {
+	return c.start + uint64(len(c.entries))
+}
+
+// Ready checks that the log accepts records: it is not closing, if it is
+// replicated, the cluster has a leader and, if it is persisted, a file can be
+// created in its directory.
+func (c *Log) Ready() error {
+	select {
+	case <-c.closing:
+		return ErrLogClosed
+	default:
+	}
+
+	if c.replication != nil {
+		if err := c.replication.ready(); err != nil {
+			return err
+		}
+	}
+
+	if c.dir == "" {
+		return nil
+	}
+
+	file, err := ioutil.TempFile(c.dir, ".ready")
+	if err != nil {
+		return fmt.Errorf("failed to write to the log directory: %w", err)
+	}
+
+	_ = file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return fmt.Errorf("failed to write to the log directory: %w", err)
+	}
+
+	return nil
+}
+
+// Stats returns a snapshot of the log counters.
+func (c *Log) Stats() LogStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.abortExpiredLocally()
+
+	stats := c.stats
+	stats.Dir = c.dir
+	stats.LocalOffset = c.start
+	stats.EndOffset = c.endOffset()
+	stats.LastStableOffset = c.lastStableOffset()
+
+	if c.store != nil {
+		stats.DiskSize = c.store.Size() - c.store.Base()
+		stats.BufferedBytes = c.store.Buffered()
+	}
+
+	return stats
+}
+
+// ReadWait is like ReadIsolated but waits until the record is appended or the
+// context is done. It returns ErrOffsetNotFound if the context is done first
+// and ErrLogClosed if the log starts closing first.
+func (c *Log) ReadWait(ctx context.Context, offset uint64, isolation Isolation) (Record, error) {
+	for {
+		c.mu.Lock()
+		appended := c.appended
+		c.mu.Unlock()
+
+		record, err := c.readIsolated(ctx, offset, isolation)
+		if !errors.Is(err, ErrOffsetNotFound) {
+			return record, err
+		}
+
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return Record{}, ErrOffsetNotFound
+		case <-c.closing:
+			return Record{}, ErrLogClosed
+		}
+	}
+}
+
+// StopWaiting makes current and future ReadWait calls return ErrLogClosed
+// instead of waiting for new records. Records can still be appended and read.
+// It is called when the server starts shutting down, so long polls do not
+// delay the shutdown.
+func (c *Log) StopWaiting() {
+	c.closeWaiters.Do(func() {
+		close(c.closing)
+	})
+}
+
+// Close stops waiting for records, commits any buffered records to stable
+// storage and closes the log files. A replicated log stops its Raft node
+// first. Appending to the closed log returns ErrLogClosed. Closing the closed
+// log does nothing.
+func (c *Log) Close() error {
+	c.StopWaiting()
+
+	if c.replication != nil {
+		if err := c.replication.close(); err != nil {
+			c.mu.Lock()
+			c.closed = true
+			c.mu.Unlock()
+
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	c.closed = true
+	c.mu.Unlock()
+
+	if c.stopSync != nil {
+		close(c.stopSync)
+		<-c.syncDone
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if offset >= uint64(len(c.records)) {
-		return Record{}, ErrOffsetNotFound
+	if c.store == nil {
+		return nil
+	}
+
+	if err := c.store.Sync(); err != nil {
+		_ = c.store.Close()
+
+		return fmt.Errorf("failed to sync the log store: %w", err)
+	}
+
+	if err := c.store.Close(); err != nil {
+		return fmt.Errorf("failed to close the log store: %w", err)
+	}
+
+	return nil
+}
+
+// append persists the entry if the log is persisted and adds it to the log.
+func (c *Log) append(e entry, now time.Time) (uint64, error) {
+	if c.closed {
+		return 0, ErrLogClosed
+	}
+
+	if err := validateHeaders(e.record.Headers); err != nil {
+		return 0, err
+	}
+
+	e.record.Offset = c.endOffset()
+
+	if c.store != nil {
+		if err := c.syncErr; err != nil {
+			c.syncErr = nil
+
+			return 0, fmt.Errorf("failed to sync the log: %w", err)
+		}
+
+		if _, _, err := c.store.Append(encodeEntry(e)); err != nil {
+			return 0, fmt.Errorf("failed to persist the record: %w", err)
+		}
+
+		if c.syncPolicy == SyncAlways {
+			if err := c.store.Sync(); err != nil {
+				return 0, fmt.Errorf("failed to sync the log: %w", err)
+			}
+		}
+	}
+
+	c.apply(e, now)
+	c.stats.AppendedBytes += uint64(len(e.record.Value))
+
+	return e.record.Offset, nil
+}
+
+// syncPeriodically commits the appended records to stable storage until Close
+// is called. A failed sync is returned by the next append.
+func (c *Log) syncPeriodically(interval time.Duration) {
+	defer close(c.syncDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			if err := c.store.Sync(); err != nil {
+				c.logger.Error("Failed to sync the log", zap.Error(err))
+				c.syncErr = err
+			}
+			c.mu.Unlock()
+		case <-c.stopSync:
+			return
+		}
+	}
+}
+
+// apply adds the entry to the log and updates the producer, transaction and
+// consumer group offset state.
+func (c *Log) apply(e entry, now time.Time) {
+	offset := e.record.Offset
+	c.entries = append(c.entries, e)
+
+	close(c.appended)
+	c.appended = make(chan struct{})
+
+	switch {
+	case e.attributes&offsetAttribute != 0:
+		c.applyGroupOffset(e)
+	case e.attributes&controlAttribute != 0:
+		c.completeTransaction(e.producerID, e.attributes&commitAttribute != 0)
+	case e.attributes&transactionalAttribute != 0:
+		txn, ok := c.transactions[e.producerID]
+		if !ok {
+			// Records of a transaction restored from the store.
+			txn = newTransaction(e.owner, now, DefaultTransactionTimeout)
+			c.transactions[e.producerID] = txn
+		}
+
+		txn.offsets = append(txn.offsets, offset)
+	case e.producerID != "":
+		c.producers[e.producerID] = producer{
+			sequence: e.sequence,
+			offset:   offset,
+		}
+	}
+}
+
+// restore reads the records and the producer state from the store from the
+// position of the first record that is not evicted.
+func (c *Log) restore(position uint64) error {
+	size := c.store.Size()
+	now := time.Now()
+
+	for position < size {
+		b, err := c.store.Read(position)
+		if err != nil {
+			return fmt.Errorf("failed to read the record at %d: %w", position, err)
+		}
+
+		e, err := decodeEntry(b)
+		if err != nil {
+			return fmt.Errorf("failed to decode the record at %d: %w", position, err)
+		}
+
+		e.record.Offset = c.endOffset()
+		c.apply(e, now)
+
+		position += store.RecordSizeLength + uint64(len(b))
 	}
 
-	return c.records[offset], nil
+	return nil
 }
 
 // Record is a record in the log.
 type Record struct {
-	Value  []byte
-	Offset uint64
+	Value   []byte
+	Offset  uint64
+	Headers []Header
+}
+
+// Header is a key and a value attached to a record, for example the trace
+// context of the producer.
+type Header struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// StoredRecord is a record as it is persisted in the log store file.
+type StoredRecord struct {
+	Value         []byte
+	ProducerID    string
+	Owner         string // the principal that owns the transaction
+	Sequence      uint64
+	Transactional bool // the record belongs to a transaction
+	Control       bool // the record is a commit or abort marker
+	Commit        bool // the control marker commits the transaction
+	GroupOffset   bool // the control marker commits an offset of a consumer group
+	Headers       []Header
+}
+
+// DecodeStoredRecord decodes a record read from the log store file.
+func DecodeStoredRecord(b []byte) (StoredRecord, error) {
+	e, err := decodeEntry(b)
+	if err != nil {
+		return StoredRecord{}, err
+	}
+
+	record := StoredRecord{
+		Value:         e.record.Value,
+		ProducerID:    e.producerID,
+		Owner:         e.owner,
+		Sequence:      e.sequence,
+		Transactional: e.attributes&transactionalAttribute != 0,
+		Control:       e.attributes&controlAttribute != 0,
+		Commit:        e.attributes&commitAttribute != 0,
+		GroupOffset:   e.attributes&offsetAttribute != 0,
+		Headers:       e.record.Headers,
+	}
+
+	return record, nil
+}
+
+// Persisted records start with the CRC-32 checksum of the rest of the record,
+// the attributes, the producer ID length, the producer ID and the sequence
+// number. Records with the owner attribute continue with the length-prefixed
+// owner of their transaction. Records with the headers attribute continue with
+// the number of headers and the length-prefixed key and value of each header.
+// The record value comes last.
+const (
+	checksumLength       = 4
+	attributesLength     = 1
+	producerIDSizeLength = 2
+	sequenceLength       = 8
+	ownerSizeLength      = 2
+	headerCountLength    = 2
+	headerSizeLength     = 2
+)
+
+func encodeEntry(e entry) []byte {
+	size := checksumLength + attributesLength + producerIDSizeLength + len(e.producerID) + sequenceLength
+
+	if e.owner != "" {
+		e.attributes |= ownerAttribute
+		size += ownerSizeLength + len(e.owner)
+	}
+
+	if len(e.record.Headers) != 0 {
+		e.attributes |= headersAttribute
+		size += headerCountLength
+
+		for _, h := range e.record.Headers {
+			size += 2*headerSizeLength + len(h.Key) + len(h.Value)
+		}
+	}
+
+	b := make([]byte, size+len(e.record.Value))
+	n := checksumLength
+	b[n] = e.attributes
+	n += attributesLength
+	binary.BigEndian.PutUint16(b[n:], uint16(len(e.producerID)))
+	n += producerIDSizeLength
+	n += copy(b[n:], e.producerID)
+	binary.BigEndian.PutUint64(b[n:], e.sequence)
+	n += sequenceLength
+
+	if e.owner != "" {
+		n += putHeaderString(b[n:], e.owner)
+	}
+
+	if len(e.record.Headers) != 0 {
+		binary.BigEndian.PutUint16(b[n:], uint16(len(e.record.Headers)))
+		n += headerCountLength
+
+		for _, h := range e.record.Headers {
+			n += putHeaderString(b[n:], h.Key)
+			n += putHeaderString(b[n:], h.Value)
+		}
+	}
+
+	copy(b[n:], e.record.Value)
+
+	binary.BigEndian.PutUint32(b, crc32.ChecksumIEEE(b[checksumLength:]))
+
+	return b
+}
+
+// validateHeaders checks that the headers fit into their length prefixes.
+func validateHeaders(headers []Header) error {
+	if len(headers) > math.MaxUint16 {
+		return fmt.Errorf("%w: %d headers", ErrInvalidHeader, len(headers))
+	}
+
+	for _, h := range headers {
+		if len(h.Key) > math.MaxUint16 || len(h.Value) > math.MaxUint16 {
+			return fmt.Errorf("%w: %q is too long", ErrInvalidHeader, h.Key)
+		}
+	}
+
+	return nil
+}
+
+func putHeaderString(b []byte, s string) int {
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+
+	return headerSizeLength + copy(b[headerSizeLength:], s)
+}
+
+func decodeEntry(b []byte) (entry, error) {
+	n := checksumLength + attributesLength + producerIDSizeLength
+	if len(b) < n {
+		return entry{}, ErrCorruptRecord
+	}
+
+	if binary.BigEndian.Uint32(b) != crc32.ChecksumIEEE(b[checksumLength:]) {
+		return entry{}, ErrChecksumMismatch
+	}
+
+	producerIDPosition := n
+	n += int(binary.BigEndian.Uint16(b[checksumLength+attributesLength:]))
+
+	if len(b) < n+sequenceLength {
+		return entry{}, ErrCorruptRecord
+	}
+
+	e := entry{
+		record:     Record{},
+		producerID: string(b[producerIDPosition:n]),
+		sequence:   binary.BigEndian.Uint64(b[n:]),
+		attributes: b[checksumLength],
+	}
+	n += sequenceLength
+
+	if e.attributes&ownerAttribute != 0 {
+		owner, size, err := headerString(b[n:])
+		if err != nil {
+			return entry{}, err
+		}
+
+		e.owner = owner
+		n += size
+	}
+
+	if e.attributes&headersAttribute != 0 {
+		headers, size, err := decodeHeaders(b[n:])
+		if err != nil {
+			return entry{}, err
+		}
+
+		e.record.Headers = headers
+		n += size
+	}
+
+	e.record.Value = b[n:]
+
+	return e, nil
+}
+
+// decodeHeaders decodes the headers at the beginning of b and returns them
+// with their encoded size.
+func decodeHeaders(b []byte) ([]Header, int, error) {
+	if len(b) < headerCountLength {
+		return nil, 0, ErrCorruptRecord
+	}
+
+	count := int(binary.BigEndian.Uint16(b))
+	n := headerCountLength
+	headers := make([]Header, 0, count)
+
+	for i := 0; i < count; i++ {
+		key, size, err := headerString(b[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		n += size
+
+		value, size, err := headerString(b[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		n += size
+		headers = append(headers, Header{Key: key, Value: value})
+	}
+
+	return headers, n, nil
+}
+
+func headerString(b []byte) (string, int, error) {
+	if len(b) < headerSizeLength {
+		return "", 0, ErrCorruptRecord
+	}
+
+	n := headerSizeLength + int(binary.BigEndian.Uint16(b))
+	if len(b) < n {
+		return "", 0, ErrCorruptRecord
+	}
+
+	return string(b[headerSizeLength:n]), n, nil
 }
@@ -1,8 +1,15 @@
 package server_test
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ivanlemeshev/proglog/internal/log/store"
 	"github.com/ivanlemeshev/proglog/internal/server"
 	"github.com/stretchr/testify/assert"
 )
@@ -45,3 +52,373 @@ func TestRead(t *testing.T) {
 	_, err = l.Read(999999)
 	assert.Equal(t, server.ErrOffsetNotFound, err)
 }
+
+func TestAppendIdempotent(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+
+	offset0, err := l.AppendIdempotent("producer", 5, []byte("first"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), offset0)
+
+	offset1, err := l.AppendIdempotent("producer", 6, []byte("second"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), offset1)
+
+	retry, err := l.AppendIdempotent("producer", 6, []byte("second"))
+	assert.Nil(t, err)
+	assert.Equal(t, offset1, retry)
+
+	_, err = l.AppendIdempotent("producer", 5, []byte("first"))
+	assert.Equal(t, server.ErrDuplicateSequence, err)
+
+	_, err = l.AppendIdempotent("producer", 8, []byte("fourth"))
+	assert.Equal(t, server.ErrOutOfOrderSequence, err)
+
+	other, err := l.AppendIdempotent("other", 6, []byte("other"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), other)
+
+	_, err = l.AppendIdempotent(strings.Repeat("p", 1<<16), 0, []byte("third"))
+	assert.ErrorIs(t, err, server.ErrInvalidProducerID)
+
+	_, err = l.Read(3)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+}
+
+func TestAppendBatch(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+	records := []server.Record{{Value: []byte("first")}, {Value: []byte("second")}}
+
+	offsets, err := l.AppendBatch("producer", 5, false, records)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0, 1}, offsets)
+
+	retry, err := l.AppendBatch("producer", 5, false, records)
+	assert.Nil(t, err)
+	assert.Equal(t, offsets, retry)
+
+	// The records appended before are not appended again.
+	offsets, err = l.AppendBatch("producer", 6, false, append(records[1:], server.Record{Value: []byte("third")}))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, offsets)
+
+	// A part of an earlier batch is retried too.
+	offsets, err = l.AppendBatch("producer", 5, false, records[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0}, offsets)
+
+	_, err = l.AppendBatch("producer", 4, false, records)
+	assert.Equal(t, server.ErrDuplicateSequence, err)
+
+	_, err = l.AppendBatch("producer", 9, false, records)
+	assert.Equal(t, server.ErrOutOfOrderSequence, err)
+
+	// A resumed producer skips the records it has given up on.
+	offsets, err = l.AppendBatch("producer", 9, true, records)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3, 4}, offsets)
+
+	// The skipped sequence numbers are not before the last record, so the
+	// records before them are not retried.
+	_, err = l.AppendBatch("producer", 7, false, records)
+	assert.Equal(t, server.ErrDuplicateSequence, err)
+
+	offsets, err = l.AppendBatch("", 0, false, records)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{5, 6}, offsets)
+
+	_, err = l.Read(7)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+}
+
+func TestOpenLog(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	_, err = l.AppendIdempotent("producer", 0, []byte("second"))
+	assert.Nil(t, err)
+
+	err = l.Close()
+	assert.Nil(t, err)
+
+	l, err = server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	r0, err := l.Read(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), r0.Value)
+
+	r1, err := l.Read(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), r1.Value)
+
+	retry, err := l.AppendIdempotent("producer", 0, []byte("second"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), retry)
+
+	offset, err := l.AppendIdempotent("producer", 1, []byte("third"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), offset)
+}
+
+func TestOpenLog_Config(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []server.SyncPolicy{server.SyncAlways, server.SyncInterval, server.SyncNever} {
+		policy := policy
+
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			l, err := server.OpenLog(dir, server.LogConfig{
+				MaxRecordSize: 32,
+				SyncPolicy:    policy,
+				SyncInterval:  time.Millisecond,
+			})
+			assert.Nil(t, err)
+
+			_, err = l.Append([]byte("record"))
+			assert.Nil(t, err)
+
+			_, err = l.Append(make([]byte, 32))
+			assert.ErrorIs(t, err, store.ErrMaxRecordLength)
+
+			err = l.Close()
+			assert.Nil(t, err)
+
+			l, err = server.OpenLog(dir, server.LogConfig{})
+			assert.Nil(t, err)
+
+			defer l.Close() // nolint:errcheck
+
+			assert.Equal(t, uint64(1), l.EndOffset())
+		})
+	}
+
+	_, err := server.OpenLog(t.TempDir(), server.LogConfig{SyncPolicy: "sometimes"})
+	assert.ErrorIs(t, err, server.ErrUnknownSyncPolicy)
+
+	_, err = server.OpenLog(t.TempDir(), server.LogConfig{SyncPolicy: server.SyncInterval})
+	assert.ErrorIs(t, err, server.ErrInvalidSyncInterval)
+}
+
+func TestOpenLog_Headers(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	headers := []server.Header{
+		{Key: "traceparent", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{Key: "empty", Value: ""},
+	}
+
+	_, err = l.Append([]byte("first"), headers...)
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("second"))
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("third"), server.Header{Key: strings.Repeat("k", 1<<16), Value: ""})
+	assert.ErrorIs(t, err, server.ErrInvalidHeader)
+
+	err = l.Close()
+	assert.Nil(t, err)
+
+	l, err = server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	r0, err := l.Read(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), r0.Value)
+	assert.Equal(t, headers, r0.Headers)
+
+	r1, err := l.Read(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), r1.Value)
+	assert.Nil(t, r1.Headers)
+}
+
+func TestLog_Stats(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+
+	_, err := l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("second"))
+	assert.Nil(t, err)
+
+	_, err = l.Read(1)
+	assert.Nil(t, err)
+
+	assert.Equal(t, server.LogStats{
+		Dir:              "",
+		LocalOffset:      0,
+		EndOffset:        2,
+		LastStableOffset: 2,
+		DiskSize:         0,
+		BufferedBytes:    0,
+		AppendedBytes:    11,
+		ReadBytes:        6,
+	}, l.Stats())
+}
+
+func TestReadWait(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+
+		_, _ = l.Append([]byte("first"))
+	}()
+
+	r, err := l.ReadWait(context.Background(), 0, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), r.Value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = l.ReadWait(ctx, 1, server.ReadUncommitted)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+}
+
+func TestLog_Close(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	waited := make(chan error, 1)
+
+	go func() {
+		_, err := l.ReadWait(context.Background(), 1, server.ReadUncommitted)
+		waited <- err
+	}()
+
+	err = l.Close()
+	assert.Nil(t, err)
+	assert.ErrorIs(t, <-waited, server.ErrLogClosed)
+
+	_, err = l.Append([]byte("second"))
+	assert.ErrorIs(t, err, server.ErrLogClosed)
+
+	err = l.Close()
+	assert.Nil(t, err)
+
+	l, err = server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	assert.Equal(t, uint64(1), l.EndOffset())
+}
+
+func TestLog_StopWaiting(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+	l.StopWaiting()
+
+	_, err := l.ReadWait(context.Background(), 0, server.ReadUncommitted)
+	assert.ErrorIs(t, err, server.ErrLogClosed)
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	r, err := l.ReadWait(context.Background(), 0, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), r.Value)
+}
+
+func TestOpenLog_ChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("record"))
+	assert.Nil(t, err)
+
+	err = l.Close()
+	assert.Nil(t, err)
+
+	name := filepath.Join(dir, "segments", "00000000000000000000.store")
+
+	data, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+
+	data[len(data)-1] ^= 0xff
+
+	err = ioutil.WriteFile(name, data, 0600)
+	assert.Nil(t, err)
+
+	_, err = server.OpenLog(dir, server.LogConfig{})
+	assert.ErrorIs(t, err, server.ErrChecksumMismatch)
+
+	_, err = server.DecodeStoredRecord(data[8:])
+	assert.Equal(t, server.ErrChecksumMismatch, err)
+
+	_, err = server.DecodeStoredRecord([]byte{1, 2})
+	assert.Equal(t, server.ErrCorruptRecord, err)
+}
+
+func TestOpenLog_MigrateStoreFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("record"))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Close())
+
+	// The store file of a log written before the store was split into
+	// segments becomes the first segment.
+	segments := filepath.Join(dir, "segments")
+	assert.Nil(t, os.Rename(filepath.Join(segments, "00000000000000000000.store"), filepath.Join(dir, "log.store")))
+	assert.Nil(t, os.Remove(segments))
+
+	l, err = server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	record, err := l.Read(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("record"), record.Value)
+	assert.FileExists(t, filepath.Join(segments, "00000000000000000000.store"))
+	assert.NoFileExists(t, filepath.Join(dir, "log.store"))
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader is the header with the ID of the request. The ID of the
+// client is kept if it is set, otherwise the server generates one.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMetadata is the metadata key of the ID of gRPC calls, like the
+// X-Request-ID header.
+const requestIDMetadata = "x-request-id"
+
+// maxRequestIDLength limits the length of request IDs set by clients.
+const maxRequestIDLength = 128
+
+// requestIDLength is the number of random bytes of generated request IDs.
+const requestIDLength = 8
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// withLogger returns a copy of the context with the logger.
+func withLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFromContext returns the logger of the request. It returns a no-op
+// logger if the context has none, so handlers can run without the router.
+func loggerFromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+
+	return zap.NewNop()
+}
+
+// withRequestID returns a copy of the context with the ID of the gRPC call.
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// requestIDFromContext returns the ID of the gRPC call, or an empty string if
+// the context has none.
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+
+	return requestID
+}
+
+// logging is a middleware that gives every request an ID and a logger with
+// the ID and writes an access log entry when the request is done.
+func logging(logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(requestIDHeader)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = newRequestID()
+			}
+
+			w.Header().Set(requestIDHeader, requestID)
+
+			fields := []zap.Field{zap.String("request_id", requestID)}
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+			}
+
+			requestLogger := logger.With(fields...)
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+
+			next.ServeHTTP(recorder, r.WithContext(withLogger(r.Context(), requestLogger)))
+
+			accessFields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", recorder.status),
+				zap.Int("bytes", recorder.written),
+				zap.Duration("duration", time.Since(start)),
+				zap.String("remote_addr", r.RemoteAddr),
+			}
+
+			if recorder.err != nil {
+				accessFields = append(accessFields, zap.NamedError("write_error", recorder.err))
+			}
+
+			requestLogger.Info("Request", accessFields...)
+		})
+	}
+}
+
+// loggingGRPC is a gRPC middleware that gives every call an ID and a logger
+// with the ID like logging. The ID is taken from the x-request-id metadata if
+// the client has set it and returned in the header metadata.
+func loggingGRPC(logger *zap.Logger) grpcMiddleware {
+	return func(ctx context.Context, call *grpcCall, next func(context.Context) error) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		requestID := ""
+		if values := md.Get(requestIDMetadata); len(values) != 0 {
+			requestID = values[0]
+		}
+
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+		}
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+
+		fields := []zap.Field{zap.String("request_id", requestID)}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+		}
+
+		requestLogger := logger.With(fields...)
+		start := time.Now()
+
+		err := next(withRequestID(withLogger(ctx, requestLogger), requestID))
+
+		remoteAddr := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			remoteAddr = p.Addr.String()
+		}
+
+		requestLogger.Info("Request",
+			zap.String("method", call.method),
+			zap.String("code", status.Code(err).String()),
+			zap.Int("bytes", call.size()),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("remote_addr", remoteAddr),
+		)
+
+		return err
+	}
+}
+
+// writeInternalError logs the error with the request context and responds
+// with a generic error, so internal details are not exposed to clients.
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	loggerFromContext(r.Context()).Error("Internal error", zap.Error(err))
+	writeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+}
+
+func newRequestID() string {
+	b := make([]byte, requestIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogging(t *testing.T) {
+	t.Parallel()
+
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	core, logs := observer.New(level)
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{
+		Addr:               "",
+		Log:                server.NewLog(),
+		Metrics:            nil,
+		TracerProvider:     nil,
+		Logger:             zap.New(core),
+		LogLevel:           &level,
+		TraceRecordHeaders: false,
+	}).Handler)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/", bytes.NewBufferString(`{"value":"aGVsbG8="}`))
+	assert.Nil(t, err)
+
+	req.Header.Set("X-Request-ID", "request-1")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "request-1", resp.Header.Get("X-Request-ID"))
+
+	_ = resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	assert.Nil(t, err)
+	assert.Len(t, resp.Header.Get("X-Request-ID"), 16)
+
+	_ = resp.Body.Close()
+
+	entries := logs.FilterMessage("Request").AllUntimed()
+	assert.Len(t, entries, 2)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "request-1", fields["request_id"])
+	assert.Equal(t, "POST", fields["method"])
+	assert.Equal(t, int64(http.StatusOK), fields["status"])
+
+	req, err = http.NewRequest(http.MethodPut, srv.URL+"/log/level", bytes.NewBufferString(`{"level":"warn"}`))
+	assert.Nil(t, err)
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, _ = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	assert.Nil(t, err)
+
+	_ = resp.Body.Close()
+
+	// Access logs are below the new level, including the one of the level
+	// change itself.
+	assert.Len(t, logs.FilterMessage("Request").AllUntimed(), 2)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/status"
+)
+
+// metricsNamespace is the prefix of the metric names.
+const metricsNamespace = "proglog"
+
+// Metrics holds the Prometheus metrics of the server. The metrics of the log
+// and the consumer groups are collected from their state on every scrape.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	grpcRequests    *prometheus.CounterVec
+	grpcDuration    *prometheus.HistogramVec
+	flushDuration   prometheus.Histogram
+	syncDuration    prometheus.Histogram
+	quotaRequests   *prometheus.CounterVec
+	quotaBytes      *prometheus.CounterVec
+	throttled       *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics with their own registry, so several servers
+// can run in one process. Use the same metrics for one server only.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by handler, method and status code.",
+		}, []string{"handler", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of HTTP requests by handler, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler", "method", "code"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "grpc",
+			Name:      "requests_total",
+			Help:      "Number of gRPC requests by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "grpc",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of gRPC requests by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		flushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "store",
+			Name:      "flush_duration_seconds",
+			Help:      "Duration of store buffer flushes.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // nolint:gomnd
+		}),
+		syncDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "store",
+			Name:      "sync_duration_seconds",
+			Help:      "Duration of store file syncs.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // nolint:gomnd
+		}),
+		quotaRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "quota",
+			Name:      "requests_total",
+			Help:      "Number of requests counted against quotas by principal and topic.",
+		}, []string{"principal", "topic"}),
+		quotaBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "quota",
+			Name:      "bytes_total",
+			Help:      "Number of request and response bytes counted against quotas by principal and topic.",
+		}, []string{"principal", "topic"}),
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "quota",
+			Name:      "throttled_total",
+			Help:      "Number of throttled requests by principal, topic, exhausted quota and resource.",
+		}, []string{"principal", "topic", "quota", "resource"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.grpcRequests,
+		m.grpcDuration,
+		m.flushDuration,
+		m.syncDuration,
+		m.quotaRequests,
+		m.quotaBytes,
+		m.throttled,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}), // nolint:exhaustivestruct
+	)
+
+	return m
+}
+
+// Handler returns the handler that exposes the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}) // nolint:exhaustivestruct
+}
+
+// registerLog adds the metrics collected from the log and the consumer groups.
+func (m *Metrics) registerLog(log *Log, coordinator *GroupCoordinator) {
+	m.registry.MustRegister(&logCollector{
+		log:         log,
+		coordinator: coordinator,
+	})
+}
+
+// instrument is a middleware that counts and times the requests of the routes.
+func (m *Metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				handler = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		code := strconv.Itoa(recorder.status)
+		m.requests.WithLabelValues(handler, r.Method, code).Inc()
+		m.requestDuration.WithLabelValues(handler, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// instrumentGRPC is a gRPC middleware that counts and times the calls of the
+// methods.
+func (m *Metrics) instrumentGRPC(ctx context.Context, call *grpcCall, next func(context.Context) error) error {
+	start := time.Now()
+
+	err := next(ctx)
+
+	code := status.Code(err).String()
+	m.grpcRequests.WithLabelValues(call.method, code).Inc()
+	m.grpcDuration.WithLabelValues(call.method, code).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// observeStore records the duration of the store flush or sync.
+func (m *Metrics) observeStore(operation string, d time.Duration) {
+	switch operation {
+	case storeFlush:
+		m.flushDuration.Observe(d.Seconds())
+	case storeSync:
+		m.syncDuration.Observe(d.Seconds())
+	}
+}
+
+// statusRecorder remembers the status code, the number of written bytes and
+// the first write error of a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int
+	err     error
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.written += n
+
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+
+	return n, err // nolint:wrapcheck
+}
+
+// nolint:gochecknoglobals
+var (
+	endOffsetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "log", "end_offset"),
+		"Offset of the next record appended to the log.",
+		nil, nil,
+	)
+	lowestOffsetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "log", "lowest_offset"),
+		"Offset of the first record kept in the log.",
+		nil, nil,
+	)
+	diskBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "log", "disk_bytes"),
+		"Size of the log files including buffered data.",
+		nil, nil,
+	)
+	appendedBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "log", "appended_bytes_total"),
+		"Bytes of record values appended to the log.",
+		nil, nil,
+	)
+	readBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "log", "read_bytes_total"),
+		"Bytes of record values read from the log.",
+		nil, nil,
+	)
+	groupLagDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "consumer_group", "lag"),
+		"Number of records between the committed offset of the group and the end of the partition.",
+		[]string{"group", "partition"}, nil,
+	)
+)
+
+// logCollector collects the metrics of the log and the consumer groups from
+// their state.
+type logCollector struct {
+	log         *Log
+	coordinator *GroupCoordinator
+}
+
+func (c *logCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- endOffsetDesc
+	ch <- lowestOffsetDesc
+	ch <- diskBytesDesc
+	ch <- appendedBytesDesc
+	ch <- readBytesDesc
+	ch <- groupLagDesc
+}
+
+func (c *logCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.log.Stats()
+
+	ch <- prometheus.MustNewConstMetric(endOffsetDesc, prometheus.GaugeValue, float64(stats.EndOffset))
+	// Records are never removed from the log yet.
+	ch <- prometheus.MustNewConstMetric(lowestOffsetDesc, prometheus.GaugeValue, 0)
+	ch <- prometheus.MustNewConstMetric(diskBytesDesc, prometheus.GaugeValue, float64(stats.DiskSize))
+	ch <- prometheus.MustNewConstMetric(appendedBytesDesc, prometheus.CounterValue, float64(stats.AppendedBytes))
+	ch <- prometheus.MustNewConstMetric(readBytesDesc, prometheus.CounterValue, float64(stats.ReadBytes))
+
+	for _, id := range c.coordinator.Groups() {
+		description, err := c.coordinator.Describe(id)
+		if err != nil {
+			continue
+		}
+
+		for partition := uint32(0); partition < c.coordinator.partitions; partition++ {
+			lag := stats.EndOffset
+			if offset, ok := description.Offsets[partition]; ok {
+				lag = 0
+				if offset < stats.EndOffset {
+					lag = stats.EndOffset - offset
+				}
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				groupLagDesc,
+				prometheus.GaugeValue,
+				float64(lag),
+				id,
+				strconv.FormatUint(uint64(partition), 10),
+			)
+		}
+	}
+}
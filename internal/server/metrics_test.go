@@ -0,0 +1,68 @@
+package server_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := server.NewMetrics()
+
+	l, err := server.OpenLog(t.TempDir(), server.LogConfig{
+		MaxRecordSize: 0,
+		SyncPolicy:    server.SyncAlways,
+		SyncInterval:  0,
+		Metrics:       metrics,
+	})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{Log: l, Metrics: metrics}).Handler)
+	defer srv.Close()
+
+	send := func(method, path, body string) {
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+
+		_ = resp.Body.Close()
+	}
+
+	send(http.MethodPost, "/", `{"value":"aGVsbG8="}`)
+	send(http.MethodPost, "/", `{"value":"d29ybGQ="}`)
+	send(http.MethodGet, "/", `{"offset":0}`)
+	send(http.MethodGet, "/", `{"offset":5}`)
+	send(http.MethodPost, "/groups/join", `{"group":"group"}`)
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	assert.Nil(t, err)
+
+	defer resp.Body.Close() // nolint:errcheck
+
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+
+	body := string(data)
+
+	assert.Contains(t, body, `proglog_http_requests_total{code="200",handler="/",method="POST"} 2`)
+	assert.Contains(t, body, `proglog_http_requests_total{code="404",handler="/",method="GET"} 1`)
+	assert.Contains(t, body, `proglog_http_request_duration_seconds_count{code="200",handler="/",method="GET"} 1`)
+	assert.Contains(t, body, "proglog_log_end_offset 2")
+	assert.Contains(t, body, "proglog_log_lowest_offset 0")
+	assert.Contains(t, body, "proglog_log_disk_bytes 56")
+	assert.Contains(t, body, "proglog_log_appended_bytes_total 10")
+	assert.Contains(t, body, "proglog_log_read_bytes_total 5")
+	assert.Contains(t, body, "proglog_store_sync_duration_seconds_count 2")
+	assert.Contains(t, body, `proglog_consumer_group_lag{group="group",partition="0"} 2`)
+}
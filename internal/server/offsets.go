@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Offsets committed by consumer groups are persisted as control markers with
+// the offset attribute, so they are replicated and restored with the records.
+// The producer ID of a marker is the group ID, and its value is the partition
+// followed by the committed offset.
+const (
+	partitionLength   = 4
+	groupOffsetLength = partitionLength + 8
+)
+
+// CommitGroupOffset persists the offset of the next record the group reads
+// from the partition.
+func (c *Log) CommitGroupOffset(groupID string, partition uint32, offset uint64) error {
+	value := make([]byte, groupOffsetLength)
+	binary.BigEndian.PutUint32(value, partition)
+	binary.BigEndian.PutUint64(value[partitionLength:], offset)
+
+	_, err := c.submit(command{
+		kind: appendCommand,
+		entry: entry{
+			record:     Record{Value: value},
+			producerID: groupID,
+			attributes: controlAttribute | offsetAttribute,
+		},
+	})
+
+	return err
+}
+
+// GroupOffsets returns the offsets committed by the group by partition. It
+// returns false if the group has not committed any offset.
+func (c *Log) GroupOffsets(groupID string) (map[uint32]uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	committed, ok := c.groupOffsets[groupID]
+	if !ok {
+		return nil, false
+	}
+
+	offsets := make(map[uint32]uint64, len(committed))
+	for partition, offset := range committed {
+		offsets[partition] = offset
+	}
+
+	return offsets, true
+}
+
+// OffsetGroups returns the IDs of the groups that have committed offsets in
+// order.
+func (c *Log) OffsetGroups() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groups := make([]string, 0, len(c.groupOffsets))
+	for id := range c.groupOffsets {
+		groups = append(groups, id)
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
+// applyGroupOffset updates the offset committed by the marker's group.
+func (c *Log) applyGroupOffset(e entry) {
+	if len(e.record.Value) != groupOffsetLength {
+		return
+	}
+
+	offsets, ok := c.groupOffsets[e.producerID]
+	if !ok {
+		offsets = make(map[uint32]uint64)
+		c.groupOffsets[e.producerID] = offsets
+	}
+
+	partition := binary.BigEndian.Uint32(e.record.Value)
+	offsets[partition] = binary.BigEndian.Uint64(e.record.Value[partitionLength:])
+}
@@ -2,6 +2,7 @@ package server_test
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/ivanlemeshev/proglog/internal/server"
@@ -66,3 +67,141 @@ func TestProduceHandler_BadRequest(t *testing.T) {
 		Status(http.StatusBadRequest).
 		End()
 }
+
+func TestProduceHandler_Idempotent(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	handler := server.NewProduceHandler(log)
+
+	tt := []struct {
+		name         string
+		requestBody  string
+		status       int
+		responseBody string
+	}{
+		{
+			"Produce message",
+			`{"value":"cHJvZHVjZSBtZXNzYWdlIDA=","producer_id":"p","sequence":0}`,
+			http.StatusOK,
+			`{"offset":0}`,
+		},
+		{
+			"Retry message",
+			`{"value":"cHJvZHVjZSBtZXNzYWdlIDA=","producer_id":"p","sequence":0}`,
+			http.StatusOK,
+			`{"offset":0}`,
+		},
+		{
+			"Skip sequence",
+			`{"value":"cHJvZHVjZSBtZXNzYWdlIDI=","producer_id":"p","sequence":2}`,
+			http.StatusConflict,
+			`{"error":"Out of order sequence"}`,
+		},
+		{
+			"Produce next message",
+			`{"value":"cHJvZHVjZSBtZXNzYWdlIDE=","producer_id":"p","sequence":1}`,
+			http.StatusOK,
+			`{"offset":1}`,
+		},
+		{
+			"Retry old message",
+			`{"value":"cHJvZHVjZSBtZXNzYWdlIDA=","producer_id":"p","sequence":0}`,
+			http.StatusConflict,
+			`{"error":"Duplicate sequence"}`,
+		},
+		{
+			"Too long producer ID",
+			`{"value":"cHJvZHVjZSBtZXNzYWdlIDI=","producer_id":"` + strings.Repeat("p", 1<<16) + `","sequence":0}`,
+			http.StatusBadRequest,
+			`{"error":"Invalid producer ID"}`,
+		},
+	}
+
+	for _, tc := range tt { // nolint:paralleltest
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			apitest.New().
+				HandlerFunc(handler).
+				Post("/").
+				JSON(testCase.requestBody).
+				Expect(t).
+				Status(testCase.status).
+				Body(testCase.responseBody).
+				End()
+		})
+	}
+}
+
+func TestProduceBatchHandler(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	handler := server.NewProduceBatchHandler(log)
+
+	tt := []struct {
+		name         string
+		requestBody  string
+		status       int
+		responseBody string
+	}{
+		{
+			"Produce batch",
+			`{"records":[{"value":"MA=="},{"value":"MQ=="}],"producer_id":"p","sequence":0}`,
+			http.StatusOK,
+			`{"offsets":[0,1]}`,
+		},
+		{
+			"Retry batch",
+			`{"records":[{"value":"MA=="},{"value":"MQ=="}],"producer_id":"p","sequence":0}`,
+			http.StatusOK,
+			`{"offsets":[0,1]}`,
+		},
+		{
+			"Skip sequence",
+			`{"records":[{"value":"Mw=="}],"producer_id":"p","sequence":3}`,
+			http.StatusConflict,
+			`{"error":"Out of order sequence"}`,
+		},
+		{
+			"Resume after skipped sequence",
+			`{"records":[{"value":"Mw=="}],"producer_id":"p","sequence":3,"resume":true}`,
+			http.StatusOK,
+			`{"offsets":[2]}`,
+		},
+		{
+			"Without producer",
+			`{"records":[{"value":"NA=="},{"value":"NQ=="}]}`,
+			http.StatusOK,
+			`{"offsets":[3,4]}`,
+		},
+		{
+			"Empty batch",
+			`{"records":[],"producer_id":"p","sequence":4}`,
+			http.StatusBadRequest,
+			`{"error":"Bad request"}`,
+		},
+		{
+			"Bad acks",
+			`{"records":[{"value":"NA=="}],"acks":"some"}`,
+			http.StatusBadRequest,
+			`{"error":"Bad acks"}`,
+		},
+	}
+
+	for _, tc := range tt { // nolint:paralleltest
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			apitest.New().
+				HandlerFunc(handler).
+				Post("/batch").
+				JSON(testCase.requestBody).
+				Expect(t).
+				Status(testCase.status).
+				Body(testCase.responseBody).
+				End()
+		})
+	}
+}
@@ -1,13 +1,30 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ProduceRequest is a produce request to write a record into the log.
+// ProduceRequest is a produce request to write a record into the log. Requests
+// with a producer ID are idempotent: a retry with the same sequence number
+// returns the offset of the original record. Transactional requests add the
+// record to the open transaction of the producer instead. With acks=all the
+// response waits until all in-sync replicas have replicated the record, the
+// default is to respond once the leader has appended it.
 type ProduceRequest struct {
-	Value []byte `json:"value"`
+	Value         []byte   `json:"value"`
+	Headers       []Header `json:"headers"`
+	ProducerID    string   `json:"producer_id"`
+	Sequence      uint64   `json:"sequence"`
+	Transactional bool     `json:"transactional"`
+	Acks          string   `json:"acks"`
 }
 
 // ProduceResponse is a response on the produce request.
@@ -15,19 +32,69 @@ type ProduceResponse struct {
 	Offset uint64 `json:"offset"`
 }
 
+// ProduceBatchRequest is a request to write several records into the log at
+// once. The records of a producer have consecutive sequence numbers from the
+// given one. A retried batch returns the offsets of the records appended
+// before instead of appending them again. Resume lets the sequence number
+// skip the records the producer has given up on, for example after a request
+// that timed out. Acks are the same as for a single record, with acks=all the
+// response waits for all records of the batch.
+type ProduceBatchRequest struct {
+	Records    []BatchRecord `json:"records"`
+	ProducerID string        `json:"producer_id"`
+	Sequence   uint64        `json:"sequence"`
+	Resume     bool          `json:"resume"`
+	Acks       string        `json:"acks"`
+}
+
+// BatchRecord is a record of a batch request.
+type BatchRecord struct {
+	Value   []byte   `json:"value"`
+	Headers []Header `json:"headers"`
+}
+
+// ProduceBatchResponse is a response on the batch request with the offsets of
+// the records in the order of the request.
+type ProduceBatchResponse struct {
+	Offsets []uint64 `json:"offsets"`
+}
+
 type produceHandler struct {
-	log *Log
+	log          *Log
+	replicas     *Replicas
+	traceHeaders bool // inject the trace context into the record headers
 }
 
 // NewProduceHandler creates a new produce handler function.
 func NewProduceHandler(log *Log) http.HandlerFunc {
+	return newProduceHandler(log, NewReplicas(log, ReplicasConfig{}), false) // nolint:exhaustivestruct
+}
+
+func newProduceHandler(log *Log, replicas *Replicas, traceHeaders bool) http.HandlerFunc {
 	handler := &produceHandler{
-		log: log,
+		log:          log,
+		replicas:     replicas,
+		traceHeaders: traceHeaders,
 	}
 
 	return handler.handle
 }
 
+// NewProduceBatchHandler creates a new batch produce handler function.
+func NewProduceBatchHandler(log *Log) http.HandlerFunc {
+	return newProduceBatchHandler(log, NewReplicas(log, ReplicasConfig{}), false) // nolint:exhaustivestruct
+}
+
+func newProduceBatchHandler(log *Log, replicas *Replicas, traceHeaders bool) http.HandlerFunc {
+	handler := &produceHandler{
+		log:          log,
+		replicas:     replicas,
+		traceHeaders: traceHeaders,
+	}
+
+	return handler.handleBatch
+}
+
 func (h *produceHandler) handle(w http.ResponseWriter, r *http.Request) {
 	var request ProduceRequest
 
@@ -38,16 +105,197 @@ func (h *produceHandler) handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offset, err := h.log.Append(request.Value)
+	if request.Transactional && request.ProducerID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	if !h.checkAcks(w, request.Acks) {
+		return
+	}
+
+	headers := h.headers(r, request.Headers)
+
+	_, span := trace.SpanFromContext(r.Context()).TracerProvider().Tracer(tracerName).Start(r.Context(), "Log.Append",
+		trace.WithAttributes(attribute.Int("record.size", len(request.Value))),
+	)
+
+	var offset uint64
+
+	switch {
+	case request.Transactional:
+		offset, err = h.log.AppendTransactional(request.ProducerID, auth.PrincipalFromContext(r.Context()),
+			request.Value, headers...)
+	case request.ProducerID != "":
+		offset, err = h.log.AppendIdempotent(request.ProducerID, request.Sequence, request.Value, headers...)
+	default:
+		offset, err = h.log.Append(request.Value, headers...)
+	}
+
+	span.SetAttributes(attribute.Int64("record.offset", int64(offset)))
+	endSpan(span, err)
+
 	if err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		writeAppendError(w, r, err)
 
 		return
 	}
 
+	if request.Acks == AcksAll {
+		if !h.waitReplicated(w, r, offset) {
+			return
+		}
+	}
+
 	response := ProduceResponse{
 		Offset: offset,
 	}
 
 	writeResponse(w, http.StatusOK, response)
 }
+
+// handleBatch appends the records of a batch request.
+func (h *produceHandler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var request ProduceBatchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.Records) == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	if !h.checkAcks(w, request.Acks) {
+		return
+	}
+
+	records := make([]Record, 0, len(request.Records))
+	size := 0
+
+	for _, record := range request.Records {
+		records = append(records, Record{Value: record.Value, Offset: 0, Headers: h.headers(r, record.Headers)})
+		size += len(record.Value)
+	}
+
+	_, span := trace.SpanFromContext(r.Context()).TracerProvider().Tracer(tracerName).Start(r.Context(), "Log.AppendBatch",
+		trace.WithAttributes(
+			attribute.Int("batch.records", len(records)),
+			attribute.Int("batch.size", size),
+		),
+	)
+
+	offsets, err := h.log.AppendBatch(request.ProducerID, request.Sequence, request.Resume, records)
+	endSpan(span, err)
+
+	if err != nil {
+		writeAppendError(w, r, err)
+
+		return
+	}
+
+	if request.Acks == AcksAll {
+		if !h.waitReplicated(w, r, maxOffset(offsets)) {
+			return
+		}
+	}
+
+	response := ProduceBatchResponse{
+		Offsets: offsets,
+	}
+
+	writeResponse(w, http.StatusOK, response)
+}
+
+// checkAcks checks the acknowledgements of the request and writes the error
+// response if they are invalid or cannot be satisfied.
+func (h *produceHandler) checkAcks(w http.ResponseWriter, acks string) bool {
+	switch acks {
+	case "", AcksLeader:
+	case AcksAll:
+		// Like the records, the in-sync replicas are checked before the
+		// append, so the record is not appended if it cannot be replicated.
+		if err := h.replicas.CheckInSync(); err != nil {
+			writeErrorResponse(w, http.StatusServiceUnavailable, "Not enough in-sync replicas")
+
+			return false
+		}
+	default:
+		writeErrorResponse(w, http.StatusBadRequest, "Bad acks")
+
+		return false
+	}
+
+	return true
+}
+
+// headers returns the headers of a record with the trace context of the
+// request if the handler adds it.
+func (h *produceHandler) headers(r *http.Request, requested []Header) headerCarrier {
+	headers := headerCarrier(requested)
+
+	// Records keep the trace context of the producer if it has set one.
+	if h.traceHeaders && headers.Get("traceparent") == "" {
+		traceContext.Inject(r.Context(), &headers)
+	}
+
+	return headers
+}
+
+// maxOffset returns the greatest of the offsets.
+func maxOffset(offsets []uint64) uint64 {
+	var max uint64
+
+	for _, offset := range offsets {
+		if offset > max {
+			max = offset
+		}
+	}
+
+	return max
+}
+
+// writeAppendError writes the error response of a failed append.
+func writeAppendError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNoTransaction):
+		writeErrorResponse(w, http.StatusConflict, "No open transaction")
+	case errors.Is(err, ErrNotTransactionOwner):
+		writeErrorResponse(w, http.StatusForbidden, "Transaction of another principal")
+	case errors.Is(err, ErrOutOfOrderSequence):
+		writeErrorResponse(w, http.StatusConflict, "Out of order sequence")
+	case errors.Is(err, ErrDuplicateSequence):
+		writeErrorResponse(w, http.StatusConflict, "Duplicate sequence")
+	case errors.Is(err, ErrInvalidProducerID):
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid producer ID")
+	case errors.Is(err, ErrInvalidHeader):
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid header")
+	case errors.Is(err, store.ErrMaxRecordLength):
+		writeErrorResponse(w, http.StatusRequestEntityTooLarge, "Record too large")
+	case errors.Is(err, ErrNotLeader), errors.Is(err, ErrNoLeader):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Not the leader")
+	case errors.Is(err, ErrLogClosed):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Log closed")
+	default:
+		writeInternalError(w, r, err)
+	}
+}
+
+// waitReplicated waits until the in-sync replicas have replicated the record
+// and writes the error response if they have not.
+func (h *produceHandler) waitReplicated(w http.ResponseWriter, r *http.Request, offset uint64) bool {
+	err := h.replicas.WaitReplicated(r.Context(), offset)
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrNotEnoughReplicas):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Not enough in-sync replicas")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeErrorResponse(w, http.StatusGatewayTimeout, "Replication timed out")
+	default:
+		writeInternalError(w, r, err)
+	}
+
+	return false
+}
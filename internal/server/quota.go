@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// throttling wraps the handler to enforce the quotas of the principal and the
+// log topic. Throttled requests get 429 with the Retry-After header in
+// seconds. The bytes of the request and the response are charged when the
+// request is done. Handlers are not wrapped if the quotas are nil.
+func throttling(quotas *quota.Manager, metrics *Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if quotas == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.PrincipalFromContext(r.Context())
+
+			retryAfter, ok := allowQuota(r.Context(), quotas, metrics, principal)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeErrorResponse(w, http.StatusTooManyRequests, "Quota exceeded")
+
+				return
+			}
+
+			body := &countingReader{ReadCloser: r.Body, read: 0}
+			r.Body = body
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r)
+
+			chargeQuota(quotas, metrics, principal, body.read+recorder.written)
+		})
+	}
+}
+
+// throttlingGRPC is a gRPC middleware that enforces the quotas of the
+// principal and the log topic on the methods in grpcMethods that are
+// throttled like throttling. Throttled calls get ResourceExhausted with the
+// retry-after metadata in seconds. Calls are not throttled if the quotas are
+// nil.
+func throttlingGRPC(quotas *quota.Manager, metrics *Metrics) grpcMiddleware {
+	return func(ctx context.Context, call *grpcCall, next func(context.Context) error) error {
+		if quotas == nil || !grpcMethods[call.method].throttled {
+			return next(ctx)
+		}
+
+		principal := auth.PrincipalFromContext(ctx)
+
+		retryAfter, ok := allowQuota(ctx, quotas, metrics, principal)
+		if !ok {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterMetadata, strconv.Itoa(retryAfter)))
+
+			return status.Error(codes.ResourceExhausted, "Quota exceeded")
+		}
+
+		err := next(ctx)
+
+		chargeQuota(quotas, metrics, principal, call.size())
+
+		return err
+	}
+}
+
+// allowQuota reports whether the quotas allow a request of the principal. If
+// they do not, the request is counted as throttled and the time in seconds
+// until the next request is allowed is returned.
+func allowQuota(ctx context.Context, quotas *quota.Manager, metrics *Metrics, principal string) (int, bool) {
+	throttle, ok := quotas.Allow(principal, logTopic)
+	if ok {
+		return 0, true
+	}
+
+	metrics.throttled.WithLabelValues(principal, logTopic, throttle.Quota, throttle.Resource).Inc()
+
+	retryAfter := int(math.Ceil(throttle.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	loggerFromContext(ctx).Debug("Throttled",
+		zap.String("quota", throttle.Quota),
+		zap.String("resource", throttle.Resource),
+		zap.Duration("retry_after", throttle.RetryAfter),
+	)
+
+	return retryAfter, false
+}
+
+// chargeQuota charges the bytes of a done request to the quotas of the
+// principal and counts them.
+func chargeQuota(quotas *quota.Manager, metrics *Metrics, principal string, bytes int) {
+	quotas.Charge(principal, logTopic, bytes)
+	metrics.quotaRequests.WithLabelValues(principal, logTopic).Inc()
+	metrics.quotaBytes.WithLabelValues(principal, logTopic).Add(float64(bytes))
+}
+
+// countingReader counts the bytes read from the request body.
+type countingReader struct {
+	io.ReadCloser
+	read int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.read += n
+
+	return n, err // nolint:wrapcheck
+}
@@ -0,0 +1,54 @@
+package server_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/quota"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPServer_Quotas(t *testing.T) {
+	t.Parallel()
+
+	metrics := server.NewMetrics()
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{
+		Log:     server.NewLog(),
+		Metrics: metrics,
+		Quotas:  quota.NewManager(quota.Config{Default: quota.Limit{RequestsPerSecond: 1}}),
+	}).Handler)
+	defer srv.Close()
+
+	produce := func() *http.Response {
+		resp, err := http.Post(srv.URL+"/", "application/json", strings.NewReader(`{"value":"dGVzdA=="}`))
+		assert.Nil(t, err)
+
+		_ = resp.Body.Close()
+
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, produce().StatusCode)
+
+	resp := produce()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	assert.Nil(t, err)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+
+	_ = resp.Body.Close()
+
+	assert.Contains(t, string(body), `proglog_quota_requests_total{principal="anonymous",topic="default"} 1`)
+	assert.Contains(t, string(body), `proglog_quota_bytes_total{principal="anonymous",topic="default"}`)
+	assert.Contains(t, string(body),
+		`proglog_quota_throttled_total{principal="anonymous",quota="principal",resource="requests",topic="default"} 1`)
+}
@@ -0,0 +1,401 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/quota"
+)
+
+// ErrReassignmentInProgress is returned if a reassignment is started while
+// another one is in progress.
+var ErrReassignmentInProgress = fmt.Errorf("reassignment in progress")
+
+// ErrNoReassignment is returned if there is no reassignment to describe or
+// no reassignment in progress to change.
+var ErrNoReassignment = fmt.Errorf("no reassignment")
+
+// ErrInvalidReassignment is returned if the target replicas are empty or
+// repeated, the throttle is negative or the log is replicated by Raft.
+var ErrInvalidReassignment = fmt.Errorf("invalid reassignment")
+
+// ErrReplicaNotAssigned is returned to a follower that fetches from the
+// leader although it is not assigned to replicate the log.
+var ErrReplicaNotAssigned = fmt.Errorf("replica not assigned")
+
+// States of reassignments.
+const (
+	ReassignmentInProgress = "in_progress"
+	ReassignmentCompleted  = "completed"
+	ReassignmentCancelled  = "cancelled"
+)
+
+// Roles of replicas in a reassignment.
+const (
+	ReplicaAdding   = "adding"
+	ReplicaKept     = "kept"
+	ReplicaRemoving = "removing"
+)
+
+// ReassignmentPlan is the change of the followers assigned to replicate the
+// log. Before the first reassignment every follower that fetches is assigned.
+type ReassignmentPlan struct {
+	Current  []string `json:"current"`
+	Target   []string `json:"target"`
+	Adding   []string `json:"adding"`
+	Removing []string `json:"removing"`
+}
+
+// ReassignmentStatus describes the plan and the progress of a reassignment.
+type ReassignmentStatus struct {
+	Plan                   ReassignmentPlan          `json:"plan"`
+	State                  string                    `json:"state"`
+	ThrottleBytesPerSecond float64                   `json:"throttle_bytes_per_second"`
+	StartedAt              time.Time                 `json:"started_at"`
+	EndedAt                *time.Time                `json:"ended_at,omitempty"`
+	Replicas               []ReassignedReplicaStatus `json:"replicas"`
+}
+
+// ReassignedReplicaStatus describes the progress of a replica of the
+// reassignment.
+type ReassignedReplicaStatus struct {
+	ID     string `json:"id"`
+	Role   string `json:"role"`
+	Offset uint64 `json:"offset"` // the offset of the next record to replicate
+	Lag    uint64 `json:"lag"`
+	InSync bool   `json:"in_sync"`
+}
+
+// reassignment is the last reassignment of the replicas.
+type reassignment struct {
+	plan      ReassignmentPlan
+	state     string
+	throttle  float64
+	limiter   *quota.Manager // limits the bytes fetched by adding replicas
+	startedAt time.Time
+	endedAt   time.Time
+}
+
+// PlanReassignment returns the plan of reassigning the log to the target
+// followers without starting it.
+func (r *Replicas) PlanReassignment(target []string) (ReassignmentPlan, error) {
+	if err := validateTarget(target); err != nil {
+		return ReassignmentPlan{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.plan(target), nil
+}
+
+// Reassign starts reassigning the log to the target followers. The adding
+// followers catch up by fetching the records, limited to the throttle in
+// bytes per second if it is not zero. Once all target followers are in sync,
+// the removed followers are dropped from the in-sync replicas and their
+// fetches are rejected with ErrReplicaNotAssigned.
+func (r *Replicas) Reassign(target []string, throttle float64) (ReassignmentStatus, error) {
+	if err := validateTarget(target); err != nil {
+		return ReassignmentStatus{}, err
+	}
+
+	if throttle < 0 {
+		return ReassignmentStatus{}, fmt.Errorf("%w: negative throttle", ErrInvalidReassignment)
+	}
+
+	if r.log.replication != nil {
+		return ReassignmentStatus{}, fmt.Errorf("%w: Raft nodes join and leave the cluster instead", ErrInvalidReassignment)
+	}
+
+	if r.log.IsFollower() {
+		return ReassignmentStatus{}, ErrNotLeader
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reassignment != nil && r.reassignment.state == ReassignmentInProgress {
+		return ReassignmentStatus{}, ErrReassignmentInProgress
+	}
+
+	r.reassignment = &reassignment{
+		plan:      r.plan(target),
+		state:     ReassignmentInProgress,
+		throttle:  throttle,
+		limiter:   newReassignmentLimiter(throttle),
+		startedAt: time.Now(),
+		endedAt:   time.Time{},
+	}
+
+	r.completeReassignment(time.Now())
+
+	return r.reassignmentStatus(), nil
+}
+
+// Reassignment returns the status of the last reassignment.
+func (r *Replicas) Reassignment() (ReassignmentStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reassignment == nil {
+		return ReassignmentStatus{}, ErrNoReassignment
+	}
+
+	r.completeReassignment(time.Now())
+
+	return r.reassignmentStatus(), nil
+}
+
+// SetReassignmentThrottle changes the throttle of the reassignment in
+// progress. Zero removes the throttle.
+func (r *Replicas) SetReassignmentThrottle(throttle float64) (ReassignmentStatus, error) {
+	if throttle < 0 {
+		return ReassignmentStatus{}, fmt.Errorf("%w: negative throttle", ErrInvalidReassignment)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reassignment == nil || r.reassignment.state != ReassignmentInProgress {
+		return ReassignmentStatus{}, ErrNoReassignment
+	}
+
+	r.reassignment.throttle = throttle
+	r.reassignment.limiter = newReassignmentLimiter(throttle)
+
+	return r.reassignmentStatus(), nil
+}
+
+// CancelReassignment cancels the reassignment in progress. The current
+// followers stay assigned, and the adding followers are rejected.
+func (r *Replicas) CancelReassignment() (ReassignmentStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reassignment == nil || r.reassignment.state != ReassignmentInProgress {
+		return ReassignmentStatus{}, ErrNoReassignment
+	}
+
+	r.assigned = toSet(r.reassignment.plan.Current)
+
+	for _, id := range r.reassignment.plan.Adding {
+		delete(r.replicas, id)
+	}
+
+	r.endReassignment(ReassignmentCancelled, time.Now())
+
+	return r.reassignmentStatus(), nil
+}
+
+func validateTarget(target []string) error {
+	seen := make(map[string]bool, len(target))
+
+	for _, id := range target {
+		if id == "" || seen[id] {
+			return fmt.Errorf("%w: the target replica %q is empty or repeated", ErrInvalidReassignment, id)
+		}
+
+		seen[id] = true
+	}
+
+	return nil
+}
+
+func newReassignmentLimiter(throttle float64) *quota.Manager {
+	if throttle == 0 {
+		return nil
+	}
+
+	return quota.NewManager(quota.Config{ // nolint:exhaustivestruct
+		Default: quota.Limit{RequestsPerSecond: 0, BytesPerSecond: throttle},
+	})
+}
+
+// plan returns the plan of reassigning the log to the target followers. It
+// must be called with the lock held.
+func (r *Replicas) plan(target []string) ReassignmentPlan {
+	current := make([]string, 0, len(r.replicas))
+
+	if r.assigned != nil {
+		for id := range r.assigned {
+			current = append(current, id)
+		}
+	} else {
+		for id := range r.replicas {
+			current = append(current, id)
+		}
+	}
+
+	currentSet := toSet(current)
+	targetSet := toSet(target)
+
+	plan := ReassignmentPlan{
+		Current:  sortedIDs(current),
+		Target:   sortedIDs(target),
+		Adding:   []string{},
+		Removing: []string{},
+	}
+
+	for _, id := range plan.Target {
+		if !currentSet[id] {
+			plan.Adding = append(plan.Adding, id)
+		}
+	}
+
+	for _, id := range plan.Current {
+		if !targetSet[id] {
+			plan.Removing = append(plan.Removing, id)
+		}
+	}
+
+	return plan
+}
+
+// assignedReplica reports whether the follower may fetch: it is assigned or
+// it is added by the reassignment in progress. It must be called with the
+// lock held.
+func (r *Replicas) assignedReplica(id string) bool {
+	if r.assigned == nil || r.assigned[id] {
+		return true
+	}
+
+	return r.reassignment != nil && r.reassignment.state == ReassignmentInProgress &&
+		toSet(r.reassignment.plan.Adding)[id]
+}
+
+// limiter returns the limiter of the follower's fetches, or nil if the
+// follower is not throttled. Only the adding followers that are not in sync
+// yet are throttled. It must be called with the lock held.
+func (r *Replicas) limiter(id string, now time.Time) *quota.Manager {
+	rs := r.reassignment
+	if rs == nil || rs.state != ReassignmentInProgress || rs.limiter == nil || !toSet(rs.plan.Adding)[id] {
+		return nil
+	}
+
+	if rep, ok := r.replicas[id]; ok && r.inSync(rep, now) {
+		return nil
+	}
+
+	return rs.limiter
+}
+
+// completeReassignment completes the reassignment in progress once all
+// target followers are in sync. It must be called with the lock held.
+func (r *Replicas) completeReassignment(now time.Time) {
+	rs := r.reassignment
+	if rs == nil || rs.state != ReassignmentInProgress {
+		return
+	}
+
+	for _, id := range rs.plan.Target {
+		rep, ok := r.replicas[id]
+		if !ok || !r.inSync(rep, now) {
+			return
+		}
+	}
+
+	r.assigned = toSet(rs.plan.Target)
+
+	for _, id := range rs.plan.Removing {
+		delete(r.replicas, id)
+	}
+
+	r.endReassignment(ReassignmentCompleted, now)
+}
+
+// endReassignment ends the reassignment in progress and wakes the waiters,
+// whose in-sync replicas may have changed.
+func (r *Replicas) endReassignment(state string, now time.Time) {
+	r.reassignment.state = state
+	r.reassignment.limiter = nil
+	r.reassignment.endedAt = now
+
+	close(r.progressed)
+	r.progressed = make(chan struct{})
+}
+
+// reassignmentStatus returns the status of the last reassignment. It must be
+// called with the lock held.
+func (r *Replicas) reassignmentStatus() ReassignmentStatus {
+	rs := r.reassignment
+	end := r.log.EndOffset()
+	now := time.Now()
+
+	status := ReassignmentStatus{
+		Plan:                   rs.plan,
+		State:                  rs.state,
+		ThrottleBytesPerSecond: rs.throttle,
+		StartedAt:              rs.startedAt,
+		EndedAt:                nil,
+		Replicas:               []ReassignedReplicaStatus{},
+	}
+
+	if !rs.endedAt.IsZero() {
+		endedAt := rs.endedAt
+		status.EndedAt = &endedAt
+	}
+
+	adding := toSet(rs.plan.Adding)
+	roles := make(map[string]string, len(rs.plan.Target)+len(rs.plan.Removing))
+
+	for _, id := range rs.plan.Target {
+		roles[id] = ReplicaKept
+		if adding[id] {
+			roles[id] = ReplicaAdding
+		}
+	}
+
+	for _, id := range rs.plan.Removing {
+		roles[id] = ReplicaRemoving
+	}
+
+	for _, id := range sortedIDs(keys(roles)) {
+		replicaStatus := ReassignedReplicaStatus{
+			ID:     id,
+			Role:   roles[id],
+			Offset: 0,
+			Lag:    end,
+			InSync: false,
+		}
+
+		if rep, ok := r.replicas[id]; ok {
+			replicaStatus.Offset = rep.offset
+			replicaStatus.Lag = 0
+			replicaStatus.InSync = r.inSync(rep, now)
+
+			if end > rep.offset {
+				replicaStatus.Lag = end - rep.offset
+			}
+		}
+
+		status.Replicas = append(status.Replicas, replicaStatus)
+	}
+
+	return status
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+
+	return set
+}
+
+func keys(m map[string]string) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func sortedIDs(ids []string) []string {
+	sorted := append([]string{}, ids...)
+	sort.Strings(sorted)
+
+	return sorted
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ReassignRequest is a request to reassign the log to the target followers.
+// A dry run returns the plan without starting the reassignment. The catch-up
+// of the adding followers is not throttled if the throttle is zero.
+type ReassignRequest struct {
+	Replicas               []string `json:"replicas"`
+	ThrottleBytesPerSecond float64  `json:"throttle_bytes_per_second"`
+	DryRun                 bool     `json:"dry_run"`
+}
+
+// ReassignmentThrottleRequest is a request to change the throttle of the
+// reassignment in progress.
+type ReassignmentThrottleRequest struct {
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+type reassignmentHandler struct {
+	replicas *Replicas
+}
+
+// NewReassignHandler creates a new handler function to plan and start
+// reassignments.
+func NewReassignHandler(replicas *Replicas) http.HandlerFunc {
+	handler := &reassignmentHandler{
+		replicas: replicas,
+	}
+
+	return handler.reassign
+}
+
+// NewReassignmentHandler creates a new handler function that describes the
+// last reassignment.
+func NewReassignmentHandler(replicas *Replicas) http.HandlerFunc {
+	handler := &reassignmentHandler{
+		replicas: replicas,
+	}
+
+	return handler.describe
+}
+
+// NewReassignmentThrottleHandler creates a new handler function to change the
+// throttle of the reassignment in progress.
+func NewReassignmentThrottleHandler(replicas *Replicas) http.HandlerFunc {
+	handler := &reassignmentHandler{
+		replicas: replicas,
+	}
+
+	return handler.throttle
+}
+
+// NewCancelReassignmentHandler creates a new handler function to cancel the
+// reassignment in progress.
+func NewCancelReassignmentHandler(replicas *Replicas) http.HandlerFunc {
+	handler := &reassignmentHandler{
+		replicas: replicas,
+	}
+
+	return handler.cancel
+}
+
+func (h *reassignmentHandler) reassign(w http.ResponseWriter, r *http.Request) {
+	var request ReassignRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Replicas == nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	if request.DryRun {
+		plan, err := h.replicas.PlanReassignment(request.Replicas)
+		if err != nil {
+			writeReassignmentError(w, r, err)
+
+			return
+		}
+
+		writeResponse(w, http.StatusOK, plan)
+
+		return
+	}
+
+	status, err := h.replicas.Reassign(request.Replicas, request.ThrottleBytesPerSecond)
+	if err != nil {
+		writeReassignmentError(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, status)
+}
+
+func (h *reassignmentHandler) describe(w http.ResponseWriter, r *http.Request) {
+	status, err := h.replicas.Reassignment()
+	if err != nil {
+		writeReassignmentError(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, status)
+}
+
+func (h *reassignmentHandler) throttle(w http.ResponseWriter, r *http.Request) {
+	var request ReassignmentThrottleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	status, err := h.replicas.SetReassignmentThrottle(request.BytesPerSecond)
+	if err != nil {
+		writeReassignmentError(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, status)
+}
+
+func (h *reassignmentHandler) cancel(w http.ResponseWriter, r *http.Request) {
+	status, err := h.replicas.CancelReassignment()
+	if err != nil {
+		writeReassignmentError(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, status)
+}
+
+func writeReassignmentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidReassignment):
+		writeErrorResponse(w, http.StatusBadRequest, "Bad reassignment")
+	case errors.Is(err, ErrNoReassignment):
+		writeErrorResponse(w, http.StatusNotFound, "Reassignment not found")
+	case errors.Is(err, ErrReassignmentInProgress):
+		writeErrorResponse(w, http.StatusConflict, "Reassignment in progress")
+	case errors.Is(err, ErrNotLeader):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Not the leader")
+	default:
+		writeInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReassignment(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	leader := server.NewLog()
+	replicas := server.NewReplicas(leader, server.ReplicasConfig{LagMax: 300 * time.Millisecond, MinInSync: 1})
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{ // nolint:exhaustivestruct
+		Log:      leader,
+		Replicas: replicas,
+	}).Handler)
+
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	for i := 0; i < 5; i++ {
+		_, err := leader.Append(bytes.Repeat([]byte("x"), 100))
+		assert.Nil(t, err)
+	}
+
+	startFollower := func(id string) (*server.Log, *server.Follower) {
+		l := server.NewLog()
+		f := server.StartFollower(l, server.FollowerConfig{ // nolint:exhaustivestruct
+			ReplicaID: id,
+			Transport: transport,
+			MaxWait:   50 * time.Millisecond,
+			Backoff:   10 * time.Millisecond,
+		})
+
+		t.Cleanup(f.Stop)
+
+		return l, f
+	}
+
+	_, err := transport.Reassignment(context.Background())
+	assert.Equal(t, client.ErrReassignmentNotFound, err)
+
+	old, oldFollower := startFollower("old")
+	assert.Eventually(t, func() bool { return old.HighWatermark() == 5 }, time.Second, 10*time.Millisecond)
+
+	plan, err := transport.PlanReassignment(context.Background(), []string{"new"})
+	assert.Nil(t, err)
+	assert.Equal(t, client.ReassignmentPlan{
+		Current:  []string{"old"},
+		Target:   []string{"new"},
+		Adding:   []string{"new"},
+		Removing: []string{"old"},
+	}, plan)
+
+	_, err = transport.PlanReassignment(context.Background(), []string{"new", "new"})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+
+	// The new follower catches up at the throttled rate.
+	reassignment, err := transport.Reassign(context.Background(), []string{"new"}, 200)
+	assert.Nil(t, err)
+	assert.Equal(t, client.ReassignmentInProgress, reassignment.State)
+	assert.Equal(t, float64(200), reassignment.ThrottleBytesPerSecond)
+	assert.Equal(t, []client.ReassignedReplica{
+		{ID: "new", Role: "adding", Offset: 0, Lag: 5, InSync: false},
+		{ID: "old", Role: "removing", Offset: 5, Lag: 0, InSync: true},
+	}, reassignment.Replicas)
+
+	_, err = transport.Reassign(context.Background(), []string{"other"}, 0)
+	assert.Equal(t, http.StatusConflict, statusCode(err))
+
+	added, _ := startFollower("new")
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Less(t, added.EndOffset(), uint64(5))
+
+	reassignment, err = transport.Reassignment(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, client.ReassignmentInProgress, reassignment.State)
+
+	// Without the throttle it completes, and the old follower is removed.
+	_, err = transport.SetReassignmentThrottle(context.Background(), 0)
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		reassignment, err = transport.Reassignment(context.Background())
+
+		return err == nil && reassignment.State == client.ReassignmentCompleted
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.NotNil(t, reassignment.EndedAt)
+	assert.Equal(t, uint64(5), added.EndOffset())
+
+	statuses := replicas.Describe()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "new", statuses[0].ID)
+
+	assert.Eventually(t, func() bool {
+		return oldFollower.Status().Error != ""
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, oldFollower.Status().Error, "Replica not assigned")
+
+	_, err = transport.SetReassignmentThrottle(context.Background(), 100)
+	assert.Equal(t, client.ErrReassignmentNotFound, err)
+
+	// A cancelled reassignment keeps the current followers.
+	reassignment, err = transport.Reassign(context.Background(), []string{"new", "other"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"other"}, reassignment.Plan.Adding)
+
+	reassignment, err = transport.CancelReassignment(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, client.ReassignmentCancelled, reassignment.State)
+
+	_, err = transport.CancelReassignment(context.Background())
+	assert.Equal(t, client.ErrReassignmentNotFound, err)
+
+	_, err = transport.Fetch(context.Background(), client.FetchRequest{ // nolint:exhaustivestruct
+		ReplicaID: "other",
+	})
+	assert.Equal(t, http.StatusGone, statusCode(err))
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotEnoughReplicas is returned if a record produced with acks=all cannot
+// be replicated because the in-sync replicas, including the leader, are fewer
+// than the minimum.
+var ErrNotEnoughReplicas = fmt.Errorf("not enough in-sync replicas")
+
+// Acknowledgements of produce requests.
+const (
+	// AcksLeader acknowledges a record once the leader has appended it.
+	AcksLeader = "leader"
+
+	// AcksAll acknowledges a record once all in-sync replicas have replicated
+	// it.
+	AcksAll = "all"
+)
+
+// Default settings of the replicas.
+const (
+	DefaultReplicaLagMax     = 10 * time.Second
+	DefaultMinInSyncReplicas = 1
+)
+
+// ReplicasConfig configures the replicas of the leader's log.
+type ReplicasConfig struct {
+	// LagMax is the time after which a replica that has not caught up with
+	// the leader is dropped from the in-sync replicas. DefaultReplicaLagMax is
+	// used if it is zero.
+	LagMax time.Duration
+
+	// MinInSync is the minimum number of in-sync replicas, including the
+	// leader, for records produced with acks=all. DefaultMinInSyncReplicas is
+	// used if it is zero.
+	MinInSync int
+}
+
+// ReplicaStatus describes a follower of the leader's log.
+type ReplicaStatus struct {
+	ID          string    `json:"id"`
+	Offset      uint64    `json:"offset"` // the offset of the next record to replicate
+	Lag         uint64    `json:"lag"`
+	InSync      bool      `json:"in_sync"`
+	LastFetchAt time.Time `json:"last_fetch_at"`
+	CaughtUpAt  time.Time `json:"caught_up_at"`
+}
+
+// Replicas tracks the followers of the leader's log by their fetch requests.
+// A follower fetching offset N has replicated the records before N. It is
+// in sync while it has caught up with the leader within the maximum lag: it
+// has fetched the end of the log, or at least the end of the log at its
+// previous fetch. Once the followers are reassigned, only the assigned ones
+// may fetch.
+type Replicas struct {
+	mu           sync.Mutex
+	log          *Log
+	lagMax       time.Duration
+	minInSync    int
+	replicas     map[string]*replica
+	progressed   chan struct{}   // closed and replaced on every fetch
+	assigned     map[string]bool // nil until the first reassignment completes
+	reassignment *reassignment   // nil until the first reassignment starts
+}
+
+type replica struct {
+	offset       uint64
+	lastFetchAt  time.Time
+	lastFetchEnd uint64 // the end of the leader's log at the last fetch
+	caughtUpAt   time.Time
+}
+
+// NewReplicas creates the tracker of the followers of the log.
+func NewReplicas(log *Log, config ReplicasConfig) *Replicas {
+	if config.LagMax == 0 {
+		config.LagMax = DefaultReplicaLagMax
+	}
+
+	if config.MinInSync == 0 {
+		config.MinInSync = DefaultMinInSyncReplicas
+	}
+
+	return &Replicas{
+		mu:           sync.Mutex{},
+		log:          log,
+		lagMax:       config.LagMax,
+		minInSync:    config.MinInSync,
+		replicas:     make(map[string]*replica),
+		progressed:   make(chan struct{}),
+		assigned:     nil,
+		reassignment: nil,
+	}
+}
+
+// Fetched records the fetch of the offset by the follower. It returns
+// ErrReplicaNotAssigned if the follower is not assigned to replicate the log.
+func (r *Replicas) Fetched(id string, offset uint64) error {
+	end := r.log.EndOffset()
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.assignedReplica(id) {
+		return fmt.Errorf("%w: %q", ErrReplicaNotAssigned, id)
+	}
+
+	rep, ok := r.replicas[id]
+	if !ok {
+		rep = &replica{} // nolint:exhaustivestruct
+		r.replicas[id] = rep
+	}
+
+	if offset >= end || (ok && offset >= rep.lastFetchEnd) {
+		rep.caughtUpAt = now
+	}
+
+	rep.offset = offset
+	rep.lastFetchAt = now
+	rep.lastFetchEnd = end
+
+	close(r.progressed)
+	r.progressed = make(chan struct{})
+
+	r.completeReassignment(now)
+
+	return nil
+}
+
+// Fetch records the fetch of the offset by the follower and returns the
+// persisted records from the offset, up to the maximum total size and at
+// least one, with the high watermark. It waits until the record at the offset
+// is appended, the high watermark advances past the one known to the follower
+// or the context is done. There are no records if none is appended yet. A
+// follower catching up in a reassignment fetches one record at a time,
+// delayed by the throttle of the reassignment.
+func (r *Replicas) Fetch(
+	ctx context.Context,
+	id string,
+	offset, highWatermark uint64,
+	maxBytes int,
+) ([][]byte, uint64, error) {
+	if err := r.Fetched(id, offset); err != nil {
+		return nil, 0, err
+	}
+
+	for {
+		r.mu.Lock()
+		progressed := r.progressed
+		limiter := r.limiter(id, time.Now())
+		r.mu.Unlock()
+
+		if limiter != nil {
+			maxBytes = 0
+		}
+
+		entries, appended, err := r.log.entriesFrom(ctx, offset, maxBytes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		current := r.HighWatermark()
+
+		if entries != nil && limiter != nil {
+			if throttle, ok := limiter.Allow(id, ""); !ok {
+				select {
+				case <-time.After(throttle.RetryAfter):
+					continue
+				case <-ctx.Done():
+					return nil, current, nil
+				}
+			}
+
+			limiter.Charge(id, "", len(entries[0]))
+		}
+
+		if entries != nil || current > highWatermark {
+			return entries, current, nil
+		}
+
+		select {
+		case <-appended:
+		case <-progressed:
+		case <-ctx.Done():
+			return nil, current, nil
+		case <-r.log.closing:
+			return nil, 0, ErrLogClosed
+		}
+	}
+}
+
+// HighWatermark returns the end of the records replicated by the leader and
+// all in-sync replicas. Followers serve only the records before it.
+func (r *Replicas) HighWatermark() uint64 {
+	highWatermark := r.log.EndOffset()
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rep := range r.replicas {
+		if r.inSync(rep, now) && rep.offset < highWatermark {
+			highWatermark = rep.offset
+		}
+	}
+
+	return highWatermark
+}
+
+// CheckInSync returns ErrNotEnoughReplicas if there are fewer in-sync
+// replicas than the minimum.
+func (r *Replicas) CheckInSync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.checkInSync(time.Now())
+}
+
+func (r *Replicas) checkInSync(now time.Time) error {
+	inSync := 1 // the leader
+
+	for _, rep := range r.replicas {
+		if r.inSync(rep, now) {
+			inSync++
+		}
+	}
+
+	if inSync < r.minInSync {
+		return fmt.Errorf("%w: %d of %d", ErrNotEnoughReplicas, inSync, r.minInSync)
+	}
+
+	return nil
+}
+
+func (r *Replicas) inSync(rep *replica, now time.Time) bool {
+	return !rep.caughtUpAt.IsZero() && now.Sub(rep.caughtUpAt) <= r.lagMax
+}
+
+// WaitReplicated waits until all in-sync replicas have replicated the record
+// at the offset. Replicas that fall behind for longer than the maximum lag
+// are dropped from the in-sync replicas instead of being waited for. It
+// returns ErrNotEnoughReplicas if too few replicas remain in sync and the
+// context error if the context is done first.
+func (r *Replicas) WaitReplicated(ctx context.Context, offset uint64) error {
+	for {
+		now := time.Now()
+
+		r.mu.Lock()
+
+		if err := r.checkInSync(now); err != nil {
+			r.mu.Unlock()
+
+			return err
+		}
+
+		// The earliest time a replica that has not replicated the record yet
+		// drops from the in-sync replicas.
+		var dropAt time.Time
+
+		for _, rep := range r.replicas {
+			if r.inSync(rep, now) && rep.offset <= offset {
+				if at := rep.caughtUpAt.Add(r.lagMax); dropAt.IsZero() || at.Before(dropAt) {
+					dropAt = at
+				}
+			}
+		}
+
+		progressed := r.progressed
+		r.mu.Unlock()
+
+		if dropAt.IsZero() {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(dropAt) + time.Millisecond)
+
+		select {
+		case <-progressed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return fmt.Errorf("failed to wait for the replicas: %w", ctx.Err())
+		}
+
+		timer.Stop()
+	}
+}
+
+// Describe returns the status of the followers ordered by ID.
+func (r *Replicas) Describe() []ReplicaStatus {
+	end := r.log.EndOffset()
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]ReplicaStatus, 0, len(r.replicas))
+
+	for id, rep := range r.replicas {
+		status := ReplicaStatus{
+			ID:          id,
+			Offset:      rep.offset,
+			Lag:         0,
+			InSync:      r.inSync(rep, now),
+			LastFetchAt: rep.lastFetchAt,
+			CaughtUpAt:  rep.caughtUpAt,
+		}
+
+		if end > rep.offset {
+			status.Lag = end - rep.offset
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+
+	return statuses
+}
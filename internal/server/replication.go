@@ -0,0 +1,731 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/logwriter"
+	"github.com/ivanlemeshev/proglog/internal/raftstore"
+	"go.uber.org/zap"
+)
+
+// ErrNotLeader is returned if a replicated log is written on a node that is
+// not the Raft leader.
+var ErrNotLeader = fmt.Errorf("not the leader")
+
+// ErrNoLeader is returned if the Raft cluster of a replicated log has no
+// leader, so it does not accept records.
+var ErrNoLeader = fmt.Errorf("no leader")
+
+// ErrNotReplicated is returned if the membership of a log that is not
+// replicated is changed.
+var ErrNotReplicated = fmt.Errorf("log not replicated")
+
+// ErrInvalidRaftConfig is returned if the Raft node ID or address is missing.
+var ErrInvalidRaftConfig = fmt.Errorf("invalid raft config")
+
+// Timings of the replicated log.
+const (
+	applyTimeout        = 10 * time.Second // of a replicated command
+	transportTimeout    = 10 * time.Second // of a Raft RPC
+	transportMaxPool    = 3                // connections kept per peer
+	retainSnapshots     = 2
+	expireCheckInterval = time.Second // of the leader checking for expired transactions
+)
+
+// RaftPeer is a voting member of the Raft cluster.
+type RaftPeer struct {
+	ID   string
+	Addr string
+}
+
+// RaftConfig configures the Raft node of a replicated log. Zero timeouts and
+// snapshot settings use the Raft defaults.
+type RaftConfig struct {
+	// NodeID is the unique ID of the node in the cluster.
+	NodeID string
+
+	// Addr is the address the node listens on for Raft RPCs. Peers connect to
+	// it, so it must not be an unspecified address like ":7000".
+	Addr string
+
+	// Peers are all voting members of the cluster including this node. The
+	// cluster is bootstrapped with them when the node starts without Raft
+	// state. A node without peers bootstraps a single node cluster.
+	Peers []RaftPeer
+
+	// Join makes a node without Raft state wait until the leader of an
+	// existing cluster adds it instead of bootstrapping a cluster, for
+	// example when members are discovered by gossip. Peers are ignored.
+	Join bool
+
+	HeartbeatTimeout  time.Duration
+	ElectionTimeout   time.Duration
+	SnapshotInterval  time.Duration
+	SnapshotThreshold uint64
+}
+
+// replication is the Raft node of a replicated log.
+type replication struct {
+	log           *Log
+	raft          *raft.Raft
+	transport     *raft.NetworkTransport
+	logStore      *raftstore.LogStore
+	maxRecordSize uint64
+	logger        *zap.Logger
+	stopTicks     chan struct{}
+	ticksDone     chan struct{}
+	closeOnce     sync.Once
+	closeErr      error
+}
+
+// applyResult is the result of a command applied by the state machine.
+type applyResult struct {
+	offsets []uint64
+	err     error
+}
+
+// OpenReplicatedLog opens the log replicated by Raft. The Raft log, the Raft
+// state and the snapshots are kept in the directory, the Raft log in the store
+// file format. Appends and transaction changes are committed by a majority of
+// the cluster before they return, and only the leader accepts them. Every node
+// applies the committed commands to its log, so records can be read on every
+// node. The log is restored from the latest snapshot and the Raft log. The
+// records are kept by Raft rather than a store, so the store settings of the
+// configuration do not apply.
+func OpenReplicatedLog(dir string, config LogConfig, raftConfig RaftConfig) (*Log, error) {
+	if raftConfig.NodeID == "" || raftConfig.Addr == "" {
+		return nil, fmt.Errorf("%w: the node ID and the address are required", ErrInvalidRaftConfig)
+	}
+
+	if config.MaxRecordSize == 0 {
+		config.MaxRecordSize = store.MaxRecordLength
+	}
+
+	log := NewLog()
+	log.dir = dir
+
+	if config.Logger != nil {
+		log.logger = config.Logger
+	}
+
+	r := &replication{
+		log:           log,
+		raft:          nil,
+		transport:     nil,
+		logStore:      nil,
+		maxRecordSize: config.MaxRecordSize,
+		logger:        log.logger,
+		stopTicks:     make(chan struct{}),
+		ticksDone:     make(chan struct{}),
+		closeOnce:     sync.Once{},
+		closeErr:      nil,
+	}
+	log.replication = r
+
+	if err := r.open(dir, raftConfig); err != nil {
+		return nil, err
+	}
+
+	go r.abortExpiredTransactions()
+
+	return log, nil
+}
+
+// open starts the Raft node and bootstraps the cluster if the node has no
+// Raft state.
+func (r *replication) open(dir string, config RaftConfig) error { // nolint:funlen
+	logOutput := logwriter.New(r.logger.With(zap.String("component", "raft")))
+
+	// A batch command of one record of the maximum size is the longest
+	// command. Configurations are not limited by it.
+	logStore, err := raftstore.NewLogStore(dir, r.maxRecordSize+commandHeaderSize+batchOverhead)
+	if err != nil {
+		return fmt.Errorf("failed to open the raft log: %w", err)
+	}
+
+	stableStore, err := raftstore.NewStableStore(dir)
+	if err != nil {
+		_ = logStore.Close()
+
+		return fmt.Errorf("failed to open the raft stable store: %w", err)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, retainSnapshots, logOutput)
+	if err != nil {
+		_ = logStore.Close()
+
+		return fmt.Errorf("failed to open the raft snapshots: %w", err)
+	}
+
+	transport, err := raft.NewTCPTransport(config.Addr, nil, transportMaxPool, transportTimeout, logOutput)
+	if err != nil {
+		_ = logStore.Close()
+
+		return fmt.Errorf("failed to listen for raft: %w", err)
+	}
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(config.NodeID)
+	raftConfig.LogOutput = logOutput
+	raftConfig.LogLevel = "INFO"
+
+	if config.HeartbeatTimeout != 0 {
+		raftConfig.HeartbeatTimeout = config.HeartbeatTimeout
+		raftConfig.LeaderLeaseTimeout = config.HeartbeatTimeout
+	}
+
+	if config.ElectionTimeout != 0 {
+		raftConfig.ElectionTimeout = config.ElectionTimeout
+	}
+
+	if config.SnapshotInterval != 0 {
+		raftConfig.SnapshotInterval = config.SnapshotInterval
+	}
+
+	if config.SnapshotThreshold != 0 {
+		raftConfig.SnapshotThreshold = config.SnapshotThreshold
+	}
+
+	node, err := raft.NewRaft(raftConfig, &logFSM{log: r.log}, logStore, stableStore, snapshots, transport)
+	if err != nil {
+		_ = transport.Close()
+		_ = logStore.Close()
+
+		return fmt.Errorf("failed to start raft: %w", err)
+	}
+
+	r.raft = node
+	r.transport = transport
+	r.logStore = logStore
+
+	hasState, err := raft.HasExistingState(logStore, stableStore, snapshots)
+	if err != nil {
+		_ = r.shutdown()
+
+		return fmt.Errorf("failed to read the raft state: %w", err)
+	}
+
+	if !hasState && !config.Join {
+		if err := node.BootstrapCluster(bootstrapConfiguration(config)).Error(); err != nil {
+			_ = r.shutdown()
+
+			return fmt.Errorf("failed to bootstrap the raft cluster: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func bootstrapConfiguration(config RaftConfig) raft.Configuration {
+	peers := config.Peers
+	if len(peers) == 0 {
+		peers = []RaftPeer{{ID: config.NodeID, Addr: config.Addr}}
+	}
+
+	servers := make([]raft.Server, 0, len(peers))
+	for _, peer := range peers {
+		servers = append(servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(peer.ID),
+			Address:  raft.ServerAddress(peer.Addr),
+		})
+	}
+
+	return raft.Configuration{Servers: servers}
+}
+
+// submit replicates the command and waits until this node applies it.
+func (r *replication) submit(cmd command) ([]uint64, error) {
+	if cmd.kind == appendBatchCommand {
+		return r.submitBatch(cmd)
+	}
+
+	if err := validateHeaders(cmd.entry.record.Headers); err != nil {
+		return nil, err
+	}
+
+	cmd.time = time.Now()
+	b := encodeCommand(cmd)
+
+	if size := uint64(len(b) - commandHeaderSize); size > r.maxRecordSize {
+		return nil, fmt.Errorf("%w: max length is %d", store.ErrMaxRecordLength, r.maxRecordSize)
+	}
+
+	return r.apply(b)
+}
+
+// submitBatch replicates the batch in as many commands as it takes to keep
+// every command within the maximum record size. If a command fails, the
+// records of the commands before it stay appended, and a retry of the batch
+// appends only the rest.
+func (r *replication) submitBatch(cmd command) ([]uint64, error) {
+	sizes := make([]uint64, len(cmd.batch))
+
+	for i, e := range cmd.batch {
+		if err := validateHeaders(e.record.Headers); err != nil {
+			return nil, err
+		}
+
+		sizes[i] = batchEntrySizeLength + uint64(len(encodeEntry(e)))
+		if sizes[i]+batchFlagsLength > r.maxRecordSize+batchOverhead {
+			return nil, fmt.Errorf("%w: max length is %d", store.ErrMaxRecordLength, r.maxRecordSize)
+		}
+	}
+
+	var offsets []uint64
+
+	for batch := cmd.batch; len(batch) != 0; {
+		n, size := 1, uint64(batchFlagsLength)+sizes[0]
+		for n < len(batch) && size+sizes[n] <= r.maxRecordSize+batchOverhead {
+			size += sizes[n]
+			n++
+		}
+
+		part := cmd
+		part.time = time.Now()
+		part.batch = batch[:n]
+
+		appended, err := r.apply(encodeCommand(part))
+		if err != nil {
+			return nil, err
+		}
+
+		offsets = append(offsets, appended...)
+		sizes = sizes[n:]
+		batch = batch[n:]
+
+		// Only the first part may skip sequence numbers, the next ones
+		// follow it.
+		cmd.resume = false
+	}
+
+	return offsets, nil
+}
+
+// apply replicates the encoded command and waits until it is applied.
+func (r *replication) apply(b []byte) ([]uint64, error) {
+	future := r.raft.Apply(b, applyTimeout)
+	if err := future.Error(); err != nil {
+		switch {
+		case errors.Is(err, raft.ErrNotLeader):
+			return nil, fmt.Errorf("%w: the leader is %q", ErrNotLeader, r.raft.Leader())
+		case errors.Is(err, raft.ErrRaftShutdown):
+			return nil, ErrLogClosed
+		default:
+			return nil, fmt.Errorf("failed to replicate the command: %w", err)
+		}
+	}
+
+	result, ok := future.Response().(applyResult)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected result of the command", ErrCorruptRecord)
+	}
+
+	return result.offsets, result.err
+}
+
+// Join adds the node to the Raft cluster of the replicated log as a voter.
+// Only the leader changes the membership, other nodes return ErrNotLeader.
+// Joining a member again with the same address does nothing, a member with a
+// new address replaces the old one.
+func (c *Log) Join(id, addr string) error {
+	if c.replication == nil {
+		return ErrNotReplicated
+	}
+
+	r := c.replication
+
+	future := r.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return r.membershipError(err)
+	}
+
+	for _, server := range future.Configuration().Servers {
+		if server.ID != raft.ServerID(id) && server.Address != raft.ServerAddress(addr) {
+			continue
+		}
+
+		if server.ID == raft.ServerID(id) && server.Address == raft.ServerAddress(addr) {
+			return nil
+		}
+
+		if err := r.raft.RemoveServer(server.ID, 0, 0).Error(); err != nil {
+			return r.membershipError(err)
+		}
+	}
+
+	if err := r.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, 0).Error(); err != nil {
+		return r.membershipError(err)
+	}
+
+	r.logger.Info("Added the Raft voter", zap.String("node_id", id), zap.String("addr", addr))
+
+	return nil
+}
+
+// Leave removes the node from the Raft cluster of the replicated log. Only the
+// leader changes the membership, other nodes return ErrNotLeader. Removing a
+// node that is not a member does nothing.
+func (c *Log) Leave(id string) error {
+	if c.replication == nil {
+		return ErrNotReplicated
+	}
+
+	r := c.replication
+
+	future := r.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return r.membershipError(err)
+	}
+
+	member := false
+
+	for _, server := range future.Configuration().Servers {
+		member = member || server.ID == raft.ServerID(id)
+	}
+
+	if !member {
+		return nil
+	}
+
+	if err := r.raft.RemoveServer(raft.ServerID(id), 0, 0).Error(); err != nil {
+		return r.membershipError(err)
+	}
+
+	r.logger.Info("Removed the Raft voter", zap.String("node_id", id))
+
+	return nil
+}
+
+// LeaderAddr returns the Raft address of the current leader. It is empty if
+// the log is not replicated or the cluster has no leader.
+func (c *Log) LeaderAddr() string {
+	if c.replication == nil {
+		return ""
+	}
+
+	return string(c.replication.raft.Leader())
+}
+
+// leading reports whether the node is the Raft leader.
+func (r *replication) leading() bool {
+	return r.raft.State() == raft.Leader
+}
+
+// staleness returns the time since the leader last contacted the node, or
+// zero on the leader.
+func (r *replication) staleness() time.Duration {
+	if r.leading() {
+		return 0
+	}
+
+	lastContact := r.raft.LastContact()
+	if lastContact.IsZero() {
+		return math.MaxInt64
+	}
+
+	return time.Since(lastContact)
+}
+
+// membershipError maps the error of a membership change.
+func (r *replication) membershipError(err error) error {
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		return fmt.Errorf("%w: the leader is %q", ErrNotLeader, r.raft.Leader())
+	case errors.Is(err, raft.ErrRaftShutdown):
+		return ErrLogClosed
+	default:
+		return fmt.Errorf("failed to change the raft membership: %w", err)
+	}
+}
+
+// ready checks that the cluster has a leader.
+func (r *replication) ready() error {
+	if r.raft.Leader() == "" {
+		return ErrNoLeader
+	}
+
+	return nil
+}
+
+// abortExpiredTransactions makes the leader replicate the tick command when
+// transactions have expired, so every node aborts them at the same point of
+// the log.
+func (r *replication) abortExpiredTransactions() {
+	defer close(r.ticksDone)
+
+	ticker := time.NewTicker(expireCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if r.raft.State() != raft.Leader {
+				continue
+			}
+
+			r.log.mu.Lock()
+			expired := r.log.hasExpiredTransactions(time.Now())
+			r.log.mu.Unlock()
+
+			if !expired {
+				continue
+			}
+
+			if _, err := r.submit(command{kind: tickCommand}); err != nil { // nolint:exhaustivestruct
+				r.logger.Warn("Failed to abort expired transactions", zap.Error(err))
+			}
+		case <-r.stopTicks:
+			return
+		}
+	}
+}
+
+// close stops the Raft node and closes its files. Closing it again does
+// nothing.
+func (r *replication) close() error {
+	r.closeOnce.Do(func() {
+		close(r.stopTicks)
+		r.closeErr = r.shutdown()
+		<-r.ticksDone
+	})
+
+	return r.closeErr
+}
+
+func (r *replication) shutdown() error {
+	if err := r.raft.Shutdown().Error(); err != nil {
+		_ = r.transport.Close()
+		_ = r.logStore.Close()
+
+		return fmt.Errorf("failed to shut down raft: %w", err)
+	}
+
+	if err := r.transport.Close(); err != nil {
+		_ = r.logStore.Close()
+
+		return fmt.Errorf("failed to close the raft transport: %w", err)
+	}
+
+	if err := r.logStore.Close(); err != nil {
+		return fmt.Errorf("failed to close the raft log: %w", err)
+	}
+
+	return nil
+}
+
+// logFSM is the Raft state machine of a replicated log.
+type logFSM struct {
+	log *Log
+}
+
+// Apply executes a committed command.
+func (f *logFSM) Apply(l *raft.Log) interface{} {
+	if l.Type != raft.LogCommand {
+		return nil
+	}
+
+	cmd, err := decodeCommand(l.Data)
+	if err != nil {
+		return applyResult{offsets: nil, err: err}
+	}
+
+	offsets, err := f.log.execute(cmd)
+
+	return applyResult{offsets: offsets, err: err}
+}
+
+// Snapshot captures the records and the owners and deadlines of the open
+// transactions. The rest of the state is restored from the records.
+func (f *logFSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.log.mu.Lock()
+	defer f.log.mu.Unlock()
+
+	snapshot := &logSnapshot{
+		entries:      append([]entry(nil), f.log.entries...),
+		transactions: make(map[string]transaction, len(f.log.transactions)),
+	}
+
+	for producerID, txn := range f.log.transactions {
+		snapshot.transactions[producerID] = transaction{owner: txn.owner, offsets: nil, deadline: txn.deadline}
+	}
+
+	return snapshot, nil
+}
+
+// Restore replaces the log state with the snapshot.
+func (f *logFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close() // nolint:errcheck
+
+	scanner := store.NewScannerWithConfig(rc, store.Config{MaxRecordLength: math.MaxUint32}) // nolint:exhaustivestruct
+	if !scanner.Scan() {
+		return fmt.Errorf("failed to read the snapshot header: %w", scannerErr(scanner))
+	}
+
+	transactions, err := decodeTransactions(scanner.Frame().Record)
+	if err != nil {
+		return fmt.Errorf("failed to decode the snapshot header: %w", err)
+	}
+
+	c := f.log
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	c.producers = make(map[string]producer)
+	c.transactions = make(map[string]*transaction)
+	c.groupOffsets = make(map[string]map[uint32]uint64)
+
+	for scanner.Scan() {
+		e, err := decodeEntry(scanner.Frame().Record)
+		if err != nil {
+			return fmt.Errorf("failed to decode the snapshot record %d: %w", len(c.entries), err)
+		}
+
+		e.record.Offset = uint64(len(c.entries))
+		// Every open transaction is in the header, which sets its deadline.
+		c.apply(e, time.Time{})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the snapshot: %w", err)
+	}
+
+	for producerID, open := range transactions {
+		if txn, ok := c.transactions[producerID]; ok {
+			txn.owner = open.owner
+			txn.deadline = open.deadline
+
+			continue
+		}
+
+		// The transaction has no records yet.
+		c.transactions[producerID] = newTransaction(open.owner, open.deadline, 0)
+	}
+
+	return nil
+}
+
+func scannerErr(scanner *store.Scanner) error {
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+// logSnapshot is a snapshot of a replicated log. It is persisted in the store
+// file format: a header record with the owners and deadlines of the open
+// transactions followed by the records of the log.
+type logSnapshot struct {
+	entries      []entry
+	transactions map[string]transaction
+}
+
+// Persist writes the snapshot to the sink.
+func (s *logSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.write(sink); err != nil {
+		_ = sink.Cancel()
+
+		return err
+	}
+
+	if err := sink.Close(); err != nil {
+		return fmt.Errorf("failed to close the snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (s *logSnapshot) write(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+
+	if err := writeFrame(buf, encodeTransactions(s.transactions)); err != nil {
+		return fmt.Errorf("failed to write the snapshot header: %w", err)
+	}
+
+	for _, e := range s.entries {
+		if err := writeFrame(buf, encodeEntry(e)); err != nil {
+			return fmt.Errorf("failed to write the snapshot record %d: %w", e.record.Offset, err)
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write the snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Release does nothing, the snapshot holds no resources.
+func (s *logSnapshot) Release() {}
+
+func writeFrame(w io.Writer, b []byte) error {
+	size := make([]byte, store.RecordSizeLength)
+	binary.BigEndian.PutUint64(size, uint64(len(b)))
+
+	if _, err := w.Write(size); err != nil {
+		return err // nolint:wrapcheck
+	}
+
+	_, err := w.Write(b)
+
+	return err // nolint:wrapcheck
+}
+
+// Open transactions are encoded as the length-prefixed producer ID, the
+// deadline in Unix nanoseconds and the length-prefixed owner.
+const deadlineLength = 8
+
+func encodeTransactions(transactions map[string]transaction) []byte {
+	var b bytes.Buffer
+
+	for producerID, txn := range transactions {
+		field := make([]byte, producerIDSizeLength+len(producerID)+deadlineLength+ownerSizeLength+len(txn.owner))
+		n := putHeaderString(field, producerID)
+		binary.BigEndian.PutUint64(field[n:], uint64(txn.deadline.UnixNano()))
+		putHeaderString(field[n+deadlineLength:], txn.owner)
+		b.Write(field)
+	}
+
+	return b.Bytes()
+}
+
+func decodeTransactions(b []byte) (map[string]transaction, error) {
+	transactions := make(map[string]transaction)
+
+	for len(b) > 0 {
+		producerID, n, err := headerString(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(b) < n+deadlineLength {
+			return nil, ErrCorruptRecord
+		}
+
+		deadline := time.Unix(0, int64(binary.BigEndian.Uint64(b[n:])))
+		b = b[n+deadlineLength:]
+
+		owner, n, err := headerString(b)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions[producerID] = transaction{owner: owner, offsets: nil, deadline: deadline}
+		b = b[n:]
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,294 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicatedLog(t *testing.T) { // nolint:funlen
+	peers := make([]server.RaftPeer, 3)
+	dirs := make([]string, len(peers))
+
+	for i := range peers {
+		peers[i] = server.RaftPeer{ID: fmt.Sprintf("node-%d", i), Addr: freeAddr(t)}
+		dirs[i] = t.TempDir()
+	}
+
+	open := func(i int) *server.Log {
+		l, err := server.OpenReplicatedLog(dirs[i], server.LogConfig{}, server.RaftConfig{ // nolint:exhaustivestruct
+			NodeID:            peers[i].ID,
+			Addr:              peers[i].Addr,
+			Peers:             peers,
+			HeartbeatTimeout:  50 * time.Millisecond,
+			ElectionTimeout:   50 * time.Millisecond,
+			SnapshotInterval:  50 * time.Millisecond,
+			SnapshotThreshold: 4,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return l
+	}
+
+	logs := make([]*server.Log, len(peers))
+	for i := range peers {
+		logs[i] = open(i)
+		defer logs[i].Close() // nolint:errcheck
+	}
+
+	leader := appendToLeader(t, logs, []byte("first"))
+
+	for i, l := range logs {
+		if i == leader {
+			continue
+		}
+
+		_, err := l.Append([]byte("follower"))
+		assert.ErrorIs(t, err, server.ErrNotLeader)
+	}
+
+	assert.Nil(t, logs[leader].BeginTransaction("producer", "app", 0))
+	_, err := logs[leader].AppendTransactional("producer", "app", []byte("transactional"))
+	assert.Nil(t, err)
+	_, err = logs[leader].AppendIdempotent("idempotent", 1, []byte("idempotent"))
+	assert.Nil(t, err)
+	_, err = logs[leader].AppendIdempotent("idempotent", 3, []byte("gap"))
+	assert.ErrorIs(t, err, server.ErrOutOfOrderSequence)
+
+	commit, err := logs[leader].CommitTransaction("producer", "app")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), commit)
+
+	for _, l := range logs {
+		assertRecords(t, l, "first", "transactional", "idempotent")
+	}
+
+	// The remaining majority elects a new leader that accepts records.
+	assert.Nil(t, logs[leader].Close())
+
+	remaining := make([]*server.Log, 0, len(logs)-1)
+	for i, l := range logs {
+		if i != leader {
+			remaining = append(remaining, l)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		appendToLeader(t, remaining, []byte(fmt.Sprintf("record-%d", i)))
+	}
+
+	for _, l := range remaining {
+		assertRecords(t, l, "first", "transactional", "idempotent", "record-0", "record-1", "record-2", "record-3")
+	}
+
+	snapshots, err := ioutil.ReadDir(filepath.Join(dirs[(leader+1)%len(dirs)], "snapshots"))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, snapshots)
+
+	// The old leader restores its log from its snapshot and Raft log and
+	// catches up with the records committed without it.
+	logs[leader] = open(leader)
+	defer logs[leader].Close() // nolint:errcheck
+
+	assertRecords(t, logs[leader], "first", "transactional", "idempotent", "record-0", "record-1", "record-2", "record-3")
+}
+
+// appendToLeader appends the record on the node that accepts it.
+func appendToLeader(t *testing.T, logs []*server.Log, value []byte) int {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for time.Now().Before(deadline) {
+		for i, l := range logs {
+			_, err := l.Append(value)
+			if err == nil {
+				return i
+			}
+
+			if !errors.Is(err, server.ErrNotLeader) {
+				t.Logf("Append on node %d: %v", i, err)
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatal("no leader accepted the record")
+
+	return 0
+}
+
+// assertRecords waits until the log has the records.
+func assertRecords(t *testing.T, l *server.Log, values ...string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	offset := uint64(0)
+
+	for _, value := range values {
+		record, err := l.ReadWait(ctx, offset, server.ReadCommitted)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		assert.Equal(t, value, string(record.Value))
+		offset = record.Offset + 1
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close() // nolint:errcheck
+
+	return listener.Addr().String()
+}
+
+func TestReplicatedLog_ExpiredTransaction(t *testing.T) {
+	dir := t.TempDir()
+	config := server.RaftConfig{ // nolint:exhaustivestruct
+		NodeID:           "node",
+		Addr:             freeAddr(t),
+		HeartbeatTimeout: 50 * time.Millisecond,
+		ElectionTimeout:  50 * time.Millisecond,
+	}
+
+	l, err := server.OpenReplicatedLog(dir, server.LogConfig{}, config) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	appendToLeader(t, []*server.Log{l}, []byte("first"))
+	assert.Nil(t, l.BeginTransaction("producer", "app", 100*time.Millisecond))
+	_, err = l.AppendTransactional("producer", "app", []byte("aborted"))
+	assert.Nil(t, err)
+	_, err = l.Append([]byte("second"))
+	assert.Nil(t, err)
+
+	// The leader aborts the expired transaction, so the next record becomes
+	// visible to read committed consumers.
+	assertRecords(t, l, "first", "second")
+
+	_, err = l.CommitTransaction("producer", "app")
+	assert.ErrorIs(t, err, server.ErrNoTransaction)
+}
+
+func TestReplicatedLog_Batch(t *testing.T) {
+	dir := t.TempDir()
+	config := server.RaftConfig{ // nolint:exhaustivestruct
+		NodeID:           "node",
+		Addr:             freeAddr(t),
+		HeartbeatTimeout: 50 * time.Millisecond,
+		ElectionTimeout:  50 * time.Millisecond,
+	}
+
+	l, err := server.OpenReplicatedLog(dir, server.LogConfig{MaxRecordSize: 64}, config) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	appendToLeader(t, []*server.Log{l}, []byte("first"))
+
+	// The batch is longer than a record may be, so it is replicated in
+	// parts.
+	records := make([]server.Record, 10)
+	values := []string{"first"}
+
+	for i := range records {
+		records[i] = server.Record{Value: []byte(fmt.Sprintf("record-%d", i))}
+		values = append(values, string(records[i].Value))
+	}
+
+	offsets, err := l.AppendBatch("producer", 0, false, records)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, offsets)
+
+	retry, err := l.AppendBatch("producer", 0, false, records)
+	assert.Nil(t, err)
+	assert.Equal(t, offsets, retry)
+
+	_, err = l.AppendBatch("producer", 10, false, []server.Record{{Value: make([]byte, 64)}})
+	assert.ErrorIs(t, err, store.ErrMaxRecordLength)
+
+	assertRecords(t, l, values...)
+}
+
+func TestOpenReplicatedLog_Config(t *testing.T) {
+	t.Parallel()
+
+	_, err := server.OpenReplicatedLog(t.TempDir(), server.LogConfig{}, server.RaftConfig{}) // nolint:exhaustivestruct
+	assert.ErrorIs(t, err, server.ErrInvalidRaftConfig)
+}
+
+func TestReplicatedLog_Membership(t *testing.T) {
+	logs := make([]*server.Log, 3)
+	ids := make([]string, len(logs))
+	addrs := make([]string, len(logs))
+
+	for i := range logs {
+		ids[i] = fmt.Sprintf("node-%d", i)
+		addrs[i] = freeAddr(t)
+
+		l, err := server.OpenReplicatedLog(t.TempDir(), server.LogConfig{}, server.RaftConfig{ // nolint:exhaustivestruct
+			NodeID:           ids[i],
+			Addr:             addrs[i],
+			Join:             i != 0,
+			HeartbeatTimeout: 50 * time.Millisecond,
+			ElectionTimeout:  50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer l.Close() // nolint:errcheck
+
+		logs[i] = l
+	}
+
+	// The first node bootstraps a single node cluster, the others wait to be
+	// added by its leader.
+	appendToLeader(t, logs[:1], []byte("first"))
+
+	for i := 1; i < len(logs); i++ {
+		assert.Nil(t, logs[0].Join(ids[i], addrs[i]))
+		assert.Nil(t, logs[0].Join(ids[i], addrs[i]))
+	}
+
+	_, err := logs[0].Append([]byte("second"))
+	assert.Nil(t, err)
+
+	for _, l := range logs {
+		assertRecords(t, l, "first", "second")
+	}
+
+	assert.ErrorIs(t, logs[1].Join("node-3", "127.0.0.1:1"), server.ErrNotLeader)
+	assert.ErrorIs(t, logs[1].Leave(ids[2]), server.ErrNotLeader)
+
+	assert.Nil(t, logs[0].Leave(ids[2]))
+	assert.Nil(t, logs[0].Leave(ids[2]))
+
+	_, err = logs[0].Append([]byte("third"))
+	assert.Nil(t, err)
+	assertRecords(t, logs[1], "first", "second", "third")
+
+	assert.ErrorIs(t, server.NewLog().Join("node", "127.0.0.1:1"), server.ErrNotReplicated)
+}
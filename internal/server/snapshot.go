@@ -0,0 +1,723 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+)
+
+// ErrNotPersisted is returned if a snapshot is taken of a log that is not
+// persisted in a store file.
+var ErrNotPersisted = fmt.Errorf("log not persisted")
+
+// ErrSnapshotExists is returned if the snapshot directory is not empty, or
+// the log directory to restore into already has a log.
+var ErrSnapshotExists = fmt.Errorf("snapshot exists")
+
+// ErrInvalidSnapshot is returned if the manifest of a snapshot cannot be read
+// or does not match the files: a checksum, a size or the number of records
+// differs, or a record is corrupt.
+var ErrInvalidSnapshot = fmt.Errorf("invalid snapshot")
+
+// snapshotManifestFileName is the name of the manifest in the snapshot
+// directory. It is written last, so a snapshot without it is incomplete.
+const snapshotManifestFileName = "manifest.json"
+
+// snapshotManifestVersion is the version of the manifest format. Snapshots
+// of this version have the segment files and the eviction checkpoint.
+const snapshotManifestVersion = 2
+
+// singleFileSnapshotVersion is the version of the snapshots that have a
+// single store file. They are still verified and restored.
+const singleFileSnapshotVersion = 1
+
+// snapshotRestoreDirPrefix is the prefix of the temporary directory in the log
+// directory the snapshot is restored into.
+const snapshotRestoreDirPrefix = ".restore-"
+
+// SnapshotManifest describes a point-in-time snapshot of the log. The records
+// before LowestOffset were evicted from the local store before the snapshot
+// was taken, they are read from the uploaded segments of TierSegments.
+type SnapshotManifest struct {
+	Version          int            `json:"version"`
+	CreatedAt        time.Time      `json:"created_at"`
+	LowestOffset     uint64         `json:"lowest_offset"`
+	EndOffset        uint64         `json:"end_offset"`
+	LastStableOffset uint64         `json:"last_stable_offset"`
+	Files            []SnapshotFile `json:"files"`
+	TierSegments     []TierSegment  `json:"tier_segments,omitempty"`
+}
+
+// SnapshotFile is a file of the snapshot with its size and SHA-256 checksum.
+type SnapshotFile struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Snapshot snapshots the records appended so far into the directory and
+// writes the manifest with the offsets and the checksums of the files. The
+// active segment of the store is sealed first, and the sealed segments, which
+// do not change anymore, are hardlinked into the directory, or copied if they
+// cannot be linked, so records can be appended while the snapshot is taken.
+// If records have been evicted to a tier, the eviction checkpoint is copied
+// too, and the uploaded segments with the evicted records are listed in the
+// manifest by their keys. The directory must not exist or be empty. The
+// snapshot is written into a temporary directory next to it and renamed once
+// it is complete, so a failed snapshot leaves nothing behind and can be
+// retried with the same name.
+func (c *Log) Snapshot(dir string) (SnapshotManifest, error) {
+	c.mu.Lock()
+	persisted := c.store != nil
+	c.mu.Unlock()
+
+	if !persisted {
+		return SnapshotManifest{}, ErrNotPersisted
+	}
+
+	tmp, err := createSnapshotDir(dir)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	manifest, err := c.writeSnapshot(tmp)
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+
+		return SnapshotManifest{}, err
+	}
+
+	// An empty directory is replaced, rename does not replace it on every
+	// platform.
+	if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = os.RemoveAll(tmp)
+
+		return SnapshotManifest{}, fmt.Errorf("failed to replace the snapshot directory: %w", err)
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.RemoveAll(tmp)
+
+		return SnapshotManifest{}, fmt.Errorf("failed to rename the snapshot directory: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// snapshotSegment is a sealed segment taken into a snapshot. It is linked
+// into the snapshot directory, or its file is kept open to be copied, so the
+// segment can be evicted meanwhile.
+type snapshotSegment struct {
+	name string
+	size uint64
+	file *os.File // nil if the segment is linked
+}
+
+// writeSnapshot takes the segments and the eviction checkpoint of the log
+// into the directory and writes the manifest.
+func (c *Log) writeSnapshot(dir string) (SnapshotManifest, error) {
+	manifest, segments, checkpoint, err := c.takeSnapshot(dir)
+
+	defer func() {
+		for _, segment := range segments {
+			if segment.file != nil {
+				_ = segment.file.Close()
+			}
+		}
+	}()
+
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	manifest.Files = make([]SnapshotFile, 0, len(segments)+1)
+
+	for _, segment := range segments {
+		var file SnapshotFile
+
+		if segment.file != nil {
+			file, err = copyFile(filepath.Join(dir, segment.name), segment.file)
+		} else {
+			file, err = checksumFile(filepath.Join(dir, segment.name))
+		}
+
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+
+		if file.Size != segment.size {
+			return SnapshotManifest{}, fmt.Errorf("failed to snapshot the segment %s: it has %d of %d bytes",
+				segment.name, file.Size, segment.size)
+		}
+
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	if checkpoint != nil {
+		file, err := copyFile(filepath.Join(dir, evictionFileName), bytes.NewReader(checkpoint))
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	if manifest.LowestOffset != 0 {
+		if manifest.TierSegments, err = c.evictedTierSegments(manifest.LowestOffset); err != nil {
+			return SnapshotManifest{}, err
+		}
+	}
+
+	if err := writeManifest(dir, manifest); err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// takeSnapshot seals the active segment and links the sealed segments into
+// the directory while no record is appended or evicted. The active segment is
+// empty then, it is created empty in the directory, so the restored log
+// continues at its position. It returns the manifest without the files, the
+// segments and the eviction checkpoint if records have been evicted.
+func (c *Log) takeSnapshot(dir string) (SnapshotManifest, []snapshotSegment, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.store.Roll(); err != nil {
+		return SnapshotManifest{}, nil, nil, fmt.Errorf("failed to seal the log store: %w", err)
+	}
+
+	manifest := SnapshotManifest{
+		Version:          snapshotManifestVersion,
+		CreatedAt:        time.Now().UTC(),
+		LowestOffset:     c.start,
+		EndOffset:        c.endOffset(),
+		LastStableOffset: c.lastStableOffset(),
+		Files:            nil,
+		TierSegments:     nil,
+	}
+
+	var checkpoint []byte
+
+	if c.start != 0 {
+		var err error
+
+		if checkpoint, err = ioutil.ReadFile(filepath.Join(c.dir, evictionFileName)); err != nil {
+			return SnapshotManifest{}, nil, nil, fmt.Errorf("failed to read the eviction checkpoint: %w", err)
+		}
+	}
+
+	local := c.store.Segments()
+	segments := make([]snapshotSegment, 0, len(local))
+
+	for i, seg := range local {
+		name := filepath.Base(seg.Name)
+
+		if i == len(local)-1 {
+			segments = append(segments, snapshotSegment{name: name, size: 0, file: nil})
+
+			if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil { // nolint:gomnd
+				return SnapshotManifest{}, segments, nil, fmt.Errorf("failed to create the active segment: %w", err)
+			}
+
+			break
+		}
+
+		if err := os.Link(seg.Name, filepath.Join(dir, name)); err == nil {
+			segments = append(segments, snapshotSegment{name: name, size: seg.Size, file: nil})
+
+			continue
+		}
+
+		// The backup directory may be on another file system.
+		file, err := os.Open(seg.Name)
+		if err != nil {
+			return SnapshotManifest{}, segments, nil, fmt.Errorf("failed to open the segment %s: %w", seg.Name, err)
+		}
+
+		segments = append(segments, snapshotSegment{name: name, size: seg.Size, file: file})
+	}
+
+	return manifest, segments, checkpoint, nil
+}
+
+// evictedTierSegments returns the uploaded segments with the records before
+// the offset. The uploaded segments do not change, and the evicted records
+// are uploaded before they are evicted, so they are listed by the tier
+// manifest in the log directory.
+func (c *Log) evictedTierSegments(offset uint64) ([]TierSegment, error) {
+	uploaded, err := readTierManifest(filepath.Join(c.dir, tierManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []TierSegment
+
+	for _, segment := range uploaded.Segments {
+		if segment.BaseOffset < offset {
+			segments = append(segments, segment)
+		}
+	}
+
+	if err := checkTierSegments(segments, offset); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOffsetEvicted, err) // nolint:errorlint
+	}
+
+	return segments, nil
+}
+
+// checkTierSegments checks that the uploaded segments have the records from
+// the first one up to the offset without gaps.
+func checkTierSegments(segments []TierSegment, offset uint64) error {
+	var end uint64
+
+	for _, segment := range segments {
+		if segment.BaseOffset != end || segment.Key == "" {
+			return fmt.Errorf("the records from %d are not uploaded", end)
+		}
+
+		end = segment.EndOffset
+	}
+
+	if end != offset {
+		return fmt.Errorf("the records from %d to %d are not uploaded", end, offset)
+	}
+
+	return nil
+}
+
+// RestoreSnapshot rebuilds the log directory from the snapshot. It verifies
+// the size and the checksum of every file and the records of the store files
+// against the manifest, and refuses to restore a snapshot that does not
+// match with ErrInvalidSnapshot. The files are copied, so the snapshot does
+// not change when records are appended to the restored log. The uploaded
+// segments of the evicted records are written to the tier manifest of the
+// log, which reads them once the tier is started with the same object store.
+// The log directory must not have a log.
+func RestoreSnapshot(snapshotDir, logDir string) (SnapshotManifest, error) {
+	manifest, err := VerifySnapshot(snapshotDir)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	for _, name := range []string{storeFileName, segmentsDirName, evictionFileName, tierManifestFileName} {
+		if _, err := os.Stat(filepath.Join(logDir, name)); err == nil {
+			return SnapshotManifest{}, fmt.Errorf("%w: %s", ErrSnapshotExists, filepath.Join(logDir, name))
+		}
+	}
+
+	if err := os.MkdirAll(logDir, 0700); err != nil { // nolint:gomnd
+		return SnapshotManifest{}, fmt.Errorf("failed to create the log directory: %w", err)
+	}
+
+	tmp, err := ioutil.TempDir(logDir, snapshotRestoreDirPrefix)
+	if err != nil {
+		return SnapshotManifest{}, fmt.Errorf("failed to create the log directory: %w", err)
+	}
+	defer os.RemoveAll(tmp) // nolint:errcheck
+
+	names, err := restoreFiles(snapshotDir, tmp, manifest)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	for i, name := range names {
+		if err := os.Rename(filepath.Join(tmp, name), filepath.Join(logDir, name)); err != nil {
+			for _, restored := range names[:i] {
+				_ = os.RemoveAll(filepath.Join(logDir, restored))
+			}
+
+			return SnapshotManifest{}, fmt.Errorf("failed to restore the log: %w", err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// restoreFiles copies the files of the snapshot into the directory in the
+// layout of a log directory and writes the tier manifest. It returns the
+// names of the files and directories to move into the log directory, the
+// store last, so a log directory without it has no restored log.
+func restoreFiles(snapshotDir, dir string, manifest SnapshotManifest) ([]string, error) {
+	var names []string
+
+	if len(manifest.TierSegments) != 0 {
+		b, err := json.MarshalIndent(tierManifest{Segments: manifest.TierSegments}, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the tier manifest: %w", err)
+		}
+
+		if err := writeFileAtomic(filepath.Join(dir, tierManifestFileName), b); err != nil {
+			return nil, err
+		}
+
+		names = append(names, tierManifestFileName)
+	}
+
+	last := storeFileName
+	if manifest.Version != singleFileSnapshotVersion {
+		last = segmentsDirName
+
+		if err := os.Mkdir(filepath.Join(dir, segmentsDirName), 0700); err != nil { // nolint:gomnd
+			return nil, fmt.Errorf("failed to create the segments directory: %w", err)
+		}
+	}
+
+	for _, expected := range manifest.Files {
+		target := filepath.Join(dir, expected.Name)
+		if _, ok := store.ParseSegmentName(expected.Name); ok {
+			target = filepath.Join(dir, segmentsDirName, expected.Name)
+		}
+
+		if err := restoreFile(filepath.Join(snapshotDir, expected.Name), target, expected); err != nil {
+			return nil, err
+		}
+
+		if expected.Name == evictionFileName {
+			names = append(names, evictionFileName)
+		}
+	}
+
+	return append(names, last), nil
+}
+
+// restoreFile copies the snapshot file and checks the copy again, so a file
+// changed after the verification is not restored.
+func restoreFile(name, target string, expected SnapshotFile) error {
+	src, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return fmt.Errorf("failed to open the snapshot file: %w", err)
+	}
+	defer src.Close() // nolint:errcheck
+
+	file, err := copyFile(target, src)
+	if err != nil {
+		return err
+	}
+
+	if file != expected {
+		return fmt.Errorf("%w: the file %s changed while it was restored", ErrInvalidSnapshot, file.Name)
+	}
+
+	return nil
+}
+
+// VerifySnapshot reads the manifest of the snapshot and verifies the size and
+// the checksum of every file, the records of the store files and the
+// eviction checkpoint.
+func VerifySnapshot(dir string) (SnapshotManifest, error) {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	var (
+		records  uint64
+		position uint64
+		first    = true
+	)
+
+	for _, expected := range manifest.Files {
+		name := filepath.Join(dir, expected.Name)
+
+		file, err := checksumFile(name)
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+
+		if file != expected {
+			return SnapshotManifest{}, fmt.Errorf("%w: the file %s has %d bytes with checksum %s, the manifest has %d bytes with %s",
+				ErrInvalidSnapshot, file.Name, file.Size, file.SHA256, expected.Size, expected.SHA256)
+		}
+
+		if !isSegmentFile(manifest, expected.Name) {
+			continue
+		}
+
+		// The segments follow each other without gaps.
+		if start, ok := store.ParseSegmentName(expected.Name); ok {
+			if !first && start != position {
+				return SnapshotManifest{}, fmt.Errorf("%w: the segment %s starts at %d, the previous one ends at %d",
+					ErrInvalidSnapshot, expected.Name, start, position)
+			}
+
+			position, first = start+file.Size, false
+		}
+
+		n, err := countRecords(name, file.Size)
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+
+		records += n
+	}
+
+	if records != manifest.EndOffset-manifest.LowestOffset {
+		return SnapshotManifest{}, fmt.Errorf("%w: the store has %d records, the manifest has offsets %d to %d",
+			ErrInvalidSnapshot, records, manifest.LowestOffset, manifest.EndOffset)
+	}
+
+	if err := verifyEviction(dir, manifest); err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// verifyEviction checks that the eviction checkpoint of the snapshot matches
+// the lowest offset and the first segment, and that the uploaded segments
+// have the evicted records.
+func verifyEviction(dir string, manifest SnapshotManifest) error {
+	if manifest.LowestOffset == 0 {
+		return nil
+	}
+
+	if err := checkTierSegments(manifest.TierSegments, manifest.LowestOffset); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err) // nolint:errorlint
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, evictionFileName))
+	if err != nil {
+		return fmt.Errorf("%w: the eviction checkpoint: %v", ErrInvalidSnapshot, err) // nolint:errorlint
+	}
+
+	var checkpoint evictionCheckpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return fmt.Errorf("%w: the eviction checkpoint: %v", ErrInvalidSnapshot, err) // nolint:errorlint
+	}
+
+	position, _ := store.ParseSegmentName(manifest.Files[0].Name)
+
+	if checkpoint.EndOffset != manifest.LowestOffset || checkpoint.Position != position {
+		return fmt.Errorf("%w: the eviction checkpoint ends at %d and %d, the snapshot starts at %d and %d",
+			ErrInvalidSnapshot, checkpoint.EndOffset, checkpoint.Position, manifest.LowestOffset, position)
+	}
+
+	return nil
+}
+
+// isSegmentFile reports whether the snapshot file has records of the store.
+func isSegmentFile(manifest SnapshotManifest, name string) bool {
+	if manifest.Version == singleFileSnapshotVersion {
+		return name == storeFileName
+	}
+
+	_, ok := store.ParseSegmentName(name)
+
+	return ok
+}
+
+// createSnapshotDir creates the temporary directory the snapshot is written
+// into next to the snapshot directory. It returns ErrSnapshotExists if the
+// snapshot directory has files.
+func createSnapshotDir(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read the snapshot directory: %w", err)
+	}
+
+	if len(files) != 0 {
+		return "", fmt.Errorf("%w: %s is not empty", ErrSnapshotExists, dir)
+	}
+
+	parent := filepath.Dir(filepath.Clean(dir))
+	if err := os.MkdirAll(parent, 0700); err != nil { // nolint:gomnd
+		return "", fmt.Errorf("failed to create the snapshot directory: %w", err)
+	}
+
+	tmp, err := ioutil.TempDir(parent, "."+filepath.Base(dir)+".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the snapshot directory: %w", err)
+	}
+
+	return tmp, nil
+}
+
+// copyFile copies the reader into a new file, syncs it and returns its size
+// and checksum.
+func copyFile(name string, r io.Reader) (SnapshotFile, error) {
+	file, err := os.OpenFile(filepath.Clean(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // nolint:gomnd
+	if err != nil {
+		return SnapshotFile{}, fmt.Errorf("failed to create the file: %w", err)
+	}
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		_ = file.Close()
+
+		return SnapshotFile{}, fmt.Errorf("failed to copy the file: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return SnapshotFile{}, fmt.Errorf("failed to sync the file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return SnapshotFile{}, fmt.Errorf("failed to close the file: %w", err)
+	}
+
+	return SnapshotFile{
+		Name:   filepath.Base(name),
+		Size:   uint64(size),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// checksumFile returns the size and the checksum of the file.
+func checksumFile(name string) (SnapshotFile, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return SnapshotFile{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err) // nolint:errorlint
+	}
+	defer file.Close() // nolint:errcheck
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return SnapshotFile{}, fmt.Errorf("failed to read the snapshot file: %w", err)
+	}
+
+	return SnapshotFile{
+		Name:   filepath.Base(name),
+		Size:   uint64(size),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// countRecords decodes the records of the store file, which verifies their
+// checksums, and returns their number.
+func countRecords(name string, size uint64) (uint64, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open the snapshot file: %w", err)
+	}
+	defer file.Close() // nolint:errcheck
+
+	// No record is longer than the file.
+	scanner := store.NewScannerWithConfig(file, store.Config{ // nolint:exhaustivestruct
+		MaxRecordLength: size,
+	})
+
+	var records uint64
+
+	for scanner.Scan() {
+		if _, err := decodeEntry(scanner.Frame().Record); err != nil {
+			return 0, fmt.Errorf("%w: the record at %d: %v", ErrInvalidSnapshot, scanner.Frame().Position, err) // nolint:errorlint
+		}
+
+		records++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err) // nolint:errorlint
+	}
+
+	return records, nil
+}
+
+// writeManifest writes the manifest into the snapshot directory atomically.
+func writeManifest(dir string, manifest SnapshotManifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the manifest: %w", err)
+	}
+
+	tmp := filepath.Join(dir, snapshotManifestFileName+".tmp")
+
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil { // nolint:gomnd
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(dir, snapshotManifestFileName)); err != nil {
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+
+	return nil
+}
+
+// readManifest reads and checks the manifest of the snapshot.
+func readManifest(dir string) (SnapshotManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, snapshotManifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return SnapshotManifest{}, fmt.Errorf("%w: %s has no manifest", ErrInvalidSnapshot, dir)
+	}
+
+	if err != nil {
+		return SnapshotManifest{}, fmt.Errorf("failed to read the manifest: %w", err)
+	}
+
+	var manifest SnapshotManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return SnapshotManifest{}, fmt.Errorf("%w: the manifest: %v", ErrInvalidSnapshot, err) // nolint:errorlint
+	}
+
+	switch {
+	case manifest.Version != snapshotManifestVersion && manifest.Version != singleFileSnapshotVersion:
+		return SnapshotManifest{}, fmt.Errorf("%w: the manifest version %d", ErrInvalidSnapshot, manifest.Version)
+	case manifest.Version == singleFileSnapshotVersion &&
+		(len(manifest.Files) != 1 || manifest.Files[0].Name != storeFileName):
+		return SnapshotManifest{}, fmt.Errorf("%w: the manifest must list only %s", ErrInvalidSnapshot, storeFileName)
+	case manifest.EndOffset < manifest.LowestOffset:
+		return SnapshotManifest{}, fmt.Errorf("%w: the end offset %d is before the lowest offset %d",
+			ErrInvalidSnapshot, manifest.EndOffset, manifest.LowestOffset)
+	}
+
+	if manifest.Version == snapshotManifestVersion {
+		if err := checkSnapshotFiles(manifest); err != nil {
+			return SnapshotManifest{}, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// checkSnapshotFiles checks that the manifest lists the segment files in the
+// order of their positions, starting with one, and the eviction checkpoint
+// only if records have been evicted. The names cannot refer to other
+// directories.
+func checkSnapshotFiles(manifest SnapshotManifest) error {
+	var (
+		segments   int
+		checkpoint bool
+	)
+
+	for _, file := range manifest.Files {
+		_, ok := store.ParseSegmentName(file.Name)
+
+		switch {
+		case ok && !checkpoint && filepath.Base(file.Name) == file.Name:
+			segments++
+		case file.Name == evictionFileName && !checkpoint:
+			checkpoint = true
+		default:
+			return fmt.Errorf("%w: the manifest lists the file %s out of order", ErrInvalidSnapshot, file.Name)
+		}
+	}
+
+	if segments == 0 {
+		return fmt.Errorf("%w: the manifest lists no segment", ErrInvalidSnapshot)
+	}
+
+	if checkpoint != (manifest.LowestOffset != 0) {
+		return fmt.Errorf("%w: the manifest must list %s only if the records before %d are evicted",
+			ErrInvalidSnapshot, evictionFileName, manifest.LowestOffset)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// SnapshotRequest is a request to snapshot the log into the named directory
+// of the backup directory.
+type SnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+type snapshotHandler struct {
+	log *Log
+	dir string
+}
+
+// NewSnapshotHandler creates a new handler function that snapshots the log
+// into a new directory of the backup directory.
+func NewSnapshotHandler(log *Log, dir string) http.HandlerFunc {
+	handler := &snapshotHandler{
+		log: log,
+		dir: dir,
+	}
+
+	return handler.snapshot
+}
+
+func (h *snapshotHandler) snapshot(w http.ResponseWriter, r *http.Request) {
+	var request SnapshotRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || !validSnapshotName(request.Name) {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	manifest, err := h.log.Snapshot(filepath.Join(h.dir, request.Name))
+
+	switch {
+	case errors.Is(err, ErrSnapshotExists):
+		writeErrorResponse(w, http.StatusConflict, "Snapshot exists")
+	case errors.Is(err, ErrNotPersisted):
+		writeErrorResponse(w, http.StatusBadRequest, "Log not persisted")
+	case errors.Is(err, ErrOffsetEvicted):
+		writeErrorResponse(w, http.StatusConflict, "Records evicted")
+	case err != nil:
+		writeInternalError(w, r, err)
+	default:
+		writeResponse(w, http.StatusOK, manifest)
+	}
+}
+
+// validSnapshotName reports whether the name is a single path element, so
+// snapshots cannot be written outside the backup directory.
+func validSnapshotName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
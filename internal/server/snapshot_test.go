@@ -0,0 +1,254 @@
+package server_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/client"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("second"))
+	assert.Nil(t, err)
+
+	snapshotDir := filepath.Join(dir, "backup", "snapshot-1")
+
+	manifest, err := l.Snapshot(snapshotDir)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), manifest.LowestOffset)
+	assert.Equal(t, uint64(2), manifest.EndOffset)
+	assert.Equal(t, uint64(2), manifest.LastStableOffset)
+	assert.Len(t, manifest.Files, 2)
+
+	// The sealed segment is linked, the active one is empty.
+	assert.Equal(t, "00000000000000000000.store", manifest.Files[0].Name)
+	assert.Equal(t, "00000000000000000057.store", manifest.Files[1].Name)
+	assert.Equal(t, uint64(0), manifest.Files[1].Size)
+
+	linked, err := os.Stat(filepath.Join(snapshotDir, manifest.Files[0].Name))
+	assert.Nil(t, err)
+
+	segment, err := os.Stat(filepath.Join(dir, "log", "segments", manifest.Files[0].Name))
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(linked, segment))
+
+	// Records appended after the snapshot are not in it.
+	_, err = l.Append([]byte("third"))
+	assert.Nil(t, err)
+
+	_, err = server.VerifySnapshot(snapshotDir)
+	assert.Nil(t, err)
+
+	_, err = l.Snapshot(snapshotDir)
+	assert.ErrorIs(t, err, server.ErrSnapshotExists)
+
+	restored, err := server.RestoreSnapshot(snapshotDir, filepath.Join(dir, "restored"))
+	assert.Nil(t, err)
+	assert.Equal(t, manifest.Files, restored.Files)
+
+	_, err = server.RestoreSnapshot(snapshotDir, filepath.Join(dir, "restored"))
+	assert.ErrorIs(t, err, server.ErrSnapshotExists)
+
+	rl, err := server.OpenLog(filepath.Join(dir, "restored"), server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer rl.Close() // nolint:errcheck
+
+	assert.Equal(t, uint64(2), rl.EndOffset())
+
+	r1, err := rl.Read(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), r1.Value)
+
+	// The restored files are copies, appending to the restored log does not
+	// change the snapshot.
+	_, err = rl.Append([]byte("restored"))
+	assert.Nil(t, err)
+
+	_, err = server.VerifySnapshot(snapshotDir)
+	assert.Nil(t, err)
+
+	_, err = server.NewLog().Snapshot(filepath.Join(dir, "backup", "memory"))
+	assert.ErrorIs(t, err, server.ErrNotPersisted)
+}
+
+func TestSnapshot_Failure(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	segment := filepath.Join(dir, "log", "segments", "00000000000000000000.store")
+
+	// Records are written to the segment file right away, so truncating it
+	// makes the snapshot fail.
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{SyncPolicy: server.SyncAlways}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	snapshotDir := filepath.Join(dir, "backup", "snapshot-1")
+
+	// A failed snapshot leaves nothing behind.
+	b, err := ioutil.ReadFile(segment)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(segment, 0))
+
+	_, err = l.Snapshot(snapshotDir)
+	assert.NotNil(t, err)
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "backup"))
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+
+	// The snapshot is retried with the same name, an empty directory is
+	// replaced.
+	assert.Nil(t, ioutil.WriteFile(segment, b, 0600))
+	assert.Nil(t, os.Mkdir(snapshotDir, 0700))
+
+	manifest, err := l.Snapshot(snapshotDir)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), manifest.EndOffset)
+
+	_, err = server.VerifySnapshot(snapshotDir)
+	assert.Nil(t, err)
+}
+
+func TestRestoreSnapshot_Mismatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	snapshotDir := filepath.Join(dir, "snapshot")
+
+	_, err = l.Snapshot(snapshotDir)
+	assert.Nil(t, err)
+
+	_, err = server.VerifySnapshot(snapshotDir)
+	assert.Nil(t, err)
+
+	file := filepath.Join(snapshotDir, "00000000000000000000.store")
+
+	b, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+
+	b[len(b)-1] ^= 0xff
+	assert.Nil(t, ioutil.WriteFile(file, b, 0600))
+
+	_, err = server.RestoreSnapshot(snapshotDir, filepath.Join(dir, "restored"))
+	assert.ErrorIs(t, err, server.ErrInvalidSnapshot)
+
+	_, err = os.Stat(filepath.Join(dir, "restored", "segments"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, os.Remove(filepath.Join(snapshotDir, "manifest.json")))
+
+	_, err = server.VerifySnapshot(snapshotDir)
+	assert.ErrorIs(t, err, server.ErrInvalidSnapshot)
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{ // nolint:exhaustivestruct
+		Log:       l,
+		BackupDir: filepath.Join(dir, "backup"),
+	}).Handler)
+
+	defer srv.Close()
+
+	transport := client.NewHTTPTransport(srv.URL, nil)
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	snapshot, err := transport.Snapshot(context.Background(), "daily")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), snapshot.EndOffset)
+
+	_, err = server.VerifySnapshot(filepath.Join(dir, "backup", "daily"))
+	assert.Nil(t, err)
+
+	_, err = transport.Snapshot(context.Background(), "daily")
+	assert.ErrorIs(t, err, client.ErrSnapshotExists)
+
+	_, err = transport.Snapshot(context.Background(), "../log")
+	assert.NotNil(t, err)
+	assert.NoDirExists(t, filepath.Join(dir, "log", "log"))
+}
+
+func TestRestoreSnapshot_SingleFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Close())
+
+	// Snapshots taken before the store was split into segments have a single
+	// store file.
+	b, err := ioutil.ReadFile(filepath.Join(dir, "log", "segments", "00000000000000000000.store"))
+	assert.Nil(t, err)
+
+	snapshotDir := filepath.Join(dir, "snapshot")
+	assert.Nil(t, os.Mkdir(snapshotDir, 0700))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(snapshotDir, "log.store"), b, 0600))
+
+	sum := sha256.Sum256(b)
+	manifest := fmt.Sprintf(`{"version":1,"lowest_offset":0,"end_offset":1,"last_stable_offset":1,`+
+		`"files":[{"name":"log.store","size":%d,"sha256":"%s"}]}`, len(b), hex.EncodeToString(sum[:]))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(snapshotDir, "manifest.json"), []byte(manifest), 0600))
+
+	_, err = server.RestoreSnapshot(snapshotDir, filepath.Join(dir, "restored"))
+	assert.Nil(t, err)
+
+	rl, err := server.OpenLog(filepath.Join(dir, "restored"), server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer rl.Close() // nolint:errcheck
+
+	record, err := rl.Read(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), record.Value)
+}
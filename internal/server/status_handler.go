@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// HealthResponse is a response on the health and readiness checks.
+type HealthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Statuses of the health and readiness checks.
+const (
+	statusOK       = "ok"
+	statusNotReady = "not_ready"
+)
+
+// StatusResponse is a response on the status request.
+type StatusResponse struct {
+	Version       string            `json:"version"`
+	StartedAt     time.Time         `json:"started_at"`
+	UptimeSeconds float64           `json:"uptime_seconds"`
+	Log           LogStatus         `json:"log"`
+	Replication   ReplicationStatus `json:"replication"`
+	Config        interface{}       `json:"config,omitempty"`
+}
+
+// ReplicationStatus describes the followers replicating the log and, if the
+// server is a follower, its replication of the leader's log.
+type ReplicationStatus struct {
+	Replicas []ReplicaStatus `json:"replicas"`
+	Follower *FollowerStatus `json:"follower,omitempty"`
+}
+
+// LogStatus describes the offsets and the files of the log.
+type LogStatus struct {
+	Persisted        bool         `json:"persisted"`
+	Dir              string       `json:"dir,omitempty"`
+	Files            []FileStatus `json:"files"`
+	LowestOffset     uint64       `json:"lowest_offset"`
+	EndOffset        uint64       `json:"end_offset"`
+	LastStableOffset uint64       `json:"last_stable_offset"`
+	BufferedBytes    uint64       `json:"buffered_bytes"`
+	AppendedBytes    uint64       `json:"appended_bytes"`
+	ReadBytes        uint64       `json:"read_bytes"`
+	Tier             *TierStatus  `json:"tier,omitempty"`
+}
+
+// FileStatus describes a file of the log.
+type FileStatus struct {
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+}
+
+// NewHealthHandler creates a handler function that reports that the process
+// is alive.
+func NewHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, http.StatusOK, HealthResponse{Status: statusOK, Error: ""})
+	}
+}
+
+// NewReadyHandler creates a handler function that reports whether the log is
+// opened and recovered, is not shutting down and its directory is writable.
+func NewReadyHandler(log *Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := log.Ready(); err != nil {
+			writeResponse(w, http.StatusServiceUnavailable, HealthResponse{
+				Status: statusNotReady,
+				Error:  err.Error(),
+			})
+
+			return
+		}
+
+		writeResponse(w, http.StatusOK, HealthResponse{Status: statusOK, Error: ""})
+	}
+}
+
+type statusHandler struct {
+	log       *Log
+	version   string
+	startedAt time.Time
+	config    interface{}
+	replicas  *Replicas
+	follower  *Follower // nil if the server is not a follower
+	tier      *Tier     // nil if the log is not offloaded
+}
+
+// NewStatusHandler creates a handler function that reports the version, the
+// uptime, the state of the log and the configuration of the server.
+func NewStatusHandler(log *Log, version string, startedAt time.Time, config interface{}) http.HandlerFunc {
+	return newStatusHandler(log, version, startedAt, config, NewReplicas(log, ReplicasConfig{}), nil, nil) // nolint:exhaustivestruct
+}
+
+func newStatusHandler(
+	log *Log,
+	version string,
+	startedAt time.Time,
+	config interface{},
+	replicas *Replicas,
+	follower *Follower,
+	tier *Tier,
+) http.HandlerFunc {
+	handler := &statusHandler{
+		log:       log,
+		version:   version,
+		startedAt: startedAt,
+		config:    config,
+		replicas:  replicas,
+		follower:  follower,
+		tier:      tier,
+	}
+
+	return handler.handle
+}
+
+func (h *statusHandler) handle(w http.ResponseWriter, r *http.Request) {
+	stats := h.log.Stats()
+
+	status := LogStatus{
+		Persisted: stats.Dir != "",
+		Dir:       stats.Dir,
+		Files:     []FileStatus{},
+		// Evicted records are read from the tier.
+		LowestOffset:     0,
+		EndOffset:        stats.EndOffset,
+		LastStableOffset: stats.LastStableOffset,
+		BufferedBytes:    stats.BufferedBytes,
+		AppendedBytes:    stats.AppendedBytes,
+		ReadBytes:        stats.ReadBytes,
+		Tier:             nil,
+	}
+
+	if status.Persisted {
+		status.Files = append(status.Files, FileStatus{
+			Path: filepath.Join(stats.Dir, segmentsDirName),
+			Size: stats.DiskSize,
+		})
+	}
+
+	if h.tier != nil {
+		tierStatus := h.tier.Status()
+		status.Tier = &tierStatus
+	} else {
+		status.LowestOffset = stats.LocalOffset
+	}
+
+	response := StatusResponse{
+		Version:       h.version,
+		StartedAt:     h.startedAt,
+		UptimeSeconds: time.Since(h.startedAt).Seconds(),
+		Log:           status,
+		Replication: ReplicationStatus{
+			Replicas: h.replicas.Describe(),
+			Follower: nil,
+		},
+		Config: h.config,
+	}
+
+	if h.follower != nil {
+		followerStatus := h.follower.Status()
+		response.Replication.Follower = &followerStatus
+	}
+
+	writeResponse(w, http.StatusOK, response)
+}
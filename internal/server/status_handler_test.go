@@ -0,0 +1,129 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	apitest.New().
+		HandlerFunc(server.NewHealthHandler()).
+		Get("/healthz").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"status":"ok"}`).
+		End()
+}
+
+func TestReadyHandler(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	handler := server.NewReadyHandler(l)
+
+	apitest.New().
+		HandlerFunc(handler).
+		Get("/readyz").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"status":"ok"}`).
+		End()
+
+	l.StopWaiting()
+
+	apitest.New().
+		HandlerFunc(handler).
+		Get("/readyz").
+		Expect(t).
+		Status(http.StatusServiceUnavailable).
+		Body(`{"status":"not_ready","error":"log closed"}`).
+		End()
+
+	err = l.Close()
+	assert.Nil(t, err)
+}
+
+func TestReadyHandler_NotWritable(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	err = os.Chmod(dir, 0500)
+	assert.Nil(t, err)
+
+	defer os.Chmod(dir, 0700) // nolint:errcheck
+
+	apitest.New().
+		HandlerFunc(server.NewReadyHandler(l)).
+		Get("/readyz").
+		Expect(t).
+		Status(http.StatusServiceUnavailable).
+		End()
+}
+
+func TestStatusHandler(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	_, err = l.Append([]byte("first"))
+	assert.Nil(t, err)
+
+	startedAt := time.Now().Add(-time.Minute)
+	settings := map[string]string{"http_addr": ":8080"}
+
+	recorder := httptest.NewRecorder()
+	server.NewStatusHandler(l, "v1.2.3", startedAt, settings)(recorder, httptest.NewRequest(http.MethodGet, "/v1/status", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var status server.StatusResponse
+
+	err = json.NewDecoder(recorder.Body).Decode(&status)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.2.3", status.Version)
+	assert.GreaterOrEqual(t, status.UptimeSeconds, 60.0)
+	assert.Equal(t, map[string]interface{}{"http_addr": ":8080"}, status.Config)
+	assert.Equal(t, server.LogStatus{
+		Persisted: true,
+		Dir:       dir,
+		Files: []server.FileStatus{
+			{Path: filepath.Join(dir, "segments"), Size: 28},
+		},
+		LowestOffset:     0,
+		EndOffset:        1,
+		LastStableOffset: 1,
+		BufferedBytes:    28,
+		AppendedBytes:    5,
+		ReadBytes:        0,
+	}, status.Log)
+}
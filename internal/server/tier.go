@@ -0,0 +1,504 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/objstore"
+	"go.uber.org/zap"
+)
+
+// DefaultTierInterval is the period of checking for new segments to upload.
+const DefaultTierInterval = time.Minute
+
+// DefaultTierReadTimeout is the time after which reading an evicted record
+// from the object store fails.
+const DefaultTierReadTimeout = 30 * time.Second
+
+// tierManifestFileName is the name of the manifest of the uploaded segments
+// in the log directory. It is also uploaded with tierManifestKey.
+const tierManifestFileName = "tier.json"
+
+const tierManifestKey = "manifest.json"
+
+// TierConfig configures the offloading of the log to an object store.
+type TierConfig struct {
+	// Store is the object store the segments are uploaded to.
+	Store objstore.Store
+
+	// LocalRetentionBytes is the size of the local store segments that are
+	// kept. The oldest uploaded segments beyond it are evicted from the local
+	// store and their records are read from the object store. Nothing is
+	// evicted if it is zero.
+	LocalRetentionBytes uint64
+
+	// CacheBytes is the size of the segments downloaded to read evicted
+	// records that are kept. DefaultTierCacheBytes is used if it is zero.
+	CacheBytes uint64
+
+	// Interval is the period of checking for new segments to upload.
+	// DefaultTierInterval is used if it is zero.
+	Interval time.Duration
+
+	// ReadTimeout is the time after which reading an evicted record, which
+	// may download its segment, fails. Reads are not bounded by the wait of
+	// long polls, which may be over before the read starts.
+	// DefaultTierReadTimeout is used if it is zero.
+	ReadTimeout time.Duration
+
+	// Logger logs failed uploads if it is not nil.
+	Logger *zap.Logger
+}
+
+// TierSegment is an uploaded segment: the records of the store from the base
+// offset up to the end offset.
+type TierSegment struct {
+	BaseOffset uint64 `json:"base_offset"`
+	EndOffset  uint64 `json:"end_offset"`
+	Position   uint64 `json:"position"` // the position of the first record in the store
+	Size       uint64 `json:"size"`
+	SHA256     string `json:"sha256"`
+	Key        string `json:"key"`
+}
+
+// TierStatus describes the segments uploaded to the object store.
+type TierStatus struct {
+	Segments       int       `json:"segments"`
+	UploadedOffset uint64    `json:"uploaded_offset"` // the end offset of the last uploaded segment
+	UploadedBytes  uint64    `json:"uploaded_bytes"`
+	LastUploadAt   time.Time `json:"last_upload_at"`
+	LocalOffset    uint64    `json:"local_offset"`    // the first record that is not evicted from the local store
+	CachedBytes    uint64    `json:"cached_bytes"`    // the size of the segments downloaded to read evicted records
+	Error          string    `json:"error,omitempty"` // the last failure
+}
+
+// tierManifest lists the uploaded segments in the order of their offsets.
+type tierManifest struct {
+	Segments []TierSegment `json:"segments"`
+}
+
+// Tier uploads the sealed segments of a persisted log to an object store and
+// evicts the oldest uploaded segments from the local store beyond the local
+// retention. The store starts a new segment once the active one reaches the
+// segment size of the log and syncs the sealed one, so the uploaded segments
+// do not change. The manifest of the uploaded segments is kept in the log
+// directory and uploaded after every segment. The log reads the evicted
+// records from the object store through a cache of downloaded segments.
+type Tier struct {
+	log      *Log
+	config   TierConfig
+	logger   *zap.Logger
+	cache    *tierCache
+	cancel   context.CancelFunc
+	done     chan struct{}
+	uploadMu sync.Mutex // serializes uploads
+	mu       sync.Mutex
+	manifest tierManifest
+	status   TierStatus
+	stopped  sync.Once
+}
+
+// StartTier loads the manifest of the uploaded segments and starts uploading
+// the new segments of the log periodically. The log reads its evicted records
+// through the tier until it is stopped. It returns ErrNotPersisted if the log
+// has no store.
+func StartTier(log *Log, config TierConfig) (*Tier, error) {
+	if log.store == nil {
+		return nil, ErrNotPersisted
+	}
+
+	if config.CacheBytes == 0 {
+		config.CacheBytes = DefaultTierCacheBytes
+	}
+
+	if config.Interval == 0 {
+		config.Interval = DefaultTierInterval
+	}
+
+	if config.ReadTimeout == 0 {
+		config.ReadTimeout = DefaultTierReadTimeout
+	}
+
+	logger := zap.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger
+	}
+
+	manifest, err := readTierManifest(filepath.Join(log.dir, tierManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := newTierCache(filepath.Join(log.dir, tierCacheDirName), config.CacheBytes, config.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &Tier{
+		log:      log,
+		config:   config,
+		logger:   logger,
+		cache:    cache,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		uploadMu: sync.Mutex{},
+		mu:       sync.Mutex{},
+		manifest: manifest,
+		status: TierStatus{
+			Segments:       0,
+			UploadedOffset: 0,
+			UploadedBytes:  0,
+			LastUploadAt:   time.Time{},
+			LocalOffset:    0,
+			CachedBytes:    0,
+			Error:          "",
+		},
+		stopped: sync.Once{},
+	}
+
+	log.mu.Lock()
+	log.tier = t
+	log.mu.Unlock()
+
+	go t.run(ctx)
+
+	return t, nil
+}
+
+// Segments returns the uploaded segments in the order of their offsets.
+func (t *Tier) Segments() []TierSegment {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]TierSegment{}, t.manifest.Segments...)
+}
+
+// Status returns the status of the uploads.
+func (t *Tier) Status() TierStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := t.status
+	status.Segments = len(t.manifest.Segments)
+
+	for _, segment := range t.manifest.Segments {
+		status.UploadedOffset = segment.EndOffset
+		status.UploadedBytes += segment.Size
+	}
+
+	t.log.mu.Lock()
+	status.LocalOffset = t.log.start
+	t.log.mu.Unlock()
+
+	status.CachedBytes = t.cache.cachedBytes()
+
+	return status
+}
+
+// Stop stops uploading, waits for the current upload to finish and removes
+// the cached segments. The log cannot read its evicted records anymore.
+// Stopping again does nothing.
+func (t *Tier) Stop() {
+	t.stopped.Do(func() {
+		t.cancel()
+		<-t.done
+
+		t.log.mu.Lock()
+		if t.log.tier == t {
+			t.log.tier = nil
+		}
+		t.log.mu.Unlock()
+
+		t.cache.close()
+	})
+}
+
+// read returns the persisted record at the offset from the uploaded segment
+// that has it. The context of the caller only passes its values, such as the
+// trace, since it may be the context of a long poll that is already done, and
+// the read is bounded by the read timeout instead.
+func (t *Tier) read(ctx context.Context, offset uint64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(detachedContext{Context: ctx}, t.config.ReadTimeout)
+	defer cancel()
+
+	t.mu.Lock()
+	segments := t.manifest.Segments
+	t.mu.Unlock()
+
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].EndOffset > offset })
+	if i == len(segments) || segments[i].BaseOffset > offset {
+		return nil, fmt.Errorf("%w: the record %d is not uploaded", ErrOffsetNotFound, offset)
+	}
+
+	return t.cache.read(ctx, segments[i], offset-segments[i].BaseOffset)
+}
+
+func (t *Tier) run(ctx context.Context) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		err := t.Upload(ctx)
+
+		t.mu.Lock()
+		t.status.LastUploadAt = time.Now()
+		t.status.Error = ""
+
+		if err != nil {
+			t.status.Error = err.Error()
+		}
+		t.mu.Unlock()
+
+		if err != nil && ctx.Err() == nil {
+			t.logger.Warn("Failed to upload the log segments", zap.Error(err))
+		}
+	}
+}
+
+// Upload uploads the sealed segments of the log store that are not uploaded
+// yet and evicts the oldest uploaded segments from the local store while the
+// local segments exceed the local retention. The active segment is not
+// uploaded.
+func (t *Tier) Upload(ctx context.Context) error {
+	t.uploadMu.Lock()
+	defer t.uploadMu.Unlock()
+
+	segments := t.log.store.Segments()
+
+	for _, local := range segments[:len(segments)-1] {
+		t.mu.Lock()
+		var position, offset uint64
+		if n := len(t.manifest.Segments); n != 0 {
+			last := t.manifest.Segments[n-1]
+			position, offset = last.Position+last.Size, last.EndOffset
+		}
+		t.mu.Unlock()
+
+		end := local.Position + local.Size
+		if end <= position {
+			continue
+		}
+
+		if position < local.Position {
+			return fmt.Errorf("%w: the records from %d to %d are neither uploaded nor in the store",
+				store.ErrMissingSegment, position, local.Position)
+		}
+
+		segment, err := t.seal(offset, position, end)
+		if err != nil {
+			return err
+		}
+
+		if err := t.upload(ctx, segment); err != nil {
+			return err
+		}
+	}
+
+	return t.evict(segments)
+}
+
+// seal counts the records of the store from the position up to the end and
+// returns them as a segment from the offset.
+func (t *Tier) seal(offset, position, end uint64) (TierSegment, error) {
+	segment := TierSegment{
+		BaseOffset: offset,
+		EndOffset:  offset,
+		Position:   position,
+		Size:       end - position,
+		SHA256:     "",
+		Key:        "",
+	}
+
+	// No record is longer than the segment.
+	scanner := store.NewScannerWithConfig(io.NewSectionReader(t.log.store, int64(position), int64(segment.Size)),
+		store.Config{MaxRecordLength: segment.Size}) // nolint:exhaustivestruct
+
+	for scanner.Scan() {
+		segment.EndOffset++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return TierSegment{}, fmt.Errorf("failed to read the log store: %w", err)
+	}
+
+	if scanner.Position() != segment.Size {
+		return TierSegment{}, fmt.Errorf("%w: the segment at %d ends at %d, the records at %d",
+			ErrCorruptRecord, position, end, position+scanner.Position())
+	}
+
+	return segment, nil
+}
+
+// upload uploads the segment and the manifest that lists it.
+func (t *Tier) upload(ctx context.Context, segment TierSegment) error {
+	segment.Key = fmt.Sprintf("segments/%020d.store", segment.BaseOffset)
+
+	hash := sha256.New()
+	r := io.TeeReader(io.NewSectionReader(t.log.store, int64(segment.Position), int64(segment.Size)), hash)
+
+	if err := t.config.Store.Put(ctx, segment.Key, r, int64(segment.Size)); err != nil {
+		return fmt.Errorf("failed to upload the segment %s: %w", segment.Key, err)
+	}
+
+	segment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	t.mu.Lock()
+	t.manifest.Segments = append(t.manifest.Segments, segment)
+	manifest := tierManifest{Segments: append([]TierSegment{}, t.manifest.Segments...)}
+	t.mu.Unlock()
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the tier manifest: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(t.log.dir, tierManifestFileName), b); err != nil {
+		return err
+	}
+
+	if err := t.config.Store.Put(ctx, tierManifestKey, bytes.NewReader(b), int64(len(b))); err != nil {
+		return fmt.Errorf("failed to upload the tier manifest: %w", err)
+	}
+
+	return nil
+}
+
+// evict evicts the oldest uploaded local segments while the local segments
+// exceed the local retention. A segment is evicted only once the log does not
+// need its records for open transactions.
+func (t *Tier) evict(segments []store.Segment) error {
+	if t.config.LocalRetentionBytes == 0 {
+		return nil
+	}
+
+	var size uint64
+	for _, local := range segments {
+		size += local.Size
+	}
+
+	t.mu.Lock()
+	uploaded := t.manifest.Segments
+	t.mu.Unlock()
+
+	for _, local := range segments[:len(segments)-1] {
+		if size <= t.config.LocalRetentionBytes {
+			return nil
+		}
+
+		end := local.Position + local.Size
+		i := sort.Search(len(uploaded), func(i int) bool { return uploaded[i].Position+uploaded[i].Size >= end })
+
+		if i == len(uploaded) || uploaded[i].Position+uploaded[i].Size != end {
+			return nil
+		}
+
+		evicted, err := t.log.evict(uploaded[i].EndOffset, end)
+		if err != nil {
+			return err
+		}
+
+		if !evicted {
+			return nil
+		}
+
+		size -= local.Size
+	}
+
+	return nil
+}
+
+// readTierManifest reads the manifest of the uploaded segments. A missing
+// manifest has no segments.
+func readTierManifest(name string) (tierManifest, error) {
+	manifest := tierManifest{Segments: []TierSegment{}}
+
+	b, err := ioutil.ReadFile(filepath.Clean(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+
+	if err != nil {
+		return tierManifest{}, fmt.Errorf("failed to read the tier manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return tierManifest{}, fmt.Errorf("failed to decode the tier manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// writeFileAtomic writes the file atomically and syncs it, so the uploaded
+// segments are not uploaded again after a restart and the evicted records are
+// not restored from a partial checkpoint.
+func writeFileAtomic(name string, b []byte) error {
+	tmp := name + ".tmp"
+
+	file, err := os.OpenFile(filepath.Clean(tmp), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(name), err)
+	}
+
+	if _, err := file.Write(b); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(name), err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to sync %s: %w", filepath.Base(name), err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(name), err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(name), err)
+	}
+
+	return nil
+}
+
+// detachedContext has the values of the context but not its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ivanlemeshev/proglog/internal/log/store"
+	"github.com/ivanlemeshev/proglog/internal/objstore"
+)
+
+// DefaultTierCacheBytes is the size of the segments downloaded from the
+// object store that are kept to read evicted records.
+const DefaultTierCacheBytes = 256 << 20
+
+// tierCacheDirName is the name of the directory in the log directory the
+// segments are downloaded into.
+const tierCacheDirName = "tier-cache"
+
+// tierCache downloads the uploaded segments to read the evicted records and
+// keeps them in a directory. The least recently read segments are removed
+// once the cached segments exceed the maximum size.
+type tierCache struct {
+	dir      string
+	maxBytes uint64
+	store    objstore.Store
+	loadMu   sync.Mutex // serializes downloads, so a segment is downloaded once
+	mu       sync.Mutex
+	segments map[string]*list.Element // by key
+	lru      *list.List               // of *cachedSegment, the most recently read first
+	size     uint64
+}
+
+// cachedSegment is a downloaded segment with the positions of its records.
+type cachedSegment struct {
+	key       string
+	name      string
+	size      uint64
+	store     store.Store
+	positions []uint64
+}
+
+// newTierCache creates the cache in the directory. The segments cached
+// before are removed, they may be incomplete.
+func newTierCache(dir string, maxBytes uint64, objects objstore.Store) (*tierCache, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to clear the tier cache: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil { // nolint:gomnd
+		return nil, fmt.Errorf("failed to create the tier cache directory: %w", err)
+	}
+
+	return &tierCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		store:    objects,
+		loadMu:   sync.Mutex{},
+		mu:       sync.Mutex{},
+		segments: make(map[string]*list.Element),
+		lru:      list.New(),
+		size:     0,
+	}, nil
+}
+
+// read returns the persisted record with the index in the segment. The
+// segment is downloaded if it is not cached.
+func (c *tierCache) read(ctx context.Context, segment TierSegment, index uint64) ([]byte, error) {
+	if b, ok, err := c.readCached(segment.Key, index); ok {
+		return b, err
+	}
+
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	// The segment may have been downloaded while waiting for the lock.
+	if b, ok, err := c.readCached(segment.Key, index); ok {
+		return b, err
+	}
+
+	cached, err := c.download(ctx, segment)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.segments[cached.key] = c.lru.PushFront(cached)
+	c.size += cached.size
+	c.evict()
+
+	return cached.read(index)
+}
+
+// readCached reads the record if the segment is cached. It returns false if
+// the segment is not cached.
+func (c *tierCache) readCached(key string, index uint64) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.segments[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	c.lru.MoveToFront(element)
+
+	b, err := element.Value.(*cachedSegment).read(index)
+
+	return b, true, err
+}
+
+// evict removes the least recently read segments while the cache exceeds the
+// maximum size. The most recently read segment is always kept.
+func (c *tierCache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		element := c.lru.Back()
+		cached := element.Value.(*cachedSegment)
+
+		c.lru.Remove(element)
+		delete(c.segments, cached.key)
+		c.size -= cached.size
+
+		_ = cached.store.Close()
+		_ = os.Remove(cached.name)
+	}
+}
+
+// download downloads the segment into a temporary file, checks its size and
+// checksum against the manifest and indexes its records.
+func (c *tierCache) download(ctx context.Context, segment TierSegment) (*cachedSegment, error) {
+	tmp, err := ioutil.TempFile(c.dir, ".download-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the tier cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+
+	r, err := c.store.Get(ctx, segment.Key)
+	if err != nil {
+		_ = tmp.Close()
+
+		return nil, fmt.Errorf("failed to download the segment %s: %w", segment.Key, err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	_ = r.Close()
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the segment %s: %w", segment.Key, err)
+	}
+
+	if uint64(size) != segment.Size || hex.EncodeToString(hash.Sum(nil)) != segment.SHA256 {
+		return nil, fmt.Errorf("%w: the segment %s does not match the manifest", ErrChecksumMismatch, segment.Key)
+	}
+
+	name := filepath.Join(c.dir, store.SegmentName(segment.BaseOffset))
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return nil, fmt.Errorf("failed to write the tier cache file: %w", err)
+	}
+
+	cached, err := openCachedSegment(name, segment)
+	if err != nil {
+		_ = os.Remove(name)
+
+		return nil, err
+	}
+
+	return cached, nil
+}
+
+// openCachedSegment opens the downloaded segment and indexes its records.
+func openCachedSegment(name string, segment TierSegment) (*cachedSegment, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the tier cache file: %w", err)
+	}
+
+	// No record is longer than the segment.
+	config := store.Config{MaxRecordLength: segment.Size} // nolint:exhaustivestruct
+	positions := make([]uint64, 0, segment.EndOffset-segment.BaseOffset)
+	scanner := store.NewScannerWithConfig(io.NewSectionReader(file, 0, int64(segment.Size)), config)
+
+	for scanner.Scan() {
+		positions = append(positions, scanner.Frame().Position)
+	}
+
+	if err := scanner.Err(); err != nil {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("failed to read the segment %s: %w", segment.Key, err)
+	}
+
+	if uint64(len(positions)) != segment.EndOffset-segment.BaseOffset {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("%w: the segment %s has %d records, the manifest has offsets %d to %d",
+			ErrCorruptRecord, segment.Key, len(positions), segment.BaseOffset, segment.EndOffset)
+	}
+
+	st, err := store.NewWithConfig(file, config)
+	if err != nil {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("failed to open the tier cache file: %w", err)
+	}
+
+	return &cachedSegment{
+		key:       segment.Key,
+		name:      name,
+		size:      segment.Size,
+		store:     st,
+		positions: positions,
+	}, nil
+}
+
+// read returns the persisted record with the index in the segment.
+func (s *cachedSegment) read(index uint64) ([]byte, error) {
+	if index >= uint64(len(s.positions)) {
+		return nil, fmt.Errorf("%w: the segment %s has %d records", ErrOffsetNotFound, s.key, len(s.positions))
+	}
+
+	b, err := s.store.Read(s.positions[index])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the segment %s: %w", s.key, err)
+	}
+
+	return b, nil
+}
+
+// close closes and removes the cached segments.
+func (c *tierCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		_ = element.Value.(*cachedSegment).store.Close()
+	}
+
+	c.segments = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+
+	_ = os.RemoveAll(c.dir)
+}
+
+// cachedBytes returns the size of the cached segments.
+func (c *tierCache) cachedBytes() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
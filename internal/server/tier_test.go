@@ -0,0 +1,301 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/objstore"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTier(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{SegmentBytes: 100}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	store, err := objstore.NewFileStore(filepath.Join(dir, "tier"))
+	assert.Nil(t, err)
+
+	config := server.TierConfig{Store: store, Interval: time.Hour} // nolint:exhaustivestruct
+
+	tier, err := server.StartTier(l, config)
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = l.Append(bytes.Repeat([]byte("x"), 40))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, tier.Upload(ctx))
+
+	// Two records make a segment, the segment of the fifth one is not sealed
+	// yet.
+	segments := tier.Segments()
+	assert.Len(t, segments, 2)
+	assert.Equal(t, uint64(0), segments[0].BaseOffset)
+	assert.Equal(t, uint64(2), segments[0].EndOffset)
+	assert.Equal(t, uint64(2), segments[1].BaseOffset)
+	assert.Equal(t, uint64(4), segments[1].EndOffset)
+	assert.Equal(t, segments[0].Size, segments[1].Position)
+
+	for _, segment := range segments {
+		local, err := ioutil.ReadFile(filepath.Join(dir, "log", "segments", fmt.Sprintf("%020d.store", segment.Position)))
+		assert.Nil(t, err)
+
+		r, err := store.Get(ctx, segment.Key)
+		assert.Nil(t, err)
+
+		b, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Close())
+
+		sum := sha256.Sum256(b)
+		assert.Equal(t, segment.SHA256, hex.EncodeToString(sum[:]))
+		assert.Equal(t, local, b)
+	}
+
+	keys, err := store.List(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"manifest.json", "segments/00000000000000000000.store", "segments/00000000000000000002.store"}, keys)
+
+	tier.Stop()
+	tier.Stop()
+
+	// The uploaded segments are not uploaded again after a restart.
+	tier, err = server.StartTier(l, config)
+	assert.Nil(t, err)
+
+	defer tier.Stop()
+
+	assert.Equal(t, segments, tier.Segments())
+
+	for i := 0; i < 2; i++ {
+		_, err = l.Append(bytes.Repeat([]byte("x"), 40))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, tier.Upload(ctx))
+
+	// The seventh record starts a new segment, so the first six are sealed
+	// into three segments.
+	status := tier.Status()
+	assert.Equal(t, 3, status.Segments)
+	assert.Equal(t, uint64(6), status.UploadedOffset)
+	assert.Equal(t, 3*segments[0].Size, status.UploadedBytes)
+	assert.Equal(t, uint64(0), status.LocalOffset)
+
+	_, err = server.StartTier(server.NewLog(), config)
+	assert.ErrorIs(t, err, server.ErrNotPersisted)
+}
+
+func TestTier_Evict(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "log")
+	logConfig := server.LogConfig{SegmentBytes: 100} // nolint:exhaustivestruct
+
+	l, err := server.OpenLog(logDir, logConfig)
+	assert.Nil(t, err)
+
+	store, err := objstore.NewFileStore(filepath.Join(dir, "tier"))
+	assert.Nil(t, err)
+
+	config := server.TierConfig{Store: store, LocalRetentionBytes: 150, CacheBytes: 100, Interval: time.Hour} // nolint:exhaustivestruct
+
+	tier, err := server.StartTier(l, config)
+	assert.Nil(t, err)
+
+	// The records 0 and 1 are idempotent, 2 and 3 are aborted and 4 is the
+	// abort marker.
+	for i := 0; i < 2; i++ {
+		_, err = l.AppendIdempotent("producer", uint64(i), bytes.Repeat([]byte("a"), 40))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, l.BeginTransaction("txn", "", time.Minute))
+
+	for i := 0; i < 2; i++ {
+		_, err = l.AppendTransactional("txn", "", bytes.Repeat([]byte("t"), 40))
+		assert.Nil(t, err)
+	}
+
+	_, err = l.AbortTransaction("txn", "")
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = l.Append(bytes.Repeat([]byte("x"), 40))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, tier.Upload(ctx))
+
+	// The sealed segments are evicted until the local segments fit into the
+	// retention, only the active segment is left.
+	status := tier.Status()
+	assert.Equal(t, uint64(7), status.LocalOffset)
+	assert.Equal(t, uint64(7), status.UploadedOffset)
+
+	files, err := ioutil.ReadDir(filepath.Join(logDir, "segments"))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	// The evicted records are read from the tier.
+	record, err := l.Read(0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), record.Offset)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 40), record.Value)
+
+	record, err = l.ReadIsolated(2, server.ReadCommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), record.Offset)
+
+	record, err = l.Read(7)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), record.Offset)
+
+	// Followers replicate the evicted records from the tier too.
+	entry, err := l.ReadEntry(ctx, 4)
+	assert.Nil(t, err)
+
+	stored, err := server.DecodeStoredRecord(entry)
+	assert.Nil(t, err)
+	assert.True(t, stored.Control)
+
+	// Only the most recently read segment stays in the cache.
+	assert.Equal(t, tier.Segments()[2].Size, tier.Status().CachedBytes)
+
+	tier.Stop()
+	assert.Nil(t, l.Close())
+
+	// The state of the evicted records is restored from the checkpoint.
+	l, err = server.OpenLog(logDir, logConfig)
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	assert.Equal(t, uint64(8), l.EndOffset())
+
+	_, err = l.Read(0)
+	assert.ErrorIs(t, err, server.ErrOffsetEvicted)
+
+	offset, err := l.AppendIdempotent("producer", 1, bytes.Repeat([]byte("a"), 40))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), offset)
+
+	// The snapshot has the local segments and lists the uploaded segments of
+	// the evicted records.
+	manifest, err := l.Snapshot(filepath.Join(dir, "snapshot"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), manifest.LowestOffset)
+	assert.Equal(t, uint64(8), manifest.EndOffset)
+	assert.Equal(t, tier.Segments(), manifest.TierSegments)
+	assert.Equal(t, "evicted.json", manifest.Files[len(manifest.Files)-1].Name)
+
+	_, err = server.RestoreSnapshot(filepath.Join(dir, "snapshot"), filepath.Join(dir, "restored"))
+	assert.Nil(t, err)
+
+	restored, err := server.OpenLog(filepath.Join(dir, "restored"), logConfig)
+	assert.Nil(t, err)
+
+	defer restored.Close() // nolint:errcheck
+
+	restoredTier, err := server.StartTier(restored, config)
+	assert.Nil(t, err)
+
+	record, err = restored.Read(0)
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 40), record.Value)
+
+	record, err = restored.Read(7)
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), 40), record.Value)
+
+	restoredTier.Stop()
+
+	tier, err = server.StartTier(l, config)
+	assert.Nil(t, err)
+
+	defer tier.Stop()
+
+	record, err = l.ReadIsolated(3, server.ReadCommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), record.Offset)
+
+	record, err = l.ReadIsolated(3, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), record.Offset)
+}
+
+// contextStore is an object store that fails if the context is done, like
+// the S3 store does.
+type contextStore struct {
+	objstore.Store
+}
+
+func (s contextStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.Get(ctx, key) // nolint:wrapcheck
+}
+
+func TestTier_ReadExpiredWait(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(filepath.Join(dir, "log"), server.LogConfig{SegmentBytes: 100}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	files, err := objstore.NewFileStore(filepath.Join(dir, "tier"))
+	assert.Nil(t, err)
+
+	tier, err := server.StartTier(l, server.TierConfig{ // nolint:exhaustivestruct
+		Store:               contextStore{Store: files},
+		LocalRetentionBytes: 1,
+		Interval:            time.Hour,
+	})
+	assert.Nil(t, err)
+
+	defer tier.Stop()
+
+	for i := 0; i < 3; i++ {
+		_, err = l.Append(bytes.Repeat([]byte("x"), 40))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, tier.Upload(context.Background()))
+	assert.Equal(t, uint64(2), tier.Status().LocalOffset)
+
+	// A long poll without a wait has a context that is done before the
+	// evicted record is read.
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	record, err := l.ReadWait(ctx, 0, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), record.Offset)
+
+	_, err = l.ReadEntry(ctx, 1)
+	assert.Nil(t, err)
+}
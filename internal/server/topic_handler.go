@@ -0,0 +1,38 @@
+package server
+
+import "net/http"
+
+// TopicStatus describes a topic of the log and its offsets.
+type TopicStatus struct {
+	Name             string `json:"name"`
+	LowestOffset     uint64 `json:"lowest_offset"`
+	EndOffset        uint64 `json:"end_offset"`
+	LastStableOffset uint64 `json:"last_stable_offset"`
+}
+
+// TopicsResponse is a response on the topics request.
+type TopicsResponse struct {
+	Topics []TopicStatus `json:"topics"`
+}
+
+// NewTopicsHandler creates a handler function that lists the topics of the
+// log. The log is not split into topics yet, so it lists the default topic
+// only. Evicted records are counted if the tier is not nil.
+func NewTopicsHandler(log *Log, tier *Tier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := log.Stats()
+
+		topic := TopicStatus{
+			Name:             logTopic,
+			LowestOffset:     stats.LocalOffset,
+			EndOffset:        stats.EndOffset,
+			LastStableOffset: stats.LastStableOffset,
+		}
+
+		if tier != nil {
+			topic.LowestOffset = 0
+		}
+
+		writeResponse(w, http.StatusOK, TopicsResponse{Topics: []TopicStatus{topic}})
+	}
+}
@@ -0,0 +1,27 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicsHandler(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+
+	_, err := log.Append([]byte("test"))
+	assert.Nil(t, err)
+
+	apitest.New().
+		HandlerFunc(server.NewTopicsHandler(log, nil)).
+		Get("/v1/topics").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"topics":[{"name":"default","lowest_offset":0,"end_offset":1,"last_stable_offset":1}]}`).
+		End()
+}
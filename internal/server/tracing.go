@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tracerName is the instrumentation name of the server spans.
+const tracerName = "github.com/ivanlemeshev/proglog/internal/server"
+
+// traceContext propagates the W3C trace context of requests and records.
+// nolint:gochecknoglobals
+var traceContext propagation.TraceContext
+
+// tracing is a middleware that starts a server span for every request. The
+// span continues the W3C trace context of the request if it has one.
+func tracing(provider trace.TracerProvider) mux.MiddlewareFunc {
+	tracer := provider.Tracer(tracerName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			ctx := traceContext.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.method", r.Method),
+					attribute.String("http.route", route),
+				),
+			)
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.status_code", recorder.status))
+
+			if recorder.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(recorder.status))
+			}
+		})
+	}
+}
+
+// tracingGRPC is a gRPC middleware that starts a server span for every call
+// like tracing. The span continues the W3C trace context of the metadata of
+// the call if it has one.
+func tracingGRPC(provider trace.TracerProvider) grpcMiddleware {
+	tracer := provider.Tracer(tracerName)
+
+	return func(ctx context.Context, call *grpcCall, next func(context.Context) error) error {
+		name := strings.TrimPrefix(call.method, "/")
+		service, method := name, ""
+
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			service, method = name[:i], name[i+1:]
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		ctx = traceContext.Extract(ctx, metadataCarrier(md))
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "grpc"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", method),
+			),
+		)
+		defer span.End()
+
+		err := next(ctx)
+
+		code := status.Code(err)
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+
+		if isServerError(code) {
+			span.SetStatus(codes.Error, code.String())
+		}
+
+		return err
+	}
+}
+
+// isServerError reports whether the gRPC code is a failure of the server,
+// like the 5xx HTTP status codes.
+func isServerError(code grpccodes.Code) bool {
+	switch code { // nolint:exhaustive
+	case grpccodes.Unknown, grpccodes.DeadlineExceeded, grpccodes.Unimplemented, grpccodes.Internal,
+		grpccodes.Unavailable, grpccodes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// endSpan records the error on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// headerCarrier adapts record headers to the trace context propagation.
+type headerCarrier []Header
+
+func (c *headerCarrier) Get(key string) string {
+	for _, h := range *c {
+		if h.Key == key {
+			return h.Value
+		}
+	}
+
+	return ""
+}
+
+func (c *headerCarrier) Set(key, value string) {
+	for i, h := range *c {
+		if h.Key == key {
+			(*c)[i].Value = value
+
+			return
+		}
+	}
+
+	*c = append(*c, Header{Key: key, Value: value})
+}
+
+func (c *headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c))
+	for _, h := range *c {
+		keys = append(keys, h.Key)
+	}
+
+	return keys
+}
+
+// metadataCarrier adapts the metadata of gRPC calls to the trace context
+// propagation.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) != 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,99 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	l, err := server.OpenLog(t.TempDir(), server.LogConfig{
+		MaxRecordSize:  0,
+		SyncPolicy:     server.SyncAlways,
+		SyncInterval:   0,
+		Metrics:        nil,
+		TracerProvider: provider,
+	})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	srv := httptest.NewServer(server.NewHTTPServer(server.HTTPConfig{
+		Addr:               "",
+		Log:                l,
+		Metrics:            nil,
+		TracerProvider:     provider,
+		TraceRecordHeaders: true,
+	}).Handler)
+	defer srv.Close()
+
+	const (
+		traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+		traceparent = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/", bytes.NewBufferString(`{"value":"aGVsbG8="}`))
+	assert.Nil(t, err)
+
+	req.Header.Set("traceparent", traceparent)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_ = resp.Body.Close()
+
+	req, err = http.NewRequest(http.MethodGet, srv.URL+"/", bytes.NewBufferString(`{"offset":0}`))
+	assert.Nil(t, err)
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+
+	defer resp.Body.Close() // nolint:errcheck
+
+	var consumed server.ConsumeResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&consumed)
+	assert.Nil(t, err)
+
+	// The record keeps the trace context of the produce request.
+	assert.Len(t, consumed.Headers, 1)
+	assert.Equal(t, "traceparent", consumed.Headers[0].Key)
+	assert.True(t, strings.HasPrefix(consumed.Headers[0].Value, "00-"+traceID+"-"))
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	produce := spans["POST /"]
+	assert.NotNil(t, produce)
+	assert.Equal(t, traceID, produce.SpanContext().TraceID().String())
+	assert.True(t, produce.Parent().IsRemote())
+
+	appended := spans["Log.Append"]
+	assert.NotNil(t, appended)
+	assert.Equal(t, produce.SpanContext().SpanID(), appended.Parent().SpanID())
+
+	consume := spans["GET /"]
+	assert.NotNil(t, consume)
+
+	read := spans["Log.Read"]
+	assert.NotNil(t, read)
+	assert.Equal(t, consume.SpanContext().SpanID(), read.Parent().SpanID())
+
+	assert.NotNil(t, spans["store.Sync"])
+}
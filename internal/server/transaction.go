@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTransactionTimeout is the time after which an abandoned transaction
+// is aborted if the producer does not set its own timeout.
+const DefaultTransactionTimeout = time.Minute
+
+// ErrTransactionInProgress is returned if the producer begins a transaction
+// before completing the previous one.
+var ErrTransactionInProgress = fmt.Errorf("transaction in progress")
+
+// ErrNoTransaction is returned if the producer has no open transaction, for
+// example because the transaction has timed out and has been aborted.
+var ErrNoTransaction = fmt.Errorf("no open transaction")
+
+// ErrNotTransactionOwner is returned if a principal appends to, commits or
+// aborts a transaction begun by another principal.
+var ErrNotTransactionOwner = fmt.Errorf("not the transaction owner")
+
+// transaction is an open transaction of a producer.
+type transaction struct {
+	owner    string   // the principal that has begun the transaction
+	offsets  []uint64 // offsets of the records appended in the transaction
+	deadline time.Time
+}
+
+func newTransaction(owner string, now time.Time, timeout time.Duration) *transaction {
+	return &transaction{
+		owner:    owner,
+		offsets:  nil,
+		deadline: now.Add(timeout),
+	}
+}
+
+// BeginTransaction opens a transaction of the producer owned by the principal.
+// Only the owner can append to, commit or abort the transaction. The
+// transaction is aborted if it is not completed within the timeout, the
+// default timeout is used if the timeout is zero.
+func (c *Log) BeginTransaction(producerID, owner string, timeout time.Duration) error {
+	_, err := c.submit(command{
+		kind:    beginCommand,
+		timeout: timeout,
+		entry:   entry{producerID: producerID, owner: owner},
+	})
+
+	return err
+}
+
+// beginTransaction opens the transaction of the producer.
+func (c *Log) beginTransaction(producerID, owner string, timeout time.Duration, now time.Time) error {
+	if _, ok := c.transactions[producerID]; ok {
+		return ErrTransactionInProgress
+	}
+
+	if timeout == 0 {
+		timeout = DefaultTransactionTimeout
+	}
+
+	c.transactions[producerID] = newTransaction(owner, now, timeout)
+
+	return nil
+}
+
+// AppendTransactional adds a new record to the open transaction of the
+// producer. The record is hidden from read committed consumers until the
+// transaction is committed.
+func (c *Log) AppendTransactional(producerID, owner string, value []byte, headers ...Header) (uint64, error) {
+	return c.submit(command{
+		kind: appendTransactionalCommand,
+		entry: entry{
+			record:     Record{Value: value, Headers: headers},
+			producerID: producerID,
+			owner:      owner,
+			attributes: transactionalAttribute,
+		},
+	})
+}
+
+// appendTransactional appends the record to the open transaction.
+func (c *Log) appendTransactional(e entry, now time.Time) (uint64, error) {
+	if _, err := c.ownTransaction(e.producerID, e.owner); err != nil {
+		return 0, err
+	}
+
+	return c.append(e, now)
+}
+
+// CommitTransaction writes the commit marker of the open transaction of the
+// producer and returns the offset of the marker.
+func (c *Log) CommitTransaction(producerID, owner string) (uint64, error) {
+	return c.submit(command{
+		kind:  commitCommand,
+		entry: entry{producerID: producerID, owner: owner},
+	})
+}
+
+// AbortTransaction writes the abort marker of the open transaction of the
+// producer and returns the offset of the marker.
+func (c *Log) AbortTransaction(producerID, owner string) (uint64, error) {
+	return c.submit(command{
+		kind:  abortCommand,
+		entry: entry{producerID: producerID, owner: owner},
+	})
+}
+
+// ownTransaction returns the open transaction of the producer if the
+// principal owns it.
+func (c *Log) ownTransaction(producerID, owner string) (*transaction, error) {
+	txn, ok := c.transactions[producerID]
+	if !ok {
+		return nil, ErrNoTransaction
+	}
+
+	if txn.owner != owner {
+		return nil, ErrNotTransactionOwner
+	}
+
+	return txn, nil
+}
+
+// endTransaction writes the control marker that completes the transaction.
+func (c *Log) endTransaction(producerID, owner string, commit bool, now time.Time) (uint64, error) {
+	if _, err := c.ownTransaction(producerID, owner); err != nil {
+		return 0, err
+	}
+
+	attributes := controlAttribute
+	if commit {
+		attributes |= commitAttribute
+	}
+
+	return c.append(entry{
+		record:     Record{Value: nil},
+		producerID: producerID,
+		owner:      owner,
+		attributes: attributes,
+	}, now)
+}
+
+// completeTransaction removes the transaction from the open transactions and
+// hides its records from read committed consumers if it is aborted.
+func (c *Log) completeTransaction(producerID string, commit bool) {
+	txn, ok := c.transactions[producerID]
+	if !ok {
+		return
+	}
+
+	delete(c.transactions, producerID)
+
+	if commit {
+		return
+	}
+
+	for _, offset := range txn.offsets {
+		c.entries[offset-c.start].aborted = true
+	}
+}
+
+// abortExpiredTransactions aborts transactions whose deadline has passed. The
+// abort markers are best effort: if a marker cannot be persisted, the
+// transaction is aborted again on the next call.
+func (c *Log) abortExpiredTransactions(now time.Time) {
+	for producerID, txn := range c.transactions {
+		if now.After(txn.deadline) {
+			_, _ = c.endTransaction(producerID, txn.owner, false, now)
+		}
+	}
+}
+
+// abortExpiredLocally aborts expired transactions on reads. A replicated log
+// changes only by replicated commands, so its leader aborts them with the tick
+// command instead, and a follower gets the abort markers from its leader.
+func (c *Log) abortExpiredLocally() {
+	if c.replication == nil && !c.following {
+		c.abortExpiredTransactions(time.Now())
+	}
+}
+
+// hasExpiredTransactions reports whether a transaction has passed its
+// deadline.
+func (c *Log) hasExpiredTransactions(now time.Time) bool {
+	for _, txn := range c.transactions {
+		if now.After(txn.deadline) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastStableOffset returns the offset of the first record of the oldest open
+// transaction or the log length if there are no open transactions.
+func (c *Log) lastStableOffset() uint64 {
+	offset := c.endOffset()
+
+	for _, txn := range c.transactions {
+		if len(txn.offsets) > 0 && txn.offsets[0] < offset {
+			offset = txn.offsets[0]
+		}
+	}
+
+	return offset
+}
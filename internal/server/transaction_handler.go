@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+)
+
+// BeginTransactionRequest is a request to open a transaction of the producer.
+// The default transaction timeout is used if the timeout is not set.
+type BeginTransactionRequest struct {
+	ProducerID string `json:"producer_id"`
+	TimeoutMs  uint64 `json:"timeout_ms"`
+}
+
+// EndTransactionRequest is a request to commit or abort the open transaction
+// of the producer.
+type EndTransactionRequest struct {
+	ProducerID string `json:"producer_id"`
+}
+
+// EndTransactionResponse is a response on the commit and abort requests.
+type EndTransactionResponse struct {
+	Offset uint64 `json:"offset"`
+}
+
+type transactionHandler struct {
+	log *Log
+}
+
+// NewBeginTransactionHandler creates a new handler function to open
+// transactions.
+func NewBeginTransactionHandler(log *Log) http.HandlerFunc {
+	handler := &transactionHandler{
+		log: log,
+	}
+
+	return handler.begin
+}
+
+// NewCommitTransactionHandler creates a new handler function to commit
+// transactions.
+func NewCommitTransactionHandler(log *Log) http.HandlerFunc {
+	handler := &transactionHandler{
+		log: log,
+	}
+
+	return handler.commit
+}
+
+// NewAbortTransactionHandler creates a new handler function to abort
+// transactions.
+func NewAbortTransactionHandler(log *Log) http.HandlerFunc {
+	handler := &transactionHandler{
+		log: log,
+	}
+
+	return handler.abort
+}
+
+func (h *transactionHandler) begin(w http.ResponseWriter, r *http.Request) {
+	var request BeginTransactionRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.ProducerID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	timeout := time.Duration(request.TimeoutMs) * time.Millisecond
+
+	err = h.log.BeginTransaction(request.ProducerID, auth.PrincipalFromContext(r.Context()), timeout)
+	if errors.Is(err, ErrInvalidProducerID) {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid producer ID")
+
+		return
+	}
+
+	if errors.Is(err, ErrTransactionInProgress) {
+		writeErrorResponse(w, http.StatusConflict, "Transaction in progress")
+
+		return
+	}
+
+	if errors.Is(err, ErrNotLeader) || errors.Is(err, ErrNoLeader) {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Not the leader")
+
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, err)
+
+		return
+	}
+
+	writeResponse(w, http.StatusOK, struct{}{})
+}
+
+func (h *transactionHandler) commit(w http.ResponseWriter, r *http.Request) {
+	h.end(w, r, h.log.CommitTransaction)
+}
+
+func (h *transactionHandler) abort(w http.ResponseWriter, r *http.Request) {
+	h.end(w, r, h.log.AbortTransaction)
+}
+
+func (h *transactionHandler) end(w http.ResponseWriter, r *http.Request, end func(string, string) (uint64, error)) {
+	var request EndTransactionRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	// Only the principal that has begun the transaction completes it.
+	offset, err := end(request.ProducerID, auth.PrincipalFromContext(r.Context()))
+	if errors.Is(err, ErrInvalidProducerID) {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid producer ID")
+
+		return
+	}
+
+	if errors.Is(err, ErrNoTransaction) {
+		writeErrorResponse(w, http.StatusConflict, "No open transaction")
+
+		return
+	}
+
+	if errors.Is(err, ErrNotTransactionOwner) {
+		writeErrorResponse(w, http.StatusForbidden, "Transaction of another principal")
+
+		return
+	}
+
+	if errors.Is(err, ErrNotLeader) || errors.Is(err, ErrNoLeader) {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Not the leader")
+
+		return
+	}
+
+	if errors.Is(err, ErrLogClosed) {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Log closed")
+
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, err)
+
+		return
+	}
+
+	response := EndTransactionResponse{
+		Offset: offset,
+	}
+
+	writeResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ivanlemeshev/proglog/internal/auth"
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/steinfletcher/apitest"
+)
+
+func TestTransactionHandlers(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+	produce := server.NewProduceHandler(log)
+	consume := server.NewConsumeHandler(log)
+
+	apitest.New().
+		HandlerFunc(server.NewBeginTransactionHandler(log)).
+		Post("/").
+		JSON(`{"producer_id":"p","timeout_ms":60000}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewBeginTransactionHandler(log)).
+		Post("/").
+		JSON(`{"producer_id":"p"}`).
+		Expect(t).
+		Status(http.StatusConflict).
+		Body(`{"error":"Transaction in progress"}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(produce).
+		Post("/").
+		JSON(`{"value":"dHJhbnNhY3Rpb24=","producer_id":"p","transactional":true}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"offset":0}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(consume).
+		Get("/").
+		JSON(`{"offset":0,"isolation":"read_committed"}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		Body(`{"error":"Record not found"}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewCommitTransactionHandler(log)).
+		Post("/").
+		JSON(`{"producer_id":"p"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"offset":1}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(consume).
+		Get("/").
+		JSON(`{"offset":0,"isolation":"read_committed"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"offset":0,"value":"dHJhbnNhY3Rpb24="}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(server.NewAbortTransactionHandler(log)).
+		Post("/").
+		JSON(`{"producer_id":"p"}`).
+		Expect(t).
+		Status(http.StatusConflict).
+		Body(`{"error":"No open transaction"}`).
+		End()
+
+	apitest.New().
+		HandlerFunc(produce).
+		Post("/").
+		JSON(`{"value":"dHJhbnNhY3Rpb24=","producer_id":"p","transactional":true}`).
+		Expect(t).
+		Status(http.StatusConflict).
+		Body(`{"error":"No open transaction"}`).
+		End()
+}
+
+// asPrincipal serves the requests as the principal.
+func asPrincipal(principal string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+func TestTransactionHandlers_Owner(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+
+	apitest.New().
+		HandlerFunc(asPrincipal("app", server.NewBeginTransactionHandler(log))).
+		Post("/").
+		JSON(`{"producer_id":"p"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		HandlerFunc(asPrincipal("other", server.NewProduceHandler(log))).
+		Post("/").
+		JSON(`{"value":"dHJhbnNhY3Rpb24=","producer_id":"p","transactional":true}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		Body(`{"error":"Transaction of another principal"}`).
+		End()
+
+	for _, handler := range []http.HandlerFunc{
+		server.NewCommitTransactionHandler(log),
+		server.NewAbortTransactionHandler(log),
+	} {
+		apitest.New().
+			HandlerFunc(asPrincipal("other", handler)).
+			Post("/").
+			JSON(`{"producer_id":"p"}`).
+			Expect(t).
+			Status(http.StatusForbidden).
+			Body(`{"error":"Transaction of another principal"}`).
+			End()
+	}
+
+	apitest.New().
+		HandlerFunc(asPrincipal("app", server.NewCommitTransactionHandler(log))).
+		Post("/").
+		JSON(`{"producer_id":"p"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"offset":0}`).
+		End()
+}
+
+func TestTransactionHandlers_BadRequest(t *testing.T) {
+	t.Parallel()
+
+	log := server.NewLog()
+
+	handlers := []http.HandlerFunc{
+		server.NewBeginTransactionHandler(log),
+		server.NewCommitTransactionHandler(log),
+		server.NewAbortTransactionHandler(log),
+	}
+
+	for _, handler := range handlers {
+		apitest.New().
+			HandlerFunc(handler).
+			Post("/").
+			Expect(t).
+			Body(`{"error":"Bad request"}`).
+			Status(http.StatusBadRequest).
+			End()
+	}
+
+	apitest.New().
+		HandlerFunc(server.NewConsumeHandler(log)).
+		Get("/").
+		JSON(`{"offset":0,"isolation":"serializable"}`).
+		Expect(t).
+		Body(`{"error":"Bad isolation level"}`).
+		Status(http.StatusBadRequest).
+		End()
+}
@@ -0,0 +1,214 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_Commit(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+
+	err := l.BeginTransaction("producer", "app", 0)
+	assert.Nil(t, err)
+
+	err = l.BeginTransaction("producer", "app", 0)
+	assert.Equal(t, server.ErrTransactionInProgress, err)
+
+	offset0, err := l.AppendTransactional("producer", "app", []byte("orders"))
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("audit"))
+	assert.Nil(t, err)
+
+	_, err = l.ReadIsolated(offset0, server.ReadCommitted)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+
+	r, err := l.ReadIsolated(offset0, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("orders"), r.Value)
+
+	marker, err := l.CommitTransaction("producer", "app")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), marker)
+
+	r, err = l.ReadIsolated(offset0, server.ReadCommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("orders"), r.Value)
+
+	_, err = l.ReadIsolated(marker, server.ReadCommitted)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+
+	_, err = l.CommitTransaction("producer", "app")
+	assert.Equal(t, server.ErrNoTransaction, err)
+}
+
+func TestTransaction_Abort(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+
+	err := l.BeginTransaction("producer", "app", 0)
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("aborted"))
+	assert.Nil(t, err)
+
+	_, err = l.AbortTransaction("producer", "app")
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("plain"))
+	assert.Nil(t, err)
+
+	r, err := l.ReadIsolated(0, server.ReadCommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("plain"), r.Value)
+	assert.Equal(t, uint64(2), r.Offset)
+
+	r, err = l.ReadIsolated(0, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("aborted"), r.Value)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("no transaction"))
+	assert.Equal(t, server.ErrNoTransaction, err)
+}
+
+func TestTransaction_OpenTransactionBlocksReadCommitted(t *testing.T) {
+	t.Parallel()
+
+	l := server.NewLog()
+
+	err := l.BeginTransaction("producer", "app", 0)
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("open"))
+	assert.Nil(t, err)
+
+	_, err = l.Append([]byte("plain"))
+	assert.Nil(t, err)
+
+	_, err = l.ReadIsolated(0, server.ReadCommitted)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+
+	r, err := l.ReadIsolated(1, server.ReadUncommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("plain"), r.Value)
+}
+
+func TestTransaction_Timeout(t *testing.T) {
+	t.Parallel()
+
+	const timeout = 20 * time.Millisecond
+
+	l := server.NewLog()
+
+	err := l.BeginTransaction("producer", "app", timeout)
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("abandoned"))
+	assert.Nil(t, err)
+
+	time.Sleep(2 * timeout)
+
+	_, err = l.ReadIsolated(0, server.ReadCommitted)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+
+	_, err = l.CommitTransaction("producer", "app")
+	assert.Equal(t, server.ErrNoTransaction, err)
+
+	err = l.BeginTransaction("producer", "app", 0)
+	assert.Nil(t, err)
+}
+
+func TestTransaction_Restore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	for _, commit := range []bool{true, false} {
+		err = l.BeginTransaction("producer", "app", 0)
+		assert.Nil(t, err)
+
+		_, err = l.AppendTransactional("producer", "app", []byte("record"))
+		assert.Nil(t, err)
+
+		if commit {
+			_, err = l.CommitTransaction("producer", "app")
+		} else {
+			_, err = l.AbortTransaction("producer", "app")
+		}
+
+		assert.Nil(t, err)
+	}
+
+	err = l.BeginTransaction("producer", "app", 0)
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("open"))
+	assert.Nil(t, err)
+
+	err = l.Close()
+	assert.Nil(t, err)
+
+	l, err = server.OpenLog(dir, server.LogConfig{})
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	r, err := l.ReadIsolated(0, server.ReadCommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), r.Offset)
+
+	_, err = l.ReadIsolated(1, server.ReadCommitted)
+	assert.Equal(t, server.ErrOffsetNotFound, err)
+
+	_, err = l.CommitTransaction("producer", "app")
+	assert.Nil(t, err)
+
+	r, err = l.ReadIsolated(1, server.ReadCommitted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("open"), r.Value)
+	assert.Equal(t, uint64(4), r.Offset)
+}
+
+func TestTransaction_Owner(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l, err := server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	err = l.BeginTransaction("producer", "app", 0)
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "app", []byte("owned"))
+	assert.Nil(t, err)
+
+	_, err = l.AppendTransactional("producer", "other", []byte("foreign"))
+	assert.Equal(t, server.ErrNotTransactionOwner, err)
+
+	_, err = l.AbortTransaction("producer", "other")
+	assert.Equal(t, server.ErrNotTransactionOwner, err)
+
+	assert.Nil(t, l.Close())
+
+	// The owner of the open transaction is restored from its records.
+	l, err = server.OpenLog(dir, server.LogConfig{}) // nolint:exhaustivestruct
+	assert.Nil(t, err)
+
+	defer l.Close() // nolint:errcheck
+
+	_, err = l.CommitTransaction("producer", "other")
+	assert.Equal(t, server.ErrNotTransactionOwner, err)
+
+	_, err = l.CommitTransaction("producer", "app")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,158 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+// Names of the files written by GenerateDev. The certificate and the key of
+// a client named name are written to name+".pem" and name+"-key.pem".
+const (
+	CAFile        = "ca.pem"
+	CAKeyFile     = "ca-key.pem"
+	ServerFile    = "server.pem"
+	ServerKeyFile = "server-key.pem"
+	DefaultClient = "client"
+)
+
+// devValidity is the validity period of the development certificates.
+const devValidity = 365 * 24 * time.Hour
+
+const serialNumberBits = 128
+
+// GenerateDev writes a local CA and a server certificate for the given hosts
+// signed by it to dir. It also writes a client certificate for each of the
+// given client names, which become the common names of the certificates, or
+// for DefaultClient if there are no names. The certificates are meant for
+// development and tests only.
+func GenerateDev(dir string, hosts []string, clients ...string) error {
+	if len(clients) == 0 {
+		clients = []string{DefaultClient}
+	}
+
+	ca, caKey, err := newCertificate(&x509.Certificate{ // nolint:exhaustivestruct
+		Subject:               pkix.Name{CommonName: "proglog development CA"}, // nolint:exhaustivestruct
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertificate(dir, CAFile, CAKeyFile, ca, caKey); err != nil {
+		return err
+	}
+
+	server := &x509.Certificate{ // nolint:exhaustivestruct
+		Subject:     pkix.Name{CommonName: "proglog server"}, // nolint:exhaustivestruct
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			server.IPAddresses = append(server.IPAddresses, ip)
+		} else {
+			server.DNSNames = append(server.DNSNames, host)
+		}
+	}
+
+	if err := generateSigned(dir, ServerFile, ServerKeyFile, server, ca, caKey); err != nil {
+		return err
+	}
+
+	for _, name := range clients {
+		client := &x509.Certificate{ // nolint:exhaustivestruct
+			Subject:     pkix.Name{CommonName: name}, // nolint:exhaustivestruct
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+
+		if err := generateSigned(dir, name+".pem", name+"-key.pem", client, ca, caKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func generateSigned(
+	dir, certFile, keyFile string,
+	template, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+) error {
+	cert, key, err := newCertificate(template, parent, parentKey)
+	if err != nil {
+		return err
+	}
+
+	return writeCertificate(dir, certFile, keyFile, cert, key)
+}
+
+// newCertificate creates a certificate from the template with a new key. The
+// certificate is self-signed if the parent is nil.
+func newCertificate(
+	template, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate a key: %w", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate a serial number: %w", err)
+	}
+
+	template.SerialNumber = serialNumber
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(devValidity)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create the certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the certificate: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+func writeCertificate(dir, certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}) // nolint:exhaustivestruct
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}) // nolint:exhaustivestruct
+
+	if err := ioutil.WriteFile(filepath.Join(dir, certFile), certPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write the certificate: %w", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, keyFile), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write the key: %w", err)
+	}
+
+	return nil
+}
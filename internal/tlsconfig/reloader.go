@@ -0,0 +1,161 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reloader keeps the server certificate and the client CAs and reloads them
+// when their files change.
+type reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+	interval     time.Duration
+	logger       *zap.Logger
+
+	mu        sync.Mutex
+	checked   time.Time
+	versions  []fileVersion
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// fileVersion identifies the content of a file by its size and modification
+// time.
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+func (r *reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+
+	return files
+}
+
+// load loads the files and remembers their versions.
+func (r *reloader) load() error {
+	versions, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the server certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+
+	if r.clientCAFile != "" {
+		if clientCAs, err = loadCertPool(r.clientCAFile); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checked = time.Now()
+	r.versions = versions
+	r.cert = &cert
+	r.clientCAs = clientCAs
+
+	return nil
+}
+
+func (r *reloader) stat() ([]fileVersion, error) {
+	files := r.files()
+	versions := make([]fileVersion, 0, len(files))
+
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the file stat: %w", err)
+		}
+
+		versions = append(versions, fileVersion{size: info.Size(), modTime: info.ModTime()})
+	}
+
+	return versions, nil
+}
+
+// reloadIfChanged reloads the files if the reload interval has passed since
+// the last check and any of them has changed. The previous files are kept if
+// the new ones cannot be loaded, for example while they are half written, and
+// the failure is logged.
+func (r *reloader) reloadIfChanged() {
+	r.mu.Lock()
+	if time.Since(r.checked) < r.interval {
+		r.mu.Unlock()
+
+		return
+	}
+
+	r.checked = time.Now()
+	loaded := r.versions
+	r.mu.Unlock()
+
+	versions, err := r.stat()
+	if err == nil && equalVersions(versions, loaded) {
+		return
+	}
+
+	if err == nil {
+		err = r.load()
+	}
+
+	if err != nil {
+		r.logger.Error("Failed to reload the TLS certificates", zap.Error(err))
+	}
+}
+
+func equalVersions(a, b []fileVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *reloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.reloadIfChanged()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cert, nil
+}
+
+// configForClient returns the configuration that verifies client
+// certificates with the current client CAs.
+func (r *reloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.reloadIfChanged()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &tls.Config{ // nolint:exhaustivestruct
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.certificate,
+		ClientAuth:     r.clientAuth,
+		ClientCAs:      r.clientCAs,
+	}, nil
+}
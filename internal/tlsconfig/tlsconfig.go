@@ -0,0 +1,141 @@
+// Package tlsconfig creates TLS configurations of the server and its clients.
+// Server certificates and client CAs are reloaded from disk when their files
+// change, so certificates can be rotated without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoCertificates is returned if a CA file has no PEM certificates.
+var ErrNoCertificates = fmt.Errorf("no certificates")
+
+// DefaultReloadInterval is the minimum time between checks of the certificate
+// files for changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// ServerConfig configures the TLS of the server.
+type ServerConfig struct {
+	// CertFile and KeyFile are the paths of the server certificate and key.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is the path of the CA certificates that verify client
+	// certificates. If it is set, clients must present a valid certificate.
+	ClientCAFile string
+
+	// OptionalClientCert lets clients connect without a certificate, e.g.
+	// when they authenticate with a bearer token instead. A certificate that
+	// is presented must still be valid.
+	OptionalClientCert bool
+
+	// Logger logs failed reloads if it is not nil.
+	Logger *zap.Logger
+
+	// ReloadInterval is the minimum time between checks of the files for
+	// changes. DefaultReloadInterval is used if it is zero.
+	ReloadInterval time.Duration
+}
+
+// NewServer creates the TLS configuration of the server. The certificate, the
+// key and the client CAs are loaded immediately, so wrong files are reported
+// at startup. Later a failed reload is logged and keeps the previous files.
+func NewServer(config ServerConfig) (*tls.Config, error) {
+	if config.ReloadInterval == 0 {
+		config.ReloadInterval = DefaultReloadInterval
+	}
+
+	logger := zap.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	if config.OptionalClientCert {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	r := &reloader{
+		certFile:     config.CertFile,
+		keyFile:      config.KeyFile,
+		clientCAFile: config.ClientCAFile,
+		clientAuth:   clientAuth,
+		interval:     config.ReloadInterval,
+		logger:       logger,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{ // nolint:exhaustivestruct
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.certificate,
+	}
+
+	if config.ClientCAFile != "" {
+		tlsConfig.GetConfigForClient = r.configForClient
+	}
+
+	return tlsConfig, nil
+}
+
+// ClientConfig configures the TLS of a client.
+type ClientConfig struct {
+	// CAFile is the path of the CA certificates that verify the server. The
+	// system CAs are used if it is empty.
+	CAFile string
+
+	// CertFile and KeyFile are the paths of the client certificate and key
+	// for mutual TLS. They are optional.
+	CertFile string
+	KeyFile  string
+}
+
+// NewClient creates the TLS configuration of a client.
+func NewClient(config ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ // nolint:exhaustivestruct
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if config.CAFile != "" {
+		pool, err := loadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(name string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCertificates, name)
+	}
+
+	return pool, nil
+}
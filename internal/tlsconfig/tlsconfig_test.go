@@ -0,0 +1,236 @@
+package tlsconfig_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanlemeshev/proglog/internal/tlsconfig"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func generate(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	err := tlsconfig.GenerateDev(dir, []string{"localhost", "127.0.0.1"})
+	assert.Nil(t, err)
+
+	return dir
+}
+
+// serve serves HTTPS with the given configuration and returns the URL.
+func serve(t *testing.T, config *tls.Config) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	srv := &http.Server{ // nolint:exhaustivestruct
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		TLSConfig: config,
+	}
+
+	go func() {
+		_ = srv.ServeTLS(listener, "", "")
+	}()
+
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return "https://" + listener.Addr().String()
+}
+
+// get requests the URL with a new connection and returns the status code.
+func get(t *testing.T, url string, config tlsconfig.ClientConfig) (int, error) {
+	t.Helper()
+
+	tlsConfig, err := tlsconfig.NewClient(config)
+	assert.Nil(t, err)
+
+	client := &http.Client{ // nolint:exhaustivestruct
+		Transport: &http.Transport{TLSClientConfig: tlsConfig}, // nolint:exhaustivestruct
+	}
+
+	resp, err := client.Get(url) // nolint:noctx
+	if err != nil {
+		return 0, err
+	}
+
+	_ = resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func TestNewServer_MutualTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := generate(t)
+
+	config, err := tlsconfig.NewServer(tlsconfig.ServerConfig{
+		CertFile:     filepath.Join(dir, tlsconfig.ServerFile),
+		KeyFile:      filepath.Join(dir, tlsconfig.ServerKeyFile),
+		ClientCAFile: filepath.Join(dir, tlsconfig.CAFile),
+	})
+	assert.Nil(t, err)
+
+	url := serve(t, config)
+
+	status, err := get(t, url, tlsconfig.ClientConfig{
+		CAFile:   filepath.Join(dir, tlsconfig.CAFile),
+		CertFile: filepath.Join(dir, tlsconfig.DefaultClient+".pem"),
+		KeyFile:  filepath.Join(dir, tlsconfig.DefaultClient+"-key.pem"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	t.Run("without client certificate", func(t *testing.T) {
+		_, err := get(t, url, tlsconfig.ClientConfig{CAFile: filepath.Join(dir, tlsconfig.CAFile)})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("client certificate of another CA", func(t *testing.T) {
+		other := generate(t)
+
+		_, err := get(t, url, tlsconfig.ClientConfig{
+			CAFile:   filepath.Join(dir, tlsconfig.CAFile),
+			CertFile: filepath.Join(other, tlsconfig.DefaultClient+".pem"),
+			KeyFile:  filepath.Join(other, tlsconfig.DefaultClient+"-key.pem"),
+		})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestNewServer_OptionalClientCert(t *testing.T) {
+	t.Parallel()
+
+	dir := generate(t)
+
+	config, err := tlsconfig.NewServer(tlsconfig.ServerConfig{ // nolint:exhaustivestruct
+		CertFile:           filepath.Join(dir, tlsconfig.ServerFile),
+		KeyFile:            filepath.Join(dir, tlsconfig.ServerKeyFile),
+		ClientCAFile:       filepath.Join(dir, tlsconfig.CAFile),
+		OptionalClientCert: true,
+	})
+	assert.Nil(t, err)
+
+	url := serve(t, config)
+
+	// A client without a certificate connects and authenticates otherwise.
+	status, err := get(t, url, tlsconfig.ClientConfig{CAFile: filepath.Join(dir, tlsconfig.CAFile)})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, err = get(t, url, tlsconfig.ClientConfig{
+		CAFile:   filepath.Join(dir, tlsconfig.CAFile),
+		CertFile: filepath.Join(dir, tlsconfig.DefaultClient+".pem"),
+		KeyFile:  filepath.Join(dir, tlsconfig.DefaultClient+"-key.pem"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// A certificate that is presented is still verified.
+	other := generate(t)
+
+	_, err = get(t, url, tlsconfig.ClientConfig{
+		CAFile:   filepath.Join(dir, tlsconfig.CAFile),
+		CertFile: filepath.Join(other, tlsconfig.DefaultClient+".pem"),
+		KeyFile:  filepath.Join(other, tlsconfig.DefaultClient+"-key.pem"),
+	})
+	assert.NotNil(t, err)
+}
+
+func TestNewServer_Reload(t *testing.T) { // nolint:funlen
+	t.Parallel()
+
+	dir := generate(t)
+	certFile := filepath.Join(dir, tlsconfig.ServerFile)
+	keyFile := filepath.Join(dir, tlsconfig.ServerKeyFile)
+
+	core, logs := observer.New(zap.ErrorLevel)
+
+	config, err := tlsconfig.NewServer(tlsconfig.ServerConfig{ // nolint:exhaustivestruct
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: time.Nanosecond,
+		Logger:         zap.New(core),
+	})
+	assert.Nil(t, err)
+
+	url := serve(t, config)
+
+	status, err := get(t, url, tlsconfig.ClientConfig{CAFile: filepath.Join(dir, tlsconfig.CAFile)})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// A broken certificate is logged and the previous one is served.
+	writeFile(t, certFile, []byte("broken"), time.Now().Add(time.Minute))
+
+	status, err = get(t, url, tlsconfig.ClientConfig{CAFile: filepath.Join(dir, tlsconfig.CAFile)})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NotZero(t, logs.FilterMessage("Failed to reload the TLS certificates").Len())
+
+	// A certificate of another CA replaces the previous one.
+	other := generate(t)
+	modTime := time.Now().Add(2 * time.Minute)
+	writeFile(t, certFile, readFile(t, filepath.Join(other, tlsconfig.ServerFile)), modTime)
+	writeFile(t, keyFile, readFile(t, filepath.Join(other, tlsconfig.ServerKeyFile)), modTime)
+
+	status, err = get(t, url, tlsconfig.ClientConfig{CAFile: filepath.Join(other, tlsconfig.CAFile)})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	_, err = get(t, url, tlsconfig.ClientConfig{CAFile: filepath.Join(dir, tlsconfig.CAFile)})
+	assert.NotNil(t, err)
+}
+
+func TestNewServer_Errors(t *testing.T) {
+	t.Parallel()
+
+	dir := generate(t)
+
+	_, err := tlsconfig.NewServer(tlsconfig.ServerConfig{
+		CertFile: filepath.Join(dir, "missing.pem"),
+		KeyFile:  filepath.Join(dir, tlsconfig.ServerKeyFile),
+	})
+	assert.NotNil(t, err)
+
+	_, err = tlsconfig.NewServer(tlsconfig.ServerConfig{
+		CertFile:     filepath.Join(dir, tlsconfig.ServerFile),
+		KeyFile:      filepath.Join(dir, tlsconfig.ServerKeyFile),
+		ClientCAFile: filepath.Join(dir, tlsconfig.CAKeyFile),
+	})
+	assert.ErrorIs(t, err, tlsconfig.ErrNoCertificates)
+
+	_, err = tlsconfig.NewClient(tlsconfig.ClientConfig{CAFile: filepath.Join(dir, "missing.pem")})
+	assert.NotNil(t, err)
+}
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+
+	return data
+}
+
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	err := ioutil.WriteFile(name, data, 0600)
+	assert.Nil(t, err)
+
+	err = os.Chtimes(name, modTime, modTime)
+	assert.Nil(t, err)
+}